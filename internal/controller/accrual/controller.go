@@ -4,34 +4,110 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/vilasle/gophermart/internal/controller"
 	"github.com/vilasle/gophermart/internal/logger"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 type AccrualsInfo struct {
-	OrderNumber string  `json:"order"`
-	Status      string  `json:"status"`
-	Accrual     float64 `json:"accrual,omitempty"` // TODO: omitempty is it ok?
+	OrderNumber string      `json:"order"`
+	Status      string      `json:"status"`
+	Accrual     money.Money `json:"accrual,omitempty"` // TODO: omitempty is it ok?
+}
+
+// CalculationBreakdownInfo is used to marshal data in GET /api/orders/{number}/breakdown
+type CalculationBreakdownInfo struct {
+	OrderNumber string           `json:"order"`
+	Status      string           `json:"status"`
+	Accrual     money.Money      `json:"accrual,omitempty"`
+	Lines       []RewardLineInfo `json:"lines"`
+}
+
+// RewardLineInfo is rule which gave points for product or for order if line is not set
+type RewardLineInfo struct {
+	Line        int         `json:"line,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Price       money.Money `json:"price,omitempty"`
+	RuleID      int16       `json:"rule_id,omitempty"`
+	RuleKind    string      `json:"rule_kind,omitempty"`
+	RewardType  string      `json:"reward_type,omitempty"`
+	Points      money.Money `json:"points"`
+	//terms of rule at time of calculation
+	RuleMatch string      `json:"rule_match,omitempty"`
+	RulePoint money.Money `json:"rule_point,omitempty"`
+}
+
+// OrdersStatusReq is used to unmarshal data in POST /api/orders/status
+type OrdersStatusReq struct {
+	Orders []string `json:"orders"`
 }
 
 type RegisterCalculationReq struct { // TODO: mb use lower case?
 	OrderNumber string     `json:"order"`
 	Products    []ProductR `json:"goods"`
+	//RFC 3339, time of registration is used if it is not set
+	PurchasedAt time.Time `json:"purchased_at"`
 }
 
 // ProductRow is used to unmarshal data in POST /api/orders
 type ProductR struct {
-	Name  string  `json:"description"`
-	Price float64 `json:"price"`
+	Name  string      `json:"description"`
+	Price money.Money `json:"price"`
 }
 
 type RegisterCalculationRuleReq struct {
-	Match string  `json:"match"`
-	Point float64 `json:"reward"`
-	Type  string  `json:"reward_type"`
+	//product (by default), order_bonus, order_cap or min_price
+	Kind  string      `json:"kind"`
+	Match string      `json:"match"`
+	Point money.Money `json:"reward"`
+	Type  string      `json:"reward_type"`
+	//total price of order for order_bonus or price of product for min_price
+	Threshold money.Money `json:"threshold"`
+	//rules with higher priority are evaluated first
+	Priority int `json:"priority"`
+	//first (by default), best, stack or cap. It defines how reward of rule is combined with rules
+	//of lower priority which match the same product, each of them is evaluated by its own policy
+	Policy string      `json:"policy"`
+	Cap    money.Money `json:"cap"`
+	//RFC 3339, rule is applied to orders purchased in [valid_from, valid_to)
+	ValidFrom time.Time `json:"valid_from"`
+	ValidTo   time.Time `json:"valid_to"`
+	//mon, tue, wed, thu, fri, sat, sun; every day if it is empty
+	Weekdays []string `json:"weekdays"`
+	//hours [hour_from, hour_to) in time zone of service, any hour if they are equal
+	HourFrom int `json:"hour_from"`
+	HourTo   int `json:"hour_to"`
+}
+
+// CalculationRuleInfo is used to marshal data in GET /api/goods
+type CalculationRuleInfo struct {
+	ID        int16       `json:"id"`
+	Kind      string      `json:"kind"`
+	Match     string      `json:"match"`
+	Point     money.Money `json:"reward"`
+	Type      string      `json:"reward_type"`
+	Threshold money.Money `json:"threshold,omitempty"`
+	Priority  int         `json:"priority"`
+	Policy    string      `json:"policy"`
+	Cap       money.Money `json:"cap,omitempty"`
+	ValidFrom *time.Time  `json:"valid_from,omitempty"`
+	ValidTo   *time.Time  `json:"valid_to,omitempty"`
+	Weekdays  []string    `json:"weekdays"`
+	HourFrom  int         `json:"hour_from"`
+	HourTo    int         `json:"hour_to"`
+	Disabled  bool        `json:"disabled"`
+}
+
+// RuleStateReq is used to unmarshal data in PATCH /api/goods/{id}
+type RuleStateReq struct {
+	Disabled *bool `json:"disabled"`
 }
 
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -74,6 +150,79 @@ func (c Controller) OrderInfo() controller.ControllerHandler {
 	}
 }
 
+// POST /api/orders/status
+//
+// returns information about known orders of batch, unknown orders are omitted
+func (c Controller) OrdersStatus() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		log := logger.GetRequestLogger(r)
+
+		req := OrdersStatusReq{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error("unmarshal body failed", "error", err)
+			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
+		}
+
+		log.Debug("getting orders info", "quantity", len(req.Orders))
+
+		calcs, err := c.Calculations(r.Context(), service.CalculationsFilterRequest{OrderNumbers: req.Orders})
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		result := make([]AccrualsInfo, 0, len(calcs))
+		for _, calc := range calcs {
+			result = append(result, AccrualsInfo{
+				OrderNumber: calc.OrderNumber,
+				Status:      calc.Status,
+				Accrual:     calc.Accrual,
+			})
+		}
+		return controller.NewResponse(nil, result, controller.TypeJSON, 0)
+	}
+}
+
+// GET /api/orders/{number}/breakdown
+func (c Controller) OrderBreakdown() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		number := chi.URLParam(r, "number")
+		if number == "" {
+			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
+		}
+
+		logger.GetRequestLogger(r).Debug("getting order breakdown", "number", number)
+
+		breakdown, err := c.Breakdown(r.Context(), service.CalculationFilterRequest{OrderNumber: number})
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		result := CalculationBreakdownInfo{
+			OrderNumber: breakdown.OrderNumber,
+			Status:      breakdown.Status,
+			Accrual:     breakdown.Accrual,
+			Lines:       make([]RewardLineInfo, 0, len(breakdown.Lines)),
+		}
+		for _, line := range breakdown.Lines {
+			info := RewardLineInfo{
+				Line:        line.Line,
+				Description: line.ProductName,
+				Price:       line.Price,
+				RuleID:      line.RuleID,
+				RewardType:  rewardTypeView(line.Type),
+				Points:      line.Points,
+				RuleMatch:   line.RuleMatch,
+				RulePoint:   line.RulePoint,
+			}
+			if line.RuleID != 0 {
+				info.RuleKind = ruleKindView(line.RuleKind)
+			}
+			result.Lines = append(result.Lines, info)
+		}
+		return controller.NewResponse(nil, result, controller.TypeJSON, 0)
+	}
+}
+
 // POST /api/orders
 func (c Controller) RegisterOrder() controller.ControllerHandler {
 	return func(r *http.Request) controller.Response {
@@ -96,7 +245,7 @@ func (c Controller) RegisterOrder() controller.ControllerHandler {
 			return controller.NewResponse(err, nil, controller.TypeText, 0)
 		}
 
-		regCalcReq := service.RegisterCalculationRequest{OrderNumber: regReq.OrderNumber}
+		regCalcReq := service.RegisterCalculationRequest{OrderNumber: regReq.OrderNumber, PurchasedAt: regReq.PurchasedAt}
 		for i := range regReq.Products {
 			regCalcReq.Products = append(regCalcReq.Products, service.ProductRow{Name: regReq.Products[i].Name, Price: regReq.Products[i].Price})
 		}
@@ -131,13 +280,13 @@ func (c Controller) AddCalculationRules() controller.ControllerHandler {
 			return controller.NewResponse(err, nil, controller.TypeText, 0)
 		}
 
-		rewardType := convertRewardType(prRegCalcRule.Type)
-		if rewardType == service.CalculationTypeUnknown {
+		ruleReq, ok := prepareRuleRequest(prRegCalcRule)
+		if !ok {
 			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
 		}
 
 		log.Debug("register calculation rule", "request", prRegCalcRule)
-		err = c.CalculationRuleService.Register(r.Context(), service.RegisterCalculationRuleRequest{Match: prRegCalcRule.Match, Point: prRegCalcRule.Point, Type: rewardType})
+		err = c.CalculationRuleService.Register(r.Context(), ruleReq)
 		if err != nil {
 			log.Error("register calculation rule failed", "error", err)
 			return controller.NewResponse(err, nil, controller.TypeText, 0)
@@ -146,6 +295,166 @@ func (c Controller) AddCalculationRules() controller.ControllerHandler {
 	}
 }
 
+// GET /api/goods
+func (c Controller) CalculationRules() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		rules, err := c.CalculationRuleService.Rules(r.Context())
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		result := make([]CalculationRuleInfo, 0, len(rules))
+		for _, rule := range rules {
+			result = append(result, prepareRuleInfo(rule))
+		}
+		return controller.NewResponse(nil, result, controller.TypeJSON, 0)
+	}
+}
+
+// PUT /api/goods/{id}
+func (c Controller) UpdateCalculationRule() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		log := logger.GetRequestLogger(r)
+
+		id, err := ruleID(r)
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		prRegCalcRule := RegisterCalculationRuleReq{}
+		if err := json.NewDecoder(r.Body).Decode(&prRegCalcRule); err != nil {
+			log.Error("unmarshal body failed", "error", err)
+			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
+		}
+
+		ruleReq, ok := prepareRuleRequest(prRegCalcRule)
+		if !ok {
+			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
+		}
+
+		log.Info("updating calculation rule", "id", id, "request", prRegCalcRule)
+		err = c.CalculationRuleService.Update(r.Context(), service.UpdateCalculationRuleRequest{
+			ID:                             id,
+			RegisterCalculationRuleRequest: ruleReq,
+		})
+		return controller.NewResponse(err, nil, controller.TypeText, 0)
+	}
+}
+
+// PATCH /api/goods/{id}
+func (c Controller) DisableCalculationRule() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		log := logger.GetRequestLogger(r)
+
+		id, err := ruleID(r)
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		req := RuleStateReq{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Disabled == nil {
+			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
+		}
+
+		log.Info("changing state of calculation rule", "id", id, "disabled", *req.Disabled)
+		err = c.CalculationRuleService.SetDisabled(r.Context(), service.DisableCalculationRuleRequest{
+			ID:       id,
+			Disabled: *req.Disabled,
+		})
+		return controller.NewResponse(err, nil, controller.TypeText, 0)
+	}
+}
+
+// DELETE /api/goods/{id}
+func (c Controller) DeleteCalculationRule() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		id, err := ruleID(r)
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		logger.GetRequestLogger(r).Info("deleting calculation rule", "id", id)
+
+		err = c.CalculationRuleService.Delete(r.Context(), service.DeleteCalculationRuleRequest{ID: id})
+		return controller.NewResponse(err, nil, controller.TypeText, 0)
+	}
+}
+
+func ruleID(r *http.Request) (int16, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 16)
+	if err != nil || id <= 0 {
+		return 0, service.ErrInvalidFormat
+	}
+	return int16(id), nil
+}
+
+func prepareRuleRequest(req RegisterCalculationRuleReq) (service.RegisterCalculationRuleRequest, bool) {
+	kind, ok := convertRuleKind(req.Kind)
+	if !ok {
+		return service.RegisterCalculationRuleRequest{}, false
+	}
+
+	//rule of minimal price does not give reward
+	rewardType := convertRewardType(req.Type)
+	if rewardType == service.CalculationTypeUnknown && !(kind == service.RuleKindMinPrice && req.Type == "") {
+		return service.RegisterCalculationRuleRequest{}, false
+	}
+
+	policy, ok := convertRulePolicy(req.Policy)
+	if !ok {
+		return service.RegisterCalculationRuleRequest{}, false
+	}
+
+	weekdays, ok := convertWeekdays(req.Weekdays)
+	if !ok {
+		return service.RegisterCalculationRuleRequest{}, false
+	}
+
+	return service.RegisterCalculationRuleRequest{
+		Kind:      kind,
+		Match:     req.Match,
+		Point:     req.Point,
+		Type:      rewardType,
+		Threshold: req.Threshold,
+		Priority:  req.Priority,
+		Policy:    policy,
+		Cap:       req.Cap,
+		ValidFrom: req.ValidFrom,
+		ValidTo:   req.ValidTo,
+		Weekdays:  weekdays,
+		HourFrom:  req.HourFrom,
+		HourTo:    req.HourTo,
+	}, true
+}
+
+func prepareRuleInfo(rule service.CalculationRuleInfo) CalculationRuleInfo {
+	info := CalculationRuleInfo{
+		ID:        rule.ID,
+		Kind:      ruleKindView(rule.Kind),
+		Match:     rule.Match,
+		Point:     rule.Point,
+		Type:      rewardTypeView(rule.Type),
+		Threshold: rule.Threshold,
+		Priority:  rule.Priority,
+		Policy:    rulePolicyView(rule.Policy),
+		Cap:       rule.Cap,
+		Weekdays:  make([]string, 0, len(rule.Weekdays)),
+		HourFrom:  rule.HourFrom,
+		HourTo:    rule.HourTo,
+		Disabled:  rule.Disabled,
+	}
+	if !rule.ValidFrom.IsZero() {
+		info.ValidFrom = &rule.ValidFrom
+	}
+	if !rule.ValidTo.IsZero() {
+		info.ValidTo = &rule.ValidTo
+	}
+	for _, day := range rule.Weekdays {
+		info.Weekdays = append(info.Weekdays, weekdayNames[day])
+	}
+	return info
+}
+
 func convertRewardType(t string) service.CalculationType {
 	switch t {
 	case "pt":
@@ -156,3 +465,82 @@ func convertRewardType(t string) service.CalculationType {
 		return service.CalculationTypeUnknown
 	}
 }
+
+// ruleKindNames is indexed by service.RuleKind
+var ruleKindNames = [...]string{
+	service.RuleKindProduct:    "product",
+	service.RuleKindOrderBonus: "order_bonus",
+	service.RuleKindOrderCap:   "order_cap",
+	service.RuleKindMinPrice:   "min_price",
+}
+
+func convertRuleKind(k string) (service.RuleKind, bool) {
+	if k == "" {
+		return service.RuleKindProduct, true
+	}
+	i := slices.Index(ruleKindNames[:], k)
+	return i, i >= 0
+}
+
+func ruleKindView(k service.RuleKind) string {
+	if k < 0 || k >= len(ruleKindNames) {
+		return ""
+	}
+	return ruleKindNames[k]
+}
+
+func rewardTypeView(t service.CalculationType) string {
+	switch t {
+	case service.CalculationTypeFixed:
+		return "pt"
+	case service.CalculationTypePercent:
+		return "%"
+	default:
+		return ""
+	}
+}
+
+func convertRulePolicy(p string) (service.RulePolicy, bool) {
+	switch p {
+	case "":
+		return service.RulePolicyUnknown, true
+	case "first":
+		return service.RulePolicyFirst, true
+	case "best":
+		return service.RulePolicyBest, true
+	case "stack":
+		return service.RulePolicyStack, true
+	case "cap":
+		return service.RulePolicyCap, true
+	default:
+		return service.RulePolicyUnknown, false
+	}
+}
+
+func rulePolicyView(p service.RulePolicy) string {
+	switch p {
+	case service.RulePolicyBest:
+		return "best"
+	case service.RulePolicyStack:
+		return "stack"
+	case service.RulePolicyCap:
+		return "cap"
+	default:
+		return "first"
+	}
+}
+
+// weekdayNames is indexed by time.Weekday
+var weekdayNames = [...]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func convertWeekdays(days []string) ([]time.Weekday, bool) {
+	result := make([]time.Weekday, 0, len(days))
+	for _, day := range days {
+		i := slices.Index(weekdayNames[:], strings.ToLower(day))
+		if i < 0 {
+			return nil, false
+		}
+		result = append(result, time.Weekday(i))
+	}
+	return result, true
+}
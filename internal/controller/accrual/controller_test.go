@@ -1,7 +1,18 @@
 package accrual
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 // https://kovardin.ru/articles/go/testirovanie-http-hendlerov-v-go/
@@ -130,3 +141,269 @@ func TestHandler_orderInfo(t *testing.T) {
 	require.Equal(t, val, value)
 }
 */
+
+type calculationsStub struct {
+	service.CalculationService
+}
+
+func (calculationsStub) Calculations(_ context.Context, dto service.CalculationsFilterRequest) ([]service.CalculationInfo, error) {
+	if len(dto.OrderNumbers) == 0 {
+		return nil, service.ErrInvalidFormat
+	}
+	return []service.CalculationInfo{{OrderNumber: "123456", Status: "PROCESSED", Accrual: money.FromInt(10)}}, nil
+}
+
+func TestController_OrdersStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "unknown orders are omitted",
+			body:     `{"orders":["123456","54321"]}`,
+			wantCode: http.StatusOK,
+			wantBody: `[{"order":"123456","status":"PROCESSED","accrual":10}]`,
+		},
+		{
+			name:     "empty batch",
+			body:     `{"orders":[]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "wrong body",
+			body:     `["123456"]`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Controller{CalculationService: calculationsStub{}}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/orders/status", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			c.OrdersStatus().ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+// rulesStub knows only rule 1
+type rulesStub struct {
+	service.CalculationRuleService
+	updated *service.UpdateCalculationRuleRequest
+}
+
+func (rulesStub) Rules(context.Context) ([]service.CalculationRuleInfo, error) {
+	return []service.CalculationRuleInfo{{
+		ID: 1,
+		RegisterCalculationRuleRequest: service.RegisterCalculationRuleRequest{
+			Match:    "bosch",
+			Point:    money.FromInt(10),
+			Type:     service.CalculationTypePercent,
+			Policy:   service.RulePolicyUnknown,
+			ValidTo:  time.Date(2024, 11, 8, 0, 0, 0, 0, time.UTC),
+			Weekdays: []time.Weekday{time.Saturday, time.Sunday},
+		},
+		Disabled: true,
+	}}, nil
+}
+
+func (s rulesStub) Update(_ context.Context, dto service.UpdateCalculationRuleRequest) error {
+	if dto.ID != 1 {
+		return service.ErrRuleNotFound
+	}
+	*s.updated = dto
+	return nil
+}
+
+func (rulesStub) SetDisabled(_ context.Context, dto service.DisableCalculationRuleRequest) error {
+	if dto.ID != 1 {
+		return service.ErrRuleNotFound
+	}
+	return nil
+}
+
+func (rulesStub) Delete(_ context.Context, dto service.DeleteCalculationRuleRequest) error {
+	if dto.ID != 1 {
+		return service.ErrRuleNotFound
+	}
+	return nil
+}
+
+func TestController_manageRules(t *testing.T) {
+	updated := service.UpdateCalculationRuleRequest{}
+	c := Controller{CalculationRuleService: rulesStub{updated: &updated}}
+
+	mux := chi.NewMux()
+	mux.Method(http.MethodGet, "/api/goods", c.CalculationRules())
+	mux.Method(http.MethodPut, "/api/goods/{id}", c.UpdateCalculationRule())
+	mux.Method(http.MethodPatch, "/api/goods/{id}", c.DisableCalculationRule())
+	mux.Method(http.MethodDelete, "/api/goods/{id}", c.DeleteCalculationRule())
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "list",
+			method:   http.MethodGet,
+			target:   "/api/goods",
+			wantCode: http.StatusOK,
+			wantBody: `[{"id":1,"kind":"product","match":"bosch","reward":10,"reward_type":"%","priority":0,"policy":"first",
+				"valid_to":"2024-11-08T00:00:00Z","weekdays":["sat","sun"],"hour_from":0,"hour_to":0,"disabled":true}]`,
+		},
+		{
+			name:     "update",
+			method:   http.MethodPut,
+			target:   "/api/goods/1",
+			body:     `{"match":"bosch","reward":15,"reward_type":"%","weekdays":["Fri"]}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "update unknown kind",
+			method:   http.MethodPut,
+			target:   "/api/goods/1",
+			body:     `{"kind":"basket","reward":15,"reward_type":"%"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "update by wrong reward type",
+			method:   http.MethodPut,
+			target:   "/api/goods/1",
+			body:     `{"match":"bosch","reward":15,"reward_type":"points"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "update unknown rule",
+			method:   http.MethodPut,
+			target:   "/api/goods/2",
+			body:     `{"match":"bosch","reward":15,"reward_type":"%"}`,
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "disable",
+			method:   http.MethodPatch,
+			target:   "/api/goods/1",
+			body:     `{"disabled":true}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "state is not set",
+			method:   http.MethodPatch,
+			target:   "/api/goods/1",
+			body:     `{}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "delete",
+			method:   http.MethodDelete,
+			target:   "/api/goods/1",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "delete by wrong id",
+			method:   http.MethodDelete,
+			target:   "/api/goods/abc",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "delete unknown rule",
+			method:   http.MethodDelete,
+			target:   "/api/goods/2",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	assert.Equal(t, service.UpdateCalculationRuleRequest{
+		ID: 1,
+		RegisterCalculationRuleRequest: service.RegisterCalculationRuleRequest{
+			Match:    "bosch",
+			Point:    money.FromInt(15),
+			Type:     service.CalculationTypePercent,
+			Weekdays: []time.Weekday{time.Friday},
+		},
+	}, updated)
+}
+
+// breakdownStub knows only order 123456
+type breakdownStub struct {
+	service.CalculationService
+}
+
+func (breakdownStub) Breakdown(_ context.Context, dto service.CalculationFilterRequest) (service.CalculationBreakdown, error) {
+	if dto.OrderNumber != "123456" {
+		return service.CalculationBreakdown{}, service.ErrEntityDoesNotExists
+	}
+	return service.CalculationBreakdown{
+		CalculationInfo: service.CalculationInfo{OrderNumber: "123456", Status: "PROCESSED", Accrual: money.FromInt(150)},
+		Lines: []service.CalculationLine{
+			{Line: 1, ProductName: "Bosch drill", Price: money.FromInt(500), RuleID: 1, Type: service.CalculationTypePercent, Points: money.FromInt(50), RuleMatch: "Bosch", RulePoint: money.FromInt(10)},
+			{Line: 2, ProductName: "Makita saw", Price: money.FromInt(300)},
+			{RuleID: 4, RuleKind: service.RuleKindOrderBonus, Type: service.CalculationTypeFixed, Points: money.FromInt(100), RulePoint: money.FromInt(100)},
+		},
+	}, nil
+}
+
+func TestController_OrderBreakdown(t *testing.T) {
+	mux := chi.NewMux()
+	mux.Method(http.MethodGet, "/api/orders/{number}/breakdown", Controller{CalculationService: breakdownStub{}}.OrderBreakdown())
+
+	tests := []struct {
+		name     string
+		number   string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "lines of order",
+			number:   "123456",
+			wantCode: http.StatusOK,
+			wantBody: `{"order":"123456","status":"PROCESSED","accrual":150,"lines":[
+				{"line":1,"description":"Bosch drill","price":500,"rule_id":1,"rule_kind":"product","reward_type":"%","points":50,"rule_match":"Bosch","rule_point":10},
+				{"line":2,"description":"Makita saw","price":300,"points":0},
+				{"rule_id":4,"rule_kind":"order_bonus","reward_type":"pt","points":100,"rule_point":100}]}`,
+		},
+		{
+			name:     "unknown order",
+			number:   "54321",
+			wantCode: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/orders/"+tt.number+"/breakdown", nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
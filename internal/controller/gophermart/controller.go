@@ -1,31 +1,84 @@
 package gophermart
 
 import (
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
-
+	"github.com/go-chi/chi/v5"
 	"github.com/vilasle/gophermart/internal/controller"
 	"github.com/vilasle/gophermart/internal/logger"
 
 	_mdw "github.com/vilasle/gophermart/internal/middleware"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
+	"github.com/vilasle/gophermart/internal/tool/token"
 )
 
-const TokenExp = time.Hour * 1
-const secretKey = "supersecretkey"
-
 ////////////////proxy-structs to convert data to structs with struct tags /////////////////////////////////////////////
 
 // OrderInf is used to marshal data in GET /api/user/orders
 type OrderInfo struct {
-	Number    string    `json:"number"`
-	Status    string    `json:"status"`
-	Accrual   float64   `json:"accrual,omitempty"` // there may be no any reward
-	CreatedAt time.Time `json:"uploaded_at"`
+	Number    string      `json:"number"`
+	Status    string      `json:"status"`
+	Accrual   money.Money `json:"accrual,omitempty"` // there may be no any reward
+	CreatedAt time.Time   `json:"uploaded_at"`
+}
+
+// OrderDetails is used to marshal data in GET /api/user/orders/{number}
+type OrderDetails struct {
+	Number    string      `json:"number"`
+	Status    string      `json:"status"`
+	Accrual   money.Money `json:"accrual,omitempty"`
+	CreatedAt time.Time   `json:"uploaded_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Attempts  int         `json:"attempts"`
+	CheckedAt *time.Time  `json:"checked_at,omitempty"` // order may be not checked yet
+}
+
+// OrderEvent is used to marshal data of event in GET /api/user/orders/events
+type OrderEvent struct {
+	Number    string      `json:"number"`
+	Status    string      `json:"status"`
+	Accrual   money.Money `json:"accrual,omitempty"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Webhook is used to marshal data in /api/user/webhooks, secret is returned only on registration
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery is used to marshal data in GET /api/user/webhooks/{id}/deliveries
+type Delivery struct {
+	ID            int64             `json:"id"`
+	Event         string            `json:"event"`
+	OrderNumber   string            `json:"order"`
+	State         string            `json:"state"`
+	Failures      int               `json:"failures"`
+	OccurredAt    time.Time         `json:"occurred_at"`
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time        `json:"delivered_at,omitempty"`
+	Attempts      []DeliveryAttempt `json:"attempts"`
+}
+
+type DeliveryAttempt struct {
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 // regReq is used to unmarshal data in POST /api/user/register & POST /api/user/login
@@ -34,34 +87,64 @@ type registerReq struct { // TODO: лучше тут хранить или в х
 	Password string `json:"password"`
 }
 
+// passwordReq is used to unmarshal data in POST /api/user/password
+type passwordReq struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// DeletedAccount is used to marshal response body in DELETE /api/user
+type DeletedAccount struct {
+	Forfeited money.Money `json:"forfeited"`
+}
+
 // UserBal is used to marshal response body in GET /api/user/balance
 type UserBal struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   money.Money `json:"current"`
+	Withdrawn money.Money `json:"withdrawn"`
 }
 
 // WithdrawalInf is used as a proxy struct to marshal response body in GET /api/user/withdrawals
 type WithdrawalInfo struct {
-	OrderNumber string  `json:"order"`
-	Sum         float64 `json:"sum"`
-	Status      string  `json:"processed_at"`
+	OrderNumber string      `json:"order"`
+	Sum         money.Money `json:"sum"`
+	Status      string      `json:"processed_at"`
+}
+
+// StatementEntry is used as a proxy struct to marshal response body in GET /api/user/statement
+type StatementEntry struct {
+	Type        string      `json:"type"` // income or expense
+	OrderNumber string      `json:"order"`
+	Sum         money.Money `json:"sum"` // negative for expense
+	Balance     money.Money `json:"balance"`
+	CreatedAt   time.Time   `json:"processed_at"`
 }
 
 // AccrualsInf is used as a proxy struct to unmarshal response body in GET /api/orders/{number}
+// and body of POST /api/internal/accrual
 type AccrualsInf struct {
-	OrderNumber string  `json:"order"`
-	Status      string  `json:"status"`
-	Accrual     float64 `json:"accrual,omitempty"` // TODO: omitempty is it ok?
+	OrderNumber string      `json:"order"`
+	Status      string      `json:"status"`
+	Accrual     money.Money `json:"accrual,omitempty"` // TODO: omitempty is it ok?
 }
 
 /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
 type Controller struct {
-	AuthSvc     service.AuthorizationService
-	OrderSvc    service.OrderService
-	WithdrawSvc service.WithdrawalService
+	AuthSvc        service.AuthorizationService
+	OrderSvc       service.OrderService
+	WithdrawSvc    service.WithdrawalService
+	IdempotencySvc service.IdempotencyService
+	WebhookSvc     service.WebhookService
+	// Issuer signs access tokens, middleware verifies them by the same issuer
+	Issuer *token.Issuer
+	// AccrualSecret is shared with accrual service which signs callbacks by it, callbacks are not accepted if it is empty
+	AccrualSecret string
 }
 
+// AccrualSignatureHeader keeps signature of callback of accrual service
+const AccrualSignatureHeader = "X-Accrual-Signature"
+
 // POST /api/user/register
 func (c Controller) UserRegister() controller.ControllerHandler {
 	return func(r *http.Request) controller.Response {
@@ -94,20 +177,14 @@ func (c Controller) UserRegister() controller.ControllerHandler {
 			return controller.NewResponse(err, nil, controller.TypeText, 0)
 
 		}
-		// Если всё ок, то производим генерацию токена и его запись в куки
-		tokenStr, err := genJWTTokenString(userID.ID)
+		// Если всё ок, то открываем сессию и записываем токены в куки
+		cookies, err := c.newSession(r, userID.ID)
 		if err != nil {
 			return controller.NewResponse(err, nil, controller.TypeText, 0)
 		}
 
 		// generate response (set cookie) and response
-		return controller.NewResponse(nil, nil, controller.TypeText, http.StatusOK, http.Cookie{
-			Name:     _mdw.CookieKey,
-			Value:    tokenStr,
-			Secure:   false,
-			HttpOnly: true,
-			Expires:  time.Now().Add(TokenExp),
-		})
+		return controller.NewResponse(nil, nil, controller.TypeText, http.StatusOK, cookies...)
 	}
 }
 
@@ -133,6 +210,7 @@ func (c Controller) UserLogin() controller.ControllerHandler {
 		user := service.AuthorizeRequest{
 			Login:    regReq.Login,
 			Password: regReq.Password,
+			ClientIP: clientIP(r),
 		}
 
 		// Передаю логин и пароль в сервис на проверку
@@ -140,19 +218,117 @@ func (c Controller) UserLogin() controller.ControllerHandler {
 		if err != nil {
 			return controller.NewResponse(err, nil, controller.TypeText, 0)
 		}
-		// Если всё ок, то производим генерацию токена
-		tokenStr, err := genJWTTokenString(userInfo.ID)
+		// Если всё ок, то открываем сессию
+		cookies, err := c.newSession(r, userInfo.ID)
 		if err != nil {
 			return controller.NewResponse(err, nil, controller.TypeText, 0)
 		}
 		// set cookie to mold the response
-		return controller.NewResponse(nil, nil, controller.TypeText, 0, http.Cookie{
-			Name:     _mdw.CookieKey,
-			Value:    tokenStr,
-			Secure:   false,
-			HttpOnly: true,
-			Expires:  time.Now().Add(TokenExp),
+		return controller.NewResponse(nil, nil, controller.TypeText, 0, cookies...)
+	}
+}
+
+// POST /api/user/logout
+func (c Controller) UserLogout() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		log := logger.GetRequestLogger(r)
+
+		claims, ok := r.Context().Value(_mdw.ClaimsKey).(*_mdw.JWTClaims)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+		log.Info("logging out user", "userID", claims.UserID)
+
+		err := c.AuthSvc.Logout(r.Context(), service.LogoutRequest{
+			UserID:         claims.UserID,
+			TokenID:        claims.ID,
+			TokenExpiresAt: claims.ExpiresAt.Time,
+		})
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+		return controller.NewResponse(nil, nil, controller.TypeText, 0, _mdw.ExpiredSessionCookies()...)
+	}
+}
+
+// POST /api/user/logout-all
+func (c Controller) UserLogoutAll() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		log := logger.GetRequestLogger(r)
+
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+		log.Info("logging out user from all devices", "userID", userID)
+
+		if err := c.AuthSvc.LogoutAll(r.Context(), userID); err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+		return controller.NewResponse(nil, nil, controller.TypeText, 0, _mdw.ExpiredSessionCookies()...)
+	}
+}
+
+// POST /api/user/password
+func (c Controller) ChangePassword() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		log := logger.GetRequestLogger(r)
+
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil || len(body) == 0 {
+			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
+		}
+
+		req := passwordReq{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
+		}
+
+		log.Info("changing password", "userID", userID)
+
+		err = c.AuthSvc.ChangePassword(r.Context(), service.ChangePasswordRequest{
+			UserID:      userID,
+			OldPassword: req.OldPassword,
+			NewPassword: req.NewPassword,
+			ClientIP:    clientIP(r),
 		})
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		// all sessions were closed, current client gets the new one
+		cookies, err := c.newSession(r, userID)
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+		return controller.NewResponse(nil, nil, controller.TypeText, 0, cookies...)
+	}
+}
+
+// DELETE /api/user
+func (c Controller) DeleteAccount() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		log := logger.GetRequestLogger(r)
+
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+
+		info, err := c.AuthSvc.DeleteAccount(r.Context(), userID)
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeJSON, 0)
+		}
+
+		log.Info("account was deleted", "userID", userID, "forfeited", info.Forfeited)
+
+		return controller.NewResponse(nil, DeletedAccount{Forfeited: info.Forfeited}, controller.TypeJSON, 0,
+			_mdw.ExpiredSessionCookies()...)
 	}
 }
 
@@ -183,6 +359,29 @@ func (c Controller) RelateOrderWithUser() controller.ControllerHandler {
 
 }
 
+// POST /api/internal/accrual
+//
+// accrual service pushes result of calculation, request is signed by shared secret in middleware
+func (c Controller) AccrualCallback() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		log := logger.GetRequestLogger(r)
+
+		req := AccrualsInf{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Error("unmarshal body failed", "error", err)
+			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
+		}
+		log.Debug("accrual result was pushed", "order", req.OrderNumber, "status", req.Status)
+
+		err := c.OrderSvc.ApplyAccrual(r.Context(), service.AccrualsInfo{
+			OrderNumber: req.OrderNumber,
+			Status:      req.Status,
+			Accrual:     req.Accrual,
+		})
+		return controller.NewResponse(err, nil, controller.TypeText, 0)
+	}
+}
+
 // GET /api/user/orders
 func (c Controller) ListOrdersRelatedWithUser() controller.ControllerHandler {
 	return func(r *http.Request) controller.Response {
@@ -192,14 +391,162 @@ func (c Controller) ListOrdersRelatedWithUser() controller.ControllerHandler {
 			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
 		}
 
-		orderInfo, err := c.OrderSvc.List(r.Context(), service.ListOrderRequest{UserID: userID})
+		query := r.URL.Query()
+		page, err := parsePage(query)
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+		from, to, err := parseTimeRange(query)
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		orderList, err := c.OrderSvc.List(r.Context(), service.ListOrderRequest{
+			UserID: userID,
+			Status: parseList(query["status"]),
+			From:   from,
+			To:     to,
+			Page:   page,
+		})
 		if err != nil {
 			return controller.NewResponse(err, nil, controller.TypeText, 0)
 		}
 		//fill the proxy slice of structs (with struct tags) to marshal the response
-		orInfo := fillListOfOrders(orderInfo)
-		return controller.NewResponse(nil, orInfo, controller.TypeJSON, 0)
+		orInfo := fillListOfOrders(orderList.Orders)
+		return withNextLink(r, orderList.Next, controller.NewResponse(nil, orInfo, controller.TypeJSON, 0))
+	}
+}
+
+// GET /api/user/orders/{number}
+func (c Controller) OrderOfUser() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+
+		order, err := c.OrderSvc.Order(r.Context(), service.OrderRequest{
+			UserID: userID,
+			Number: chi.URLParam(r, "number"),
+		})
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		details := OrderDetails{
+			Number:    order.Number,
+			Status:    order.Status,
+			Accrual:   order.Accrual,
+			CreatedAt: order.CreatedAt,
+			UpdatedAt: order.UpdatedAt,
+			Attempts:  order.Attempts,
+		}
+		if !order.CheckedAt.IsZero() {
+			details.CheckedAt = &order.CheckedAt
+		}
+		return controller.NewResponse(nil, details, controller.TypeJSON, 0)
+	}
+}
+
+// orderEventsPoll is how often stream of order events reads new events without signal, e.g. changes
+// which are made by another instance. Comment is sent as keep-alive too
+const orderEventsPoll = 15 * time.Second
+
+// GET /api/user/orders/events (AUTH only), server-sent events of changes of user orders.
+// Stream is resumed after event from Last-Event-ID header
+func (c Controller) OrderEvents() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.GetRequestLogger(r)
+
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0).Write(w)
+			return
+		}
+
+		lastID, err := lastEventID(r)
+		if err != nil {
+			controller.NewResponse(err, nil, controller.TypeText, 0).Write(w)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		//stream is open longer than write timeout of server
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			log.Warn("can not reset write deadline of event stream", "error", err)
+		}
+
+		//subscription goes before reading, so changes between them are not missed
+		signal, cancel := c.OrderSvc.Subscribe(userID)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		ticker := time.NewTicker(orderEventsPoll)
+		defer ticker.Stop()
+
+		for {
+			if lastID, err = c.writeOrderEvents(r, w, userID, lastID); err != nil {
+				log.Error("writing order events failed", "userID", userID, "error", err)
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-signal:
+			case <-ticker.C:
+				io.WriteString(w, ": ping\n\n")
+			}
+		}
+	}
+}
+
+// writeOrderEvents writes all events after lastID and returns id of the last written event
+func (c Controller) writeOrderEvents(r *http.Request, w io.Writer, userID string, lastID int64) (int64, error) {
+	for {
+		events, err := c.OrderSvc.Events(r.Context(), service.OrderEventsRequest{UserID: userID, AfterID: lastID})
+		if err != nil || len(events) == 0 {
+			return lastID, err
+		}
+
+		for _, event := range events {
+			data, err := json.Marshal(OrderEvent{
+				Number:    event.Number,
+				Status:    event.Status,
+				Accrual:   event.Accrual,
+				UpdatedAt: event.CreatedAt,
+			})
+			if err != nil {
+				return lastID, err
+			}
+
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: order\ndata: %s\n\n", event.ID, data); err != nil {
+				return lastID, err
+			}
+			lastID = event.ID
+		}
+	}
+}
+
+// lastEventID returns id of the last event which client got, zero if it is new stream
+func lastEventID(r *http.Request) (int64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		return 0, nil
 	}
+
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		return 0, service.ErrInvalidFormat
+	}
+	return id, nil
 }
 
 // GET /api/user/balance
@@ -247,8 +594,8 @@ func (c Controller) Withdraw() controller.ControllerHandler {
 
 		// proxy struct to unmarshal OrderNumber & Sum
 		inputBody := struct {
-			Order string  `json:"order"`
-			Sum   float64 `json:"sum"`
+			Order string      `json:"order"`
+			Sum   money.Money `json:"sum"`
 		}{}
 
 		err = json.Unmarshal(body, &inputBody)
@@ -282,32 +629,275 @@ func (c Controller) ListOfWithdrawals() controller.ControllerHandler {
 		}
 		log.Info("getting withdrawals", "userID", userID)
 
-		withdrawalInfo, err := c.WithdrawSvc.List(r.Context(), service.WithdrawalListRequest{UserID: userID})
+		query := r.URL.Query()
+		page, err := parsePage(query)
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+		from, to, err := parseTimeRange(query)
 		if err != nil {
 			return controller.NewResponse(err, nil, controller.TypeText, 0)
 		}
 
-		withdrawList := fillListOfWithdrawals(withdrawalInfo)
+		withdrawalList, err := c.WithdrawSvc.List(r.Context(), service.WithdrawalListRequest{
+			UserID: userID,
+			From:   from,
+			To:     to,
+			Page:   page,
+		})
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		withdrawList := fillListOfWithdrawals(withdrawalList.Withdrawals)
 
 		log.Info("getting withdrawals", "withdrawList", withdrawList, "userID", userID)
 
-		return controller.NewResponse(nil, withdrawList, controller.TypeJSON, 0)
+		return withNextLink(r, withdrawalList.Next, controller.NewResponse(nil, withdrawList, controller.TypeJSON, 0))
+	}
+}
+
+// GET /api/user/statement (AUTH only), CSV is returned for Accept: text/csv
+func (c Controller) Statement() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+
+		entries, err := c.WithdrawSvc.Statement(r.Context(), service.StatementRequest{UserID: userID})
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		statement := fillStatement(entries)
+
+		if !acceptsCSV(r) {
+			return controller.NewResponse(nil, statement, controller.TypeJSON, 0)
+		}
+
+		body, err := statementCSV(statement)
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+		return controller.WithHeader(controller.NewResponse(nil, body, controller.TypeCSV, 0),
+			"Content-Disposition", `attachment; filename="statement.csv"`)
+	}
+}
+
+// acceptsCSV reports whether client asks for text/csv
+func acceptsCSV(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept") {
+		for _, item := range strings.Split(v, ",") {
+			if mediaType, _, err := mime.ParseMediaType(item); err == nil && mediaType == "text/csv" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func statementCSV(statement []StatementEntry) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+
+	w.Write([]string{"processed_at", "type", "order", "sum", "balance"})
+	for _, v := range statement {
+		w.Write([]string{v.CreatedAt.Format(time.RFC3339), v.Type, v.OrderNumber, v.Sum.String(), v.Balance.String()})
+	}
+	w.Flush()
+
+	return buf.Bytes(), w.Error()
+}
+
+// POST /api/user/webhooks (AUTH only)
+func (c Controller) RegisterWebhook() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+
+		input := struct {
+			URL string `json:"url"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
+		}
+
+		webhook, err := c.WebhookSvc.Register(r.Context(), service.RegisterWebhookRequest{UserID: userID, URL: input.URL})
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		return controller.NewResponse(nil, Webhook(webhook), controller.TypeJSON, http.StatusCreated)
+	}
+}
+
+// GET /api/user/webhooks (AUTH only)
+func (c Controller) ListOfWebhooks() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+
+		webhooks, err := c.WebhookSvc.List(r.Context(), userID)
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		result := make([]Webhook, 0, len(webhooks))
+		for _, v := range webhooks {
+			result = append(result, Webhook(v))
+		}
+		return controller.NewResponse(nil, result, controller.TypeJSON, 0)
+	}
+}
+
+// DELETE /api/user/webhooks/{id} (AUTH only)
+func (c Controller) DeleteWebhook() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+
+		err := c.WebhookSvc.Delete(r.Context(), service.WebhookRequest{UserID: userID, ID: chi.URLParam(r, "id")})
+		return controller.NewResponse(err, nil, controller.TypeText, 0)
+	}
+}
+
+// GET /api/user/webhooks/{id}/deliveries (AUTH only)
+func (c Controller) ListOfDeliveries() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+
+		deliveries, err := c.WebhookSvc.Deliveries(r.Context(), service.WebhookRequest{UserID: userID, ID: chi.URLParam(r, "id")})
+		if err != nil {
+			return controller.NewResponse(err, nil, controller.TypeText, 0)
+		}
+
+		return controller.NewResponse(nil, fillListOfDeliveries(deliveries), controller.TypeJSON, 0)
+	}
+}
+
+// POST /api/user/webhooks/deliveries/{id}/redeliver (AUTH only)
+func (c Controller) Redeliver() controller.ControllerHandler {
+	return func(r *http.Request) controller.Response {
+		userID, ok := r.Context().Value(_mdw.UserIDKey).(string)
+		if !ok {
+			return controller.NewResponse(service.ErrWrongNameOrPassword, nil, controller.TypeText, 0)
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			return controller.NewResponse(service.ErrInvalidFormat, nil, controller.TypeText, 0)
+		}
+
+		err = c.WebhookSvc.Redeliver(r.Context(), service.RedeliveryRequest{UserID: userID, DeliveryID: id})
+		return controller.NewResponse(err, nil, controller.TypeText, http.StatusAccepted)
+	}
+}
+
+// clientIP returns address of client without port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// parsePage reads query parameters of page: limit, after (cursor of previous page) and sort (asc or desc)
+func parsePage(query url.Values) (service.PageRequest, error) {
+	page := service.PageRequest{After: query.Get("after")}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return page, service.ErrInvalidFormat
+		}
+		page.Limit = limit
+	}
+
+	switch query.Get("sort") {
+	case "", "asc":
+	case "desc":
+		page.Descending = true
+	default:
+		return page, service.ErrInvalidFormat
+	}
+
+	return page, nil
+}
+
+// parseTimeRange reads query parameters from and to in RFC3339 or as date YYYY-MM-DD.
+// from is inclusive, to is exclusive, but date of to is included entirely
+func parseTimeRange(query url.Values) (from, to time.Time, err error) {
+	if from, _, err = parseTime(query.Get("from")); err != nil {
+		return
+	}
+
+	var date bool
+	if to, date, err = parseTime(query.Get("to")); err != nil {
+		return
+	}
+	if date {
+		to = to.AddDate(0, 0, 1)
+	}
+	return
+}
+
+func parseTime(v string) (t time.Time, date bool, err error) {
+	if v == "" {
+		return time.Time{}, false, nil
+	}
+	if t, err = time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC(), false, nil
+	}
+	if t, err = time.Parse(time.DateOnly, v); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, service.ErrInvalidFormat
+}
+
+// parseList reads values of repeated or comma separated query parameter
+func parseList(values []string) []string {
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
 	}
+	return result
 }
 
-func genJWTTokenString(userID string) (string, error) {
-	type JWTClaims struct {
-		jwt.RegisteredClaims
-		UserID string
+// withNextLink adds Link header with URL of next page to response of list, next is empty on the last page
+func withNextLink(r *http.Request, next string, resp controller.Response) controller.Response {
+	if next == "" {
+		return resp
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenExp)),
-		},
 
-		UserID: userID,
-	})
-	return token.SignedString([]byte(secretKey))
+	query := r.URL.Query()
+	query.Set("after", next)
+
+	link := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return controller.WithHeader(resp, "Link", fmt.Sprintf(`<%s>; rel="next"`, link.String()))
+}
+
+// newSession opens session of user and returns cookies with its tokens
+func (c Controller) newSession(r *http.Request, userID string) ([]http.Cookie, error) {
+	session, err := c.AuthSvc.CreateSession(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	return _mdw.SessionCookies(c.Issuer, session)
 }
 
 func fillListOfOrders(orderInfo []service.OrderInfo) []OrderInfo {
@@ -324,16 +914,61 @@ func fillListOfOrders(orderInfo []service.OrderInfo) []OrderInfo {
 	return orders
 }
 
+func fillStatement(entries []service.StatementEntry) []StatementEntry {
+	statement := make([]StatementEntry, 0, len(entries))
+	for _, v := range entries {
+		kind := "expense"
+		if v.Income {
+			kind = "income"
+		}
+		statement = append(statement, StatementEntry{
+			Type:        kind,
+			OrderNumber: v.OrderNumber,
+			Sum:         v.Sum,
+			Balance:     v.Balance,
+			CreatedAt:   v.CreatedAt,
+		})
+	}
+	return statement
+}
+
+func fillListOfDeliveries(deliveries []service.DeliveryInfo) []Delivery {
+	result := make([]Delivery, 0, len(deliveries))
+	for _, v := range deliveries {
+		delivery := Delivery{
+			ID:          v.ID,
+			Event:       v.Event,
+			OrderNumber: v.OrderNumber,
+			State:       v.State,
+			Failures:    v.Failures,
+			OccurredAt:  v.OccurredAt,
+			Attempts:    make([]DeliveryAttempt, 0, len(v.Attempts)),
+		}
+		if !v.NextAttemptAt.IsZero() {
+			delivery.NextAttemptAt = &v.NextAttemptAt
+		}
+		if !v.DeliveredAt.IsZero() {
+			delivery.DeliveredAt = &v.DeliveredAt
+		}
+		for _, a := range v.Attempts {
+			delivery.Attempts = append(delivery.Attempts, DeliveryAttempt{
+				StatusCode: a.StatusCode,
+				Error:      a.Error,
+				DurationMs: a.Duration.Milliseconds(),
+				CreatedAt:  a.CreatedAt,
+			})
+		}
+		result = append(result, delivery)
+	}
+	return result
+}
+
 func fillListOfWithdrawals(withdrawalInfo []service.WithdrawalInfo) []WithdrawalInfo {
 	withdrawList := make([]WithdrawalInfo, 0, len(withdrawalInfo))
 	for _, v := range withdrawalInfo {
-		s := v.Sum
-		if s < 0 {
-			s = -s
-		}
 		withdrawList = append(withdrawList, WithdrawalInfo{
 			OrderNumber: v.OrderNumber,
-			Sum:         s,
+			Sum:         v.Sum.Abs(),
 			Status:      v.CreatedAt.Format(time.RFC3339),
 		})
 	}
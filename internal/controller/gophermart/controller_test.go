@@ -1,7 +1,21 @@
 package gophermart
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vilasle/gophermart/internal/controller"
+	_mdw "github.com/vilasle/gophermart/internal/middleware"
+	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
+	"github.com/vilasle/gophermart/internal/tool/signature"
 )
 
 // create  a mock///////////////////////////////////////////////////////////////////////////////////////
@@ -76,3 +90,198 @@ func TestController_UserRegister(t *testing.T) {
 	// 	})
 	// }
 }
+
+func Test_parsePage(t *testing.T) {
+	page, err := parsePage(url.Values{"limit": {"10"}, "after": {"abc"}, "sort": {"desc"}})
+	require.NoError(t, err)
+	assert.Equal(t, service.PageRequest{Limit: 10, After: "abc", Descending: true}, page)
+
+	for _, query := range []url.Values{{"limit": {"0"}}, {"limit": {"ten"}}, {"sort": {"up"}}} {
+		_, err := parsePage(query)
+		assert.ErrorIs(t, err, service.ErrInvalidFormat, query.Encode())
+	}
+}
+
+func Test_parseTimeRange(t *testing.T) {
+	from, to, err := parseTimeRange(url.Values{"from": {"2024-05-01T10:00:00+03:00"}, "to": {"2024-05-31"}})
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC), from)
+	//the whole day of "to" is included
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), to)
+
+	_, _, err = parseTimeRange(url.Values{"from": {"yesterday"}})
+	assert.ErrorIs(t, err, service.ErrInvalidFormat)
+}
+
+func Test_withNextLink(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/user/orders?limit=2&after=old", nil)
+
+	w := httptest.NewRecorder()
+	withNextLink(r, "next", controller.NewResponse(nil, []int{}, controller.TypeJSON, 0)).Write(w)
+	assert.Equal(t, `</api/user/orders?after=next&limit=2>; rel="next"`, w.Header().Get("Link"))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	withNextLink(r, "", controller.NewResponse(nil, []int{}, controller.TypeJSON, 0)).Write(w)
+	assert.Empty(t, w.Header().Get("Link"))
+}
+
+func Test_acceptsCSV(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "application/json", want: false},
+		{accept: "text/csv", want: true},
+		{accept: "application/json;q=0.5, text/csv; charset=utf-8", want: true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/statement", nil)
+		r.Header.Set("Accept", tt.accept)
+		assert.Equal(t, tt.want, acceptsCSV(r), tt.accept)
+	}
+}
+
+func Test_statementCSV(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	body, err := statementCSV(fillStatement([]service.StatementEntry{
+		{Income: true, OrderNumber: "954323", Sum: money.FromInt(100), Balance: money.FromInt(100), CreatedAt: createdAt},
+		{OrderNumber: "4323", Sum: money.FromMinor(-3050), Balance: money.FromMinor(6950), CreatedAt: createdAt.Add(time.Hour)},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "processed_at,type,order,sum,balance\n"+
+		"2024-05-01T10:00:00Z,income,954323,100,100\n"+
+		"2024-05-01T11:00:00Z,expense,4323,-30.5,69.5\n", string(body))
+}
+
+// eventsOrderService returns prepared events once and signals about them
+type eventsOrderService struct {
+	service.OrderService
+	events  []service.OrderEvent
+	afterID []int64
+	signal  chan struct{}
+}
+
+func (s *eventsOrderService) Events(_ context.Context, dto service.OrderEventsRequest) ([]service.OrderEvent, error) {
+	s.afterID = append(s.afterID, dto.AfterID)
+	result := make([]service.OrderEvent, 0)
+	for _, event := range s.events {
+		if event.ID > dto.AfterID {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
+
+func (s *eventsOrderService) Subscribe(string) (<-chan struct{}, func()) {
+	return s.signal, func() {}
+}
+
+func TestController_OrderEvents(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	svc := &eventsOrderService{
+		events: []service.OrderEvent{
+			{ID: 7, Number: "12345678903", Status: "PROCESSING", CreatedAt: createdAt},
+			{ID: 8, Number: "12345678903", Status: "PROCESSED", Accrual: money.FromInt(100), CreatedAt: createdAt},
+		},
+		signal: make(chan struct{}),
+	}
+	c := Controller{OrderSvc: svc}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), _mdw.UserIDKey, "user"))
+	r := httptest.NewRequest(http.MethodGet, "/api/user/orders/events", nil).WithContext(ctx)
+	r.Header.Set("Last-Event-ID", "7")
+	w := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.OrderEvents()(w, r)
+	}()
+
+	//the second reading is started by signal
+	svc.signal <- struct{}{}
+	cancel()
+	<-done
+
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "id: 8\nevent: order\n"+
+		`data: {"number":"12345678903","status":"PROCESSED","accrual":100,"updated_at":"2024-05-01T10:00:00Z"}`+"\n\n",
+		w.Body.String())
+	//events after 7 until empty result, then again after signal
+	assert.Equal(t, []int64{7, 8, 8}, svc.afterID)
+
+	r = httptest.NewRequest(http.MethodGet, "/api/user/orders/events", nil).WithContext(ctx)
+	r.Header.Set("Last-Event-ID", "last")
+	w = httptest.NewRecorder()
+	c.OrderEvents()(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_fillListOfDeliveries(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	deliveries := fillListOfDeliveries([]service.DeliveryInfo{
+		{
+			ID:            1,
+			Event:         "order.updated",
+			OrderNumber:   "12345678903",
+			State:         "pending",
+			Failures:      1,
+			OccurredAt:    createdAt,
+			NextAttemptAt: createdAt.Add(time.Minute),
+			Attempts: []service.DeliveryAttemptInfo{
+				{StatusCode: 500, Error: "unexpected status 500", Duration: 1500 * time.Millisecond, CreatedAt: createdAt},
+			},
+		},
+		{ID: 2, Event: "balance.credited", OrderNumber: "12345678903", State: "delivered", OccurredAt: createdAt, DeliveredAt: createdAt},
+	})
+
+	require.Len(t, deliveries, 2)
+	require.NotNil(t, deliveries[0].NextAttemptAt)
+	assert.Nil(t, deliveries[0].DeliveredAt)
+	assert.Equal(t, []DeliveryAttempt{{StatusCode: 500, Error: "unexpected status 500", DurationMs: 1500, CreatedAt: createdAt}},
+		deliveries[0].Attempts)
+
+	assert.Nil(t, deliveries[1].NextAttemptAt)
+	require.NotNil(t, deliveries[1].DeliveredAt)
+	assert.Equal(t, []DeliveryAttempt{}, deliveries[1].Attempts)
+}
+
+// accrualOrderService keeps pushed results of accrual service
+type accrualOrderService struct {
+	service.OrderService
+	applied []service.AccrualsInfo
+}
+
+func (s *accrualOrderService) ApplyAccrual(_ context.Context, dto service.AccrualsInfo) error {
+	if dto.OrderNumber != "12345678903" {
+		return service.ErrOrderNotFound
+	}
+	s.applied = append(s.applied, dto)
+	return nil
+}
+
+func TestController_AccrualCallback(t *testing.T) {
+	svc := &accrualOrderService{}
+	c := Controller{OrderSvc: svc, AccrualSecret: "secret"}
+	handler := _mdw.SignatureMiddleware(c.AccrualSecret, AccrualSignatureHeader)(c.AccrualCallback())
+
+	send := func(secret, body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/internal/accrual", strings.NewReader(body))
+		r.Header.Set(AccrualSignatureHeader, signature.Sign(secret, time.Now(), []byte(body)))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("secret", `{"order":"12345678903","status":"PROCESSED","accrual":100}`))
+	assert.Equal(t, []service.AccrualsInfo{{OrderNumber: "12345678903", Status: "PROCESSED", Accrual: money.FromInt(100)}}, svc.applied)
+
+	assert.Equal(t, http.StatusNotFound, send("secret", `{"order":"4561261212345467","status":"PROCESSED","accrual":100}`))
+	assert.Equal(t, http.StatusBadRequest, send("secret", `order`))
+	assert.Equal(t, http.StatusUnauthorized, send("another", `{"order":"12345678903","status":"PROCESSED","accrual":100}`))
+	assert.Len(t, svc.applied, 1)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/vilasle/gophermart/internal/service"
 )
@@ -37,6 +38,11 @@ func (r baseResponse) Write(w http.ResponseWriter) {
 		w.Header().Set(k, v)
 	}
 
+	var limitErr service.LimitError
+	if errors.As(r.err, &limitErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(limitErr.RetryAfter.Seconds())))
+	}
+
 	w.WriteHeader(getErrorCode(r.err, r.successCode))
 	w.Write(r.data)
 }
@@ -46,10 +52,12 @@ type ResponseType = int
 const (
 	TypeText ResponseType = iota + 1
 	TypeJSON
+	TypeCSV
 )
 
 type textResponse struct {
 	data        any
+	contentType string
 	successCode int
 	cookies     []http.Cookie
 	err         error
@@ -74,18 +82,45 @@ func NewResponse(err error, data any, kind ResponseType, httpCodeIfSuccess int,
 	switch kind {
 	case TypeJSON:
 		return jsonResponse{data: data, successCode: httpCodeIfSuccess, cookies: cookies, err: err} // TODO: mb MUST use data.([]controller.OrderInf) ???
+	case TypeCSV:
+		return textResponse{data: data, contentType: "text/csv; charset=utf-8", successCode: httpCodeIfSuccess, cookies: cookies, err: err}
 	default:
-		return textResponse{data: data, successCode: httpCodeIfSuccess, cookies: cookies, err: err}
+		return textResponse{data: data, contentType: "text/plain", successCode: httpCodeIfSuccess, cookies: cookies, err: err}
+	}
+}
+
+type headerResponse struct {
+	Response
+	header http.Header
+}
+
+// WithHeader adds header to response, e.g. Link of next page
+func WithHeader(resp Response, key, value string) Response {
+	header := http.Header{}
+	if r, ok := resp.(headerResponse); ok {
+		resp, header = r.Response, r.header
 	}
+	header.Add(key, value)
+	return headerResponse{Response: resp, header: header}
+}
+
+func (r headerResponse) Write(w http.ResponseWriter) {
+	for k, v := range r.header {
+		w.Header()[k] = v
+	}
+	r.Response.Write(w)
 }
 
 func (r textResponse) Write(w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Content-Type", r.contentType)
 
 	var body []byte
 
-	if v, ok := r.data.(string); ok {
+	switch v := r.data.(type) {
+	case string:
 		body = []byte(v)
+	case []byte:
+		body = v
 	}
 
 	base := baseResponse{
@@ -94,7 +129,7 @@ func (r textResponse) Write(w http.ResponseWriter) {
 		cookies:     r.cookies,
 		err:         r.err,
 		header: map[string]string{
-			"Content-Type": "text/plain",
+			"Content-Type": r.contentType,
 		},
 	}
 
@@ -145,9 +180,31 @@ func getErrorCode(err error, successCode int) int {
 	if errors.Is(err, service.ErrWrongNameOrPassword) {
 		return http.StatusUnauthorized //401 — неверная пара логин/пароль;
 	}
+	if errors.Is(err, service.ErrWrongPassword) {
+		return http.StatusForbidden // 403 — неверный текущий пароль
+	}
+	if errors.Is(err, service.ErrInvalidToken) {
+		return http.StatusUnauthorized // 401 — токен отозван или просрочен
+	}
 	if errors.Is(err, service.ErrOrderUploadAnotherUser) {
 		return http.StatusConflict // 409 — номер заказа уже был загружен другим пользователем;
 	}
+	if errors.Is(err, service.ErrOrderNotFound) {
+		return http.StatusNotFound // 404 — заказ не загружен
+	}
+	if errors.Is(err, service.ErrOrderOfAnotherUser) {
+		return http.StatusForbidden // 403 — заказ загружен другим пользователем
+	}
+	if errors.Is(err, service.ErrWebhookNotFound) {
+		return http.StatusNotFound // 404 — вебхук или доставка не найдены
+	}
+	if errors.Is(err, service.ErrRuleNotFound) {
+		return http.StatusNotFound // 404 — правило начисления не найдено
+	}
+
+	if errors.Is(err, service.ErrIdempotencyKeyReused) || errors.Is(err, service.ErrIdempotencyKeyInProgress) {
+		return http.StatusConflict // 409 — ключ идемпотентности уже использован
+	}
 
 	if errors.Is(err, service.ErrWrongNumberOfOrder) {
 		return http.StatusUnprocessableEntity // 422 — неверный формат номера заказа;
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vilasle/gophermart/internal/logger"
+	"github.com/vilasle/gophermart/internal/service"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyMiddleware replays saved response for retries with the same Idempotency-Key.
+// It must run after JWTMiddleware, because keys belong to user
+func IdempotencyMiddleware(svc service.IdempotencyService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			key := req.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(res, req)
+				return
+			}
+
+			log := logger.With("component", "idempotency", "key", key)
+
+			userID, ok := req.Context().Value(UserIDKey).(string)
+			if !ok {
+				res.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				res.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			dto := service.IdempotencyRequest{
+				UserID:      userID,
+				Key:         key,
+				Fingerprint: fingerprint(req, body),
+			}
+
+			saved, replay, err := svc.Start(req.Context(), dto)
+			if err != nil {
+				log.Info("request was rejected", "error", err)
+				http.Error(res, err.Error(), idempotencyErrorCode(err))
+				return
+			}
+
+			if replay {
+				log.Debug("replay saved response", "status", saved.StatusCode)
+				if saved.ContentType != "" {
+					res.Header().Set("Content-Type", saved.ContentType)
+				}
+				res.Header().Set("Idempotent-Replayed", "true")
+				res.WriteHeader(saved.StatusCode)
+				res.Write(saved.Body)
+				return
+			}
+
+			//key is released if response is not saved, also on panic of handler, so retry is processed again.
+			//keys left by crash of server are taken over by retry after processing timeout
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), time.Second*5)
+				defer cancel()
+				if err := svc.Cancel(ctx, dto); err != nil {
+					log.Error("releasing key failed", "error", err)
+				}
+			}()
+
+			rw := &recordingResponseWriter{ResponseWriter: res, status: http.StatusOK}
+			next.ServeHTTP(rw, req)
+
+			//response must be saved even if client has gone
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), time.Second*5)
+			defer cancel()
+
+			//server errors are not final, retry must be processed again
+			if rw.status >= http.StatusInternalServerError {
+				return
+			}
+
+			if err := svc.Complete(ctx, dto, service.IdempotentResponse{
+				StatusCode:  rw.status,
+				ContentType: rw.Header().Get("Content-Type"),
+				Body:        rw.body.Bytes(),
+			}); err != nil {
+				log.Error("saving response failed", "error", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+func fingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(req.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func idempotencyErrorCode(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidFormat):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrIdempotencyKeyReused), errors.Is(err, service.ErrIdempotencyKeyInProgress):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// recordingResponseWriter writes response to client and keeps copy of it
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recordingResponseWriter) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *recordingResponseWriter) WriteHeader(statusCode int) {
+	r.status = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
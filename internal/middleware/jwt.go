@@ -2,113 +2,139 @@ package middleware
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/vilasle/gophermart/internal/logger"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/token"
 )
 
-const tokenExp = time.Hour * 1
-const secretKey = "supersecretkey"
+// AccessTokenExp is short, expired access token is replaced by refresh token
+const AccessTokenExp = time.Minute * 15
 
 type contextKey string
 
 const UserIDKey contextKey = "userID"
+
+// ClaimsKey keeps *JWTClaims of access token which was used for request
+const ClaimsKey contextKey = "claims"
 const CookieKey string = "token"
+const RefreshCookieKey string = "refresh_token"
 
-type JWTClaims struct {
-	jwt.RegisteredClaims
-	UserID string
-}
+type JWTClaims = token.Claims
 
-func JWTMiddleware(some ...service.AuthorizationService) func(http.Handler) http.Handler {
+func JWTMiddleware(issuer *token.Issuer, svc service.AuthorizationService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-			fmt.Println("JWT MW Is available!")
-			// get token string from the cookies
-			tokenString, err := req.Cookie(CookieKey)
-			// check it
-			if err != nil {
-				res.WriteHeader(http.StatusUnauthorized)
-				return
-			}
-			if tokenString.Value == "" {
-				res.WriteHeader(http.StatusUnauthorized)
-				return
+			log := logger.With("component", "jwt")
+
+			claims, err := parseAccessToken(issuer, req)
+			if err == nil {
+				err = svc.CheckToken(req.Context(), service.CheckTokenRequest{
+					UserID:       claims.UserID,
+					TokenID:      claims.ID,
+					TokenVersion: claims.Version,
+				})
+				if err != nil {
+					log.Info("access token was rejected", "userID", claims.UserID, "error", err)
+					http.Error(res, "Token is not valid, please authorize again", http.StatusUnauthorized)
+					return
+				}
+			} else {
+				// access token is short-lived or was signed by removed key, so the session is continued by refresh token
+				log.Debug("access token was not accepted", "error", err)
+				claims, err = refreshSession(issuer, res, req, svc)
+				if err != nil {
+					log.Info("refreshing session failed", "error", err)
+					http.Error(res, "Session is expired, please authorize again", http.StatusUnauthorized)
+					return
+				}
 			}
 
-			claims := &JWTClaims{}
-
-			// парсим из строки токена tokenString в структуру claims
-			token, err := jwt.ParseWithClaims(tokenString.Value, claims, func(t *jwt.Token) (interface{}, error) {
-				if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-					res.WriteHeader(http.StatusUnauthorized)                                 //TODO [MENTOR] mb use StatusInternalServerError?
-					return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"]) // TODO: should I print it?
-				} // anti-hacker check
-				return []byte(secretKey), nil
-			})
-			if err != nil {
-				// TODO: по логике норм ли? jwt по идее не обязан вызывать методы сервиса
-				// (НАДО ЛИ ЧТО-ТО ПИСАТЬ ТИПА КАК СНИЗУ)
-				// просим авторизоваться, т.к. с токеном что-то не так (например просрочился)
-				http.Error(res, "Bad token, please authorize again", http.StatusUnauthorized) // TODO: mb set another header?
-				return
-			}
-			// check является ли токен ненулевым, имеет ли он AccessToken и не истёк ли срок его действия.
-			if !token.Valid {
-				http.Error(res, "Token is not valid, please authorize again", http.StatusUnauthorized)
-				return
-			}
-
-			err = some[0].CheckByUserID(req.Context(), claims.UserID)
-			if err != nil {
-				http.Error(res, "Failed to validate token", http.StatusUnauthorized)
-				return // TODO: ВЫЙДУ ВООБЩЕ ИЗ ОБРАБОТКИ ЗАПРОСА И УПР НЕ УЙДЕТ В ХЭНДЛЕР ДАЛЬШЕ?
-			}
-
-			// ГЕНЕРЮ ТОКЕН, вставляю его в куку, передаю управление хэндлеру
-			newToken, err := genJWTTokenString(claims.UserID)
-			if err != nil {
-				http.Error(res, "Failed to generate token", http.StatusInternalServerError)
-			}
-			http.SetCookie(res, &http.Cookie{
-				Name:     "token",
-				Value:    newToken,
-				Secure:   false,
-				HttpOnly: true,
-				Expires:  time.Now().Add(tokenExp),
-			})
-
-			// add userID to context to use it in controller
+			// add userID and claims to context to use it in controller
 			ctx := context.WithValue(req.Context(), UserIDKey, claims.UserID)
-			// expiration date - OK - continue
-			next.ServeHTTP(res, req.WithContext(ctx)) // continue
+			ctx = context.WithValue(ctx, ClaimsKey, claims)
 
+			next.ServeHTTP(res, req.WithContext(ctx)) // continue
 		})
 
 	}
 }
 
-//////////////////////////////////////////////////////////
+// SessionCookies signs access token of session and returns cookies with access and refresh tokens
+func SessionCookies(issuer *token.Issuer, session service.SessionInfo) ([]http.Cookie, error) {
+	accessToken, expiresAt, err := issuer.Issue(session.UserID, session.TokenID, session.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
 
-// genJWTTokenString create JWT token and return it in string type
-func genJWTTokenString(userID string) (string, error) { // создаём новый токен с алгоритмом подписи HS256 и утверждениями — Claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, JWTClaims{
-		RegisteredClaims: jwt.RegisteredClaims{
-			// set expiration time
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(tokenExp)),
+	return []http.Cookie{
+		{
+			Name:     CookieKey,
+			Value:    accessToken,
+			Path:     "/",
+			HttpOnly: true,
+			Expires:  expiresAt,
+		},
+		{
+			Name:     RefreshCookieKey,
+			Value:    session.RefreshToken,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+			Expires:  session.RefreshExpiresAt,
 		},
-		// set my own statement
-		UserID: userID,
-	})
+	}, nil
+}
+
+// ExpiredSessionCookies returns cookies which remove tokens from client
+func ExpiredSessionCookies() []http.Cookie {
+	return []http.Cookie{
+		{Name: CookieKey, Path: "/", HttpOnly: true, MaxAge: -1},
+		{Name: RefreshCookieKey, Path: "/", HttpOnly: true, MaxAge: -1},
+	}
+}
 
-	// создаём строку токена с подписью
-	tokenString, err := token.SignedString([]byte(secretKey))
+func parseAccessToken(issuer *token.Issuer, req *http.Request) (*JWTClaims, error) {
+	// get token string from the cookies
+	cookie, err := req.Cookie(CookieKey)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if cookie.Value == "" {
+		return nil, http.ErrNoCookie
 	}
-	// возвращаем строку токена
-	return tokenString, nil
+	return issuer.Parse(cookie.Value)
+}
+
+// refreshSession rotates refresh token from cookie and sets new tokens to response
+func refreshSession(issuer *token.Issuer, res http.ResponseWriter, req *http.Request, svc service.AuthorizationService) (*JWTClaims, error) {
+	cookie, err := req.Cookie(RefreshCookieKey)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := svc.RefreshSession(req.Context(), service.RefreshSessionRequest{RefreshToken: cookie.Value})
+	if err != nil {
+		return nil, err
+	}
+
+	cookies, err := SessionCookies(issuer, session)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cookies {
+		http.SetCookie(res, &c)
+	}
+
+	return &JWTClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.TokenID,
+			ExpiresAt: jwt.NewNumericDate(cookies[0].Expires),
+		},
+		UserID:  session.UserID,
+		Version: session.TokenVersion,
+	}, nil
 }
@@ -65,6 +65,11 @@ func (r *loggingResponseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
+// Unwrap allows to use http.ResponseController, e.g. flushing of event stream
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	// get statusCOde using original http.ResponseWriter
 	r.ResponseWriter.WriteHeader(statusCode)
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vilasle/gophermart/internal/logger"
+	"github.com/vilasle/gophermart/internal/tool/signature"
+)
+
+// SignatureTolerance is the largest difference between time of signature and time of request
+const SignatureTolerance = 5 * time.Minute
+
+// SignatureMiddleware passes requests which body is signed by secret in header, see signature.Sign.
+// It is used for internal endpoints which are called by another services instead of users
+func SignatureMiddleware(secret, header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, 1<<20))
+			if err != nil {
+				http.Error(res, "Body is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			if err := signature.Verify(secret, req.Header.Get(header), body, time.Now(), SignatureTolerance); err != nil {
+				logger.With("component", "signature").Info("request was rejected", "path", req.URL.Path, "error", err)
+				http.Error(res, "Signature is not valid", http.StatusUnauthorized)
+				return
+			}
+
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(res, req)
+		})
+	}
+}
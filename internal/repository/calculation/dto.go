@@ -1,5 +1,11 @@
 package repository
 
+import (
+	"time"
+
+	"github.com/vilasle/gophermart/internal/tool/money"
+)
+
 type CalculationStatus = int
 
 const (
@@ -21,7 +27,8 @@ func IsCorrectStatus(s CalculationStatus) bool {
 type AddingCalculation struct {
 	OrderNumber string
 	ProductName string
-	Price       float64
+	Price       money.Money
+	PurchasedAt time.Time
 }
 
 type ClearingCalculationQueue struct {
@@ -35,29 +42,82 @@ type CalculationQueue struct {
 type CalculationQueueInfo struct {
 	OrderNumber string
 	ProductName string
-	Price       float64
+	Price       money.Money
+	PurchasedAt time.Time
 }
 
 type AddCalculationResult struct {
 	OrderNumber string
 	Status      int
-	Value       float64
+	Value       money.Money
 }
 
 type CalculationFilter struct {
 	OrderNumber string
+	//is used if it is not empty, e.g. for batch lookup
+	OrderNumbers []string
 }
 
 type CalculationInfo struct {
 	OrderNumber string
 	Status      CalculationStatus
-	Value       float64
+	Value       money.Money
+}
+
+type CalculationLine struct {
+	//position of product in order starting from 1, it is 0 for rules of order
+	Line        int
+	ProductName string
+	Price       money.Money
+	//it is 0 if product is not matched by any rule
+	RuleID          int16
+	RuleKind        int
+	CalculationType int
+	Points          money.Money
+	//match and point of rule at time of calculation, rule can be changed or deleted later
+	RuleMatch string
+	RulePoint money.Money
+}
+
+type ReplacingCalculationLines struct {
+	OrderNumber string
+	Lines       []CalculationLine
+}
+
+type CalculationLineFilter struct {
+	OrderNumber string
 }
 
 type AddingRule struct {
+	Kind            int
 	Match           string
-	Point           float64
+	Point           money.Money
 	CalculationType int
+	Threshold       money.Money
+	Priority        int
+	Policy          int
+	Cap             money.Money
+	//zero time is not bounded
+	ValidFrom time.Time
+	ValidTo   time.Time
+	//bit i is set for time.Weekday(i), zero means every day
+	Weekdays int
+	HourFrom int
+	HourTo   int
+}
+
+type UpdatingRule struct {
+	ID int16
+	AddingRule
+}
+
+type RuleDisabling struct {
+	ID       int16
+	Disabled bool
+}
+
+type DeletingRule struct {
+	ID int16
 }
 
 type RuleFilter struct {
@@ -66,7 +126,20 @@ type RuleFilter struct {
 
 type RuleInfo struct {
 	ID              int16
+	Kind            int
 	Match           string
-	Point           float64
+	Point           money.Money
 	CalculationType int
+	Threshold       money.Money
+	Priority        int
+	Policy          int
+	Cap             money.Money
+	//zero time is not bounded
+	ValidFrom time.Time
+	ValidTo   time.Time
+	//bit i is set for time.Weekday(i), zero means every day
+	Weekdays int
+	HourFrom int
+	HourTo   int
+	Disabled bool
 }
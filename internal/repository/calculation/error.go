@@ -3,3 +3,4 @@ package repository
 import "errors"
 
 var ErrDuplicate = errors.New("duplicate")
+var ErrNotFound = errors.New("not found")
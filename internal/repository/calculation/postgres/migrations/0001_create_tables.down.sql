@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS calculation;
+DROP TABLE IF EXISTS calculation_queue;
+DROP TABLE IF EXISTS rules;
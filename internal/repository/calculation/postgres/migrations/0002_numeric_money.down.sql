@@ -0,0 +1,3 @@
+ALTER TABLE rules ALTER COLUMN point TYPE REAL;
+ALTER TABLE calculation_queue ALTER COLUMN price TYPE REAL;
+ALTER TABLE calculation ALTER COLUMN points TYPE REAL;
@@ -0,0 +1,18 @@
+-- value goes through double precision, because direct cast of REAL keeps only 6 significant digits
+DO $$
+DECLARE
+	col RECORD;
+BEGIN
+	FOR col IN
+		SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND data_type = 'real' AND (
+			(table_name = 'rules' AND column_name = 'point') OR
+			(table_name = 'calculation_queue' AND column_name = 'price') OR
+			(table_name = 'calculation' AND column_name = 'points'))
+	LOOP
+		EXECUTE format(
+			'ALTER TABLE %I ALTER COLUMN %I TYPE NUMERIC(14,2) USING round(%I::double precision::numeric, 2)',
+			col.table_name, col.column_name, col.column_name);
+	END LOOP;
+END
+$$;
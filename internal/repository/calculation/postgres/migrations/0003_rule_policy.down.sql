@@ -0,0 +1,3 @@
+ALTER TABLE rules DROP COLUMN IF EXISTS cap;
+ALTER TABLE rules DROP COLUMN IF EXISTS policy;
+ALTER TABLE rules DROP COLUMN IF EXISTS priority;
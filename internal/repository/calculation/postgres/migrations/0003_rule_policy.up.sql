@@ -0,0 +1,4 @@
+-- rules without policy keep behaviour of the first match
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS policy SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS cap NUMERIC(14,2) NOT NULL DEFAULT 0;
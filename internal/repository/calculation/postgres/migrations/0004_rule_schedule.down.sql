@@ -0,0 +1,7 @@
+ALTER TABLE calculation_queue DROP COLUMN IF EXISTS purchased_at;
+
+ALTER TABLE rules DROP COLUMN IF EXISTS hour_to;
+ALTER TABLE rules DROP COLUMN IF EXISTS hour_from;
+ALTER TABLE rules DROP COLUMN IF EXISTS weekdays;
+ALTER TABLE rules DROP COLUMN IF EXISTS valid_to;
+ALTER TABLE rules DROP COLUMN IF EXISTS valid_from;
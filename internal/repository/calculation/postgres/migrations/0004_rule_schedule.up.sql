@@ -0,0 +1,9 @@
+-- rules without bounds are valid at any time, expired rules are kept for recalculations
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS valid_from TIMESTAMPTZ;
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS valid_to TIMESTAMPTZ;
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS weekdays SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS hour_from SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS hour_to SMALLINT NOT NULL DEFAULT 0;
+
+-- rules are evaluated against purchase time, so it is kept until order is calculated
+ALTER TABLE calculation_queue ADD COLUMN IF NOT EXISTS purchased_at TIMESTAMPTZ NOT NULL DEFAULT now();
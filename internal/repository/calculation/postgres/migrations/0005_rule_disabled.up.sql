@@ -0,0 +1,2 @@
+-- disabled rules are kept but not applied
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
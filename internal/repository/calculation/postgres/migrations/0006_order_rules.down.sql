@@ -0,0 +1,5 @@
+DELETE FROM rules WHERE kind <> 0;
+DROP INDEX IF EXISTS rules_product_match_idx;
+ALTER TABLE rules ADD CONSTRAINT rules_match_key UNIQUE (match);
+ALTER TABLE rules DROP COLUMN IF EXISTS threshold;
+ALTER TABLE rules DROP COLUMN IF EXISTS kind;
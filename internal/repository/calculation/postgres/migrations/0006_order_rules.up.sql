@@ -0,0 +1,5 @@
+-- rules of orders do not have match, so it is unique only for rules of products
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS kind SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS threshold NUMERIC(14,2) NOT NULL DEFAULT 0;
+ALTER TABLE rules DROP CONSTRAINT IF EXISTS rules_match_key;
+CREATE UNIQUE INDEX IF NOT EXISTS rules_product_match_idx ON rules (match) WHERE kind = 0;
@@ -0,0 +1,13 @@
+-- lines explain reward of order, rule is not referenced because it can be deleted later
+CREATE TABLE IF NOT EXISTS calculation_line (
+	order_number VARCHAR(255) NOT NULL,
+	seq SMALLINT NOT NULL,
+	line SMALLINT NOT NULL,
+	product_name VARCHAR(255) NOT NULL,
+	price NUMERIC(14,2) NOT NULL,
+	rule_id INTEGER NOT NULL,
+	rule_kind SMALLINT NOT NULL,
+	way SMALLINT NOT NULL,
+	points NUMERIC(14,2) NOT NULL,
+	PRIMARY KEY (order_number, seq)
+);
@@ -0,0 +1,7 @@
+ALTER TABLE calculation_line DROP COLUMN IF EXISTS rule_point;
+ALTER TABLE calculation_line DROP COLUMN IF EXISTS rule_match;
+
+DELETE FROM rules WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS rules_product_match_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS rules_product_match_idx ON rules (match) WHERE kind = 0;
+ALTER TABLE rules DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,11 @@
+-- deleted rules are kept for audit and for rule_id of calculation lines, their match can be registered again
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+DROP INDEX IF EXISTS rules_product_match_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS rules_product_match_idx ON rules (match) WHERE kind = 0 AND deleted_at IS NULL;
+
+-- terms of rule are copied to lines, so lines explain reward after rule is changed.
+-- lines of minimal price (rule_kind 3) do not give points, so they do not have terms
+ALTER TABLE calculation_line ADD COLUMN IF NOT EXISTS rule_match VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE calculation_line ADD COLUMN IF NOT EXISTS rule_point NUMERIC(14,2) NOT NULL DEFAULT 0;
+UPDATE calculation_line SET rule_match = rules.match, rule_point = rules.point
+FROM rules WHERE rules.id = calculation_line.rule_id AND calculation_line.rule_kind <> 3;
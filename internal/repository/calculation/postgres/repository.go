@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/huandu/go-sqlbuilder"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -15,6 +16,7 @@ const (
 	//	tables
 	calculationQueueTable = "calculation_queue"
 	calculationTable      = "calculation"
+	calculationLineTable  = "calculation_line"
 	ruleTable             = "rules"
 )
 
@@ -33,10 +35,10 @@ func NewCalculationRepository(conn *sql.DB) (CalculationRepository, error) {
 
 func (r CalculationRepository) AddCalculationToQueue(ctx context.Context, dto ...decl.AddingCalculation) error {
 	sb := sqlbuilder.InsertInto(calculationQueueTable).
-		Cols("order_number", "product_name", "price")
+		Cols("order_number", "product_name", "price", "purchased_at")
 
 	for _, v := range dto {
-		sb.Values(v.OrderNumber, v.ProductName, v.Price)
+		sb.Values(v.OrderNumber, v.ProductName, v.Price, v.PurchasedAt)
 	}
 
 	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
@@ -67,7 +69,7 @@ func (r CalculationRepository) AddCalculationResult(ctx context.Context, dto dec
 }
 
 func (r CalculationRepository) GetCalculationsQueue(ctx context.Context) ([]decl.CalculationQueueInfo, error) {
-	sb := sqlbuilder.Select("order_number", "product_name", "price").From(calculationQueueTable)
+	sb := sqlbuilder.Select("order_number", "product_name", "price", "purchased_at").From(calculationQueueTable)
 
 	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
 
@@ -86,7 +88,7 @@ func prepareCalculationQueue(rows *sql.Rows) ([]decl.CalculationQueueInfo, error
 	result := make([]decl.CalculationQueueInfo, 0)
 	for rows.Next() {
 		var v decl.CalculationQueueInfo
-		err := rows.Scan(&v.OrderNumber, &v.ProductName, &v.Price)
+		err := rows.Scan(&v.OrderNumber, &v.ProductName, &v.Price, &v.PurchasedAt)
 		if err != nil {
 			return nil, getRepositoryError(err)
 		}
@@ -116,6 +118,9 @@ func (r CalculationRepository) Calculations(ctx context.Context, dto decl.Calcul
 	if dto.OrderNumber != "" {
 		sb.Where(sb.Equal("order_number", dto.OrderNumber))
 	}
+	if len(dto.OrderNumbers) > 0 {
+		sb.Where(sb.Any("order_number", "=", dto.OrderNumbers))
+	}
 
 	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
 
@@ -142,10 +147,74 @@ func prepareCalculations(rows *sql.Rows) ([]decl.CalculationInfo, error) {
 	return result, rows.Err()
 }
 
+func (r CalculationRepository) ReplaceCalculationLines(ctx context.Context, dto decl.ReplacingCalculationLines) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return getRepositoryError(err)
+	}
+	defer tx.Rollback()
+
+	db := sqlbuilder.DeleteFrom(calculationLineTable)
+	db.Where(db.Equal("order_number", dto.OrderNumber))
+
+	txt, args := db.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return getRepositoryError(err)
+	}
+
+	if len(dto.Lines) > 0 {
+		ib := sqlbuilder.InsertInto(calculationLineTable).
+			Cols("order_number", "seq", "line", "product_name", "price", "rule_id", "rule_kind", "way", "points",
+				"rule_match", "rule_point")
+		for i, v := range dto.Lines {
+			ib.Values(dto.OrderNumber, i, v.Line, v.ProductName, v.Price, v.RuleID, v.RuleKind, v.CalculationType, v.Points,
+				v.RuleMatch, v.RulePoint)
+		}
+
+		txt, args = ib.BuildWithFlavor(sqlbuilder.PostgreSQL)
+		if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+			return getRepositoryError(err)
+		}
+	}
+
+	return getRepositoryError(tx.Commit())
+}
+
+func (r CalculationRepository) CalculationLines(ctx context.Context, dto decl.CalculationLineFilter) ([]decl.CalculationLine, error) {
+	sb := sqlbuilder.Select("line", "product_name", "price", "rule_id", "rule_kind", "way", "points",
+		"rule_match", "rule_point").
+		From(calculationLineTable)
+	sb.Where(sb.Equal("order_number", dto.OrderNumber))
+	sb.OrderBy("seq")
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	rows, err := r.db.QueryContext(ctx, txt, args...)
+	if err != nil {
+		return nil, getRepositoryError(err)
+	}
+	defer rows.Close()
+
+	result := make([]decl.CalculationLine, 0)
+	for rows.Next() {
+		var v decl.CalculationLine
+		err := rows.Scan(&v.Line, &v.ProductName, &v.Price, &v.RuleID, &v.RuleKind, &v.CalculationType, &v.Points,
+			&v.RuleMatch, &v.RulePoint)
+		if err != nil {
+			return nil, getRepositoryError(err)
+		}
+		result = append(result, v)
+	}
+	return result, getRepositoryError(rows.Err())
+}
+
 func (r CalculationRepository) AddRules(ctx context.Context, dto ...decl.AddingRule) (id int16, err error) {
-	sp := sqlbuilder.InsertInto("rules").Cols("match", "point", "way").Returning("id")
+	sp := sqlbuilder.InsertInto("rules").
+		Cols("kind", "match", "point", "way", "threshold", "priority", "policy", "cap",
+			"valid_from", "valid_to", "weekdays", "hour_from", "hour_to").
+		Returning("id")
 	for _, v := range dto {
-		sp.Values(v.Match, v.Point, v.CalculationType)
+		sp.Values(v.Kind, v.Match, v.Point, v.CalculationType, v.Threshold, v.Priority, v.Policy, v.Cap,
+			nullTime(v.ValidFrom), nullTime(v.ValidTo), v.Weekdays, v.HourFrom, v.HourTo)
 	}
 	txt, args := sp.BuildWithFlavor(sqlbuilder.PostgreSQL)
 	row := r.db.QueryRowContext(ctx, txt, args...)
@@ -154,12 +223,76 @@ func (r CalculationRepository) AddRules(ctx context.Context, dto ...decl.AddingR
 	return id, getRepositoryError(err)
 }
 
+func (r CalculationRepository) UpdateRule(ctx context.Context, dto decl.UpdatingRule) error {
+	sb := sqlbuilder.Update(ruleTable)
+	sb.Set(
+		sb.Equal("kind", dto.Kind),
+		sb.Equal("match", dto.Match),
+		sb.Equal("point", dto.Point),
+		sb.Equal("way", dto.CalculationType),
+		sb.Equal("threshold", dto.Threshold),
+		sb.Equal("priority", dto.Priority),
+		sb.Equal("policy", dto.Policy),
+		sb.Equal("cap", dto.Cap),
+		sb.Equal("valid_from", nullTime(dto.ValidFrom)),
+		sb.Equal("valid_to", nullTime(dto.ValidTo)),
+		sb.Equal("weekdays", dto.Weekdays),
+		sb.Equal("hour_from", dto.HourFrom),
+		sb.Equal("hour_to", dto.HourTo),
+	)
+	sb.Where(sb.Equal("id", dto.ID), sb.IsNull("deleted_at"))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	result, err := r.db.ExecContext(ctx, txt, args...)
+
+	return affectedRule(result, err)
+}
+
+func (r CalculationRepository) SetRuleDisabled(ctx context.Context, dto decl.RuleDisabling) error {
+	sb := sqlbuilder.Update(ruleTable)
+	sb.Set(sb.Equal("disabled", dto.Disabled))
+	sb.Where(sb.Equal("id", dto.ID), sb.IsNull("deleted_at"))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	result, err := r.db.ExecContext(ctx, txt, args...)
+
+	return affectedRule(result, err)
+}
+
+// DeleteRule marks rule as deleted, it is kept because calculation lines refer to it
+func (r CalculationRepository) DeleteRule(ctx context.Context, dto decl.DeletingRule) error {
+	sb := sqlbuilder.Update(ruleTable)
+	sb.Set("deleted_at = now()")
+	sb.Where(sb.Equal("id", dto.ID), sb.IsNull("deleted_at"))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	result, err := r.db.ExecContext(ctx, txt, args...)
+
+	return affectedRule(result, err)
+}
+
+func affectedRule(result sql.Result, err error) error {
+	if err != nil {
+		return getRepositoryError(err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return decl.ErrNotFound
+	}
+	return nil
+}
+
 func (r CalculationRepository) Rules(ctx context.Context, dto decl.RuleFilter) ([]decl.RuleInfo, error) {
-	sp := sqlbuilder.Select("id", "match", "point", "way").From(ruleTable)
+	sp := sqlbuilder.Select("id", "kind", "match", "point", "way", "threshold", "priority", "policy", "cap",
+		"valid_from", "valid_to", "weekdays", "hour_from", "hour_to", "disabled").From(ruleTable)
+	sp.Where(sp.IsNull("deleted_at"))
 
 	if dto.ID > 0 {
 		sp.Where(sp.Equal("id", dto.ID))
 	}
+	sp.OrderBy("priority DESC", "id")
 
 	txt, args := sp.BuildWithFlavor(sqlbuilder.PostgreSQL)
 	rows, err := r.db.QueryContext(ctx, txt, args...)
@@ -177,16 +310,26 @@ func (r CalculationRepository) Rules(ctx context.Context, dto decl.RuleFilter) (
 func prepareRulesInfo(rows *sql.Rows) ([]decl.RuleInfo, error) {
 	rules := make([]decl.RuleInfo, 0)
 	for rows.Next() {
-		var rule decl.RuleInfo
-		err := rows.Scan(&rule.ID, &rule.Match, &rule.Point, &rule.CalculationType)
+		var (
+			rule               decl.RuleInfo
+			validFrom, validTo sql.NullTime
+		)
+		err := rows.Scan(&rule.ID, &rule.Kind, &rule.Match, &rule.Point, &rule.CalculationType, &rule.Threshold, &rule.Priority, &rule.Policy, &rule.Cap,
+			&validFrom, &validTo, &rule.Weekdays, &rule.HourFrom, &rule.HourTo, &rule.Disabled)
 		if err != nil {
 			return nil, err
 		}
+		rule.ValidFrom, rule.ValidTo = validFrom.Time, validTo.Time
 		rules = append(rules, rule)
 	}
 	return rules, rows.Err()
 }
 
+// nullTime stores zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
 func getRepositoryError(err error) error {
 	if err != nil {
 		return err
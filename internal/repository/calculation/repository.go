@@ -12,10 +12,18 @@ type CalculationRepository interface {
 	UpdateCalculationResult(context.Context, AddCalculationResult) error
 
 	Calculations(context.Context, CalculationFilter) ([]CalculationInfo, error)
+
+	//lines of previous calculation of order are replaced
+	ReplaceCalculationLines(context.Context, ReplacingCalculationLines) error
+	CalculationLines(context.Context, CalculationLineFilter) ([]CalculationLine, error)
 }
 
 type CalculationRules interface {
 	AddRules(context.Context, ...AddingRule) (id int16, err error)
+	//UpdateRule, SetRuleDisabled and DeleteRule return ErrNotFound if rule does not exist
+	UpdateRule(context.Context, UpdatingRule) error
+	SetRuleDisabled(context.Context, RuleDisabling) error
+	DeleteRule(context.Context, DeletingRule) error
 
 	Rules(context.Context, RuleFilter) ([]RuleInfo, error)
 }
@@ -1,6 +1,11 @@
 package gophermart
 
-import "time"
+import (
+	"time"
+
+	"github.com/vilasle/gophermart/internal/tool/cursor"
+	"github.com/vilasle/gophermart/internal/tool/money"
+)
 
 type AuthData struct {
 	Login        string
@@ -11,50 +16,201 @@ type UserInfo struct {
 	ID           string
 	Login        string
 	PasswordHash []byte
+	TokenVersion int
+}
+
+type PasswordUpdateRequest struct {
+	UserID          string
+	PasswordHash    []byte
+	OldPasswordHash []byte
+	//invalidates all access and refresh tokens of user together with changing of password
+	RevokeTokens bool
+}
+
+// ForfeitOrderNumber is order number of expense which forfeits balance of deleted user
+const ForfeitOrderNumber = "forfeit"
+
+type DeletedUserInfo struct {
+	Forfeited money.Money
+}
+
+type LoginAttemptInfo struct {
+	Key         string
+	Failures    int
+	LockedUntil time.Time
+}
+
+type LoginFailureRequest struct {
+	Key    string
+	Window time.Duration
+}
+
+type LoginLockRequest struct {
+	Key         string
+	LockedUntil time.Time
+}
+
+type RefreshTokenRequest struct {
+	Hash    []byte
+	UserID  string
+	TokenID string
+	//expired tokens of user are deleted on adding new one
+	ExpiresAt time.Time
+}
+
+type RefreshTokenUsing struct {
+	Hash []byte
+	//user of successor is taken from used token, expired token is not rotated
+	Successor RefreshTokenRequest
+	//successor sealed by used token, it is returned to concurrent refreshes with the same token
+	SealedSuccessor []byte
+	//how long rotated token returns its successor instead of being treated as stolen
+	Grace time.Duration
+}
+
+type RefreshTokenInfo struct {
+	UserID       string
+	TokenID      string
+	TokenVersion int
+	ExpiresAt    time.Time
+	Revoked      bool
+	//token was rotated during grace window, successor fields are filled
+	Reused             bool
+	SuccessorTokenID   string
+	SuccessorExpiresAt time.Time
+	SealedSuccessor    []byte
+}
+
+type AccessTokenRequest struct {
+	UserID    string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+type AccessTokenInfo struct {
+	TokenVersion int
+	Revoked      bool
 }
 
 type WithdrawalRequest struct {
 	OrderNumber string
 	UserID      string
-	Sum         float64
+	Sum         money.Money
 }
 
+const (
+	TransactionAny int = iota
+	TransactionIncome
+	TransactionExpense
+)
+
 type TransactionRequest struct {
 	UserID string
+	//one of TransactionAny, TransactionIncome, TransactionExpense
+	Kind int
+	//created_at is in [From, To), zero value is not bounded
+	From  time.Time
+	To    time.Time
+	Limit int
+	//rows are ordered by created_at and id, rows after cursor are returned
+	After      cursor.Cursor
+	Descending bool
 }
 
 type Transaction struct {
+	ID          int64
 	Income      bool
 	UserID      string
 	OrderNumber string
-	Sum         float64
+	Sum         money.Money
 	CreatedAt   time.Time
 }
 
 type OrderCreateRequest struct {
 	UserID string
 	Number string
+	//the first check of order in accrual service is postponed by it
+	CheckAfter time.Duration
 }
 
 type OrderUpdateRequest struct {
 	UserID  string
 	Number  string
 	Status  int
-	Accrual float64
+	Accrual money.Money
 }
 
 type OrderListRequest struct {
 	UserID      string
 	OrderNumber string
-	Status	  []int
-	Limit	   int
+	Status      []int
+	//created_at is in [From, To), zero value is not bounded
+	From  time.Time
+	To    time.Time
+	Limit int
+	//rows are ordered by created_at and id, rows after cursor are returned
+	After      cursor.Cursor
+	Descending bool
 }
 
 type OrderInfo struct {
+	ID        int64
+	UserID    string
+	Number    string
+	Status    int
+	Accrual   money.Money
+	CreatedAt time.Time
+	//time of the last change of status or accrual
+	UpdatedAt time.Time
+	//quantity and time of the last requests to accrual service, CheckedAt is zero if order was not checked
+	Attempts  int
+	CheckedAt time.Time
+	//quantity of the requests which accrual service answered that order is unknown
+	NotFoundAttempts int
+	//time of the next request to accrual service and error of the last one
+	NextCheckAt time.Time
+	LastError   string
+}
+
+// OrderClaimRequest claims orders by Owner, it is id of instance which checks orders
+type OrderClaimRequest struct {
+	Owner string
+	Limit int
+	Lease time.Duration
+}
+
+type OrderLeaseRequest struct {
+	Number string
+	Owner  string
+	Lease  time.Duration
+}
+
+type OrderAttemptRequest struct {
+	Number string
+	//lease of owner is checked if it is set
+	Owner string
+	//empty if accrual service answered
+	Error string
+	//delay of the next check from now
+	RetryAfter time.Duration
+	//accrual service answered that order is unknown
+	NotFound bool
+}
+
+type OrderEventRequest struct {
+	UserID string
+	//events with id greater than AfterID are returned in order of id
+	AfterID int64
+	Limit   int
+}
+
+// OrderEvent is state of order after its change
+type OrderEvent struct {
+	ID        int64
 	UserID    string
 	Number    string
 	Status    int
-	Accrual   float64
+	Accrual   money.Money
 	CreatedAt time.Time
 }
 
@@ -62,8 +218,131 @@ type AccrualRequest struct {
 	OrderNumber string
 }
 
+type AccrualBatchRequest struct {
+	OrderNumbers []string
+}
+
 type AccrualInfo struct {
 	Number  string
 	Status  string
-	Accrual float64
+	Accrual money.Money
+}
+
+type IdempotencyKeyRequest struct {
+	UserID      string
+	Key         string
+	Fingerprint string
+	//reserved keys older than TTL are expired and can be reserved again
+	TTL time.Duration
+	//keys without response older than ProcessingTimeout are left by crashed requests and can be reserved again
+	ProcessingTimeout time.Duration
+}
+
+type IdempotencyKeyFilter struct {
+	UserID string
+	Key    string
+}
+
+type IdempotencyKeyInfo struct {
+	UserID      string
+	Key         string
+	Fingerprint string
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+type IdempotencyResponseRequest struct {
+	UserID      string
+	Key         string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// events of webhooks
+const (
+	WebhookEventOrderUpdated = "order.updated"
+	WebhookEventCredited     = "balance.credited"
+	WebhookEventWithdrawn    = "balance.withdrawn"
+)
+
+// states of webhook delivery
+const (
+	DeliveryPending int = iota + 1
+	DeliveryDelivered
+	DeliveryFailed
+)
+
+type WebhookRequest struct {
+	UserID string
+	URL    string
+	Secret string
+}
+
+type WebhookInfo struct {
+	ID        string
+	UserID    string
+	URL       string
+	Secret    string
+	CreatedAt time.Time
+}
+
+type WebhookFilter struct {
+	UserID string
+	ID     string
+}
+
+type DeliveryListRequest struct {
+	UserID    string
+	WebhookID string
+	//the last deliveries are returned
+	Limit int
+}
+
+type DeliveryClaimRequest struct {
+	Limit int
+	//claimed deliveries are not claimed again during lease, e.g. by another instance
+	Lease time.Duration
+}
+
+// Delivery of event to webhook. Status is set for order events, Sum is accrual of order or sum of transaction
+type Delivery struct {
+	ID            int64
+	WebhookID     string
+	URL           string
+	Secret        string
+	Event         string
+	OrderNumber   string
+	Status        int
+	Sum           money.Money
+	OccurredAt    time.Time
+	State         int
+	Failures      int
+	NextAttemptAt time.Time
+	DeliveredAt   time.Time
+	Attempts      []DeliveryAttempt
+}
+
+// DeliveryAttempt is result of request to webhook, StatusCode is zero if response was not got
+type DeliveryAttempt struct {
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+type DeliveryResultRequest struct {
+	DeliveryID    int64
+	Attempt       DeliveryAttempt
+	State         int
+	Failures      int
+	NextAttemptAt time.Time
+}
+
+type RedeliveryRequest struct {
+	UserID     string
+	DeliveryID int64
 }
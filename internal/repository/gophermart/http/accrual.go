@@ -1,8 +1,12 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -11,20 +15,110 @@ import (
 
 	mart "github.com/vilasle/gophermart/internal/repository/gophermart"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/breaker"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
+// metrics of accrual client are published by expvar:
+// requests, failures and rejected by breaker requests, state of breaker and its transitions as "from_to"
+var metrics = expvar.NewMap("accrual_client")
+
 type AccrualRepository struct {
-	addr *url.URL
+	addr    *url.URL
+	client  *http.Client
+	breaker *breaker.Breaker
+}
+
+type AccrualRepositoryConfig struct {
+	Timeout time.Duration
+	//breaker is opened after BreakerFailures failed requests in a row and passes probe request after BreakerTimeout
+	BreakerFailures int
+	BreakerTimeout  time.Duration
 }
 
 func NewAccrualRepository(addr *url.URL) *AccrualRepository {
-	return &AccrualRepository{addr: addr}
+	return NewAccrualRepositoryWithConfig(addr, AccrualRepositoryConfig{})
+}
+
+func NewAccrualRepositoryWithConfig(addr *url.URL, config AccrualRepositoryConfig) *AccrualRepository {
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	//connections to accrual service are reused by all workers
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 32
+
+	state := new(expvar.String)
+	state.Set(breaker.Closed.String())
+	metrics.Set("breaker_state", state)
+
+	return &AccrualRepository{
+		addr:   addr,
+		client: &http.Client{Timeout: config.Timeout, Transport: transport},
+		breaker: breaker.New(breaker.Config{
+			Failures:    config.BreakerFailures,
+			OpenTimeout: config.BreakerTimeout,
+			OnStateChange: func(from, to breaker.State) {
+				state.Set(to.String())
+				metrics.Add(from.String()+"_"+to.String(), 1)
+			},
+		}),
+	}
 }
 
 func (r AccrualRepository) AccrualByOrder(ctx context.Context, dto mart.AccrualRequest) (mart.AccrualInfo, error) {
+	var result mart.AccrualInfo
+	err := r.call(ctx, func() (err error) {
+		result, err = r.accrualByOrder(ctx, dto)
+		return err
+	})
+	return result, err
+}
+
+func (r AccrualRepository) AccrualByOrders(ctx context.Context, dto mart.AccrualBatchRequest) ([]mart.AccrualInfo, error) {
+	var result []mart.AccrualInfo
+	err := r.call(ctx, func() (err error) {
+		result, err = r.accrualByOrders(ctx, dto)
+		return err
+	})
+	return result, err
+}
+
+// call passes request through breaker and reports its result to breaker
+func (r AccrualRepository) call(ctx context.Context, request func() error) error {
+	if err := r.breaker.Allow(); err != nil {
+		metrics.Add("rejected", 1)
+		return fmt.Errorf("%w: %w", service.ErrUnavailable, err)
+	}
+	metrics.Add("requests", 1)
+
+	err := request()
+	switch {
+	case ctx.Err() != nil:
+		r.breaker.Release()
+	case isFailure(err):
+		metrics.Add("failures", 1)
+		r.breaker.Failure()
+	default:
+		r.breaker.Success()
+	}
+	return err
+}
+
+// isFailure reports that accrual service does not work, answers about unknown order, limit and
+// missing batch lookup are not failures
+func isFailure(err error) bool {
+	return err != nil &&
+		!errors.Is(err, service.ErrEntityDoesNotExists) &&
+		!errors.Is(err, service.ErrLimit) &&
+		!errors.Is(err, service.ErrNotSupported)
+}
+
+func (r AccrualRepository) accrualByOrder(ctx context.Context, dto mart.AccrualRequest) (mart.AccrualInfo, error) {
 	var (
 		addr = r.addr.JoinPath("orders", dto.OrderNumber).String()
-		cl   = &http.Client{Timeout: 10 * time.Second}
 		req  *http.Request
 		resp *http.Response
 		err  error
@@ -34,12 +128,18 @@ func (r AccrualRepository) AccrualByOrder(ctx context.Context, dto mart.AccrualR
 		return mart.AccrualInfo{}, err
 	}
 
-	if resp, err = cl.Do(req); err != nil {
+	if resp, err = r.client.Do(req); err != nil {
 		return mart.AccrualInfo{}, err
 	}
 
 	defer resp.Body.Close()
 
+	//body is read anyway, so connection can be reused
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return mart.AccrualInfo{}, err
+	}
+
 	if resp.StatusCode == http.StatusTooManyRequests {
 		err := createLimitError(resp)
 		return mart.AccrualInfo{}, err
@@ -49,19 +149,77 @@ func (r AccrualRepository) AccrualByOrder(ctx context.Context, dto mart.AccrualR
 		return mart.AccrualInfo{}, service.ErrUnexpected
 	}
 
-	content, err := io.ReadAll(resp.Body)
+	return prepareAccrualInfo(content)
+}
+
+func (r AccrualRepository) accrualByOrders(ctx context.Context, dto mart.AccrualBatchRequest) ([]mart.AccrualInfo, error) {
+	body, err := json.Marshal(struct {
+		Orders []string `json:"orders"`
+	}{Orders: dto.OrderNumbers})
 	if err != nil {
-		return mart.AccrualInfo{}, err
+		return nil, err
 	}
 
-	return prepareAccrualInfo(content)
+	addr := r.addr.JoinPath("orders", "status").String()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, addr, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	//body is read anyway, so connection can be reused
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return prepareAccrualsInfo(content)
+	case http.StatusTooManyRequests:
+		return nil, createLimitError(resp)
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		//older accrual service does not have batch endpoint
+		return nil, service.ErrNotSupported
+	default:
+		return nil, service.ErrUnexpected
+	}
+}
+
+func prepareAccrualsInfo(content []byte) ([]mart.AccrualInfo, error) {
+	result := []struct {
+		Order   string      `json:"order"`
+		Status  string      `json:"status"`
+		Accrual money.Money `json:"accrual"`
+	}{}
+
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, service.ErrUnexpected
+	}
+
+	accruals := make([]mart.AccrualInfo, 0, len(result))
+	for _, r := range result {
+		accruals = append(accruals, mart.AccrualInfo{
+			Number:  r.Order,
+			Status:  r.Status,
+			Accrual: r.Accrual,
+		})
+	}
+	return accruals, nil
 }
 
 func prepareAccrualInfo(content []byte) (mart.AccrualInfo, error) {
 	result := struct {
-		Order   string  `json:"order"`
-		Status  string  `json:"status"`
-		Accrual float64 `json:"accrual"`
+		Order   string      `json:"order"`
+		Status  string      `json:"status"`
+		Accrual money.Money `json:"accrual"`
 	}{}
 
 	if err := json.Unmarshal(content, &result); err != nil {
@@ -1 +1,133 @@
-package http
\ No newline at end of file
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mart "github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/breaker"
+	"github.com/vilasle/gophermart/internal/tool/money"
+)
+
+func TestAccrualRepository_AccrualByOrder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/orders/1":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"order":"1","status":"PROCESSED","accrual":729.98}`))
+		case "/api/orders/2":
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/orders/3":
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	addr, err := url.Parse(srv.URL + "/api")
+	require.NoError(t, err)
+	r := NewAccrualRepository(addr)
+	ctx := context.Background()
+
+	info, err := r.AccrualByOrder(ctx, mart.AccrualRequest{OrderNumber: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, mart.AccrualInfo{Number: "1", Status: "PROCESSED", Accrual: money.FromMinor(72998)}, info)
+
+	_, err = r.AccrualByOrder(ctx, mart.AccrualRequest{OrderNumber: "2"})
+	assert.ErrorIs(t, err, service.ErrEntityDoesNotExists)
+
+	_, err = r.AccrualByOrder(ctx, mart.AccrualRequest{OrderNumber: "3"})
+	assert.Equal(t, service.LimitError{RetryAfter: time.Minute}, err)
+
+	_, err = r.AccrualByOrder(ctx, mart.AccrualRequest{OrderNumber: "4"})
+	assert.ErrorIs(t, err, service.ErrUnexpected)
+
+	//answers of working service do not open breaker
+	assert.Equal(t, breaker.Closed, r.breaker.State())
+}
+
+func TestAccrualRepository_AccrualByOrders(t *testing.T) {
+	var status atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/orders/status" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"orders":["1","2"]}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if code := int(status.Load()); code != http.StatusOK {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(code)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"order":"1","status":"PROCESSED","accrual":729.98}]`))
+	}))
+	defer srv.Close()
+
+	addr, err := url.Parse(srv.URL + "/api")
+	require.NoError(t, err)
+	r := NewAccrualRepositoryWithConfig(addr, AccrualRepositoryConfig{BreakerFailures: 1})
+	ctx := context.Background()
+	batch := mart.AccrualBatchRequest{OrderNumbers: []string{"1", "2"}}
+
+	status.Store(http.StatusOK)
+	info, err := r.AccrualByOrders(ctx, batch)
+	require.NoError(t, err)
+	assert.Equal(t, []mart.AccrualInfo{{Number: "1", Status: "PROCESSED", Accrual: money.FromMinor(72998)}}, info)
+
+	status.Store(http.StatusTooManyRequests)
+	_, err = r.AccrualByOrders(ctx, batch)
+	assert.Equal(t, service.LimitError{RetryAfter: time.Minute}, err)
+
+	//older accrual service
+	status.Store(http.StatusNotFound)
+	_, err = r.AccrualByOrders(ctx, batch)
+	assert.ErrorIs(t, err, service.ErrNotSupported)
+
+	_, err = r.AccrualByOrders(ctx, mart.AccrualBatchRequest{OrderNumbers: []string{"1"}})
+	assert.ErrorIs(t, err, service.ErrUnexpected)
+	assert.Equal(t, breaker.Open, r.breaker.State())
+}
+
+func TestAccrualRepository_breaker(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	addr, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	r := NewAccrualRepositoryWithConfig(addr, AccrualRepositoryConfig{BreakerFailures: 3, BreakerTimeout: time.Hour})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := r.AccrualByOrder(ctx, mart.AccrualRequest{OrderNumber: "1"})
+		assert.ErrorIs(t, err, service.ErrUnexpected)
+	}
+
+	//service is not requested while breaker is open
+	_, err = r.AccrualByOrder(ctx, mart.AccrualRequest{OrderNumber: "1"})
+	assert.ErrorIs(t, err, service.ErrUnavailable)
+	assert.ErrorIs(t, err, breaker.ErrOpen)
+	assert.Equal(t, int32(3), requests.Load())
+	assert.Equal(t, breaker.Open, r.breaker.State())
+	assert.Equal(t, `"open"`, metrics.Get("breaker_state").String())
+}
@@ -0,0 +1,2 @@
+ALTER TABLE "order" ALTER COLUMN sum TYPE REAL;
+ALTER TABLE "transaction" ALTER COLUMN sum TYPE REAL;
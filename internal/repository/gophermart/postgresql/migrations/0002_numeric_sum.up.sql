@@ -0,0 +1,16 @@
+-- value goes through double precision, because direct cast of REAL keeps only 6 significant digits
+DO $$
+BEGIN
+	IF (SELECT data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'order' AND column_name = 'sum') = 'real' THEN
+		ALTER TABLE "order" ALTER COLUMN sum TYPE NUMERIC(14,2)
+			USING round(sum::double precision::numeric, 2);
+	END IF;
+
+	IF (SELECT data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'transaction' AND column_name = 'sum') = 'real' THEN
+		ALTER TABLE "transaction" ALTER COLUMN sum TYPE NUMERIC(14,2)
+			USING round(sum::double precision::numeric, 2);
+	END IF;
+END
+$$;
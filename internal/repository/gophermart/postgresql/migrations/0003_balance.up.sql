@@ -0,0 +1,32 @@
+-- one row per user, withdrawals lock it with SELECT ... FOR UPDATE
+CREATE TABLE IF NOT EXISTS balance (
+	user_id UUID PRIMARY KEY,
+	current NUMERIC(14,2) NOT NULL DEFAULT 0,
+	withdrawn NUMERIC(14,2) NOT NULL DEFAULT 0,
+	FOREIGN KEY (user_id) REFERENCES "user" (id),
+	CONSTRAINT balance_current_non_negative CHECK (current >= 0)
+);
+
+-- balance must match ledger, so users overdrawn by earlier races are reported instead of being hidden
+DO $$
+DECLARE
+	overdrawn TEXT;
+BEGIN
+	SELECT string_agg(user_id::TEXT || ' (' || total::TEXT || ')', ', ' ORDER BY user_id) INTO overdrawn
+	FROM (
+		SELECT user_id, SUM(sum) AS total FROM "transaction" GROUP BY user_id HAVING SUM(sum) < 0
+	) ledger;
+
+	IF overdrawn IS NOT NULL THEN
+		RAISE EXCEPTION 'users are overdrawn: %', overdrawn;
+	END IF;
+END $$;
+
+INSERT INTO balance (user_id, current, withdrawn)
+SELECT
+	user_id,
+	SUM(sum),
+	-SUM(CASE WHEN income THEN 0 ELSE sum END)
+FROM "transaction"
+GROUP BY user_id
+ON CONFLICT (user_id) DO NOTHING;
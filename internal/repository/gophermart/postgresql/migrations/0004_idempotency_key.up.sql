@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_key (
+	user_id UUID NOT NULL,
+	key VARCHAR(255) NOT NULL,
+	fingerprint VARCHAR(64) NOT NULL,
+	-- NULL while first request is processing
+	status_code SMALLINT,
+	content_type VARCHAR(255),
+	body BYTEA,
+	created_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (user_id, key),
+	FOREIGN KEY (user_id) REFERENCES "user" (id)
+);
+CREATE INDEX IF NOT EXISTS idempotency_key_created_at_idx ON idempotency_key (created_at);
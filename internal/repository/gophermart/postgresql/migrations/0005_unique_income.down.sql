@@ -0,0 +1 @@
+DROP INDEX IF EXISTS transaction_income_order_number_idx;
@@ -0,0 +1,19 @@
+-- before this migration a crash or retry could credit one order several times.
+-- ledger history is not changed automatically, so migration stops with numbers of such orders
+-- and operator has to resolve them before starting again
+DO $$
+DECLARE
+	duplicates TEXT;
+BEGIN
+	SELECT string_agg(order_number, ', ' ORDER BY order_number) INTO duplicates
+	FROM (
+		SELECT order_number FROM "transaction" WHERE income GROUP BY order_number HAVING COUNT(*) > 1
+	) credits;
+
+	IF duplicates IS NOT NULL THEN
+		RAISE EXCEPTION 'orders are credited several times: %', duplicates;
+	END IF;
+END $$;
+
+-- order can be credited at most once
+CREATE UNIQUE INDEX IF NOT EXISTS transaction_income_order_number_idx ON "transaction" (order_number) WHERE income;
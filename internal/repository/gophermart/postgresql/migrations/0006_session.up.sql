@@ -0,0 +1,25 @@
+-- incrementing of version invalidates all access tokens of user
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS token_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS refresh_token (
+	-- sha256 of token, token itself is known only by client
+	hash BYTEA PRIMARY KEY,
+	user_id UUID NOT NULL,
+	-- jti of access token which was issued together with refresh token
+	token_id VARCHAR(64) NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	-- not NULL when token was used for refreshing or was revoked
+	revoked_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	FOREIGN KEY (user_id) REFERENCES "user" (id)
+);
+CREATE INDEX IF NOT EXISTS refresh_token_user_id_idx ON refresh_token (user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_token (
+	token_id VARCHAR(64) PRIMARY KEY,
+	user_id UUID NOT NULL,
+	-- revoked token is kept until it expires
+	expires_at TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES "user" (id)
+);
+CREATE INDEX IF NOT EXISTS revoked_token_expires_at_idx ON revoked_token (expires_at);
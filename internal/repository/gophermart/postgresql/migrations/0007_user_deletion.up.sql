@@ -0,0 +1,2 @@
+-- deleted user is anonymized, the row is kept because orders and transactions refer to it
+ALTER TABLE "user" ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+-- failed logins by login name and by client address, key is e.g. "login:<name>" or "ip:<address>"
+CREATE TABLE IF NOT EXISTS login_attempt (
+	key VARCHAR(300) PRIMARY KEY,
+	failures INTEGER NOT NULL,
+	locked_until TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS login_attempt_updated_at_idx ON login_attempt (updated_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS transaction_user_id_created_at_idx;
+DROP INDEX IF EXISTS order_user_id_created_at_idx;
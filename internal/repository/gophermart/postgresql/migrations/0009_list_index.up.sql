@@ -0,0 +1,3 @@
+-- lists of orders and transactions are paged by (created_at, id) of user
+CREATE INDEX IF NOT EXISTS order_user_id_created_at_idx ON "order" (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS transaction_user_id_created_at_idx ON "transaction" (user_id, created_at, id);
@@ -0,0 +1,3 @@
+ALTER TABLE "order" DROP COLUMN IF EXISTS checked_at;
+ALTER TABLE "order" DROP COLUMN IF EXISTS attempts;
+ALTER TABLE "order" DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,7 @@
+-- time of last change of status or accrual, number and time of the last accrual checks of order
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+UPDATE "order" SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE "order" ALTER COLUMN updated_at SET NOT NULL;
+
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS checked_at TIMESTAMP;
@@ -0,0 +1,10 @@
+-- log of changes of orders, id is used by clients of event stream to resume it
+CREATE TABLE IF NOT EXISTS order_event (
+	id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	user_id UUID NOT NULL,
+	order_number VARCHAR(255) NOT NULL,
+	status SMALLINT NOT NULL,
+	sum NUMERIC(14,2) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS order_event_user_id_idx ON order_event (user_id, id);
@@ -0,0 +1,38 @@
+-- webhooks of users, payloads are signed by secret of webhook
+CREATE TABLE IF NOT EXISTS webhook (
+	id UUID PRIMARY KEY,
+	user_id UUID NOT NULL REFERENCES "user" (id),
+	url TEXT NOT NULL,
+	secret VARCHAR(128) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_user_id_idx ON webhook (user_id);
+
+-- outbox of events, rows are added in transaction of the event and sent by delivery workers
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+	id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	webhook_id UUID NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+	event VARCHAR(64) NOT NULL,
+	order_number VARCHAR(255) NOT NULL,
+	status SMALLINT,
+	sum NUMERIC(14,2) NOT NULL,
+	occurred_at TIMESTAMPTZ NOT NULL,
+	-- pending, delivered or failed after all retries
+	state SMALLINT NOT NULL,
+	-- failed attempts since creation or the last redelivery
+	failures INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL,
+	delivered_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS webhook_delivery_webhook_id_idx ON webhook_delivery (webhook_id, id);
+CREATE INDEX IF NOT EXISTS webhook_delivery_pending_idx ON webhook_delivery (next_attempt_at) WHERE state = 1;
+
+CREATE TABLE IF NOT EXISTS webhook_attempt (
+	id BIGINT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+	delivery_id BIGINT NOT NULL REFERENCES webhook_delivery (id) ON DELETE CASCADE,
+	status_code INTEGER,
+	error TEXT,
+	duration_ms INTEGER NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_attempt_delivery_id_idx ON webhook_attempt (delivery_id, id);
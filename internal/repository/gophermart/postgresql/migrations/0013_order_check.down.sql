@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS "order_next_check_at_idx";
+ALTER TABLE "order" DROP COLUMN IF EXISTS last_error;
+ALTER TABLE "order" DROP COLUMN IF EXISTS next_check_at;
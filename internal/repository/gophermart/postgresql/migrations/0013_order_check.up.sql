@@ -0,0 +1,6 @@
+-- orders are checked in accrual service when next_check_at comes, error of the last check is kept for diagnostics
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS next_check_at TIMESTAMP NOT NULL DEFAULT now();
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS last_error TEXT;
+
+-- only NEW and PROCESSING orders are checked
+CREATE INDEX IF NOT EXISTS "order_next_check_at_idx" ON "order" (next_check_at) WHERE status IN (1, 2);
@@ -0,0 +1,2 @@
+-- instance which claimed order for checking in accrual service, lease expires at next_check_at
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS lease_owner VARCHAR(64);
@@ -0,0 +1,5 @@
+-- rotated token keeps its successor, so concurrent refreshes with the same token during short grace window
+-- get the same new session instead of being treated as theft.
+-- successor is sealed by key derived from rotated token, so it can be read only by holder of that token
+ALTER TABLE refresh_token ADD COLUMN IF NOT EXISTS successor_hash BYTEA;
+ALTER TABLE refresh_token ADD COLUMN IF NOT EXISTS successor_sealed BYTEA;
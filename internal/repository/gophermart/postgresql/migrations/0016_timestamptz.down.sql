@@ -0,0 +1,9 @@
+ALTER TABLE idempotency_key ALTER COLUMN created_at TYPE TIMESTAMP USING created_at::TIMESTAMP;
+
+ALTER TABLE "transaction" ALTER COLUMN created_at TYPE TIMESTAMP USING created_at::TIMESTAMP;
+
+ALTER TABLE "order"
+	ALTER COLUMN created_at TYPE TIMESTAMP USING created_at::TIMESTAMP,
+	ALTER COLUMN updated_at TYPE TIMESTAMP USING updated_at::TIMESTAMP,
+	ALTER COLUMN checked_at TYPE TIMESTAMP USING checked_at::TIMESTAMP,
+	ALTER COLUMN next_check_at TYPE TIMESTAMP USING next_check_at::TIMESTAMP;
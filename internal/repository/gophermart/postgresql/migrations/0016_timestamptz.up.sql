@@ -0,0 +1,11 @@
+-- times were written by now() as local time of session, so they are read in the same time zone.
+-- filters and cursors are compared as absolute times after it, whatever time zone of client is
+ALTER TABLE "order"
+	ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at::TIMESTAMPTZ,
+	ALTER COLUMN updated_at TYPE TIMESTAMPTZ USING updated_at::TIMESTAMPTZ,
+	ALTER COLUMN checked_at TYPE TIMESTAMPTZ USING checked_at::TIMESTAMPTZ,
+	ALTER COLUMN next_check_at TYPE TIMESTAMPTZ USING next_check_at::TIMESTAMPTZ;
+
+ALTER TABLE "transaction" ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at::TIMESTAMPTZ;
+
+ALTER TABLE idempotency_key ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at::TIMESTAMPTZ;
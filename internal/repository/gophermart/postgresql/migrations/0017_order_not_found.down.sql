@@ -0,0 +1 @@
+ALTER TABLE "order" DROP COLUMN IF EXISTS not_found_attempts;
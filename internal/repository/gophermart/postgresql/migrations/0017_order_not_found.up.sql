@@ -0,0 +1,2 @@
+-- number of accrual checks which answered that order is unknown, only they make order invalid
+ALTER TABLE "order" ADD COLUMN IF NOT EXISTS not_found_attempts INTEGER NOT NULL DEFAULT 0;
@@ -4,14 +4,22 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/huandu/go-sqlbuilder"
 	"github.com/jackc/pgx/v5/pgconn"
 	mart "github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/tool/cursor"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 const (
 	codeDuplicateKey = "23505"
+	//events are kept for clients which resume event stream after long break
+	orderEventRetention = 30 * 24 * time.Hour
 )
 
 type PostgresqlGophermartRepository struct {
@@ -38,7 +46,7 @@ func (r PostgresqlGophermartRepository) AddUser(ctx context.Context, dto mart.Au
 }
 
 func (r PostgresqlGophermartRepository) CheckUser(ctx context.Context, dto mart.AuthData) (mart.UserInfo, error) {
-	sb := sqlbuilder.Select("id", "login", "password").From(`"user"`)
+	sb := sqlbuilder.Select("id", "login", "password", "token_version").From(`"user"`)
 	sb.Where(sb.Equal("login", dto.Login))
 
 	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
@@ -46,144 +54,806 @@ func (r PostgresqlGophermartRepository) CheckUser(ctx context.Context, dto mart.
 
 	var id, login string
 	var password []byte
-	err := row.Scan(&id, &login, &password)
+	var version int
+	err := row.Scan(&id, &login, &password, &version)
 
-	return mart.UserInfo{ID: id, Login: login, PasswordHash: password}, getRepositoryError(err)
+	return mart.UserInfo{ID: id, Login: login, PasswordHash: password, TokenVersion: version}, getRepositoryError(err)
 }
 
 func (r PostgresqlGophermartRepository) CheckUserByID(ctx context.Context, reqID string) (mart.UserInfo, error) {
-	sb := sqlbuilder.Select("id", "login", "password").From(`"user"`)
-	sb.Where(sb.Equal("id", reqID))
+	sb := sqlbuilder.Select("id", "login", "password", "token_version").From(`"user"`)
+	sb.Where(sb.Equal("id", reqID), sb.IsNull("deleted_at"))
 
 	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
 	row := r.db.QueryRowContext(ctx, txt, args...)
 
 	var id, login string
 	var password []byte
+	var version int
 
-	err := row.Scan(&id, &login, &password)
+	err := row.Scan(&id, &login, &password, &version)
 
-	return mart.UserInfo{ID: id, Login: login, PasswordHash: password}, getRepositoryError(err)
+	return mart.UserInfo{ID: id, Login: login, PasswordHash: password, TokenVersion: version}, getRepositoryError(err)
+}
+
+func (r PostgresqlGophermartRepository) UpdatePassword(ctx context.Context, dto mart.PasswordUpdateRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sb := sqlbuilder.Update(`"user"`)
+	sb.Set(sb.Equal("password", dto.PasswordHash))
+	sb.Where(sb.Equal("id", dto.UserID), sb.Equal("password", dto.OldPasswordHash), sb.IsNull("deleted_at"))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	result, err := tx.ExecContext(ctx, txt, args...)
+	if err != nil {
+		return getRepositoryError(err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return mart.ErrEmptyResult
+	}
+
+	if dto.RevokeTokens {
+		if err := revokeUserTokens(ctx, tx, dto.UserID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteUser anonymizes user and forfeits its balance. Orders and transactions are kept for accounting
+func (r PostgresqlGophermartRepository) DeleteUser(ctx context.Context, userID string) (mart.DeletedUserInfo, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mart.DeletedUserInfo{}, err
+	}
+	defer tx.Rollback()
+
+	sb := sqlbuilder.Update(`"user"`)
+	sb.Set(
+		"login = 'deleted:' || id::text",
+		sb.Equal("password", nil),
+		"deleted_at = now()",
+	)
+	sb.Where(sb.Equal("id", userID), sb.IsNull("deleted_at"))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	result, err := tx.ExecContext(ctx, txt, args...)
+	if err != nil {
+		return mart.DeletedUserInfo{}, getRepositoryError(err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return mart.DeletedUserInfo{}, err
+	} else if affected == 0 {
+		return mart.DeletedUserInfo{}, mart.ErrEmptyResult
+	}
+
+	current, err := lockBalance(ctx, tx, userID)
+	if err != nil {
+		return mart.DeletedUserInfo{}, getRepositoryError(err)
+	}
+
+	//forfeit is posted as expense, so sum of transactions is still equal to balance
+	if current != 0 {
+		if err := addTransaction(ctx, tx, mart.ForfeitOrderNumber, userID, false, -current); err != nil {
+			return mart.DeletedUserInfo{}, err
+		}
+
+		upd := sqlbuilder.Update("balance")
+		upd.Set(upd.Equal("current", 0))
+		upd.Where(upd.Equal("user_id", userID))
+
+		txt, args = upd.BuildWithFlavor(sqlbuilder.PostgreSQL)
+		if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+			return mart.DeletedUserInfo{}, getRepositoryError(err)
+		}
+	}
+
+	if err := revokeUserTokens(ctx, tx, userID); err != nil {
+		return mart.DeletedUserInfo{}, err
+	}
+
+	//deliveries of webhooks are deleted together with them
+	del := sqlbuilder.DeleteFrom("webhook")
+	del.Where(del.Equal("user_id", userID))
+
+	txt, args = del.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return mart.DeletedUserInfo{}, getRepositoryError(err)
+	}
+
+	return mart.DeletedUserInfo{Forfeited: current}, tx.Commit()
+}
+
+func (r PostgresqlGophermartRepository) AddRefreshToken(ctx context.Context, dto mart.RefreshTokenRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := addRefreshToken(ctx, tx, dto); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// addRefreshToken deletes expired tokens of user and adds new one
+func addRefreshToken(ctx context.Context, tx *sql.Tx, dto mart.RefreshTokenRequest) error {
+	del := sqlbuilder.DeleteFrom("refresh_token")
+	del.Where(del.Equal("user_id", dto.UserID), "expires_at < now()")
+
+	txt, args := del.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return getRepositoryError(err)
+	}
+
+	sb := sqlbuilder.InsertInto("refresh_token").
+		Cols("hash", "user_id", "token_id", "expires_at", "created_at").
+		Values(dto.Hash, dto.UserID, dto.TokenID, dto.ExpiresAt, sqlbuilder.Raw("now()"))
+
+	txt, args = sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return getRepositoryError(err)
+	}
+	return nil
+}
+
+// UseRefreshToken locks row of token, so only one of concurrent refreshes rotates token
+// and others wait for it and get its successor
+func (r PostgresqlGophermartRepository) UseRefreshToken(ctx context.Context, dto mart.RefreshTokenUsing) (mart.RefreshTokenInfo, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return mart.RefreshTokenInfo{}, err
+	}
+	defer tx.Rollback()
+
+	sb := sqlbuilder.NewSelectBuilder()
+	sb.Select(
+		"t.user_id", "t.token_id", "u.token_version", "t.expires_at", "t.revoked_at IS NOT NULL",
+		//revoked_at of rotated token is time of rotation
+		fmt.Sprintf("t.successor_hash IS NOT NULL AND t.revoked_at > now() - make_interval(secs => %s)", sb.Var(dto.Grace.Seconds())),
+		"COALESCE(s.revoked_at IS NULL AND s.expires_at > now(), FALSE)",
+		"t.successor_sealed", "COALESCE(s.token_id, '')", "s.expires_at",
+	).
+		From("refresh_token t").
+		Join(`"user" u`, "u.id = t.user_id").
+		JoinWithOption(sqlbuilder.LeftJoin, "refresh_token s", "s.hash = t.successor_hash")
+	sb.Where(sb.Equal("t.hash", dto.Hash))
+	//successor can be absent, so only row of used token is locked
+	sb.SQL("FOR UPDATE OF t")
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+
+	var (
+		info           mart.RefreshTokenInfo
+		inGrace, alive bool
+		successorExp   sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx, txt, args...).
+		Scan(&info.UserID, &info.TokenID, &info.TokenVersion, &info.ExpiresAt, &info.Revoked,
+			&inGrace, &alive, &info.SealedSuccessor, &info.SuccessorTokenID, &successorExp)
+	if err != nil {
+		return mart.RefreshTokenInfo{}, getRepositoryError(err)
+	}
+
+	if info.Revoked {
+		if !inGrace {
+			info.SealedSuccessor, info.SuccessorTokenID = nil, ""
+			return info, nil
+		}
+		//successor was rotated or revoked already, so token is just invalid
+		if !alive {
+			return mart.RefreshTokenInfo{}, mart.ErrEmptyResult
+		}
+		info.Revoked, info.Reused = false, true
+		info.SuccessorExpiresAt = successorExp.Time
+		return info, nil
+	}
+
+	if !info.ExpiresAt.After(time.Now()) {
+		return info, nil
+	}
+
+	upd := sqlbuilder.Update("refresh_token")
+	upd.Set(
+		"revoked_at = now()",
+		upd.Equal("successor_hash", dto.Successor.Hash),
+		upd.Equal("successor_sealed", dto.SealedSuccessor),
+	)
+	upd.Where(upd.Equal("hash", dto.Hash))
+
+	txt, args = upd.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return mart.RefreshTokenInfo{}, getRepositoryError(err)
+	}
+
+	successor := dto.Successor
+	successor.UserID = info.UserID
+	if err := addRefreshToken(ctx, tx, successor); err != nil {
+		return mart.RefreshTokenInfo{}, err
+	}
+
+	return info, tx.Commit()
+}
+
+func (r PostgresqlGophermartRepository) RevokeSession(ctx context.Context, dto mart.AccessTokenRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//revoked tokens which have already expired are not needed anymore
+	del := sqlbuilder.DeleteFrom("revoked_token")
+	del.Where("expires_at < now()")
+
+	txt, args := del.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return getRepositoryError(err)
+	}
+
+	ins := sqlbuilder.InsertInto("revoked_token").
+		Cols("token_id", "user_id", "expires_at").
+		Values(dto.TokenID, dto.UserID, dto.ExpiresAt).
+		SQL("ON CONFLICT (token_id) DO NOTHING")
+
+	txt, args = ins.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return getRepositoryError(err)
+	}
+
+	upd := sqlbuilder.Update("refresh_token")
+	upd.Set("revoked_at = now()")
+	upd.Where(upd.Equal("user_id", dto.UserID), upd.Equal("token_id", dto.TokenID), upd.IsNull("revoked_at"))
+
+	txt, args = upd.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return getRepositoryError(err)
+	}
+
+	return tx.Commit()
+}
+
+func (r PostgresqlGophermartRepository) RevokeUserTokens(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := revokeUserTokens(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revokeUserTokens increments token version of user and revokes all its refresh tokens
+func revokeUserTokens(ctx context.Context, tx *sql.Tx, userID string) error {
+	sb := sqlbuilder.Update(`"user"`)
+	sb.Set("token_version = token_version + 1")
+	sb.Where(sb.Equal("id", userID))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return getRepositoryError(err)
+	}
+
+	upd := sqlbuilder.Update("refresh_token")
+	upd.Set("revoked_at = now()")
+	upd.Where(upd.Equal("user_id", userID), upd.IsNull("revoked_at"))
+
+	txt, args = upd.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	_, err := tx.ExecContext(ctx, txt, args...)
+	return getRepositoryError(err)
+}
+
+func (r PostgresqlGophermartRepository) CheckAccessToken(ctx context.Context, dto mart.AccessTokenRequest) (mart.AccessTokenInfo, error) {
+	revoked := sqlbuilder.Select("1").From("revoked_token")
+	revoked.Where(revoked.Equal("token_id", dto.TokenID))
+
+	sb := sqlbuilder.NewSelectBuilder()
+	sb.Select("token_version", sb.Exists(revoked)).From(`"user"`)
+	sb.Where(sb.Equal("id", dto.UserID), sb.IsNull("deleted_at"))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+
+	var info mart.AccessTokenInfo
+	err := r.db.QueryRowContext(ctx, txt, args...).Scan(&info.TokenVersion, &info.Revoked)
+	return info, getRepositoryError(err)
+}
+
+func (r PostgresqlGophermartRepository) LoginAttempts(ctx context.Context, keys []string) ([]mart.LoginAttemptInfo, error) {
+	sb := sqlbuilder.Select("key", "failures", "locked_until").From("login_attempt")
+	sb.Where(sb.In("key", sqlbuilder.Flatten(keys)...))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	rows, err := r.db.QueryContext(ctx, txt, args...)
+	if err != nil {
+		return nil, getRepositoryError(err)
+	}
+	defer rows.Close()
+
+	attempts := make([]mart.LoginAttemptInfo, 0, len(keys))
+	for rows.Next() {
+		attempt, err := scanLoginAttempt(rows)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+func (r PostgresqlGophermartRepository) AddLoginFailure(ctx context.Context, dto mart.LoginFailureRequest) (mart.LoginAttemptInfo, error) {
+	//stale counters are not needed anymore
+	del := sqlbuilder.DeleteFrom("login_attempt")
+	del.Where(
+		fmt.Sprintf("updated_at < now() - make_interval(secs => %s)", del.Var(dto.Window.Seconds())),
+		del.Or(del.IsNull("locked_until"), "locked_until < now()"),
+	)
+
+	txt, args := del.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := r.db.ExecContext(ctx, txt, args...); err != nil {
+		return mart.LoginAttemptInfo{}, getRepositoryError(err)
+	}
+
+	sb := sqlbuilder.InsertInto("login_attempt").
+		Cols("key", "failures", "updated_at").
+		Values(dto.Key, 1, sqlbuilder.Raw("now()"))
+	sb.SQL(fmt.Sprintf(`ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN login_attempt.updated_at < now() - make_interval(secs => %s) THEN 1
+			ELSE login_attempt.failures + 1 END,
+		updated_at = EXCLUDED.updated_at`, sb.Var(dto.Window.Seconds())))
+	sb.Returning("key", "failures", "locked_until")
+
+	txt, args = sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	attempt, err := scanLoginAttempt(r.db.QueryRowContext(ctx, txt, args...))
+	return attempt, getRepositoryError(err)
+}
+
+func (r PostgresqlGophermartRepository) LockLogin(ctx context.Context, dto mart.LoginLockRequest) error {
+	sb := sqlbuilder.Update("login_attempt")
+	sb.Set(sb.Equal("locked_until", dto.LockedUntil))
+	sb.Where(sb.Equal("key", dto.Key))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	_, err := r.db.ExecContext(ctx, txt, args...)
+	return getRepositoryError(err)
+}
+
+func (r PostgresqlGophermartRepository) ResetLoginFailures(ctx context.Context, keys []string) error {
+	sb := sqlbuilder.DeleteFrom("login_attempt")
+	sb.Where(sb.In("key", sqlbuilder.Flatten(keys)...))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	_, err := r.db.ExecContext(ctx, txt, args...)
+	return getRepositoryError(err)
+}
+
+func scanLoginAttempt(row interface{ Scan(...any) error }) (mart.LoginAttemptInfo, error) {
+	var (
+		attempt     mart.LoginAttemptInfo
+		lockedUntil sql.NullTime
+	)
+	if err := row.Scan(&attempt.Key, &attempt.Failures, &lockedUntil); err != nil {
+		return mart.LoginAttemptInfo{}, err
+	}
+	attempt.LockedUntil = lockedUntil.Time
+	return attempt, nil
 }
 
 // WithdrawalRepository
+//
+// Expense locks balance row of user, so concurrent withdrawals are checked one by one
 func (r PostgresqlGophermartRepository) Expense(ctx context.Context, dto mart.WithdrawalRequest) error {
-	v := dto.Sum
-	if v > 0 {
-		v = -v
+	sum := dto.Sum.Abs()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := lockBalance(ctx, tx, dto.UserID)
+	if err != nil {
+		return getRepositoryError(err)
+	}
+
+	if current < sum {
+		return mart.ErrNotEnoughPoints
 	}
 
-	sbCh := sqlbuilder.Select("SUM(sum)").From(`"transaction"`).GroupBy("user_id")
-	sbCh.Where(sbCh.Equal("user_id", dto.UserID))
+	if err := addTransaction(ctx, tx, dto.OrderNumber, dto.UserID, false, -sum); err != nil {
+		return err
+	}
 
-	txt1, args1 := sbCh.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if err := addDeliveries(ctx, tx, dto.UserID, mart.Delivery{
+		Event:       mart.WebhookEventWithdrawn,
+		OrderNumber: dto.OrderNumber,
+		Sum:         sum,
+	}); err != nil {
+		return err
+	}
 
-	sbAdd := sqlbuilder.InsertInto(`"transaction"`).
+	sb := sqlbuilder.Update("balance")
+	sb.Set(
+		fmt.Sprintf("current = current - %s", sb.Var(sum)),
+		fmt.Sprintf("withdrawn = withdrawn + %s", sb.Var(sum)),
+	)
+	sb.Where(sb.Equal("user_id", dto.UserID))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return getRepositoryError(err)
+	}
+
+	return tx.Commit()
+}
+
+func (r PostgresqlGophermartRepository) Income(ctx context.Context, dto mart.WithdrawalRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	credited, err := addIncome(ctx, tx, dto.OrderNumber, dto.UserID, dto.Sum.Abs())
+	if err != nil {
+		return err
+	}
+
+	if !credited {
+		return mart.ErrDuplicate
+	}
+
+	return tx.Commit()
+}
+
+// lockBalance returns current balance of user and holds lock of row until the end of transaction
+func lockBalance(ctx context.Context, tx *sql.Tx, userID string) (money.Money, error) {
+	ins := sqlbuilder.InsertInto("balance").Cols("user_id").Values(userID).
+		SQL("ON CONFLICT (user_id) DO NOTHING")
+
+	txt, args := ins.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return 0, err
+	}
+
+	sb := sqlbuilder.Select("current").From("balance").ForUpdate()
+	sb.Where(sb.Equal("user_id", userID))
+
+	txt, args = sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+
+	var current money.Money
+	err := tx.QueryRowContext(ctx, txt, args...).Scan(&current)
+	return current, err
+}
+
+// addIncome credits order once, credited is false if order already has income
+func addIncome(ctx context.Context, tx *sql.Tx, orderNumber, userID string, sum money.Money) (credited bool, err error) {
+	ins := sqlbuilder.InsertInto(`"transaction"`).
 		Cols("order_number", "user_id", "income", "sum", "created_at").
-		Values(dto.OrderNumber, dto.UserID, false, v, sqlbuilder.Raw("now()"))
+		Values(orderNumber, userID, true, sum, sqlbuilder.Raw("now()")).
+		SQL("ON CONFLICT (order_number) WHERE income DO NOTHING")
+
+	txt, args := ins.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	result, err := tx.ExecContext(ctx, txt, args...)
+	if err != nil {
+		return false, getRepositoryError(err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return false, err
+	} else if affected == 0 {
+		return false, nil
+	}
+
+	sb := sqlbuilder.InsertInto("balance").Cols("user_id", "current").Values(userID, sum).
+		SQL("ON CONFLICT (user_id) DO UPDATE SET current = balance.current + EXCLUDED.current")
+
+	txt, args = sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return false, getRepositoryError(err)
+	}
+
+	if err := addDeliveries(ctx, tx, userID, mart.Delivery{
+		Event:       mart.WebhookEventCredited,
+		OrderNumber: orderNumber,
+		Sum:         sum,
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func addTransaction(ctx context.Context, tx *sql.Tx, orderNumber, userID string, income bool, sum money.Money) error {
+	sb := sqlbuilder.InsertInto(`"transaction"`).
+		Cols("order_number", "user_id", "income", "sum", "created_at").
+		Values(orderNumber, userID, income, sum, sqlbuilder.Raw("now()"))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	_, err := tx.ExecContext(ctx, txt, args...)
+	return getRepositoryError(err)
+}
+
+func (r PostgresqlGophermartRepository) Transactions(ctx context.Context, dto mart.TransactionRequest) ([]mart.Transaction, error) {
+	sb := sqlbuilder.Select("id", "order_number", "user_id", "income", "sum", "created_at").
+		From(`"transaction"`)
+	sb.Where(sb.Equal("user_id", dto.UserID))
+
+	switch dto.Kind {
+	case mart.TransactionIncome:
+		sb.Where("income")
+	case mart.TransactionExpense:
+		sb.Where("NOT income")
+	}
+
+	page(sb, dto.From, dto.To, dto.After, dto.Descending, dto.Limit)
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	rows, err := r.db.QueryContext(ctx, txt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions, err := scanTransactions(rows)
+
+	return transactions, getRepositoryError(err)
+}
+
+func scanTransactions(rows *sql.Rows) ([]mart.Transaction, error) {
+	transactions := make([]mart.Transaction, 0)
+	for rows.Next() {
+		transaction := mart.Transaction{}
+		if err := rows.Scan(&transaction.ID, &transaction.OrderNumber, &transaction.UserID, &transaction.Income,
+			&transaction.Sum, &transaction.CreatedAt); err != nil {
+
+			return nil, getRepositoryError(err)
+		}
+		transactions = append(transactions, transaction)
+	}
+	return transactions, rows.Err()
+}
+
+// OrderRepository
+func (r PostgresqlGophermartRepository) Create(ctx context.Context, dto mart.OrderCreateRequest) error {
+	//delay is number, so it is formatted into query instead of argument which is not ordered with values
+	nextCheck := fmt.Sprintf("now() + make_interval(secs => %s)", strconv.FormatFloat(dto.CheckAfter.Seconds(), 'f', -1, 64))
+	sb := sqlbuilder.InsertInto(`"order"`).
+		Cols("number", "user_id", "created_at", "updated_at", "status", "sum", "next_check_at").
+		Values(dto.Number, dto.UserID, sqlbuilder.Raw("now()"), sqlbuilder.Raw("now()"), mart.StatusNew, money.Money(0), sqlbuilder.Raw(nextCheck))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	_, err := r.db.ExecContext(ctx, txt, args...)
+	return getRepositoryError(err)
+}
+
+func (r PostgresqlGophermartRepository) Update(ctx context.Context, dto mart.OrderUpdateRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := updateOrder(ctx, tx, dto); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r PostgresqlGophermartRepository) UpdateWithIncome(ctx context.Context, dto mart.OrderUpdateRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	changed, err := updateOrder(ctx, tx, dto)
+	if err != nil {
+		return err
+	}
+
+	//order in final status is not changed, so it is credited only when it really becomes processed.
+	//Order which was credited earlier is only updated
+	if changed && dto.Status == mart.StatusProcessed {
+		if _, err := addIncome(ctx, tx, dto.Number, dto.UserID, dto.Accrual.Abs()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
 
-	txt2, args2 := sbAdd.BuildWithFlavor(sqlbuilder.PostgreSQL)
+// updateOrder changes status and accrual of order and logs event if they are changed really, changed reports about it
+func updateOrder(ctx context.Context, tx *sql.Tx, dto mart.OrderUpdateRequest) (changed bool, err error) {
+	txt, args := updateOrderQuery(dto)
 
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
+	var userID string
+	err = tx.QueryRowContext(ctx, txt, args...).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, getRepositoryError(err)
 	}
-	defer tx.Rollback()
 
-	row := tx.QueryRowContext(ctx, txt1, args1...)
+	return true, addOrderEvent(ctx, tx, userID, dto)
+}
 
-	var sum float64
-	if err := row.Scan(&sum); err == nil && sum < dto.Sum {
-		return mart.ErrNotEnoughPoints
-	} else if err == sql.ErrNoRows {
-		return mart.ErrNotEnoughPoints
-	} else if err != nil {
+func addOrderEvent(ctx context.Context, tx *sql.Tx, userID string, dto mart.OrderUpdateRequest) error {
+	//old events of user are not needed anymore
+	del := sqlbuilder.DeleteFrom("order_event")
+	del.Where(
+		del.Equal("user_id", userID),
+		fmt.Sprintf("created_at < now() - make_interval(secs => %s)", del.Var(orderEventRetention.Seconds())),
+	)
+
+	txt, args := del.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
 		return getRepositoryError(err)
 	}
 
-	if _, err := tx.ExecContext(ctx, txt2, args2...); err != nil {
+	sb := sqlbuilder.InsertInto("order_event").
+		Cols("user_id", "order_number", "status", "sum", "created_at").
+		Values(userID, dto.Number, dto.Status, dto.Accrual, sqlbuilder.Raw("now()"))
+
+	txt, args = sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
 		return getRepositoryError(err)
 	}
 
-	return tx.Commit()
+	return addDeliveries(ctx, tx, userID, mart.Delivery{
+		Event:       mart.WebhookEventOrderUpdated,
+		OrderNumber: dto.Number,
+		Status:      dto.Status,
+		Sum:         dto.Accrual,
+	})
 }
 
-func (r PostgresqlGophermartRepository) Income(ctx context.Context, dto mart.WithdrawalRequest) error {
-	v := dto.Sum
-	if v < 0 {
-		v = -v
-	}
-	sbAdd := sqlbuilder.InsertInto(`"transaction"`).
-		Cols("order_number", "user_id", "income", "sum", "created_at").
-		Values(dto.OrderNumber, dto.UserID, true, v, sqlbuilder.Raw("now()"))
+func (r PostgresqlGophermartRepository) OrderEvents(ctx context.Context, dto mart.OrderEventRequest) ([]mart.OrderEvent, error) {
+	sb := sqlbuilder.Select("id", "user_id", "order_number", "status", "sum", "created_at").
+		From("order_event")
+	sb.Where(
+		sb.Equal("user_id", dto.UserID),
+		sb.GreaterThan("id", dto.AfterID),
+	)
+	sb.OrderBy("id").Asc()
 
-	txt, args := sbAdd.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if dto.Limit > 0 {
+		sb.Limit(dto.Limit)
+	}
 
-	_, err := r.db.ExecContext(ctx, txt, args...)
-	return getRepositoryError(err)
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	rows, err := r.db.QueryContext(ctx, txt, args...)
+	if err != nil {
+		return nil, getRepositoryError(err)
+	}
+	defer rows.Close()
 
+	events := make([]mart.OrderEvent, 0)
+	for rows.Next() {
+		event := mart.OrderEvent{}
+		if err := rows.Scan(&event.ID, &event.UserID, &event.Number, &event.Status, &event.Accrual, &event.CreatedAt); err != nil {
+			return nil, getRepositoryError(err)
+		}
+		events = append(events, event)
+	}
+	return events, getRepositoryError(rows.Err())
 }
 
-func (r PostgresqlGophermartRepository) Transactions(ctx context.Context, dto mart.TransactionRequest) ([]mart.Transaction, error) {
-	sb := sqlbuilder.Select("order_number", "user_id", "income", "sum", "created_at").
-		From(`"transaction"`)
-	sb.Where(sb.Equal("user_id", dto.UserID))
+func (r PostgresqlGophermartRepository) ClaimOrders(ctx context.Context, dto mart.OrderClaimRequest) ([]mart.OrderInfo, error) {
+	due := sqlbuilder.Select("id").From(`"order"`)
+	due.Where(due.In("status", mart.StatusNew, mart.StatusProcessing), "next_check_at <= now()")
+	due.OrderBy("next_check_at").Asc()
+	due.Limit(dto.Limit)
+	due.SQL("FOR UPDATE SKIP LOCKED")
+
+	sb := sqlbuilder.Update(`"order"`)
+	sb.Set(
+		fmt.Sprintf("next_check_at = now() + make_interval(secs => %s)", sb.Var(dto.Lease.Seconds())),
+		sb.Equal("lease_owner", dto.Owner),
+	)
+	sb.Where(sb.In("id", due))
+	sb.SQL("RETURNING " + strings.Join(orderColumns, ", "))
 
 	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
 	rows, err := r.db.QueryContext(ctx, txt, args...)
 	if err != nil {
-		return nil, err
+		return nil, getRepositoryError(err)
 	}
 	defer rows.Close()
 
-	transactions, err := scanTransactions(rows)
-
-	return transactions, getRepositoryError(err)
+	orders, err := scanAsOrdersInfo(rows)
+	return orders, getRepositoryError(err)
 }
 
-func scanTransactions(rows *sql.Rows) ([]mart.Transaction, error) {
-	transactions := make([]mart.Transaction, 0)
-	for rows.Next() {
-		transaction := mart.Transaction{}
-		if err := rows.Scan(&transaction.OrderNumber, &transaction.UserID, &transaction.Income,
-			&transaction.Sum, &transaction.CreatedAt); err != nil {
+func (r PostgresqlGophermartRepository) AddAttempt(ctx context.Context, dto mart.OrderAttemptRequest) error {
+	var lastError any
+	if dto.Error != "" {
+		lastError = dto.Error
+	}
 
-			return nil, getRepositoryError(err)
-		}
-		transactions = append(transactions, transaction)
+	sb := sqlbuilder.Update(`"order"`)
+	sb.Set(
+		"attempts = attempts + 1",
+		"checked_at = now()",
+		fmt.Sprintf("next_check_at = now() + make_interval(secs => %s)", sb.Var(dto.RetryAfter.Seconds())),
+		sb.Equal("last_error", lastError),
+		"lease_owner = NULL",
+	)
+	if dto.NotFound {
+		sb.SetMore("not_found_attempts = not_found_attempts + 1")
 	}
-	return transactions, rows.Err()
+	sb.Where(sb.Equal("number", dto.Number))
+	if dto.Owner != "" {
+		sb.Where(sb.Equal("lease_owner", dto.Owner))
+	}
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	return r.execLeased(ctx, txt, args)
 }
 
-// OrderRepository
-func (r PostgresqlGophermartRepository) Create(ctx context.Context, dto mart.OrderCreateRequest) error {
-	sb := sqlbuilder.InsertInto(`"order"`).
-		Cols("number", "user_id", "created_at", "status", "sum").
-		Values(dto.Number, dto.UserID, sqlbuilder.Raw("now()"), mart.StatusNew, 0)
+func (r PostgresqlGophermartRepository) ExtendLease(ctx context.Context, dto mart.OrderLeaseRequest) error {
+	sb := sqlbuilder.Update(`"order"`)
+	sb.Set(fmt.Sprintf("next_check_at = now() + make_interval(secs => %s)", sb.Var(dto.Lease.Seconds())))
+	sb.Where(
+		sb.Equal("number", dto.Number),
+		sb.Equal("lease_owner", dto.Owner),
+	)
 
 	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
-	_, err := r.db.ExecContext(ctx, txt, args...)
-	return getRepositoryError(err)
+	return r.execLeased(ctx, txt, args)
 }
 
-func (r PostgresqlGophermartRepository) Update(ctx context.Context, dto mart.OrderUpdateRequest) error {
+// execLeased executes update of leased order, lease is lost if order is not updated
+func (r PostgresqlGophermartRepository) execLeased(ctx context.Context, txt string, args []any) error {
+	result, err := r.db.ExecContext(ctx, txt, args...)
+	if err != nil {
+		return getRepositoryError(err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return mart.ErrEmptyResult
+	}
+	return nil
+}
+
+func updateOrderQuery(dto mart.OrderUpdateRequest) (string, []any) {
 	sb := sqlbuilder.Update(`"order"`)
 	sb.Set(
 		sb.Equal("status", dto.Status),
 		sb.Equal("sum", dto.Accrual),
+		"updated_at = now()",
 	)
 
-	sb.Where(sb.Equal("number", dto.Number))
+	//order is not touched when status and accrual are the same. Final status is not changed,
+	//e.g. by check which was in flight when accrual service pushed result
+	sb.Where(
+		sb.Equal("number", dto.Number),
+		sb.Or(sb.NotEqual("status", dto.Status), sb.NotEqual("sum", dto.Accrual)),
+		sb.NotIn("status", mart.StatusProcessed, mart.StatusInvalid),
+	)
+	sb.SQL("RETURNING user_id")
 
-	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
-	_, err := r.db.ExecContext(ctx, txt, args...)
-	return getRepositoryError(err)
+	return sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
 }
 
 func (r PostgresqlGophermartRepository) List(ctx context.Context, dto mart.OrderListRequest) ([]mart.OrderInfo, error) {
-	sp := sqlbuilder.
-		Select("user_id", "number", "created_at", "status", "sum").
-		From(`"order"`)
+	sp := sqlbuilder.Select(orderColumns...).From(`"order"`)
 
 	if len(dto.OrderNumber) > 0 {
 		sp.Where(sp.Equal("number", dto.OrderNumber))
@@ -197,9 +867,7 @@ func (r PostgresqlGophermartRepository) List(ctx context.Context, dto mart.Order
 		sp.Where(sp.Any("status", "=", dto.Status))
 	}
 
-	if dto.Limit > 0 {
-		sp.Limit(dto.Limit)
-	}
+	page(sp, dto.From, dto.To, dto.After, dto.Descending, dto.Limit)
 
 	txt, args := sp.BuildWithFlavor(sqlbuilder.PostgreSQL)
 	rows, err := r.db.QueryContext(ctx, txt, args...)
@@ -218,19 +886,397 @@ func (r PostgresqlGophermartRepository) List(ctx context.Context, dto mart.Order
 	return orders, getRepositoryError(err)
 }
 
+// page bounds rows by created_at in [from, to) and returns them ordered by created_at and id
+// after cursor, zero values are not bounded
+func page(sb *sqlbuilder.SelectBuilder, from, to time.Time, after cursor.Cursor, desc bool, limit int) {
+	if !from.IsZero() {
+		sb.Where(sb.GreaterEqualThan("created_at", from))
+	}
+
+	if !to.IsZero() {
+		sb.Where(sb.LessThan("created_at", to))
+	}
+
+	op, dir := ">", "ASC"
+	if desc {
+		op, dir = "<", "DESC"
+	}
+
+	if !after.IsZero() {
+		sb.Where(fmt.Sprintf("(created_at, id) %s (%s, %s)", op, sb.Var(after.CreatedAt), sb.Var(after.ID)))
+	}
+
+	//direction of each column, Desc() of builder is applied only to the last one
+	sb.OrderBy("created_at "+dir, "id "+dir)
+
+	if limit > 0 {
+		sb.Limit(limit)
+	}
+}
+
+// orderColumns are read by scanAsOrdersInfo
+var orderColumns = []string{
+	"id", "user_id", "number", "created_at", "status", "sum", "updated_at", "attempts", "checked_at",
+	"next_check_at", "last_error", "not_found_attempts",
+}
+
 func scanAsOrdersInfo(rows *sql.Rows) ([]mart.OrderInfo, error) {
 	orders := make([]mart.OrderInfo, 0)
 	for rows.Next() {
 		order := mart.OrderInfo{}
-		err := rows.Scan(&order.UserID, &order.Number, &order.CreatedAt, &order.Status, &order.Accrual)
+		checkedAt, lastError := sql.NullTime{}, sql.NullString{}
+		err := rows.Scan(&order.ID, &order.UserID, &order.Number, &order.CreatedAt, &order.Status, &order.Accrual,
+			&order.UpdatedAt, &order.Attempts, &checkedAt, &order.NextCheckAt, &lastError,
+			&order.NotFoundAttempts)
 		if err != nil {
 			return nil, err
 		}
+		order.CheckedAt = checkedAt.Time
+		order.LastError = lastError.String
 		orders = append(orders, order)
 	}
 	return orders, rows.Err()
 }
 
+// WebhookRepository
+func (r PostgresqlGophermartRepository) AddWebhook(ctx context.Context, dto mart.WebhookRequest) (mart.WebhookInfo, error) {
+	sb := sqlbuilder.InsertInto("webhook").
+		Cols("id", "user_id", "url", "secret", "created_at").
+		Values(sqlbuilder.Raw("gen_random_uuid()"), dto.UserID, dto.URL, dto.Secret, sqlbuilder.Raw("now()"))
+	sb.Returning("id", "user_id", "url", "secret", "created_at")
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+
+	webhook := mart.WebhookInfo{}
+	err := r.db.QueryRowContext(ctx, txt, args...).
+		Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.Secret, &webhook.CreatedAt)
+	return webhook, getRepositoryError(err)
+}
+
+func (r PostgresqlGophermartRepository) Webhooks(ctx context.Context, userID string) ([]mart.WebhookInfo, error) {
+	sb := sqlbuilder.Select("id", "user_id", "url", "secret", "created_at").From("webhook")
+	sb.Where(sb.Equal("user_id", userID))
+	sb.OrderBy("created_at").Asc()
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	rows, err := r.db.QueryContext(ctx, txt, args...)
+	if err != nil {
+		return nil, getRepositoryError(err)
+	}
+	defer rows.Close()
+
+	webhooks := make([]mart.WebhookInfo, 0)
+	for rows.Next() {
+		webhook := mart.WebhookInfo{}
+		if err := rows.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.Secret, &webhook.CreatedAt); err != nil {
+			return nil, getRepositoryError(err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, getRepositoryError(rows.Err())
+}
+
+func (r PostgresqlGophermartRepository) DeleteWebhook(ctx context.Context, dto mart.WebhookFilter) error {
+	sb := sqlbuilder.DeleteFrom("webhook")
+	sb.Where(sb.Equal("id", dto.ID), sb.Equal("user_id", dto.UserID))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	result, err := r.db.ExecContext(ctx, txt, args...)
+	if err != nil {
+		return getRepositoryError(err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return mart.ErrEmptyResult
+	}
+	return nil
+}
+
+func (r PostgresqlGophermartRepository) Deliveries(ctx context.Context, dto mart.DeliveryListRequest) ([]mart.Delivery, error) {
+	check := sqlbuilder.Select("1").From("webhook")
+	check.Where(check.Equal("id", dto.WebhookID), check.Equal("user_id", dto.UserID))
+
+	txt, args := check.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	var exists int
+	if err := r.db.QueryRowContext(ctx, txt, args...).Scan(&exists); err != nil {
+		return nil, getRepositoryError(err)
+	}
+
+	sb := sqlbuilder.Select(deliveryColumns...).From("webhook_delivery d")
+	sb.Join("webhook w", "w.id = d.webhook_id")
+	sb.Where(sb.Equal("d.webhook_id", dto.WebhookID))
+	sb.OrderBy("d.id").Desc()
+	if dto.Limit > 0 {
+		sb.Limit(dto.Limit)
+	}
+
+	txt, args = sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	deliveries, err := r.queryDeliveries(ctx, txt, args)
+	if err != nil || len(deliveries) == 0 {
+		return deliveries, err
+	}
+
+	ids := make([]int64, len(deliveries))
+	index := make(map[int64]int, len(deliveries))
+	for i, delivery := range deliveries {
+		ids[i] = delivery.ID
+		index[delivery.ID] = i
+	}
+
+	at := sqlbuilder.Select("delivery_id", "status_code", "error", "duration_ms", "created_at").From("webhook_attempt")
+	at.Where(at.Any("delivery_id", "=", ids))
+	at.OrderBy("id").Asc()
+
+	txt, args = at.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	rows, err := r.db.QueryContext(ctx, txt, args...)
+	if err != nil {
+		return nil, getRepositoryError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			deliveryID int64
+			statusCode sql.NullInt64
+			message    sql.NullString
+			duration   int64
+			attempt    mart.DeliveryAttempt
+		)
+		if err := rows.Scan(&deliveryID, &statusCode, &message, &duration, &attempt.CreatedAt); err != nil {
+			return nil, getRepositoryError(err)
+		}
+		attempt.StatusCode = int(statusCode.Int64)
+		attempt.Error = message.String
+		attempt.Duration = time.Duration(duration) * time.Millisecond
+
+		i := index[deliveryID]
+		deliveries[i].Attempts = append(deliveries[i].Attempts, attempt)
+	}
+	return deliveries, getRepositoryError(rows.Err())
+}
+
+// ClaimDeliveries locks due deliveries with SKIP LOCKED, so concurrent workers get different rows
+func (r PostgresqlGophermartRepository) ClaimDeliveries(ctx context.Context, dto mart.DeliveryClaimRequest) ([]mart.Delivery, error) {
+	due := sqlbuilder.Select("id").From("webhook_delivery")
+	due.Where(due.Equal("state", mart.DeliveryPending), "next_attempt_at <= now()")
+	due.OrderBy("next_attempt_at").Asc()
+	due.Limit(dto.Limit)
+	due.SQL("FOR UPDATE SKIP LOCKED")
+
+	sb := sqlbuilder.Update("webhook_delivery d")
+	sb.Set(fmt.Sprintf("next_attempt_at = now() + make_interval(secs => %s)", sb.Var(dto.Lease.Seconds())))
+	sb.SQL("FROM webhook w")
+	sb.Where(
+		"w.id = d.webhook_id",
+		sb.In("d.id", due),
+	)
+	sb.SQL("RETURNING " + strings.Join(deliveryColumns, ", "))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	return r.queryDeliveries(ctx, txt, args)
+}
+
+func (r PostgresqlGophermartRepository) SaveDeliveryResult(ctx context.Context, dto mart.DeliveryResultRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var statusCode, message any
+	if dto.Attempt.StatusCode != 0 {
+		statusCode = dto.Attempt.StatusCode
+	}
+	if dto.Attempt.Error != "" {
+		message = dto.Attempt.Error
+	}
+
+	ins := sqlbuilder.InsertInto("webhook_attempt").
+		Cols("delivery_id", "status_code", "error", "duration_ms", "created_at").
+		Values(dto.DeliveryID, statusCode, message, dto.Attempt.Duration.Milliseconds(), sqlbuilder.Raw("now()"))
+
+	txt, args := ins.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return getRepositoryError(err)
+	}
+
+	sb := sqlbuilder.Update("webhook_delivery")
+	sb.Set(
+		sb.Equal("state", dto.State),
+		sb.Equal("failures", dto.Failures),
+		sb.Equal("next_attempt_at", dto.NextAttemptAt),
+	)
+	if dto.State == mart.DeliveryDelivered {
+		sb.SetMore("delivered_at = now()")
+	}
+	sb.Where(sb.Equal("id", dto.DeliveryID))
+
+	txt, args = sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	if _, err := tx.ExecContext(ctx, txt, args...); err != nil {
+		return getRepositoryError(err)
+	}
+
+	return tx.Commit()
+}
+
+func (r PostgresqlGophermartRepository) Redeliver(ctx context.Context, dto mart.RedeliveryRequest) error {
+	sb := sqlbuilder.Update("webhook_delivery d")
+	sb.Set(
+		sb.Equal("state", mart.DeliveryPending),
+		sb.Equal("failures", 0),
+		"next_attempt_at = now()",
+	)
+	sb.SQL("FROM webhook w")
+	sb.Where(
+		"w.id = d.webhook_id",
+		sb.Equal("d.id", dto.DeliveryID),
+		sb.Equal("w.user_id", dto.UserID),
+	)
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	result, err := r.db.ExecContext(ctx, txt, args...)
+	if err != nil {
+		return getRepositoryError(err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return mart.ErrEmptyResult
+	}
+	return nil
+}
+
+// deliveryColumns are read by queryDeliveries, d is webhook_delivery and w is webhook
+var deliveryColumns = []string{
+	"d.id", "d.webhook_id", "w.url", "w.secret", "d.event", "d.order_number", "d.status", "d.sum",
+	"d.occurred_at", "d.state", "d.failures", "d.next_attempt_at", "d.delivered_at",
+}
+
+func (r PostgresqlGophermartRepository) queryDeliveries(ctx context.Context, txt string, args []any) ([]mart.Delivery, error) {
+	rows, err := r.db.QueryContext(ctx, txt, args...)
+	if err != nil {
+		return nil, getRepositoryError(err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]mart.Delivery, 0)
+	for rows.Next() {
+		var (
+			delivery    mart.Delivery
+			status      sql.NullInt64
+			deliveredAt sql.NullTime
+		)
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.URL, &delivery.Secret, &delivery.Event,
+			&delivery.OrderNumber, &status, &delivery.Sum, &delivery.OccurredAt, &delivery.State, &delivery.Failures,
+			&delivery.NextAttemptAt, &deliveredAt); err != nil {
+
+			return nil, getRepositoryError(err)
+		}
+		delivery.Status = int(status.Int64)
+		delivery.DeliveredAt = deliveredAt.Time
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, getRepositoryError(rows.Err())
+}
+
+// addDeliveries adds delivery of event to each webhook of user, it is called in transaction of the event
+func addDeliveries(ctx context.Context, tx *sql.Tx, userID string, event mart.Delivery) error {
+	var status any
+	if event.Status != 0 {
+		status = event.Status
+	}
+
+	b := sqlbuilder.Buildf(`INSERT INTO webhook_delivery
+		(webhook_id, event, order_number, status, sum, occurred_at, state, next_attempt_at)
+		SELECT id, %v, %v, %v, %v, now(), %v, now() FROM webhook WHERE user_id = %v`,
+		event.Event, event.OrderNumber, status, event.Sum, mart.DeliveryPending, userID)
+
+	txt, args := b.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	_, err := tx.ExecContext(ctx, txt, args...)
+	return getRepositoryError(err)
+}
+
+// IdempotencyRepository
+func (r PostgresqlGophermartRepository) ReserveKey(ctx context.Context, dto mart.IdempotencyKeyRequest) error {
+	sb := sqlbuilder.InsertInto("idempotency_key").
+		Cols("user_id", "key", "fingerprint", "created_at").
+		Values(dto.UserID, dto.Key, dto.Fingerprint, sqlbuilder.Raw("now()"))
+	sb.SQL(fmt.Sprintf(`ON CONFLICT (user_id, key) DO UPDATE SET
+		fingerprint = EXCLUDED.fingerprint,
+		status_code = NULL,
+		content_type = NULL,
+		body = NULL,
+		created_at = EXCLUDED.created_at
+		WHERE idempotency_key.created_at < now() - make_interval(secs => %s)
+		OR (idempotency_key.status_code IS NULL AND idempotency_key.created_at < now() - make_interval(secs => %s))`,
+		sb.Var(dto.TTL.Seconds()), sb.Var(dto.ProcessingTimeout.Seconds())))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	result, err := r.db.ExecContext(ctx, txt, args...)
+	if err != nil {
+		return getRepositoryError(err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return mart.ErrDuplicate
+	}
+	return nil
+}
+
+func (r PostgresqlGophermartRepository) Key(ctx context.Context, dto mart.IdempotencyKeyFilter) (mart.IdempotencyKeyInfo, error) {
+	sb := sqlbuilder.Select("user_id", "key", "fingerprint", "status_code", "content_type", "body", "created_at").
+		From("idempotency_key")
+	sb.Where(sb.Equal("user_id", dto.UserID), sb.Equal("key", dto.Key))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	row := r.db.QueryRowContext(ctx, txt, args...)
+
+	var (
+		info        mart.IdempotencyKeyInfo
+		statusCode  sql.NullInt32
+		contentType sql.NullString
+	)
+
+	err := row.Scan(&info.UserID, &info.Key, &info.Fingerprint, &statusCode, &contentType, &info.Body, &info.CreatedAt)
+	if err != nil {
+		return mart.IdempotencyKeyInfo{}, getRepositoryError(err)
+	}
+
+	info.Completed = statusCode.Valid
+	info.StatusCode = int(statusCode.Int32)
+	info.ContentType = contentType.String
+
+	return info, nil
+}
+
+func (r PostgresqlGophermartRepository) SaveResponse(ctx context.Context, dto mart.IdempotencyResponseRequest) error {
+	sb := sqlbuilder.Update("idempotency_key")
+	sb.Set(
+		sb.Equal("status_code", dto.StatusCode),
+		sb.Equal("content_type", dto.ContentType),
+		sb.Equal("body", dto.Body),
+	)
+	sb.Where(sb.Equal("user_id", dto.UserID), sb.Equal("key", dto.Key))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	_, err := r.db.ExecContext(ctx, txt, args...)
+	return getRepositoryError(err)
+}
+
+func (r PostgresqlGophermartRepository) DeleteKey(ctx context.Context, dto mart.IdempotencyKeyFilter) error {
+	sb := sqlbuilder.DeleteFrom("idempotency_key")
+	sb.Where(sb.Equal("user_id", dto.UserID), sb.Equal("key", dto.Key))
+
+	txt, args := sb.BuildWithFlavor(sqlbuilder.PostgreSQL)
+	_, err := r.db.ExecContext(ctx, txt, args...)
+	return getRepositoryError(err)
+}
+
 func getRepositoryError(err error) error {
 	if err == nil {
 		return err
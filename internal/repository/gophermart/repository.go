@@ -13,6 +13,27 @@ type AuthorizationRepository interface {
 	AddUser(context.Context, AuthData) (UserInfo, error)
 	CheckUser(context.Context, AuthData) (UserInfo, error)
 	CheckUserByID(context.Context, string) (UserInfo, error)
+	//replaces password hash if it is still equal to old one, otherwise returns ErrEmptyResult
+	UpdatePassword(context.Context, PasswordUpdateRequest) error
+	//anonymizes user and forfeits its balance. Returns ErrEmptyResult if user does not exist or was deleted
+	DeleteUser(context.Context, string) (DeletedUserInfo, error)
+	AddRefreshToken(context.Context, RefreshTokenRequest) error
+	//marks unused refresh token as used and adds its successor. Token which was rotated during grace window
+	//returns successor issued for it as Reused, Revoked of result is true if token was used or revoked before.
+	//returns ErrEmptyResult if token does not exist or successor of reused token is not valid anymore
+	UseRefreshToken(context.Context, RefreshTokenUsing) (RefreshTokenInfo, error)
+	//revokes access token until it expires and refresh token issued together with it
+	RevokeSession(context.Context, AccessTokenRequest) error
+	//invalidates all access and refresh tokens of user
+	RevokeUserTokens(context.Context, string) error
+	//returns ErrEmptyResult if user does not exist
+	CheckAccessToken(context.Context, AccessTokenRequest) (AccessTokenInfo, error)
+	//returns state of failed logins by keys, keys without failures are skipped
+	LoginAttempts(context.Context, []string) ([]LoginAttemptInfo, error)
+	//increments failures of key, counter starts again when last failure is older than window
+	AddLoginFailure(context.Context, LoginFailureRequest) (LoginAttemptInfo, error)
+	LockLogin(context.Context, LoginLockRequest) error
+	ResetLoginFailures(context.Context, []string) error
 }
 
 type WithdrawalRepository interface {
@@ -23,10 +44,50 @@ type WithdrawalRepository interface {
 
 type OrderRepository interface {
 	Create(context.Context, OrderCreateRequest) error
+	//orders with final status PROCESSED or INVALID are not changed
 	Update(context.Context, OrderUpdateRequest) error
+	//updates order and posts income of its accrual in one transaction, order is credited at most once
+	UpdateWithIncome(context.Context, OrderUpdateRequest) error
 	List(context.Context, OrderListRequest) ([]OrderInfo, error)
+	//returns NEW and PROCESSING orders which are due to be checked in accrual service and postpones
+	//their next check by lease, so orders are not claimed by another instance during processing
+	ClaimOrders(context.Context, OrderClaimRequest) ([]OrderInfo, error)
+	//prolongs lease of claimed order, returns ErrEmptyResult if lease was lost
+	ExtendLease(context.Context, OrderLeaseRequest) error
+	//counts request to accrual service about order, schedules its next check and releases lease,
+	//returns ErrEmptyResult if lease was lost
+	AddAttempt(context.Context, OrderAttemptRequest) error
+	//returns events which are logged by Update and UpdateWithIncome when status or accrual of order is changed
+	OrderEvents(context.Context, OrderEventRequest) ([]OrderEvent, error)
+}
+
+// WebhookRepository keeps webhooks and their deliveries. Deliveries are added by Income, Expense,
+// UpdateWithIncome and by changes of orders in the same transaction
+type WebhookRepository interface {
+	AddWebhook(context.Context, WebhookRequest) (WebhookInfo, error)
+	Webhooks(context.Context, string) ([]WebhookInfo, error)
+	//returns ErrEmptyResult if webhook of user does not exist
+	DeleteWebhook(context.Context, WebhookFilter) error
+	//returns the last deliveries with their attempts, ErrEmptyResult if webhook of user does not exist
+	Deliveries(context.Context, DeliveryListRequest) ([]Delivery, error)
+	//returns pending deliveries which are due and postpones them by lease
+	ClaimDeliveries(context.Context, DeliveryClaimRequest) ([]Delivery, error)
+	SaveDeliveryResult(context.Context, DeliveryResultRequest) error
+	//returns delivery to pending state, ErrEmptyResult if delivery of user does not exist
+	Redeliver(context.Context, RedeliveryRequest) error
+}
+
+type IdempotencyRepository interface {
+	//returns ErrDuplicate if key is reserved and does not expire
+	ReserveKey(context.Context, IdempotencyKeyRequest) error
+	//returns ErrEmptyResult if key does not exist
+	Key(context.Context, IdempotencyKeyFilter) (IdempotencyKeyInfo, error)
+	SaveResponse(context.Context, IdempotencyResponseRequest) error
+	DeleteKey(context.Context, IdempotencyKeyFilter) error
 }
 
 type AccrualRepository interface {
 	AccrualByOrder(context.Context, AccrualRequest) (AccrualInfo, error)
+	//returns information about known orders of batch, service.ErrNotSupported if accrual service does not have batch lookup
+	AccrualByOrders(context.Context, AccrualBatchRequest) ([]AccrualInfo, error)
 }
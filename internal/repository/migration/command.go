@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/vilasle/gophermart/internal/logger"
+)
+
+var ErrUnknownCommand = errors.New("unknown migrate command, expected up, down [steps] or version")
+
+// Run executes arguments of migrate subcommand: up, down [steps], version
+func Run(ctx context.Context, m *Migrator, args []string) error {
+	if len(args) == 0 {
+		return ErrUnknownCommand
+	}
+
+	switch args[0] {
+	case "up":
+		if err := m.Up(ctx); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			v, err := strconv.Atoi(args[1])
+			if err != nil || v <= 0 {
+				return fmt.Errorf("%w: steps must be positive number", ErrUnknownCommand)
+			}
+			steps = v
+		}
+		if err := m.Down(ctx, steps); err != nil {
+			return err
+		}
+	case "version":
+	default:
+		return ErrUnknownCommand
+	}
+
+	v, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info("schema version", "component", m.component, "version", v)
+	return nil
+}
@@ -0,0 +1,264 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vilasle/gophermart/internal/logger"
+)
+
+// lockKey is shared by all components, because they can create schema_migrations at the same time
+const lockKey int64 = 0x6d69677261746531
+
+var ErrInvalidMigration = errors.New("invalid migration")
+var ErrUnknownVersion = errors.New("database has unknown migration version")
+
+// Migration is a numbered pair of scripts, Down can be empty if migration is irreversible
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator applies migrations of one component, several components can share one database
+// because schema_migrations contains name of component
+type Migrator struct {
+	db         *sql.DB
+	component  string
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, component string, migrations []Migration) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &Migrator{db: db, component: component, migrations: sorted}
+}
+
+// Load reads migrations from files like 0001_create_tables.up.sql and 0001_create_tables.down.sql
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		version, name, direction, err := parseFileName(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("%w: version %d has different names %s and %s", ErrInvalidMigration, version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%w: version %d does not have up script", ErrInvalidMigration, m.Version)
+		}
+		result = append(result, *m)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return result, nil
+}
+
+func parseFileName(name string) (version int64, title string, direction string, err error) {
+	base := strings.TrimSuffix(name, ".sql")
+
+	switch {
+	case strings.HasSuffix(base, ".up"):
+		direction, base = "up", strings.TrimSuffix(base, ".up")
+	case strings.HasSuffix(base, ".down"):
+		direction, base = "down", strings.TrimSuffix(base, ".down")
+	default:
+		return 0, "", "", fmt.Errorf("%w: %s must end with .up.sql or .down.sql", ErrInvalidMigration, name)
+	}
+
+	number, title, _ := strings.Cut(base, "_")
+	version, err = strconv.ParseInt(number, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, "", "", fmt.Errorf("%w: %s must start with positive number", ErrInvalidMigration, name)
+	}
+	return version, title, direction, nil
+}
+
+// Up applies all not applied migrations
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mg := range m.migrations {
+			if mg.Version <= current {
+				continue
+			}
+			if err := m.apply(ctx, conn, mg, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down rolls back last steps migrations
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		for i := 0; i < steps; i++ {
+			current, err := m.version(ctx, conn)
+			if err != nil {
+				return err
+			}
+			if current == 0 {
+				return nil
+			}
+
+			mg, ok := m.find(current)
+			if !ok {
+				return fmt.Errorf("%w: %d", ErrUnknownVersion, current)
+			}
+			if mg.Down == "" {
+				return fmt.Errorf("%w: version %d can not be rolled back", ErrInvalidMigration, mg.Version)
+			}
+
+			if err := m.apply(ctx, conn, mg, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Version returns last applied version, 0 means that nothing was applied
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var v int64
+	err := m.withLock(ctx, func(conn *sql.Conn) (err error) {
+		v, err = m.version(ctx, conn)
+		return err
+	})
+	return v, err
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, mg := range m.migrations {
+		if mg.Version == version {
+			return mg, true
+		}
+	}
+	return Migration{}, false
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mg Migration, up bool) error {
+	log := logger.With("component", "migrator", "service", m.component, "version", mg.Version, "name", mg.Name, "up", up)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := mg.Up
+	if !up {
+		script = mg.Down
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		log.Error("migration failed", "error", err)
+		return fmt.Errorf("migration %d_%s: %w", mg.Version, mg.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (component, version, name, applied_at) VALUES ($1, $2, $3, now())`,
+			m.component, mg.Version, mg.Name)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			`DELETE FROM schema_migrations WHERE component = $1 AND version = $2`,
+			m.component, mg.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Info("migration was applied")
+	return nil
+}
+
+func (m *Migrator) version(ctx context.Context, conn *sql.Conn) (int64, error) {
+	row := conn.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM schema_migrations WHERE component = $1`, m.component)
+
+	var v int64
+	err := row.Scan(&v)
+	return v, err
+}
+
+// withLock runs fn on one connection holding advisory lock, so two instances do not migrate concurrently
+func (m *Migrator) withLock(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			component VARCHAR(64) NOT NULL,
+			version BIGINT NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (component, version)
+		);
+	`); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
@@ -0,0 +1,85 @@
+package migration
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []Migration
+		wantErr error
+	}{
+		{
+			name: "sorted by version",
+			fsys: fstest.MapFS{
+				"migrations/0010_add_index.up.sql":       {Data: []byte("CREATE INDEX")},
+				"migrations/0002_add_column.up.sql":      {Data: []byte("ALTER TABLE ADD")},
+				"migrations/0002_add_column.down.sql":    {Data: []byte("ALTER TABLE DROP")},
+				"migrations/0001_create_tables.up.sql":   {Data: []byte("CREATE TABLE")},
+				"migrations/0001_create_tables.down.sql": {Data: []byte("DROP TABLE")},
+				"migrations/README.md":                   {Data: []byte("ignored")},
+			},
+			want: []Migration{
+				{Version: 1, Name: "create_tables", Up: "CREATE TABLE", Down: "DROP TABLE"},
+				{Version: 2, Name: "add_column", Up: "ALTER TABLE ADD", Down: "ALTER TABLE DROP"},
+				{Version: 10, Name: "add_index", Up: "CREATE INDEX"},
+			},
+		},
+		{
+			name: "only down script",
+			fsys: fstest.MapFS{
+				"migrations/0001_create_tables.down.sql": {Data: []byte("DROP TABLE")},
+			},
+			wantErr: ErrInvalidMigration,
+		},
+		{
+			name: "without direction",
+			fsys: fstest.MapFS{
+				"migrations/0001_create_tables.sql": {Data: []byte("CREATE TABLE")},
+			},
+			wantErr: ErrInvalidMigration,
+		},
+		{
+			name: "without version",
+			fsys: fstest.MapFS{
+				"migrations/create_tables.up.sql": {Data: []byte("CREATE TABLE")},
+			},
+			wantErr: ErrInvalidMigration,
+		},
+		{
+			name: "different names with one version",
+			fsys: fstest.MapFS{
+				"migrations/0001_create_tables.up.sql": {Data: []byte("CREATE TABLE")},
+				"migrations/0001_drop_tables.down.sql": {Data: []byte("DROP TABLE")},
+			},
+			wantErr: ErrInvalidMigration,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.fsys, "migrations")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	m := NewMigrator(nil, "test", nil)
+
+	assert.ErrorIs(t, Run(context.Background(), m, nil), ErrUnknownCommand)
+	assert.ErrorIs(t, Run(context.Background(), m, []string{"sideways"}), ErrUnknownCommand)
+	assert.ErrorIs(t, Run(context.Background(), m, []string{"down", "-1"}), ErrUnknownCommand)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"regexp"
+	"slices"
 	"sync"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/vilasle/gophermart/internal/logger"
 	repository "github.com/vilasle/gophermart/internal/repository/calculation"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 type CalculationService struct {
@@ -20,12 +22,19 @@ type CalculationService struct {
 	mxRules  *sync.Mutex
 	rules    map[int16]rule
 	manager  *EventManager
+	//subscribers are notified about calculated orders, it can be nil
+	notifier *Notifier
+	//days and hours of rules are evaluated in it, time.Local is used if it is nil
+	location *time.Location
 }
 
 type CalculationServiceConfig struct {
 	repository.CalculationRepository
 	repository.CalculationRules
 	*EventManager
+	*Notifier
+	//days and hours of rules are evaluated in it, time.Local (TZ) is used if it is not set
+	Location *time.Location
 }
 
 func NewCalculationService(config CalculationServiceConfig) *CalculationService {
@@ -33,6 +42,8 @@ func NewCalculationService(config CalculationServiceConfig) *CalculationService
 		repCalc:  config.CalculationRepository,
 		repRules: config.CalculationRules,
 		manager:  config.EventManager,
+		notifier: config.Notifier,
+		location: config.Location,
 		mxRules:  &sync.Mutex{},
 		rules:    make(map[int16]rule),
 	}
@@ -40,6 +51,9 @@ func NewCalculationService(config CalculationServiceConfig) *CalculationService
 	s.manager.RegisterHandler(NewOrder, s.calculateOrder)
 	//add new registered rule on service
 	s.manager.RegisterHandler(NewRule, s.readRule)
+	//changed rule replaces previous one, disabled rule is removed
+	s.manager.RegisterHandler(UpdateRule, s.readRule)
+	s.manager.RegisterHandler(DeleteRule, s.removeRule)
 
 	return s
 }
@@ -54,6 +68,10 @@ func (c CalculationService) Start(ctx context.Context) error {
 }
 
 func (c CalculationService) Register(ctx context.Context, dto service.RegisterCalculationRequest) error {
+	if dto.PurchasedAt.IsZero() {
+		dto.PurchasedAt = time.Now()
+	}
+
 	//save on db; line on table need for unexpected finishing service
 	addingQueueDto, addingCalc := prepareAddingDto(dto)
 
@@ -86,37 +104,107 @@ func (c CalculationService) Calculation(ctx context.Context, dto service.Calcula
 	return prepareCalculatedInfo(result[0]), nil
 }
 
+func (c CalculationService) Calculations(ctx context.Context, dto service.CalculationsFilterRequest) ([]service.CalculationInfo, error) {
+	if len(dto.OrderNumbers) == 0 || len(dto.OrderNumbers) > service.MaxCalculationsBatch {
+		return nil, service.ErrInvalidFormat
+	}
+
+	numbers := make([]string, 0, len(dto.OrderNumbers))
+	seen := make(map[string]struct{}, len(dto.OrderNumbers))
+	for _, number := range dto.OrderNumbers {
+		if number == "" {
+			return nil, service.ErrInvalidFormat
+		}
+		if _, ok := seen[number]; !ok {
+			seen[number] = struct{}{}
+			numbers = append(numbers, number)
+		}
+	}
+
+	result, err := c.repCalc.Calculations(ctx, repository.CalculationFilter{
+		OrderNumbers: numbers,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	calculations := make([]service.CalculationInfo, 0, len(result))
+	for _, calc := range result {
+		calculations = append(calculations, prepareCalculatedInfo(calc))
+	}
+	return calculations, nil
+}
+
+func (c CalculationService) Breakdown(ctx context.Context, dto service.CalculationFilterRequest) (service.CalculationBreakdown, error) {
+	calc, err := c.Calculation(ctx, dto)
+	if err != nil {
+		return service.CalculationBreakdown{}, err
+	}
+
+	lines, err := c.repCalc.CalculationLines(ctx, repository.CalculationLineFilter{OrderNumber: dto.OrderNumber})
+	if err != nil {
+		return service.CalculationBreakdown{}, err
+	}
+
+	return prepareBreakdown(calc, lines), nil
+}
+
 // EVENTS
 //
-// event.Type = NewRule; event.Data = id rule on repository
+// event.Type = NewRule, UpdateRule; event.Data = id rule on repository
 func (c CalculationService) readRule(ctx context.Context, event Event) {
 	id, ok := event.Data.(int16)
 	if !ok {
 		logger.Warn("was raise event with wrong data", "event", event.Type, "data", event.Data)
 		return
 	}
+
+	//handlers of events run concurrently, so reading and applying are not split by another event of the rule,
+	//otherwise stale version could replace newer one or bring deleted rule back
+	c.mxRules.Lock()
+	defer c.mxRules.Unlock()
+
 	rs, err := c.repRules.Rules(ctx, repository.RuleFilter{ID: id})
 	if err != nil {
 		logger.Error("getting specific rule", "id", id, "error", err)
 		return
 	}
 
-	if err := c.fillRules(rs); err != nil {
+	//rule was deleted after event
+	delete(c.rules, id)
+
+	if err := c.applyRules(rs); err != nil {
 		logger.Error("preparing rules for using", "error", err)
 		return
 	}
 }
 
+// event.Type = DeleteRule; event.Data = id rule on repository
+func (c CalculationService) removeRule(_ context.Context, event Event) {
+	id, ok := event.Data.(int16)
+	if !ok {
+		logger.Warn("was raise event with wrong data", "event", event.Type, "data", event.Data)
+		return
+	}
+
+	c.mxRules.Lock()
+	defer c.mxRules.Unlock()
+
+	delete(c.rules, id)
+}
+
 // event.Type = NewOrder; event.Data = service.RegisterCalculationRequest
 func (c CalculationService) calculateOrder(ctx context.Context, event Event) {
 	var (
-		number   string
-		products []service.ProductRow
+		number      string
+		products    []service.ProductRow
+		purchasedAt time.Time
 	)
 
 	if dto, ok := event.Data.(service.RegisterCalculationRequest); ok {
 		number = dto.OrderNumber
 		products = dto.Products
+		purchasedAt = dto.PurchasedAt
 	} else {
 		logger.Warn("was raise event with wrong data", "event", event.Type, "data", event.Data)
 		return
@@ -133,10 +221,17 @@ func (c CalculationService) calculateOrder(ctx context.Context, event Event) {
 		logger.Error("updating calculation result", "error", err, "data", updateDto)
 	}
 
-	bonus := c.calculateProductsBonus(products)
+	lines := c.calculateLines(products, purchasedAt)
+	bonus := linesReward(lines)
 
 	logger.Debug("calculating order", "order", number, "products", products, "bonus", bonus)
 
+	//explanation of reward is not required for accrual, so order is calculated even if it is not saved
+	linesDto := prepareLinesDto(number, lines)
+	if err := c.repCalc.ReplaceCalculationLines(ctx, linesDto); err != nil {
+		logger.Error("saving lines of calculation", "error", err, "order", number)
+	}
+
 	resultDto := prepareCalculatedDto(number, bonus)
 
 	logger.Debug("update calculation dto", "dto", resultDto)
@@ -146,6 +241,13 @@ func (c CalculationService) calculateOrder(ctx context.Context, event Event) {
 		return
 	}
 
+	//status is final, subscribers do not need to poll it
+	c.notifier.Notify(prepareCalculatedInfo(repository.CalculationInfo{
+		OrderNumber: resultDto.OrderNumber,
+		Status:      resultDto.Status,
+		Value:       resultDto.Value,
+	}))
+
 	clearDto := repository.ClearingCalculationQueue{OrderNumber: number}
 	if err := c.repCalc.ClearCalculationsQueue(ctx, clearDto); err != nil {
 		logger.Error("clearing queue was failed", "error", err, "data", clearDto)
@@ -154,12 +256,58 @@ func (c CalculationService) calculateOrder(ctx context.Context, event Event) {
 
 }
 
-func (c CalculationService) calculateProductsBonus(products []service.ProductRow) float64 {
-	var bonus float64
-	for _, product := range products {
-		bonus += c.calculateProduct(product)
+/*
+calculateLines explains reward of order, every product has at least one line and sum of points of lines is reward.
+Rules which were active at time of purchase are used, so expired rules are still applied to late orders
+*/
+func (c CalculationService) calculateLines(products []service.ProductRow, purchasedAt time.Time) []rewardLine {
+	order := c.orderRules(purchasedAt)
+
+	lines := make([]rewardLine, 0, len(products))
+	var bonus, total money.Money
+	for i, product := range products {
+		total += product.Price
+
+		if product.Price < order.minPrice {
+			lines = append(lines, rewardLine{line: i + 1, product: product, ruleID: order.minPriceRule, kind: service.RuleKindMinPrice})
+			continue
+		}
+
+		matched := c.productRules(product, purchasedAt)
+		if len(matched) == 0 {
+			lines = append(lines, rewardLine{line: i + 1, product: product})
+			continue
+		}
+		for _, m := range matched {
+			line := newRewardLine(m.id, m.rule, m.reward)
+			line.line, line.product = i+1, product
+			lines = append(lines, line)
+			bonus += m.reward
+		}
 	}
-	return bonus
+	return append(lines, order.lines(bonus, total)...)
+}
+
+func (c CalculationService) orderRules(purchasedAt time.Time) orderRules {
+	c.mxRules.Lock()
+	defer c.mxRules.Unlock()
+
+	purchasedAt = purchasedAt.In(c.zone())
+
+	ids := make([]int16, 0)
+	for id, rule := range c.rules {
+		if rule.kind != service.RuleKindProduct && rule.schedule.activeAt(purchasedAt) {
+			ids = append(ids, id)
+		}
+	}
+	//result does not depend on order of map
+	slices.Sort(ids)
+
+	order := orderRules{}
+	for _, id := range ids {
+		order.add(id, c.rules[id])
+	}
+	return order
 }
 
 func (c CalculationService) runNotProcessedOrders(ctx context.Context) error {
@@ -178,16 +326,32 @@ func (c CalculationService) runNotProcessedOrders(ctx context.Context) error {
 	return nil
 }
 
-func (c CalculationService) calculateProduct(product service.ProductRow) float64 {
+// productRules returns rules which give reward for product
+func (c CalculationService) productRules(product service.ProductRow, purchasedAt time.Time) []matchedRule {
 	c.mxRules.Lock()
 	defer c.mxRules.Unlock()
 	logger.Debug("calculating product", "product", product)
-	for _, rule := range c.rules {
+
+	purchasedAt = purchasedAt.In(c.zone())
+
+	matched := make([]matchedRule, 0)
+	for id, rule := range c.rules {
+		if rule.kind != service.RuleKindProduct || !rule.schedule.activeAt(purchasedAt) {
+			continue
+		}
 		if r := rule.calculate(product.Name, product.Price); r > 0 {
-			return r
+			matched = append(matched, matchedRule{id: id, rule: rule, reward: r})
 		}
 	}
-	return 0
+	return contributingRules(matched)
+}
+
+// zone returns location where days and hours of rules are evaluated
+func (c CalculationService) zone() *time.Location {
+	if c.location == nil {
+		return time.Local
+	}
+	return c.location
 }
 
 func (c CalculationService) readAllRules(ctx context.Context) error {
@@ -202,25 +366,66 @@ func (c *CalculationService) fillRules(rs []repository.RuleInfo) error {
 	c.mxRules.Lock()
 	defer c.mxRules.Unlock()
 
+	return c.applyRules(rs)
+}
+
+// applyRules replaces rules by their new versions, caller holds mxRules
+func (c *CalculationService) applyRules(rs []repository.RuleInfo) error {
 	errs := make([]error, 0, len(rs))
 
 	for _, r := range rs {
+		//previous version of rule is not applied even if new one is invalid
+		delete(c.rules, r.ID)
+
+		if r.Disabled {
+			continue
+		}
+
 		exp, err := regexp.Compile(r.Match)
 		if err != nil {
 			errs = append(errs, wrap.Wrapf(err, "invalid regexp %s", r.Match))
 			continue
 		}
 
-		calcType, correct := service.DefineCalculationType(r.CalculationType)
+		kind, correct := service.DefineRuleKind(r.Kind)
 		if !correct {
+			errs = append(errs, errors.New("invalid kind of rule"))
+			continue
+		}
+
+		//rule of minimal price does not give reward
+		calcType, correct := service.DefineCalculationType(r.CalculationType)
+		if !correct && kind != service.RuleKindMinPrice {
 			errs = append(errs, errors.New("invalid calculation type"))
 			continue
 		}
 
+		policy, correct := service.DefineRulePolicy(r.Policy)
+		if r.Policy == service.RulePolicyUnknown {
+			policy, correct = service.RulePolicyFirst, true
+		}
+		if !correct {
+			errs = append(errs, errors.New("invalid policy of rule"))
+			continue
+		}
+
 		c.rules[r.ID] = rule{
+			kind:            kind,
 			exp:             exp,
 			calculationType: calcType,
 			value:           r.Point,
+			threshold:       r.Threshold,
+			priority:        r.Priority,
+			policy:          policy,
+			cap:             r.Cap,
+			schedule: schedule{
+				validFrom: r.ValidFrom,
+				validTo:   r.ValidTo,
+				weekdays:  r.Weekdays,
+				hourFrom:  r.HourFrom,
+				hourTo:    r.HourTo,
+			},
+			match: r.Match,
 		}
 	}
 	return errors.Join(errs...)
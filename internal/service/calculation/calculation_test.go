@@ -8,6 +8,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -15,6 +16,7 @@ import (
 	"github.com/vilasle/gophermart/internal/logger"
 	repository "github.com/vilasle/gophermart/internal/repository/calculation"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 type MockLoggerWriter struct {
@@ -63,13 +65,13 @@ func TestCalculationService_fillRules(t *testing.T) {
 					{
 						ID:              1,
 						Match:           "test",
-						Point:           1234,
+						Point:           money.FromInt(1234),
 						CalculationType: service.CalculationTypeFixed,
 					},
 					{
 						ID:              2,
 						Match:           "test",
-						Point:           1,
+						Point:           money.FromInt(1),
 						CalculationType: service.CalculationTypePercent,
 					},
 				},
@@ -90,7 +92,7 @@ func TestCalculationService_fillRules(t *testing.T) {
 					{
 						ID:              1,
 						Match:           "test",
-						Point:           1234,
+						Point:           money.FromInt(1234),
 						CalculationType: -21321,
 					},
 				},
@@ -111,7 +113,7 @@ func TestCalculationService_fillRules(t *testing.T) {
 					{
 						ID:              1,
 						Match:           `test\`,
-						Point:           1234,
+						Point:           money.FromInt(1234),
 						CalculationType: service.CalculationTypeFixed,
 					},
 				},
@@ -185,7 +187,7 @@ func TestCalculationService_readRule(t *testing.T) {
 						{
 							ID:              dto.ID,
 							Match:           "test",
-							Point:           1234,
+							Point:           money.FromInt(1234),
 							CalculationType: service.CalculationTypeFixed,
 						},
 					}
@@ -258,7 +260,7 @@ func TestCalculationService_readRule(t *testing.T) {
 						{
 							ID:              1,
 							Match:           `test\`,
-							Point:           1234,
+							Point:           money.FromInt(1234),
 							CalculationType: service.CalculationTypeFixed,
 						},
 					}
@@ -342,7 +344,7 @@ func TestCalculationService_readAllRules(t *testing.T) {
 						{
 							ID:              1,
 							Match:           "test",
-							Point:           1234,
+							Point:           money.FromInt(1234),
 							CalculationType: service.CalculationTypeFixed,
 						},
 					}
@@ -410,7 +412,7 @@ func TestCalculationService_fillCalculatedDto(t *testing.T) {
 	}
 	type args struct {
 		orderNumber string
-		value       float64
+		value       money.Money
 	}
 	tests := []struct {
 		name   string
@@ -429,11 +431,11 @@ func TestCalculationService_fillCalculatedDto(t *testing.T) {
 			},
 			args: args{
 				orderNumber: "1234567890",
-				value:       100,
+				value:       money.FromInt(100),
 			},
 			want: repository.AddCalculationResult{
 				OrderNumber: "1234567890",
-				Value:       100,
+				Value:       money.FromInt(100),
 				Status:      repository.Processed,
 			},
 		},
@@ -467,7 +469,7 @@ func TestCalculationService_fillCalculatedDto(t *testing.T) {
 	}
 }
 
-func TestCalculationService_calculateProduct(t *testing.T) {
+func TestCalculationService_calculateLinesOfProduct(t *testing.T) {
 	type fields struct {
 		repCalc  repository.CalculationRepository
 		repRules repository.CalculationRules
@@ -482,7 +484,7 @@ func TestCalculationService_calculateProduct(t *testing.T) {
 		name   string
 		fields fields
 		args   args
-		want   float64
+		want   money.Money
 	}{
 		{
 			name: "calculate product",
@@ -493,12 +495,12 @@ func TestCalculationService_calculateProduct(t *testing.T) {
 				rules: map[int16]rule{
 					1: {
 						calculationType: service.CalculationTypeFixed,
-						value:           10,
+						value:           money.FromInt(10),
 						exp:             regexp.MustCompile("(?i)test"),
 					},
 					2: {
 						calculationType: service.CalculationTypePercent,
-						value:           10,
+						value:           money.FromInt(10),
 						exp:             regexp.MustCompile("(?i)test"),
 					},
 				},
@@ -507,10 +509,10 @@ func TestCalculationService_calculateProduct(t *testing.T) {
 			args: args{
 				product: service.ProductRow{
 					Name:  "test",
-					Price: 100,
+					Price: money.FromInt(100),
 				},
 			},
-			want: 10,
+			want: money.FromInt(10),
 		},
 		{
 			name: "not found matched rules",
@@ -521,12 +523,12 @@ func TestCalculationService_calculateProduct(t *testing.T) {
 				rules: map[int16]rule{
 					1: {
 						calculationType: service.CalculationTypeFixed,
-						value:           10,
+						value:           money.FromInt(10),
 						exp:             regexp.MustCompile("(?i)test"),
 					},
 					2: {
 						calculationType: service.CalculationTypePercent,
-						value:           10,
+						value:           money.FromInt(10),
 						exp:             regexp.MustCompile("(?i)test"),
 					},
 				},
@@ -535,7 +537,7 @@ func TestCalculationService_calculateProduct(t *testing.T) {
 			args: args{
 				product: service.ProductRow{
 					Name:  "ping-pong",
-					Price: 100,
+					Price: money.FromInt(100),
 				},
 			},
 			want: 0,
@@ -550,8 +552,8 @@ func TestCalculationService_calculateProduct(t *testing.T) {
 				rules:    tt.fields.rules,
 				manager:  tt.fields.manager,
 			}
-			if got := c.calculateProduct(tt.args.product); got != tt.want {
-				t.Errorf("CalculationService.calculateProduct() = %v, want %v", got, tt.want)
+			if got := linesReward(c.calculateLines([]service.ProductRow{tt.args.product}, time.Now())); got != tt.want {
+				t.Errorf("reward of CalculationService.calculateLines() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -582,13 +584,15 @@ func TestCalculationService_calculateOrder(t *testing.T) {
 		rules: map[int16]rule{
 			1: {
 				calculationType: service.CalculationTypeFixed,
-				value:           10,
+				value:           money.FromInt(10),
 				exp:             regexp.MustCompile("(?i)test"),
+				match:           "(?i)test",
 			},
 			2: {
 				calculationType: service.CalculationTypePercent,
-				value:           10,
+				value:           money.FromInt(10),
 				exp:             regexp.MustCompile("(?i)test"),
+				match:           "(?i)test",
 			},
 		},
 		manager: NewEventManager(),
@@ -616,15 +620,15 @@ func TestCalculationService_calculateOrder(t *testing.T) {
 						Products: []service.ProductRow{
 							{
 								Name:  "test-product",
-								Price: 100,
+								Price: money.FromInt(100),
 							},
 							{
 								Name:  "product1",
-								Price: 100,
+								Price: money.FromInt(100),
 							},
 							{
 								Name:  "product2",
-								Price: 100,
+								Price: money.FromInt(100),
 							},
 						},
 					},
@@ -637,7 +641,7 @@ func TestCalculationService_calculateOrder(t *testing.T) {
 					},
 					{
 						OrderNumber: "123445",
-						Value:       10,
+						Value:       money.FromInt(10),
 						Status:      repository.Processed,
 					},
 				},
@@ -648,6 +652,14 @@ func TestCalculationService_calculateOrder(t *testing.T) {
 					for _, d := range dto {
 						mcr.EXPECT().UpdateCalculationResult(ctx, d).Return(err)
 					}
+					mcr.EXPECT().ReplaceCalculationLines(ctx, repository.ReplacingCalculationLines{
+						OrderNumber: "123445",
+						Lines: []repository.CalculationLine{
+							{Line: 1, ProductName: "test-product", Price: money.FromInt(100), RuleID: 1, CalculationType: service.CalculationTypeFixed, Points: money.FromInt(10), RuleMatch: "(?i)test", RulePoint: money.FromInt(10)},
+							{Line: 2, ProductName: "product1", Price: money.FromInt(100)},
+							{Line: 3, ProductName: "product2", Price: money.FromInt(100)},
+						},
+					}).Return(err)
 					mcr.EXPECT().ClearCalculationsQueue(ctx, dtoClear).Return(err)
 				},
 			},
@@ -682,15 +694,15 @@ func TestCalculationService_calculateOrder(t *testing.T) {
 						Products: []service.ProductRow{
 							{
 								Name:  "test-product",
-								Price: 100,
+								Price: money.FromInt(100),
 							},
 							{
 								Name:  "product1",
-								Price: 100,
+								Price: money.FromInt(100),
 							},
 							{
 								Name:  "product2",
-								Price: 100,
+								Price: money.FromInt(100),
 							},
 						},
 					},
@@ -703,7 +715,7 @@ func TestCalculationService_calculateOrder(t *testing.T) {
 					},
 					{
 						OrderNumber: "123445",
-						Value:       10,
+						Value:       money.FromInt(10),
 						Status:      repository.Processed,
 					},
 				},
@@ -714,6 +726,7 @@ func TestCalculationService_calculateOrder(t *testing.T) {
 					for _, d := range dto {
 						mcr.EXPECT().UpdateCalculationResult(ctx, d).Return(err)
 					}
+					mcr.EXPECT().ReplaceCalculationLines(ctx, gomock.Any()).Return(err)
 				},
 				err: errors.New("saving error"),
 			},
@@ -795,7 +808,7 @@ func TestCalculationService_Calculation(t *testing.T) {
 	// 			dtoResult: []repository.CalculationInfo{
 	// 				{
 	// 					OrderNumber: "123456",
-	// 					Value:       10,
+	// 					Value:       money.FromInt(10),
 	// 					Status:      repository.Processed,
 	// 				},
 	// 			},
@@ -804,7 +817,7 @@ func TestCalculationService_Calculation(t *testing.T) {
 	// 		want: []service.CalculationInfo{
 	// 			{
 	// 				OrderNumber: "123456",
-	// 				Accrual:     10,
+	// 				Accrual:     money.FromInt(10),
 	// 				Status:      "PROCESSED",
 	// 			},
 	// 		},
@@ -821,27 +834,27 @@ func TestCalculationService_Calculation(t *testing.T) {
 	// 			dtoResult: []repository.CalculationInfo{
 	// 				{
 	// 					OrderNumber: "123456",
-	// 					Value:       10,
+	// 					Value:       money.FromInt(10),
 	// 					Status:      repository.Processed,
 	// 				},
 	// 				{
 	// 					OrderNumber: "54321",
-	// 					Value:       10,
+	// 					Value:       money.FromInt(10),
 	// 					Status:      repository.Processed,
 	// 				},
 	// 				{
 	// 					OrderNumber: "097653",
-	// 					Value:       10,
+	// 					Value:       money.FromInt(10),
 	// 					Status:      repository.Processing,
 	// 				},
 	// 				{
 	// 					OrderNumber: "34365",
-	// 					Value:       10,
+	// 					Value:       money.FromInt(10),
 	// 					Status:      repository.Invalid,
 	// 				},
 	// 				{
 	// 					OrderNumber: "67453903",
-	// 					Value:       10,
+	// 					Value:       money.FromInt(10),
 	// 					Status:      7,
 	// 				},
 	// 			},
@@ -850,27 +863,27 @@ func TestCalculationService_Calculation(t *testing.T) {
 	// 		want: []service.CalculationInfo{
 	// 			{
 	// 				OrderNumber: "123456",
-	// 				Accrual:     10,
+	// 				Accrual:     money.FromInt(10),
 	// 				Status:      "PROCESSED",
 	// 			},
 	// 			{
 	// 				OrderNumber: "54321",
-	// 				Accrual:     10,
+	// 				Accrual:     money.FromInt(10),
 	// 				Status:      "PROCESSED",
 	// 			},
 	// 			{
 	// 				OrderNumber: "097653",
-	// 				Accrual:     10,
+	// 				Accrual:     money.FromInt(10),
 	// 				Status:      "PROCESSING",
 	// 			},
 	// 			{
 	// 				OrderNumber: "34365",
-	// 				Accrual:     10,
+	// 				Accrual:     money.FromInt(10),
 	// 				Status:      "INVALID",
 	// 			},
 	// 			{
 	// 				OrderNumber: "67453903",
-	// 				Accrual:     10,
+	// 				Accrual:     money.FromInt(10),
 	// 				Status:      "",
 	// 			},
 	// 		},
@@ -985,7 +998,7 @@ func TestCalculationService_Register(t *testing.T) {
 	// 				Products: []service.ProductRow{
 	// 					{
 	// 						Name:  "test",
-	// 						Price: 100,
+	// 						Price: money.FromInt(100),
 	// 					},
 	// 				},
 	// 			},
@@ -993,7 +1006,7 @@ func TestCalculationService_Register(t *testing.T) {
 	// 				{
 	// 					OrderNumber: "123456",
 	// 					ProductName: "test",
-	// 					Price:       100,
+	// 					Price:       money.FromInt(100),
 	// 				},
 	// 			},
 	// 			err: nil,
@@ -1016,7 +1029,7 @@ func TestCalculationService_Register(t *testing.T) {
 	// 				Products: []service.ProductRow{
 	// 					{
 	// 						Name:  "test",
-	// 						Price: 100,
+	// 						Price: money.FromInt(100),
 	// 					},
 	// 				},
 	// 			},
@@ -1024,7 +1037,7 @@ func TestCalculationService_Register(t *testing.T) {
 	// 				{
 	// 					OrderNumber: "123456",
 	// 					ProductName: "test",
-	// 					Price:       100,
+	// 					Price:       money.FromInt(100),
 	// 				},
 	// 			},
 	// 			err: errors.New("error on repository"),
@@ -1054,3 +1067,135 @@ func TestCalculationService_Register(t *testing.T) {
 	// 	})
 	// }
 }
+
+func TestCalculationService_Calculations(t *testing.T) {
+	errConnection := errors.New("connection refused")
+	tooMany := make([]string, service.MaxCalculationsBatch+1)
+	for i := range tooMany {
+		tooMany[i] = "123456"
+	}
+
+	tests := []struct {
+		name    string
+		dto     service.CalculationsFilterRequest
+		setup   func(*MockCalculationRepository)
+		want    []service.CalculationInfo
+		wantErr error
+	}{
+		{
+			name: "known orders, duplicates are requested once",
+			dto:  service.CalculationsFilterRequest{OrderNumbers: []string{"123456", "54321", "123456", "097653"}},
+			setup: func(rep *MockCalculationRepository) {
+				rep.EXPECT().Calculations(gomock.Any(), repository.CalculationFilter{
+					OrderNumbers: []string{"123456", "54321", "097653"},
+				}).Return([]repository.CalculationInfo{
+					{OrderNumber: "123456", Value: money.FromInt(10), Status: repository.Processed},
+					{OrderNumber: "54321", Status: repository.Processing},
+				}, nil)
+			},
+			want: []service.CalculationInfo{
+				{OrderNumber: "123456", Accrual: money.FromInt(10), Status: "PROCESSED"},
+				{OrderNumber: "54321", Status: "PROCESSING"},
+			},
+		},
+		{
+			name:    "empty batch",
+			dto:     service.CalculationsFilterRequest{},
+			wantErr: service.ErrInvalidFormat,
+		},
+		{
+			name:    "too big batch",
+			dto:     service.CalculationsFilterRequest{OrderNumbers: tooMany},
+			wantErr: service.ErrInvalidFormat,
+		},
+		{
+			name:    "empty number",
+			dto:     service.CalculationsFilterRequest{OrderNumbers: []string{"123456", ""}},
+			wantErr: service.ErrInvalidFormat,
+		},
+		{
+			name: "repository error",
+			dto:  service.CalculationsFilterRequest{OrderNumbers: []string{"123456"}},
+			setup: func(rep *MockCalculationRepository) {
+				rep.EXPECT().Calculations(gomock.Any(), gomock.Any()).Return(nil, errConnection)
+			},
+			wantErr: errConnection,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			rep := NewMockCalculationRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(rep)
+			}
+
+			c := CalculationService{repCalc: rep}
+			got, err := c.Calculations(context.Background(), tt.dto)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCalculationService_Breakdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(*MockCalculationRepository)
+		want    service.CalculationBreakdown
+		wantErr error
+	}{
+		{
+			name: "lines of order",
+			setup: func(rep *MockCalculationRepository) {
+				rep.EXPECT().Calculations(gomock.Any(), repository.CalculationFilter{OrderNumber: "123456"}).Return([]repository.CalculationInfo{
+					{OrderNumber: "123456", Value: money.FromInt(110), Status: repository.Processed},
+				}, nil)
+				rep.EXPECT().CalculationLines(gomock.Any(), repository.CalculationLineFilter{OrderNumber: "123456"}).Return([]repository.CalculationLine{
+					{Line: 1, ProductName: "Bosch drill", Price: money.FromInt(100), RuleID: 1, CalculationType: service.CalculationTypePercent, Points: money.FromInt(10), RuleMatch: "Bosch", RulePoint: money.FromInt(10)},
+					{RuleID: 4, RuleKind: service.RuleKindOrderBonus, CalculationType: service.CalculationTypeFixed, Points: money.FromInt(100), RulePoint: money.FromInt(100)},
+				}, nil)
+			},
+			want: service.CalculationBreakdown{
+				CalculationInfo: service.CalculationInfo{OrderNumber: "123456", Status: "PROCESSED", Accrual: money.FromInt(110)},
+				Lines: []service.CalculationLine{
+					{Line: 1, ProductName: "Bosch drill", Price: money.FromInt(100), RuleID: 1, Type: service.CalculationTypePercent, Points: money.FromInt(10), RuleMatch: "Bosch", RulePoint: money.FromInt(10)},
+					{RuleID: 4, RuleKind: service.RuleKindOrderBonus, Type: service.CalculationTypeFixed, Points: money.FromInt(100), RulePoint: money.FromInt(100)},
+				},
+			},
+		},
+		{
+			name: "unknown order",
+			setup: func(rep *MockCalculationRepository) {
+				rep.EXPECT().Calculations(gomock.Any(), gomock.Any()).Return(nil, nil)
+			},
+			wantErr: service.ErrEntityDoesNotExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			rep := NewMockCalculationRepository(ctrl)
+			tt.setup(rep)
+
+			c := CalculationService{repCalc: rep}
+			got, err := c.Breakdown(context.Background(), service.CalculationFilterRequest{OrderNumber: "123456"})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
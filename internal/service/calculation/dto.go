@@ -1,13 +1,15 @@
 package calculation
 
-import(
-	"math"
-	"github.com/vilasle/gophermart/internal/service"
+import (
+	"time"
+
 	repository "github.com/vilasle/gophermart/internal/repository/calculation"
+	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 // dto
-func prepareCalculatedDto(orderNumber string, value float64) repository.AddCalculationResult {
+func prepareCalculatedDto(orderNumber string, value money.Money) repository.AddCalculationResult {
 	status := repository.Invalid
 	if value > 0 {
 		status = repository.Processed
@@ -15,14 +17,17 @@ func prepareCalculatedDto(orderNumber string, value float64) repository.AddCalcu
 
 	return repository.AddCalculationResult{
 		OrderNumber: orderNumber,
-		Value:       math.Round(value*100) / 100,
+		Value:       value,
 		Status:      status,
 	}
 }
 
 func prepareQueueToExpectedDto(dto []repository.CalculationQueueInfo) []service.RegisterCalculationRequest {
 	m := make(map[string][]service.ProductRow)
+	//all products of order have the same time of purchase
+	purchased := make(map[string]time.Time)
 	for _, v := range dto {
+		purchased[v.OrderNumber] = v.PurchasedAt
 		if _, ok := m[v.OrderNumber]; !ok {
 			m[v.OrderNumber] = make([]service.ProductRow, 0)
 		}
@@ -38,6 +43,7 @@ func prepareQueueToExpectedDto(dto []repository.CalculationQueueInfo) []service.
 		result = append(result, service.RegisterCalculationRequest{
 			OrderNumber: k,
 			Products:    v,
+			PurchasedAt: purchased[k],
 		})
 	}
 	return result
@@ -53,6 +59,7 @@ func prepareAddingDto(dto service.RegisterCalculationRequest) ([]repository.Addi
 			OrderNumber: orderNumber,
 			ProductName: product.Name,
 			Price:       product.Price,
+			PurchasedAt: dto.PurchasedAt,
 		})
 	}
 
@@ -65,11 +72,53 @@ func prepareAddingDto(dto service.RegisterCalculationRequest) ([]repository.Addi
 	return addingDto, calcDto
 }
 
+func prepareLinesDto(orderNumber string, lines []rewardLine) repository.ReplacingCalculationLines {
+	dto := repository.ReplacingCalculationLines{
+		OrderNumber: orderNumber,
+		Lines:       make([]repository.CalculationLine, 0, len(lines)),
+	}
+	for _, line := range lines {
+		dto.Lines = append(dto.Lines, repository.CalculationLine{
+			Line:            line.line,
+			ProductName:     line.product.Name,
+			Price:           line.product.Price,
+			RuleID:          line.ruleID,
+			RuleKind:        line.kind,
+			CalculationType: line.calculationType,
+			Points:          line.points,
+			RuleMatch:       line.match,
+			RulePoint:       line.value,
+		})
+	}
+	return dto
+}
+
+func prepareBreakdown(calc service.CalculationInfo, lines []repository.CalculationLine) service.CalculationBreakdown {
+	breakdown := service.CalculationBreakdown{
+		CalculationInfo: calc,
+		Lines:           make([]service.CalculationLine, 0, len(lines)),
+	}
+	for _, line := range lines {
+		breakdown.Lines = append(breakdown.Lines, service.CalculationLine{
+			Line:        line.Line,
+			ProductName: line.ProductName,
+			Price:       line.Price,
+			RuleID:      line.RuleID,
+			RuleKind:    line.RuleKind,
+			Type:        line.CalculationType,
+			Points:      line.Points,
+			RuleMatch:   line.RuleMatch,
+			RulePoint:   line.RulePoint,
+		})
+	}
+	return breakdown
+}
+
 func prepareCalculatedInfo(dto repository.CalculationInfo) service.CalculationInfo {
 	return service.CalculationInfo{
 		OrderNumber: dto.OrderNumber,
 		Status:      statusView(dto.Status),
-		Accrual:     math.Round(dto.Value*100) / 100,
+		Accrual:     dto.Value,
 	}
 }
 
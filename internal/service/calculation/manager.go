@@ -12,6 +12,9 @@ type EventType = int
 const (
 	NewOrder EventType = iota + 1
 	NewRule
+	//rule was changed, disabled or enabled again
+	UpdateRule
+	DeleteRule
 )
 
 type EventHandler func(context.Context, Event)
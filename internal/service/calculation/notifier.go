@@ -0,0 +1,165 @@
+package calculation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vilasle/gophermart/internal/logger"
+	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
+	"github.com/vilasle/gophermart/internal/tool/signature"
+)
+
+// HeaderSignature keeps signature of notification by secret which is shared with subscribers, see signature.Sign
+const HeaderSignature = "X-Accrual-Signature"
+
+type NotifierConfig struct {
+	//callback urls of subscribers, e.g. http://gophermart:8080/api/internal/accrual
+	Subscribers []string
+	Secret      string
+	//notification is sent at most Attempts times, delay between attempts is doubled from RetryDelay
+	Attempts   int
+	RetryDelay time.Duration
+	Workers    int
+	Client     *http.Client
+}
+
+type notification struct {
+	subscriber string
+	body       []byte
+}
+
+/*
+Notifier pushes final status of calculated order to subscribers. Notifications are kept in memory,
+so subscribers must reconcile missed ones by polling of GET /api/orders/{number}
+*/
+type Notifier struct {
+	config NotifierConfig
+	queue  chan notification
+}
+
+func NewNotifier(config NotifierConfig) *Notifier {
+	if config.Attempts <= 0 {
+		config.Attempts = 5
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = time.Second
+	}
+	if config.Workers <= 0 {
+		config.Workers = 2
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Notifier{
+		config: config,
+		queue:  make(chan notification, 1024),
+	}
+}
+
+// Start runs delivery of notifications until context is done
+func (n *Notifier) Start(ctx context.Context) {
+	for i := 0; i < n.config.Workers; i++ {
+		go n.run(ctx)
+	}
+}
+
+// Notify queues result of order for all subscribers, it does not wait for delivery. Nil notifier does nothing
+func (n *Notifier) Notify(info service.CalculationInfo) {
+	if n == nil || len(n.config.Subscribers) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(struct {
+		OrderNumber string      `json:"order"`
+		Status      string      `json:"status"`
+		Accrual     money.Money `json:"accrual"`
+	}{
+		OrderNumber: info.OrderNumber,
+		Status:      info.Status,
+		Accrual:     info.Accrual,
+	})
+	if err != nil {
+		logger.Error("preparing notification was failed", "order", info.OrderNumber, "error", err)
+		return
+	}
+
+	for _, subscriber := range n.config.Subscribers {
+		select {
+		case n.queue <- notification{subscriber: subscriber, body: body}:
+		default:
+			logger.Warn("queue of notifications is full, notification is dropped", "order", info.OrderNumber, "subscriber", subscriber)
+		}
+	}
+}
+
+func (n *Notifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case nt := <-n.queue:
+			n.deliver(ctx, nt)
+		}
+	}
+}
+
+// deliver sends notification until subscriber accepts it or attempts are over, returns true if it is accepted
+func (n *Notifier) deliver(ctx context.Context, nt notification) bool {
+	log := logger.With("component", "notifier", "subscriber", nt.subscriber)
+
+	delay := n.config.RetryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := n.send(ctx, nt)
+		if err == nil {
+			return true
+		}
+		if !retry || attempt >= n.config.Attempts || ctx.Err() != nil {
+			log.Warn("notification was not delivered", "attempts", attempt, "error", err)
+			return false
+		}
+		log.Debug("notification will be sent again", "attempt", attempt, "delay", delay, "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// send makes one attempt. Errors of request are retried except client errors of subscriber, e.g. unknown order
+func (n *Notifier) send(ctx context.Context, nt notification) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, nt.subscriber, bytes.NewReader(nt.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, signature.Sign(n.config.Secret, time.Now(), nt.body))
+
+	resp, err := n.config.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	//body is read anyway, so connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
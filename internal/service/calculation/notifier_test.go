@@ -0,0 +1,87 @@
+package calculation
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
+	"github.com/vilasle/gophermart/internal/tool/signature"
+)
+
+func TestNotifier_deliver(t *testing.T) {
+	var (
+		requests atomic.Int32
+		status   atomic.Int32
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := signature.Verify("secret", r.Header.Get(HeaderSignature), body, time.Now(), time.Minute); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if string(body) != `{"order":"123456","status":"PROCESSED","accrual":10}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		//the first request is failed
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	n := NewNotifier(NotifierConfig{
+		Subscribers: []string{srv.URL},
+		Secret:      "secret",
+		Attempts:    3,
+		RetryDelay:  time.Millisecond,
+	})
+	n.Notify(service.CalculationInfo{OrderNumber: "123456", Status: "PROCESSED", Accrual: money.FromInt(10)})
+	require.Len(t, n.queue, 1)
+	nt := <-n.queue
+
+	status.Store(http.StatusOK)
+	assert.True(t, n.deliver(context.Background(), nt))
+	assert.Equal(t, int32(2), requests.Load())
+
+	//unknown order is not sent again
+	requests.Store(1)
+	status.Store(http.StatusNotFound)
+	assert.False(t, n.deliver(context.Background(), nt))
+	assert.Equal(t, int32(2), requests.Load())
+
+	//wrong secret
+	n.config.Secret = "another"
+	requests.Store(1)
+	assert.False(t, n.deliver(context.Background(), nt))
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	var n *Notifier
+	//nil notifier is not configured
+	n.Notify(service.CalculationInfo{OrderNumber: "123456"})
+
+	n = NewNotifier(NotifierConfig{Subscribers: []string{"http://first", "http://second"}})
+	n.Notify(service.CalculationInfo{OrderNumber: "123456", Status: "INVALID"})
+	require.Len(t, n.queue, 2)
+	assert.Equal(t, "http://first", (<-n.queue).subscriber)
+	assert.Equal(t, "http://second", (<-n.queue).subscriber)
+
+	//notifications are dropped when queue is full
+	for i := 0; i < cap(n.queue); i++ {
+		n.Notify(service.CalculationInfo{OrderNumber: "123456", Status: "INVALID"})
+	}
+	assert.Len(t, n.queue, cap(n.queue))
+}
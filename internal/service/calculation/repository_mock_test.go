@@ -68,6 +68,21 @@ func (mr *MockCalculationRepositoryMockRecorder) AddCalculationToQueue(arg0 inte
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCalculationToQueue", reflect.TypeOf((*MockCalculationRepository)(nil).AddCalculationToQueue), varargs...)
 }
 
+// CalculationLines mocks base method.
+func (m *MockCalculationRepository) CalculationLines(arg0 context.Context, arg1 repository.CalculationLineFilter) ([]repository.CalculationLine, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CalculationLines", arg0, arg1)
+	ret0, _ := ret[0].([]repository.CalculationLine)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CalculationLines indicates an expected call of CalculationLines.
+func (mr *MockCalculationRepositoryMockRecorder) CalculationLines(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CalculationLines", reflect.TypeOf((*MockCalculationRepository)(nil).CalculationLines), arg0, arg1)
+}
+
 // Calculations mocks base method.
 func (m *MockCalculationRepository) Calculations(arg0 context.Context, arg1 repository.CalculationFilter) ([]repository.CalculationInfo, error) {
 	m.ctrl.T.Helper()
@@ -112,6 +127,20 @@ func (mr *MockCalculationRepositoryMockRecorder) GetCalculationsQueue(arg0 inter
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCalculationsQueue", reflect.TypeOf((*MockCalculationRepository)(nil).GetCalculationsQueue), arg0)
 }
 
+// ReplaceCalculationLines mocks base method.
+func (m *MockCalculationRepository) ReplaceCalculationLines(arg0 context.Context, arg1 repository.ReplacingCalculationLines) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceCalculationLines", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceCalculationLines indicates an expected call of ReplaceCalculationLines.
+func (mr *MockCalculationRepositoryMockRecorder) ReplaceCalculationLines(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceCalculationLines", reflect.TypeOf((*MockCalculationRepository)(nil).ReplaceCalculationLines), arg0, arg1)
+}
+
 // UpdateCalculationResult mocks base method.
 func (m *MockCalculationRepository) UpdateCalculationResult(arg0 context.Context, arg1 repository.AddCalculationResult) error {
 	m.ctrl.T.Helper()
@@ -169,6 +198,20 @@ func (mr *MockCalculationRulesMockRecorder) AddRules(arg0 interface{}, arg1 ...i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRules", reflect.TypeOf((*MockCalculationRules)(nil).AddRules), varargs...)
 }
 
+// DeleteRule mocks base method.
+func (m *MockCalculationRules) DeleteRule(arg0 context.Context, arg1 repository.DeletingRule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRule", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRule indicates an expected call of DeleteRule.
+func (mr *MockCalculationRulesMockRecorder) DeleteRule(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRule", reflect.TypeOf((*MockCalculationRules)(nil).DeleteRule), arg0, arg1)
+}
+
 // Rules mocks base method.
 func (m *MockCalculationRules) Rules(arg0 context.Context, arg1 repository.RuleFilter) ([]repository.RuleInfo, error) {
 	m.ctrl.T.Helper()
@@ -183,3 +226,31 @@ func (mr *MockCalculationRulesMockRecorder) Rules(arg0, arg1 interface{}) *gomoc
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rules", reflect.TypeOf((*MockCalculationRules)(nil).Rules), arg0, arg1)
 }
+
+// SetRuleDisabled mocks base method.
+func (m *MockCalculationRules) SetRuleDisabled(arg0 context.Context, arg1 repository.RuleDisabling) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetRuleDisabled", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetRuleDisabled indicates an expected call of SetRuleDisabled.
+func (mr *MockCalculationRulesMockRecorder) SetRuleDisabled(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRuleDisabled", reflect.TypeOf((*MockCalculationRules)(nil).SetRuleDisabled), arg0, arg1)
+}
+
+// UpdateRule mocks base method.
+func (m *MockCalculationRules) UpdateRule(arg0 context.Context, arg1 repository.UpdatingRule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRule", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRule indicates an expected call of UpdateRule.
+func (mr *MockCalculationRulesMockRecorder) UpdateRule(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRule", reflect.TypeOf((*MockCalculationRules)(nil).UpdateRule), arg0, arg1)
+}
@@ -1,12 +1,17 @@
 package calculation
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	repository "github.com/vilasle/gophermart/internal/repository/calculation"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 type RuleServiceConfig struct {
@@ -27,48 +32,415 @@ func NewRuleService(config RuleServiceConfig) *RuleService {
 }
 
 func (s RuleService) Register(ctx context.Context, dto service.RegisterCalculationRuleRequest) error {
+	adding, err := prepareAddingRule(dto)
+	if err != nil {
+		return err
+	}
+
+	id, err := s.rep.AddRules(ctx, adding)
+	if err != nil {
+		return ruleError(err)
+	}
+
+	s.manager.RaiseEvent(NewRule, id)
+
+	return nil
+}
+
+func (s RuleService) Rules(ctx context.Context) ([]service.CalculationRuleInfo, error) {
+	rs, err := s.rep.Rules(ctx, repository.RuleFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]service.CalculationRuleInfo, 0, len(rs))
+	for _, r := range rs {
+		result = append(result, prepareRuleInfo(r))
+	}
+	return result, nil
+}
+
+func (s RuleService) Update(ctx context.Context, dto service.UpdateCalculationRuleRequest) error {
+	adding, err := prepareAddingRule(dto.RegisterCalculationRuleRequest)
+	if err != nil {
+		return err
+	}
+
+	if err := s.rep.UpdateRule(ctx, repository.UpdatingRule{ID: dto.ID, AddingRule: adding}); err != nil {
+		return ruleError(err)
+	}
+
+	s.manager.RaiseEvent(UpdateRule, dto.ID)
+
+	return nil
+}
+
+func (s RuleService) SetDisabled(ctx context.Context, dto service.DisableCalculationRuleRequest) error {
+	if err := s.rep.SetRuleDisabled(ctx, repository.RuleDisabling{ID: dto.ID, Disabled: dto.Disabled}); err != nil {
+		return ruleError(err)
+	}
+
+	//rule is read again, disabled rule is removed from calculation
+	s.manager.RaiseEvent(UpdateRule, dto.ID)
+
+	return nil
+}
+
+func (s RuleService) Delete(ctx context.Context, dto service.DeleteCalculationRuleRequest) error {
+	if err := s.rep.DeleteRule(ctx, repository.DeletingRule{ID: dto.ID}); err != nil {
+		return ruleError(err)
+	}
+
+	s.manager.RaiseEvent(DeleteRule, dto.ID)
+
+	return nil
+}
+
+// prepareAddingRule checks rule and converts it for saving
+func prepareAddingRule(dto service.RegisterCalculationRuleRequest) (repository.AddingRule, error) {
 	//add for ignoring register of letters
 	exp := strings.Join([]string{"(?i)", dto.Match}, "")
 
 	//to be sure that exp is correct
 	_, err := regexp.Compile(exp)
 	if err != nil {
-		return err
+		return repository.AddingRule{}, err
+	}
+
+	//rule without policy is evaluated as the first match
+	if _, correct := service.DefineRulePolicy(dto.Policy); !correct && dto.Policy != service.RulePolicyUnknown {
+		return repository.AddingRule{}, service.ErrInvalidFormat
+	}
+	if dto.Cap < 0 || (dto.Policy == service.RulePolicyCap) != (dto.Cap > 0) {
+		//cap is set only for policy which uses it
+		return repository.AddingRule{}, service.ErrInvalidFormat
+	}
+	if !validKind(dto) {
+		return repository.AddingRule{}, service.ErrInvalidFormat
+	}
+
+	weekdays, correct := weekdaysMask(dto.Weekdays)
+	if !correct || !validPeriod(dto.ValidFrom, dto.ValidTo) || !validHours(dto.HourFrom, dto.HourTo) {
+		return repository.AddingRule{}, service.ErrInvalidFormat
 	}
 
-	id, err := s.rep.AddRules(ctx, repository.AddingRule{
+	return repository.AddingRule{
+		Kind:            dto.Kind,
 		Match:           dto.Match,
 		Point:           dto.Point,
 		CalculationType: dto.Type,
-	})
+		Threshold:       dto.Threshold,
+		Priority:        dto.Priority,
+		Policy:          dto.Policy,
+		Cap:             dto.Cap,
+		ValidFrom:       dto.ValidFrom,
+		ValidTo:         dto.ValidTo,
+		Weekdays:        weekdays,
+		HourFrom:        dto.HourFrom,
+		HourTo:          dto.HourTo,
+	}, nil
+}
 
-	if err != nil {
-		if err == repository.ErrDuplicate {
-			return service.ErrDuplicate
-		}
-		return err
+// validKind checks that rule has only fields which are used by its kind
+func validKind(dto service.RegisterCalculationRuleRequest) bool {
+	_, typed := service.DefineCalculationType(dto.Type)
+
+	switch dto.Kind {
+	case service.RuleKindProduct:
+		return dto.Threshold == 0
+	case service.RuleKindOrderBonus:
+		return dto.Match == "" && typed && dto.Point > 0 && dto.Threshold > 0 && orderPolicy(dto)
+	case service.RuleKindOrderCap:
+		return dto.Match == "" && typed && dto.Point > 0 && dto.Threshold == 0 && orderPolicy(dto)
+	case service.RuleKindMinPrice:
+		return dto.Match == "" && dto.Point == 0 && dto.Threshold > 0 && orderPolicy(dto)
+	default:
+		return false
 	}
+}
 
-	s.manager.RaiseEvent(NewRule, id)
+// orderPolicy checks that policy is not set for rule of order, policies combine rewards of products only
+func orderPolicy(dto service.RegisterCalculationRuleRequest) bool {
+	return dto.Policy == service.RulePolicyUnknown && dto.Cap == 0
+}
 
-	return nil
+func prepareRuleInfo(r repository.RuleInfo) service.CalculationRuleInfo {
+	return service.CalculationRuleInfo{
+		ID: r.ID,
+		RegisterCalculationRuleRequest: service.RegisterCalculationRuleRequest{
+			Kind:      r.Kind,
+			Match:     r.Match,
+			Point:     r.Point,
+			Type:      r.CalculationType,
+			Threshold: r.Threshold,
+			Priority:  r.Priority,
+			Policy:    r.Policy,
+			Cap:       r.Cap,
+			ValidFrom: r.ValidFrom,
+			ValidTo:   r.ValidTo,
+			Weekdays:  weekdaysOfMask(r.Weekdays),
+			HourFrom:  r.HourFrom,
+			HourTo:    r.HourTo,
+		},
+		Disabled: r.Disabled,
+	}
+}
+
+func ruleError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrDuplicate):
+		return service.ErrDuplicate
+	case errors.Is(err, repository.ErrNotFound):
+		return service.ErrRuleNotFound
+	default:
+		return err
+	}
 }
 
 type rule struct {
+	kind            service.RuleKind
 	exp             *regexp.Regexp
 	calculationType service.CalculationType
-	value           float64
+	value           money.Money
+	threshold       money.Money
+	priority        int
+	policy          service.RulePolicy
+	cap             money.Money
+	schedule        schedule
+	//source of exp, it is copied to calculation lines
+	match string
 }
 
-func (r *rule) calculate(name string, price float64) float64 {
-	if r.exp.MatchString(name) {
-		switch r.calculationType {
-		case service.CalculationTypePercent:
-			return price * (r.value / 100)
-		case service.CalculationTypeFixed:
-			return r.value
+// schedule limits time of purchase when rule is applied
+type schedule struct {
+	//zero time is not bounded
+	validFrom time.Time
+	validTo   time.Time
+	//bit i is set for time.Weekday(i), zero means every day
+	weekdays int
+	//window [hourFrom, hourTo) which can pass midnight, rule is applied at any hour if they are equal
+	hourFrom int
+	hourTo   int
+}
+
+// activeAt reports whether rule is applied to order purchased at t, days and hours are evaluated in location of t
+func (s schedule) activeAt(t time.Time) bool {
+	if !s.validFrom.IsZero() && t.Before(s.validFrom) {
+		return false
+	}
+	if !s.validTo.IsZero() && !t.Before(s.validTo) {
+		return false
+	}
+	if s.weekdays != 0 && s.weekdays&(1<<t.Weekday()) == 0 {
+		return false
+	}
+
+	hour := t.Hour()
+	switch {
+	case s.hourFrom < s.hourTo:
+		return hour >= s.hourFrom && hour < s.hourTo
+	case s.hourFrom > s.hourTo:
+		return hour >= s.hourFrom || hour < s.hourTo
+	default:
+		return true
+	}
+}
+
+func weekdaysMask(days []time.Weekday) (mask int, correct bool) {
+	for _, day := range days {
+		if day < time.Sunday || day > time.Saturday {
+			return 0, false
+		}
+		mask |= 1 << day
+	}
+	return mask, true
+}
+
+func weekdaysOfMask(mask int) []time.Weekday {
+	days := make([]time.Weekday, 0)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if mask&(1<<day) != 0 {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+func validPeriod(from, to time.Time) bool {
+	return from.IsZero() || to.IsZero() || to.After(from)
+}
+
+func validHours(from, to int) bool {
+	return from >= 0 && from < 24 && to >= 0 && to <= 24
+}
+
+// matchedRule is rule which gives reward for product
+type matchedRule struct {
+	id     int16
+	rule   rule
+	reward money.Money
+}
+
+/*
+contributingRules returns rules which give reward for product with points which are given by each of them.
+Rules are ordered by priority (higher first) and id, so result does not depend on order of their storing.
+Every matched rule is evaluated by its own policy, it defines how reward of rule is combined with result
+of rules after it:
+  - first: reward of rule only, rules after it are not used;
+  - best: the larger of reward of rule and result of rules after it, rule wins on equal rewards;
+  - stack: reward of rule and result of rules after it;
+  - cap: as stack, but sum is limited by cap of rule, rewards are used in order until cap is reached.
+*/
+func contributingRules(matched []matchedRule) []matchedRule {
+	if len(matched) == 0 {
+		return nil
+	}
+
+	slices.SortFunc(matched, func(a, b matchedRule) int {
+		if a.rule.priority != b.rule.priority {
+			return cmp.Compare(b.rule.priority, a.rule.priority)
+		}
+		return cmp.Compare(a.id, b.id)
+	})
+
+	//result is built from the last rule, nothing is after it
+	var result []matchedRule
+	for i := len(matched) - 1; i >= 0; i-- {
+		m := matched[i]
+		switch m.rule.policy {
+		case service.RulePolicyBest:
+			if m.reward >= matchedReward(result) {
+				result = []matchedRule{m}
+			}
+		case service.RulePolicyStack:
+			result = append([]matchedRule{m}, result...)
+		case service.RulePolicyCap:
+			result = limitRewards(append([]matchedRule{m}, result...), m.rule.cap)
+		default:
+			result = []matchedRule{m}
+		}
+	}
+	return result
+}
+
+func matchedReward(matched []matchedRule) money.Money {
+	var reward money.Money
+	for _, m := range matched {
+		reward += m.reward
+	}
+	return reward
+}
+
+// limitRewards uses rewards of rules in order until limit is reached
+func limitRewards(matched []matchedRule, limit money.Money) []matchedRule {
+	result := make([]matchedRule, 0, len(matched))
+	for _, m := range matched {
+		if limit <= 0 {
+			break
 		}
+		m.reward = min(m.reward, limit)
+		limit -= m.reward
+		result = append(result, m)
+	}
+	return result
+}
+
+func (r *rule) calculate(name string, price money.Money) money.Money {
+	if r.exp.MatchString(name) {
+		return r.reward(price)
 	}
 	return 0
 
 }
+
+// reward is fixed value of rule or its percent of amount
+func (r *rule) reward(amount money.Money) money.Money {
+	switch r.calculationType {
+	case service.CalculationTypePercent:
+		return amount.Percent(r.value)
+	case service.CalculationTypeFixed:
+		return r.value
+	default:
+		return 0
+	}
+}
+
+// orderRules are evaluated after rules of products
+type orderRules struct {
+	//products which are cheaper are not rewarded by rules of products
+	minPrice     money.Money
+	minPriceRule int16
+	bonuses      []matchedRule
+	caps         []matchedRule
+}
+
+func (o *orderRules) add(id int16, r rule) {
+	switch r.kind {
+	case service.RuleKindMinPrice:
+		//product must satisfy all of them
+		if r.threshold > o.minPrice {
+			o.minPrice, o.minPriceRule = r.threshold, id
+		}
+	case service.RuleKindOrderBonus:
+		o.bonuses = append(o.bonuses, matchedRule{id: id, rule: r})
+	case service.RuleKindOrderCap:
+		o.caps = append(o.caps, matchedRule{id: id, rule: r})
+	}
+}
+
+// lines returns bonuses which are given and reduction of reward by the least cap
+func (o orderRules) lines(reward, total money.Money) []rewardLine {
+	lines := make([]rewardLine, 0)
+	for _, bonus := range o.bonuses {
+		if total > bonus.rule.threshold {
+			line := newRewardLine(bonus.id, bonus.rule, bonus.rule.reward(total))
+			reward += line.points
+			lines = append(lines, line)
+		}
+	}
+
+	limited, limit := reward, -1
+	for i, c := range o.caps {
+		if v := c.rule.reward(total); v < limited {
+			limited, limit = v, i
+		}
+	}
+	if limit >= 0 {
+		lines = append(lines, newRewardLine(o.caps[limit].id, o.caps[limit].rule, limited-reward))
+	}
+	return lines
+}
+
+// rewardLine is part of reward of order, lines explain which rule gave points for which product
+type rewardLine struct {
+	//position of product in order starting from 1, it is 0 for rules of order
+	line    int
+	product service.ProductRow
+	//it is 0 if rule is not matched
+	ruleID          int16
+	kind            service.RuleKind
+	calculationType service.CalculationType
+	points          money.Money
+	//terms of rule are kept with line, rule can be changed later
+	match string
+	value money.Money
+}
+
+func linesReward(lines []rewardLine) money.Money {
+	var reward money.Money
+	for _, line := range lines {
+		reward += line.points
+	}
+	return reward
+}
+
+func newRewardLine(id int16, r rule, points money.Money) rewardLine {
+	return rewardLine{
+		ruleID:          id,
+		kind:            r.kind,
+		calculationType: r.calculationType,
+		points:          points,
+		match:           r.match,
+		value:           r.value,
+	}
+}
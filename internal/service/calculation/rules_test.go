@@ -3,16 +3,26 @@ package calculation
 import (
 	"context"
 	"regexp"
+	"sync"
 	"testing"
+	"time"
 
 	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	repository "github.com/vilasle/gophermart/internal/repository/calculation"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 func TestRuleService_Register(t *testing.T) {
 	type behavior func(rep *MockCalculationRules, ctx context.Context, dto service.RegisterCalculationRuleRequest, id int16) error
 
+	//invalid rule is not saved
+	noCalls := func(*MockCalculationRules, context.Context, service.RegisterCalculationRuleRequest, int16) error {
+		return nil
+	}
+
 	type args struct {
 		ctx context.Context
 		dto service.RegisterCalculationRuleRequest
@@ -29,7 +39,7 @@ func TestRuleService_Register(t *testing.T) {
 				ctx: context.Background(),
 				dto: service.RegisterCalculationRuleRequest{
 					Match: "test",
-					Point: 5,
+					Point: money.FromInt(5),
 					Type:  service.CalculationTypePercent,
 				},
 				behavior: func(rep *MockCalculationRules, ctx context.Context, dto service.RegisterCalculationRuleRequest, id int16) error {
@@ -42,6 +52,181 @@ func TestRuleService_Register(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "rule with cap",
+			args: args{
+				ctx: context.Background(),
+				dto: service.RegisterCalculationRuleRequest{
+					Match:    "test",
+					Point:    money.FromInt(5),
+					Type:     service.CalculationTypePercent,
+					Priority: 10,
+					Policy:   service.RulePolicyCap,
+					Cap:      money.FromInt(50),
+				},
+				behavior: func(rep *MockCalculationRules, ctx context.Context, dto service.RegisterCalculationRuleRequest, id int16) error {
+					rep.EXPECT().AddRules(ctx, repository.AddingRule{
+						Match:           dto.Match,
+						Point:           dto.Point,
+						CalculationType: dto.Type,
+						Priority:        10,
+						Policy:          service.RulePolicyCap,
+						Cap:             money.FromInt(50),
+					}).Return(id, nil)
+					return nil
+				},
+			},
+		},
+		{
+			name: "cap is not set",
+			args: args{
+				ctx:      context.Background(),
+				dto:      service.RegisterCalculationRuleRequest{Match: "test", Point: money.FromInt(5), Policy: service.RulePolicyCap},
+				behavior: noCalls,
+			},
+			wantErr: true,
+		},
+		{
+			name: "cap of another policy",
+			args: args{
+				ctx:      context.Background(),
+				dto:      service.RegisterCalculationRuleRequest{Match: "test", Point: money.FromInt(5), Policy: service.RulePolicyBest, Cap: money.FromInt(50)},
+				behavior: noCalls,
+			},
+			wantErr: true,
+		},
+		{
+			name: "scheduled rule",
+			args: args{
+				ctx: context.Background(),
+				dto: service.RegisterCalculationRuleRequest{
+					Match:     "bosch",
+					Point:     money.FromInt(10),
+					Type:      service.CalculationTypePercent,
+					ValidFrom: time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC),
+					ValidTo:   time.Date(2024, 11, 8, 0, 0, 0, 0, time.UTC),
+					Weekdays:  []time.Weekday{time.Saturday, time.Sunday},
+					HourFrom:  22,
+					HourTo:    2,
+				},
+				behavior: func(rep *MockCalculationRules, ctx context.Context, dto service.RegisterCalculationRuleRequest, id int16) error {
+					rep.EXPECT().AddRules(ctx, repository.AddingRule{
+						Match:           dto.Match,
+						Point:           dto.Point,
+						CalculationType: dto.Type,
+						ValidFrom:       dto.ValidFrom,
+						ValidTo:         dto.ValidTo,
+						Weekdays:        1<<time.Saturday | 1<<time.Sunday,
+						HourFrom:        22,
+						HourTo:          2,
+					}).Return(id, nil)
+					return nil
+				},
+			},
+		},
+		{
+			name: "period is finished before start",
+			args: args{
+				ctx: context.Background(),
+				dto: service.RegisterCalculationRuleRequest{
+					Match:     "test",
+					Point:     money.FromInt(5),
+					ValidFrom: time.Date(2024, 11, 8, 0, 0, 0, 0, time.UTC),
+					ValidTo:   time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC),
+				},
+				behavior: noCalls,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown day of week",
+			args: args{
+				ctx:      context.Background(),
+				dto:      service.RegisterCalculationRuleRequest{Match: "test", Point: money.FromInt(5), Weekdays: []time.Weekday{7}},
+				behavior: noCalls,
+			},
+			wantErr: true,
+		},
+		{
+			name: "hour out of day",
+			args: args{
+				ctx:      context.Background(),
+				dto:      service.RegisterCalculationRuleRequest{Match: "test", Point: money.FromInt(5), HourFrom: 24, HourTo: 2},
+				behavior: noCalls,
+			},
+			wantErr: true,
+		},
+		{
+			name: "order bonus",
+			args: args{
+				ctx: context.Background(),
+				dto: service.RegisterCalculationRuleRequest{
+					Kind:      service.RuleKindOrderBonus,
+					Point:     money.FromInt(100),
+					Type:      service.CalculationTypeFixed,
+					Threshold: money.FromInt(5000),
+				},
+				behavior: func(rep *MockCalculationRules, ctx context.Context, dto service.RegisterCalculationRuleRequest, id int16) error {
+					rep.EXPECT().AddRules(ctx, repository.AddingRule{
+						Kind:            service.RuleKindOrderBonus,
+						Point:           money.FromInt(100),
+						CalculationType: service.CalculationTypeFixed,
+						Threshold:       money.FromInt(5000),
+					}).Return(id, nil)
+					return nil
+				},
+			},
+		},
+		{
+			name: "order rule with match",
+			args: args{
+				ctx: context.Background(),
+				dto: service.RegisterCalculationRuleRequest{
+					Kind:  service.RuleKindOrderCap,
+					Match: "bosch",
+					Point: money.FromInt(500),
+					Type:  service.CalculationTypeFixed,
+				},
+				behavior: noCalls,
+			},
+			wantErr: true,
+		},
+		{
+			name: "minimal price with reward",
+			args: args{
+				ctx:      context.Background(),
+				dto:      service.RegisterCalculationRuleRequest{Kind: service.RuleKindMinPrice, Point: money.FromInt(5), Threshold: money.FromInt(100)},
+				behavior: noCalls,
+			},
+			wantErr: true,
+		},
+		{
+			name: "threshold of product rule",
+			args: args{
+				ctx:      context.Background(),
+				dto:      service.RegisterCalculationRuleRequest{Match: "test", Point: money.FromInt(5), Threshold: money.FromInt(100)},
+				behavior: noCalls,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown kind",
+			args: args{
+				ctx:      context.Background(),
+				dto:      service.RegisterCalculationRuleRequest{Kind: 42, Point: money.FromInt(5), Type: service.CalculationTypeFixed},
+				behavior: noCalls,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown policy",
+			args: args{
+				ctx:      context.Background(),
+				dto:      service.RegisterCalculationRuleRequest{Match: "test", Point: money.FromInt(5), Policy: 42},
+				behavior: noCalls,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -79,54 +264,54 @@ func Test_rule_calculate(t *testing.T) {
 	type fields struct {
 		exp             *regexp.Regexp
 		calculationType service.CalculationType
-		value           float64
+		value           money.Money
 	}
 	type args struct {
 		name  string
-		price float64
+		price money.Money
 	}
 	tests := []struct {
 		name   string
 		fields fields
 		args   args
-		want   float64
+		want   money.Money
 	}{
 		{
 			name: "percent type",
 			fields: fields{
 				exp:             regexp.MustCompile("(?i)test"),
 				calculationType: service.CalculationTypePercent,
-				value:           5,
+				value:           money.FromInt(5),
 			},
 			args: args{
 				name:  "test",
-				price: 100,
+				price: money.FromInt(100),
 			},
-			want: 5,
+			want: money.FromInt(5),
 		},
 		{
 			name: "fixed type",
 			fields: fields{
 				exp:             regexp.MustCompile("(?i)test"),
 				calculationType: service.CalculationTypeFixed,
-				value:           50,
+				value:           money.FromInt(50),
 			},
 			args: args{
 				name:  "test",
-				price: 100,
+				price: money.FromInt(100),
 			},
-			want: 50,
+			want: money.FromInt(50),
 		},
 		{
 			name: "unknown type",
 			fields: fields{
 				exp:             regexp.MustCompile("(?i)test"),
 				calculationType: service.CalculationType(10),
-				value:           10,
+				value:           money.FromInt(10),
 			},
 			args: args{
 				name:  "test",
-				price: 100,
+				price: money.FromInt(100),
 			},
 			want: 0,
 		},
@@ -135,52 +320,52 @@ func Test_rule_calculate(t *testing.T) {
 			fields: fields{
 				exp:             regexp.MustCompile("(?i)test"),
 				calculationType: service.CalculationTypeFixed,
-				value:           10,
+				value:           money.FromInt(10),
 			},
 			args: args{
 				name:  "TEST",
-				price: 100,
+				price: money.FromInt(100),
 			},
-			want: 10,
+			want: money.FromInt(10),
 		},
 		{
 			name: "match in middle",
 			fields: fields{
 				exp:             regexp.MustCompile("(?i)test"),
 				calculationType: service.CalculationTypeFixed,
-				value:           10,
+				value:           money.FromInt(10),
 			},
 			args: args{
 				name:  "fvdfg23432TEST32423fvfdv23",
-				price: 100,
+				price: money.FromInt(100),
 			},
-			want: 10,
+			want: money.FromInt(10),
 		},
 		{
 			name: "match in start",
 			fields: fields{
 				exp:             regexp.MustCompile("(?i)test"),
 				calculationType: service.CalculationTypeFixed,
-				value:           10,
+				value:           money.FromInt(10),
 			},
 			args: args{
 				name:  "testfvdfg23432TEST32423fvfdv23",
-				price: 100,
+				price: money.FromInt(100),
 			},
-			want: 10,
+			want: money.FromInt(10),
 		},
 		{
 			name: "match in finish",
 			fields: fields{
 				exp:             regexp.MustCompile("(?i)test"),
 				calculationType: service.CalculationTypeFixed,
-				value:           10,
+				value:           money.FromInt(10),
 			},
 			args: args{
 				name:  "fvdfg2343232423fvfdv23test",
-				price: 100,
+				price: money.FromInt(100),
 			},
-			want: 10,
+			want: money.FromInt(10),
 		},
 	}
 	for _, tt := range tests {
@@ -196,3 +381,507 @@ func Test_rule_calculate(t *testing.T) {
 		})
 	}
 }
+
+func Test_contributingRulesReward(t *testing.T) {
+	fixed := func(id int16, priority int, policy service.RulePolicy, reward int64) matchedRule {
+		return matchedRule{id: id, rule: rule{priority: priority, policy: policy, cap: money.FromInt(25)}, reward: money.FromInt(reward)}
+	}
+
+	tests := []struct {
+		name    string
+		matched []matchedRule
+		want    money.Money
+	}{
+		{
+			name: "nothing is matched",
+			want: 0,
+		},
+		{
+			name:    "the first by priority",
+			matched: []matchedRule{fixed(1, 0, service.RulePolicyFirst, 10), fixed(2, 5, service.RulePolicyFirst, 20)},
+			want:    money.FromInt(20),
+		},
+		{
+			name:    "the first by id with the same priority",
+			matched: []matchedRule{fixed(3, 0, service.RulePolicyFirst, 30), fixed(2, 0, service.RulePolicyUnknown, 20)},
+			want:    money.FromInt(20),
+		},
+		{
+			name:    "best for customer",
+			matched: []matchedRule{fixed(1, 0, service.RulePolicyBest, 10), fixed(2, 0, service.RulePolicyBest, 30), fixed(3, 5, service.RulePolicyBest, 20)},
+			want:    money.FromInt(30),
+		},
+		{
+			name:    "best of rule and the first of rules after it",
+			matched: []matchedRule{fixed(1, 0, service.RulePolicyFirst, 10), fixed(2, 0, service.RulePolicyFirst, 30), fixed(3, 5, service.RulePolicyBest, 20)},
+			want:    money.FromInt(20),
+		},
+		{
+			name:    "stack",
+			matched: []matchedRule{fixed(1, 0, service.RulePolicyStack, 10), fixed(2, 0, service.RulePolicyStack, 30), fixed(3, 5, service.RulePolicyStack, 20)},
+			want:    money.FromInt(60),
+		},
+		{
+			name:    "stack with the first of rules after it",
+			matched: []matchedRule{fixed(1, 0, service.RulePolicyFirst, 10), fixed(2, 0, service.RulePolicyFirst, 30), fixed(3, 5, service.RulePolicyStack, 20)},
+			want:    money.FromInt(30),
+		},
+		{
+			name:    "stack is limited by cap",
+			matched: []matchedRule{fixed(1, 0, service.RulePolicyStack, 10), fixed(2, 0, service.RulePolicyStack, 30), fixed(3, 5, service.RulePolicyCap, 20)},
+			want:    money.FromInt(25),
+		},
+		{
+			name:    "cap limits only rules after it",
+			matched: []matchedRule{fixed(1, 5, service.RulePolicyStack, 20), fixed(2, 0, service.RulePolicyCap, 10), fixed(3, 0, service.RulePolicyStack, 30)},
+			want:    money.FromInt(45),
+		},
+		{
+			name:    "the first rule does not use rules after it",
+			matched: []matchedRule{fixed(1, 0, service.RulePolicyStack, 10), fixed(2, 5, service.RulePolicyFirst, 30)},
+			want:    money.FromInt(30),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make([]rewardLine, 0)
+			for _, m := range contributingRules(tt.matched) {
+				lines = append(lines, newRewardLine(m.id, m.rule, m.reward))
+			}
+			assert.Equal(t, tt.want, linesReward(lines))
+		})
+	}
+}
+
+// productReward is reward of order with one product
+func productReward(c CalculationService, product service.ProductRow, purchasedAt time.Time) money.Money {
+	return linesReward(c.calculateLines([]service.ProductRow{product}, purchasedAt))
+}
+
+// map of rules is iterated in random order, result must not depend on it
+func TestCalculationService_calculateLinesDeterministic(t *testing.T) {
+	rules := []repository.RuleInfo{
+		{ID: 7, Match: "(?i)phone", Point: money.FromInt(15), CalculationType: service.CalculationTypeFixed},
+		{ID: 3, Match: "(?i)smart", Point: money.FromInt(5), CalculationType: service.CalculationTypePercent},
+		{ID: 5, Match: "(?i)phone", Point: money.FromInt(40), CalculationType: service.CalculationTypeFixed},
+		{ID: 9, Match: "(?i)smart", Point: money.FromInt(2), CalculationType: service.CalculationTypeFixed},
+		{ID: 4, Match: "(?i)smartphone", Point: money.FromInt(1), CalculationType: service.CalculationTypeFixed, Priority: -1, Policy: service.RulePolicyStack},
+	}
+	product := service.ProductRow{Name: "Smartphone", Price: money.FromInt(1000)}
+
+	for i := 0; i < 100; i++ {
+		c := CalculationService{mxRules: &sync.Mutex{}, rules: make(map[int16]rule)}
+		//order of loading does not matter too
+		require.NoError(t, c.fillRules(append(rules[i%len(rules):], rules[:i%len(rules)]...)))
+
+		//the first rule of priority 0 by id is 3: 5% of 1000
+		assert.Equal(t, money.FromInt(50), productReward(c, product, time.Now()), "run %d", i)
+	}
+}
+
+func Test_schedule_activeAt(t *testing.T) {
+	//it is Friday
+	at := time.Date(2024, 11, 1, 23, 30, 0, 0, time.UTC)
+	weekend := 1<<time.Saturday | 1<<time.Sunday
+
+	tests := []struct {
+		name     string
+		schedule schedule
+		want     bool
+	}{
+		{name: "without bounds", want: true},
+		{name: "start of period", schedule: schedule{validFrom: at}, want: true},
+		{name: "before period", schedule: schedule{validFrom: at.Add(time.Second)}, want: false},
+		{name: "end of period is excluded", schedule: schedule{validTo: at}, want: false},
+		{name: "in period", schedule: schedule{validFrom: at.AddDate(0, 0, -1), validTo: at.AddDate(0, 0, 6)}, want: true},
+		{name: "expired", schedule: schedule{validFrom: at.AddDate(0, 0, -7), validTo: at.AddDate(0, 0, -1)}, want: false},
+		{name: "day of week", schedule: schedule{weekdays: 1 << time.Friday}, want: true},
+		{name: "another day of week", schedule: schedule{weekdays: weekend}, want: false},
+		{name: "hours", schedule: schedule{hourFrom: 18, hourTo: 24}, want: true},
+		{name: "another hours", schedule: schedule{hourFrom: 9, hourTo: 18}, want: false},
+		{name: "hours over midnight", schedule: schedule{hourFrom: 22, hourTo: 2}, want: true},
+		{name: "hours over midnight finished", schedule: schedule{hourFrom: 0, hourTo: 23}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.schedule.activeAt(at))
+		})
+	}
+}
+
+// promotion is applied by time of purchase, late recalculation of order gets the same reward
+func TestCalculationService_calculateLinesScheduled(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	c := CalculationService{mxRules: &sync.Mutex{}, rules: make(map[int16]rule), location: moscow}
+	require.NoError(t, c.fillRules([]repository.RuleInfo{
+		{ID: 1, Match: "(?i)bosch", Point: money.FromInt(5), CalculationType: service.CalculationTypePercent},
+		{
+			ID: 2, Match: "(?i)bosch", Point: money.FromInt(10), CalculationType: service.CalculationTypePercent, Priority: 1,
+			ValidFrom: time.Date(2024, 11, 1, 0, 0, 0, 0, moscow),
+			ValidTo:   time.Date(2024, 11, 8, 0, 0, 0, 0, moscow),
+		},
+		{
+			ID: 3, Match: "(?i)bosch", Point: money.FromInt(20), CalculationType: service.CalculationTypePercent, Priority: 2,
+			Weekdays: 1 << time.Sunday, HourFrom: 10, HourTo: 12,
+		},
+	}))
+	product := service.ProductRow{Name: "Bosch drill", Price: money.FromInt(1000)}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want money.Money
+	}{
+		{name: "before promotion", at: time.Date(2024, 10, 31, 20, 59, 0, 0, time.UTC), want: money.FromInt(50)},
+		{name: "promotion started in local time", at: time.Date(2024, 10, 31, 21, 0, 0, 0, time.UTC), want: money.FromInt(100)},
+		{name: "sunday morning in local time", at: time.Date(2024, 11, 3, 7, 0, 0, 0, time.UTC), want: money.FromInt(200)},
+		{name: "after promotion", at: time.Date(2024, 11, 8, 9, 0, 0, 0, moscow), want: money.FromInt(50)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, productReward(c, product, tt.at))
+		})
+	}
+}
+
+func TestRuleService_manage(t *testing.T) {
+	ctx := context.Background()
+	rule := service.RegisterCalculationRuleRequest{Match: "bosch", Point: money.FromInt(10), Type: service.CalculationTypePercent}
+	adding := repository.AddingRule{Match: "bosch", Point: money.FromInt(10), CalculationType: service.CalculationTypePercent}
+
+	tests := []struct {
+		name      string
+		behavior  func(rep *MockCalculationRules)
+		call      func(s *RuleService) error
+		wantErr   error
+		wantEvent EventType
+	}{
+		{
+			name: "update",
+			behavior: func(rep *MockCalculationRules) {
+				rep.EXPECT().UpdateRule(ctx, repository.UpdatingRule{ID: 3, AddingRule: adding}).Return(nil)
+			},
+			call: func(s *RuleService) error {
+				return s.Update(ctx, service.UpdateCalculationRuleRequest{ID: 3, RegisterCalculationRuleRequest: rule})
+			},
+			wantEvent: UpdateRule,
+		},
+		{
+			name:     "update by invalid rule",
+			behavior: func(*MockCalculationRules) {},
+			call: func(s *RuleService) error {
+				invalid := rule
+				invalid.HourFrom = 25
+				return s.Update(ctx, service.UpdateCalculationRuleRequest{ID: 3, RegisterCalculationRuleRequest: invalid})
+			},
+			wantErr: service.ErrInvalidFormat,
+		},
+		{
+			name: "update by duplicate match",
+			behavior: func(rep *MockCalculationRules) {
+				rep.EXPECT().UpdateRule(ctx, repository.UpdatingRule{ID: 3, AddingRule: adding}).Return(repository.ErrDuplicate)
+			},
+			call: func(s *RuleService) error {
+				return s.Update(ctx, service.UpdateCalculationRuleRequest{ID: 3, RegisterCalculationRuleRequest: rule})
+			},
+			wantErr: service.ErrDuplicate,
+		},
+		{
+			name: "disable",
+			behavior: func(rep *MockCalculationRules) {
+				rep.EXPECT().SetRuleDisabled(ctx, repository.RuleDisabling{ID: 3, Disabled: true}).Return(nil)
+			},
+			call: func(s *RuleService) error {
+				return s.SetDisabled(ctx, service.DisableCalculationRuleRequest{ID: 3, Disabled: true})
+			},
+			wantEvent: UpdateRule,
+		},
+		{
+			name: "disable unknown rule",
+			behavior: func(rep *MockCalculationRules) {
+				rep.EXPECT().SetRuleDisabled(ctx, repository.RuleDisabling{ID: 3, Disabled: true}).Return(repository.ErrNotFound)
+			},
+			call: func(s *RuleService) error {
+				return s.SetDisabled(ctx, service.DisableCalculationRuleRequest{ID: 3, Disabled: true})
+			},
+			wantErr: service.ErrRuleNotFound,
+		},
+		{
+			name: "delete",
+			behavior: func(rep *MockCalculationRules) {
+				rep.EXPECT().DeleteRule(ctx, repository.DeletingRule{ID: 3}).Return(nil)
+			},
+			call: func(s *RuleService) error {
+				return s.Delete(ctx, service.DeleteCalculationRuleRequest{ID: 3})
+			},
+			wantEvent: DeleteRule,
+		},
+		{
+			name: "delete unknown rule",
+			behavior: func(rep *MockCalculationRules) {
+				rep.EXPECT().DeleteRule(ctx, repository.DeletingRule{ID: 3}).Return(repository.ErrNotFound)
+			},
+			call: func(s *RuleService) error {
+				return s.Delete(ctx, service.DeleteCalculationRuleRequest{ID: 3})
+			},
+			wantErr: service.ErrRuleNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			rep := NewMockCalculationRules(ctrl)
+			tt.behavior(rep)
+
+			//manager is not started, raised events stay in queue
+			em := NewEventManager()
+			em.inWork.Store(true)
+
+			s := NewRuleService(RuleServiceConfig{Repository: rep, EventManager: em})
+
+			err := tt.call(s)
+			require.ErrorIs(t, err, tt.wantErr)
+
+			if tt.wantEvent == 0 {
+				assert.Empty(t, em.events)
+				return
+			}
+			require.Len(t, em.events, 1)
+			assert.Equal(t, Event{Type: tt.wantEvent, Data: int16(3)}, <-em.events)
+		})
+	}
+}
+
+// changed rules are applied without restart
+func TestCalculationService_ruleEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	rep := NewMockCalculationRules(ctrl)
+	c := CalculationService{repRules: rep, mxRules: &sync.Mutex{}, rules: make(map[int16]rule)}
+	product := service.ProductRow{Name: "Bosch drill", Price: money.FromInt(1000)}
+
+	bosch := repository.RuleInfo{ID: 1, Match: "(?i)bosch", Point: money.FromInt(5), CalculationType: service.CalculationTypePercent}
+	require.NoError(t, c.fillRules([]repository.RuleInfo{bosch}))
+	assert.Equal(t, money.FromInt(50), productReward(c, product, time.Now()))
+
+	bosch.Point = money.FromInt(10)
+	rep.EXPECT().Rules(ctx, repository.RuleFilter{ID: 1}).Return([]repository.RuleInfo{bosch}, nil)
+	c.readRule(ctx, Event{Type: UpdateRule, Data: int16(1)})
+	assert.Equal(t, money.FromInt(100), productReward(c, product, time.Now()))
+
+	bosch.Disabled = true
+	rep.EXPECT().Rules(ctx, repository.RuleFilter{ID: 1}).Return([]repository.RuleInfo{bosch}, nil)
+	c.readRule(ctx, Event{Type: UpdateRule, Data: int16(1)})
+	assert.Equal(t, money.Money(0), productReward(c, product, time.Now()))
+
+	bosch.Disabled = false
+	rep.EXPECT().Rules(ctx, repository.RuleFilter{ID: 1}).Return([]repository.RuleInfo{bosch}, nil)
+	c.readRule(ctx, Event{Type: UpdateRule, Data: int16(1)})
+	assert.Equal(t, money.FromInt(100), productReward(c, product, time.Now()))
+
+	c.removeRule(ctx, Event{Type: DeleteRule, Data: int16(1)})
+	assert.Empty(t, c.rules)
+
+	//event of rule which was deleted before it was handled does not bring rule back
+	require.NoError(t, c.fillRules([]repository.RuleInfo{bosch}))
+	rep.EXPECT().Rules(ctx, repository.RuleFilter{ID: 1}).Return([]repository.RuleInfo{}, nil)
+	c.readRule(ctx, Event{Type: UpdateRule, Data: int16(1)})
+	assert.Empty(t, c.rules)
+}
+
+// update and deletion of the same rule are handled concurrently by event manager
+func TestCalculationService_concurrentRuleEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	rep := NewMockCalculationRules(ctrl)
+	c := CalculationService{repRules: rep, mxRules: &sync.Mutex{}, rules: make(map[int16]rule)}
+
+	bosch := repository.RuleInfo{ID: 1, Match: "(?i)bosch", Point: money.FromInt(5), CalculationType: service.CalculationTypePercent}
+	require.NoError(t, c.fillRules([]repository.RuleInfo{bosch}))
+
+	//update reads rule before deletion is committed, deletion is handled while update is reading
+	read := make(chan struct{})
+	deleted := make(chan struct{})
+	rep.EXPECT().Rules(ctx, repository.RuleFilter{ID: 1}).DoAndReturn(
+		func(context.Context, repository.RuleFilter) ([]repository.RuleInfo, error) {
+			close(read)
+			select {
+			case <-deleted:
+			case <-time.After(100 * time.Millisecond):
+			}
+			return []repository.RuleInfo{bosch}, nil
+		})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.readRule(ctx, Event{Type: UpdateRule, Data: int16(1)})
+	}()
+
+	<-read
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.removeRule(ctx, Event{Type: DeleteRule, Data: int16(1)})
+		close(deleted)
+	}()
+	wg.Wait()
+
+	//deletion waits for update, so deleted rule is not applied again
+	assert.Empty(t, c.rules)
+}
+
+func Test_orderRules_lines(t *testing.T) {
+	bonus := func(threshold, value int64, calculationType service.CalculationType) rule {
+		return rule{kind: service.RuleKindOrderBonus, threshold: money.FromInt(threshold), value: money.FromInt(value), calculationType: calculationType}
+	}
+	limit := func(value int64, calculationType service.CalculationType) rule {
+		return rule{kind: service.RuleKindOrderCap, value: money.FromInt(value), calculationType: calculationType}
+	}
+
+	tests := []struct {
+		name   string
+		rules  []rule
+		reward int64
+		total  int64
+		want   money.Money
+	}{
+		{name: "without rules", reward: 300, total: 6000, want: money.FromInt(300)},
+		{name: "bonus", rules: []rule{bonus(5000, 100, service.CalculationTypeFixed)}, reward: 300, total: 6000, want: money.FromInt(400)},
+		{name: "threshold is not exceeded", rules: []rule{bonus(5000, 100, service.CalculationTypeFixed)}, reward: 300, total: 5000, want: money.FromInt(300)},
+		{
+			name:   "bonuses are summed",
+			rules:  []rule{bonus(5000, 100, service.CalculationTypeFixed), bonus(1000, 1, service.CalculationTypePercent)},
+			reward: 300, total: 6000, want: money.FromInt(460),
+		},
+		{name: "cap by points", rules: []rule{limit(250, service.CalculationTypeFixed)}, reward: 300, total: 6000, want: money.FromInt(250)},
+		{name: "cap by percent", rules: []rule{limit(2, service.CalculationTypePercent)}, reward: 300, total: 6000, want: money.FromInt(120)},
+		{
+			name:   "the least cap limits reward with bonus",
+			rules:  []rule{limit(10, service.CalculationTypePercent), bonus(5000, 500, service.CalculationTypeFixed), limit(700, service.CalculationTypeFixed)},
+			reward: 300, total: 6000, want: money.FromInt(600),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := orderRules{}
+			for i, r := range tt.rules {
+				order.add(int16(i+1), r)
+			}
+			reward := money.FromInt(tt.reward)
+			assert.Equal(t, tt.want, reward+linesReward(order.lines(reward, money.FromInt(tt.total))))
+		})
+	}
+}
+
+// rules of order are applied after rules of products
+func TestCalculationService_calculateLines(t *testing.T) {
+	c := CalculationService{mxRules: &sync.Mutex{}, rules: make(map[int16]rule), location: time.UTC}
+	require.NoError(t, c.fillRules([]repository.RuleInfo{
+		{ID: 1, Match: "(?i)bosch", Point: money.FromInt(10), CalculationType: service.CalculationTypePercent},
+		{ID: 2, Kind: service.RuleKindMinPrice, Threshold: money.FromInt(100)},
+		{ID: 3, Kind: service.RuleKindOrderBonus, Point: money.FromInt(100), CalculationType: service.CalculationTypeFixed, Threshold: money.FromInt(5000)},
+		{ID: 4, Kind: service.RuleKindOrderCap, Point: money.FromInt(1000), CalculationType: service.CalculationTypeFixed},
+		{
+			ID: 5, Kind: service.RuleKindOrderCap, Point: money.FromInt(5), CalculationType: service.CalculationTypePercent,
+			ValidFrom: time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}))
+	purchased := time.Date(2024, 10, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		products []service.ProductRow
+		at       time.Time
+		want     money.Money
+	}{
+		{
+			name:     "cheap product is not rewarded",
+			products: []service.ProductRow{{Name: "Bosch drill", Price: money.FromInt(1000)}, {Name: "Bosch bit", Price: money.FromInt(50)}},
+			at:       purchased,
+			want:     money.FromInt(100),
+		},
+		{
+			name:     "basket exceeds threshold",
+			products: []service.ProductRow{{Name: "Bosch drill", Price: money.FromInt(4000)}, {Name: "Makita saw", Price: money.FromInt(2000)}},
+			at:       purchased,
+			want:     money.FromInt(500),
+		},
+		{
+			name:     "reward of order is limited",
+			products: []service.ProductRow{{Name: "Bosch mower", Price: money.FromInt(20000)}},
+			at:       purchased,
+			want:     money.FromInt(1000),
+		},
+		{
+			name:     "scheduled cap is active",
+			products: []service.ProductRow{{Name: "Bosch mower", Price: money.FromInt(20000)}},
+			at:       purchased.AddDate(0, 1, 0),
+			want:     money.FromInt(1000),
+		},
+		{
+			name:     "scheduled percent cap is less",
+			products: []service.ProductRow{{Name: "Bosch drill", Price: money.FromInt(4000)}, {Name: "Makita saw", Price: money.FromInt(2000)}},
+			at:       purchased.AddDate(0, 1, 0),
+			want:     money.FromInt(300),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, linesReward(c.calculateLines(tt.products, tt.at)))
+		})
+	}
+}
+
+// lines of product show points which are really given by each rule
+func Test_contributingRules(t *testing.T) {
+	matched := func(id int16, policy service.RulePolicy, reward int64) matchedRule {
+		return matchedRule{id: id, rule: rule{policy: policy, cap: money.FromInt(25)}, reward: money.FromInt(reward)}
+	}
+	points := func(rules []matchedRule) map[int16]money.Money {
+		result := make(map[int16]money.Money)
+		for _, r := range rules {
+			result[r.id] = r.reward
+		}
+		return result
+	}
+
+	assert.Equal(t, map[int16]money.Money{2: money.FromInt(30)},
+		points(contributingRules([]matchedRule{matched(1, service.RulePolicyBest, 10), matched(2, 0, 30), matched(3, 0, 20)})))
+	assert.Equal(t, map[int16]money.Money{1: money.FromInt(10), 2: money.FromInt(15)},
+		points(contributingRules([]matchedRule{matched(1, service.RulePolicyCap, 10), matched(2, 0, 30), matched(3, 0, 20)})))
+	assert.Empty(t, contributingRules(nil))
+}
+
+func TestCalculationService_calculateLinesExplained(t *testing.T) {
+	c := CalculationService{mxRules: &sync.Mutex{}, rules: make(map[int16]rule), location: time.UTC}
+	require.NoError(t, c.fillRules([]repository.RuleInfo{
+		{ID: 1, Match: "(?i)bosch", Point: money.FromInt(10), CalculationType: service.CalculationTypePercent, Policy: service.RulePolicyStack},
+		{ID: 2, Match: "(?i)drill", Point: money.FromInt(50), CalculationType: service.CalculationTypeFixed},
+		{ID: 3, Kind: service.RuleKindMinPrice, Threshold: money.FromInt(100)},
+		{ID: 4, Kind: service.RuleKindOrderBonus, Point: money.FromInt(100), CalculationType: service.CalculationTypeFixed, Threshold: money.FromInt(5000)},
+		{ID: 5, Kind: service.RuleKindOrderCap, Point: money.FromInt(500), CalculationType: service.CalculationTypeFixed},
+	}))
+	drill := service.ProductRow{Name: "Bosch drill", Price: money.FromInt(4000)}
+	bit := service.ProductRow{Name: "Bosch bit", Price: money.FromInt(50)}
+	saw := service.ProductRow{Name: "Makita saw", Price: money.FromInt(2000)}
+
+	lines := c.calculateLines([]service.ProductRow{drill, bit, saw}, time.Now())
+
+	assert.Equal(t, []rewardLine{
+		{line: 1, product: drill, ruleID: 1, calculationType: service.CalculationTypePercent, points: money.FromInt(400), match: "(?i)bosch", value: money.FromInt(10)},
+		{line: 1, product: drill, ruleID: 2, calculationType: service.CalculationTypeFixed, points: money.FromInt(50), match: "(?i)drill", value: money.FromInt(50)},
+		{line: 2, product: bit, ruleID: 3, kind: service.RuleKindMinPrice},
+		{line: 3, product: saw},
+		{ruleID: 4, kind: service.RuleKindOrderBonus, calculationType: service.CalculationTypeFixed, points: money.FromInt(100), value: money.FromInt(100)},
+		{ruleID: 5, kind: service.RuleKindOrderCap, calculationType: service.CalculationTypeFixed, points: money.FromInt(-50), value: money.FromInt(500)},
+	}, lines)
+	assert.Equal(t, money.FromInt(500), linesReward(lines))
+}
@@ -1,6 +1,11 @@
 package service
 
-import "time"
+import (
+	"time"
+
+	"github.com/vilasle/gophermart/internal/tool/cursor"
+	"github.com/vilasle/gophermart/internal/tool/money"
+)
 
 type CalculationType = int
 
@@ -22,6 +27,54 @@ const (
 	CalculationTypeFixed
 )
 
+// RulePolicy defines how reward of rule is combined with rewards of rules which match the same product after it.
+// Matched rules are ordered by priority (higher first) and id, every of them is evaluated by its own policy
+type RulePolicy = int
+
+func DefineRulePolicy(p int) (value RulePolicy, correct bool) {
+	switch p {
+	case RulePolicyFirst, RulePolicyBest, RulePolicyStack, RulePolicyCap:
+		return p, true
+	default:
+		return RulePolicyUnknown, false
+	}
+}
+
+const (
+	RulePolicyUnknown RulePolicy = iota
+	// RulePolicyFirst gives reward of rule, rules after it are not used
+	RulePolicyFirst
+	// RulePolicyBest gives the larger of reward of rule and result of rules after it
+	RulePolicyBest
+	// RulePolicyStack gives sum of reward of rule and result of rules after it
+	RulePolicyStack
+	// RulePolicyCap gives the same sum as RulePolicyStack which is limited by cap of rule
+	RulePolicyCap
+)
+
+// RuleKind defines what rule is applied to. Order rules are evaluated after rules of products
+type RuleKind = int
+
+func DefineRuleKind(k int) (value RuleKind, correct bool) {
+	switch k {
+	case RuleKindProduct, RuleKindOrderBonus, RuleKindOrderCap, RuleKindMinPrice:
+		return k, true
+	default:
+		return RuleKindProduct, false
+	}
+}
+
+const (
+	// RuleKindProduct gives reward for product which matches rule
+	RuleKindProduct RuleKind = iota
+	// RuleKindOrderBonus gives reward if total price of order exceeds threshold, reward is fixed or percent of total price
+	RuleKindOrderBonus
+	// RuleKindOrderCap limits reward of order by fixed points or by percent of total price
+	RuleKindOrderCap
+	// RuleKindMinPrice excludes products which are cheaper than threshold from rewards of product rules
+	RuleKindMinPrice
+)
+
 type RegisterRequest struct {
 	Login    string
 	Password string
@@ -30,6 +83,8 @@ type RegisterRequest struct {
 type AuthorizeRequest struct {
 	Login    string
 	Password string
+	//failed logins are limited by login and by client address
+	ClientIP string
 }
 
 type UserID struct {
@@ -40,20 +95,130 @@ type UserInfo struct {
 	ID string
 }
 
+type SessionInfo struct {
+	UserID string
+	//jti of access token
+	TokenID      string
+	TokenVersion int
+	RefreshToken string
+	//refresh token can be used until this time
+	RefreshExpiresAt time.Time
+}
+
+type RefreshSessionRequest struct {
+	RefreshToken string
+}
+
+type CheckTokenRequest struct {
+	UserID       string
+	TokenID      string
+	TokenVersion int
+}
+
+type LogoutRequest struct {
+	UserID  string
+	TokenID string
+	//revoked access token is kept in revocation list until it expires
+	TokenExpiresAt time.Time
+}
+
+type ChangePasswordRequest struct {
+	UserID      string
+	OldPassword string
+	NewPassword string
+	//failed checks of old password are limited by client address too if it is set
+	ClientIP string
+}
+
+type DeletedAccountInfo struct {
+	//balance which was left on account
+	Forfeited money.Money
+}
+
 type RegisterOrderRequest struct {
 	UserID string
 	Number string
 }
 
+// MaxPageLimit is the largest page of lists, it is also used when limit is not set
+const MaxPageLimit = 1000
+
+// PageRequest of list which is ordered by time of creation. After is cursor from previous page
+type PageRequest struct {
+	Limit      int
+	After      string
+	Descending bool
+}
+
+// Bounds validates page and returns its limit and cursor
+func (p PageRequest) Bounds() (int, cursor.Cursor, error) {
+	if p.Limit < 0 || p.Limit > MaxPageLimit {
+		return 0, cursor.Cursor{}, ErrInvalidFormat
+	}
+
+	limit := p.Limit
+	if limit == 0 {
+		limit = MaxPageLimit
+	}
+
+	after, err := cursor.Parse(p.After)
+	if err != nil {
+		return 0, cursor.Cursor{}, ErrInvalidFormat
+	}
+	return limit, after, nil
+}
+
 type ListOrderRequest struct {
 	UserID string
+	Status []string
+	//uploaded_at is in [From, To), zero value is not bounded
+	From time.Time
+	To   time.Time
+	Page PageRequest
+}
+
+// OrderList is page of orders, Next is cursor of next page or empty string on the last page
+type OrderList struct {
+	Orders []OrderInfo
+	Next   string
 }
 
 type OrderInfo struct {
 	UserID    string
 	Number    string
 	Status    string
-	Accrual   float64
+	Accrual   money.Money
+	CreatedAt time.Time
+}
+
+type OrderRequest struct {
+	UserID string
+	Number string
+}
+
+type OrderDetails struct {
+	Number    string
+	Status    string
+	Accrual   money.Money
+	CreatedAt time.Time
+	//time of the last change of status or accrual
+	UpdatedAt time.Time
+	//quantity and time of the last requests to accrual service, CheckedAt is zero if order was not checked yet
+	Attempts  int
+	CheckedAt time.Time
+}
+
+type OrderEventsRequest struct {
+	UserID  string
+	AfterID int64
+}
+
+// OrderEvent is state of order after its change, ID is increasing
+type OrderEvent struct {
+	ID        int64
+	Number    string
+	Status    string
+	Accrual   money.Money
 	CreatedAt time.Time
 }
 
@@ -62,58 +227,212 @@ type UserBalanceRequest struct {
 }
 
 type UserBalance struct {
-	Current   float64
-	Withdrawn float64
+	Current   money.Money
+	Withdrawn money.Money
 }
 
 type WithdrawalRequest struct {
 	UserID      string
 	OrderNumber string
-	Sum         float64
+	Sum         money.Money
 }
 
 type WithdrawalListRequest struct {
 	UserID string
+	//processed_at is in [From, To), zero value is not bounded
+	From time.Time
+	To   time.Time
+	Page PageRequest
+}
+
+// WithdrawalList is page of withdrawals, Next is cursor of next page or empty string on the last page
+type WithdrawalList struct {
+	Withdrawals []WithdrawalInfo
+	Next        string
 }
 
 type WithdrawalInfo struct {
 	OrderNumber string
-	Sum         float64
+	Sum         money.Money
 	CreatedAt   time.Time
 }
 
+type StatementRequest struct {
+	UserID string
+}
+
+// StatementEntry is credit or debit of account. Sum is negative for debit, Balance is balance after entry
+type StatementEntry struct {
+	OrderNumber string
+	Income      bool
+	Sum         money.Money
+	Balance     money.Money
+	CreatedAt   time.Time
+}
+
+type RegisterWebhookRequest struct {
+	UserID string
+	URL    string
+}
+
+// WebhookInfo of user, Secret is returned only on registration
+type WebhookInfo struct {
+	ID        string
+	URL       string
+	Secret    string
+	CreatedAt time.Time
+}
+
+type WebhookRequest struct {
+	UserID string
+	ID     string
+}
+
+// DeliveryInfo is state of delivery of event to webhook, State is pending, delivered or failed
+type DeliveryInfo struct {
+	ID            int64
+	Event         string
+	OrderNumber   string
+	State         string
+	Failures      int
+	OccurredAt    time.Time
+	NextAttemptAt time.Time
+	DeliveredAt   time.Time
+	Attempts      []DeliveryAttemptInfo
+}
+
+// DeliveryAttemptInfo is result of request to webhook, StatusCode is zero if response was not got
+type DeliveryAttemptInfo struct {
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+type RedeliveryRequest struct {
+	UserID     string
+	DeliveryID int64
+}
+
 type AccrualsFilterRequest struct {
 	Number string
 }
 
+type AccrualsBatchRequest struct {
+	Numbers []string
+}
+
 type AccrualsInfo struct {
 	OrderNumber string
 	Status      string
-	Accrual     float64
+	Accrual     money.Money
+}
+
+type IdempotencyRequest struct {
+	UserID string
+	Key    string
+	//hash of method, path and body of request
+	Fingerprint string
+}
+
+type IdempotentResponse struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
 }
 
 type RegisterCalculationRequest struct {
 	OrderNumber string
 	Products    []ProductRow
+	//rules are evaluated against it, time of registration is used if it is not set
+	PurchasedAt time.Time
 }
 
 type ProductRow struct {
 	Name  string
-	Price float64
+	Price money.Money
 }
 
 type CalculationFilterRequest struct {
 	OrderNumber string
 }
 
+// MaxCalculationsBatch is the largest quantity of orders in one batch lookup of calculations
+const MaxCalculationsBatch = 100
+
+type CalculationsFilterRequest struct {
+	OrderNumbers []string
+}
+
 type CalculationInfo struct {
 	OrderNumber string
 	Status      string
-	Accrual     float64
+	Accrual     money.Money
+}
+
+// CalculationBreakdown explains accrual, sum of points of lines is accrual.
+// Orders which were calculated before saving of lines do not have them
+type CalculationBreakdown struct {
+	CalculationInfo
+	Lines []CalculationLine
+}
+
+type CalculationLine struct {
+	//position of product in order starting from 1, it is 0 for rules of order
+	Line        int
+	ProductName string
+	Price       money.Money
+	//it is 0 if product is not matched by any rule
+	RuleID   int16
+	RuleKind RuleKind
+	Type     CalculationType
+	Points   money.Money
+	//match and point of rule at time of calculation, rule can be changed or deleted later
+	RuleMatch string
+	RulePoint money.Money
 }
 
 type RegisterCalculationRuleRequest struct {
+	//RuleKindProduct is used if it is not set, match is set only for rules of products
+	Kind  RuleKind
 	Match string
-	Point float64
+	Point money.Money
 	Type  CalculationType
+	//total price of order for RuleKindOrderBonus or price of product for RuleKindMinPrice
+	Threshold money.Money
+	//rules with higher priority are evaluated first, rules with the same priority are evaluated in order of registration
+	Priority int
+	//RulePolicyFirst is used if it is not set
+	Policy RulePolicy
+	//limit of reward of product for RulePolicyCap
+	Cap money.Money
+	//rule is applied to orders purchased in [ValidFrom, ValidTo), zero time is not bounded
+	ValidFrom time.Time
+	ValidTo   time.Time
+	//days of week when rule is applied, empty means every day
+	Weekdays []time.Weekday
+	//hours of day [HourFrom, HourTo) when rule is applied, window can pass midnight (22-2).
+	//Rule is applied at any hour if they are equal
+	HourFrom int
+	HourTo   int
+}
+
+type UpdateCalculationRuleRequest struct {
+	ID int16
+	RegisterCalculationRuleRequest
+}
+
+type DisableCalculationRuleRequest struct {
+	ID       int16
+	Disabled bool
+}
+
+type DeleteCalculationRuleRequest struct {
+	ID int16
+}
+
+type CalculationRuleInfo struct {
+	ID int16
+	RegisterCalculationRuleRequest
+	Disabled bool
 }
@@ -14,8 +14,18 @@ var ErrLimit = errors.New("limit exceeded")
 var ErrNotEnoughPoints = errors.New("not have enough points")
 var ErrWrongNumberOfOrder = errors.New("wrong number of order")
 var ErrOrderUploadAnotherUser = errors.New("order upload another user")
+var ErrOrderNotFound = errors.New("order not found")
+var ErrOrderOfAnotherUser = errors.New("order belongs to another user")
+var ErrWebhookNotFound = errors.New("webhook or delivery not found")
+var ErrRuleNotFound = errors.New("rule not found")
 var ErrWrongNameOrPassword = errors.New("wrong name or password")
+var ErrWrongPassword = errors.New("wrong password")
 var ErrUnexpected = errors.New("unexpected error")
+var ErrUnavailable = errors.New("service is unavailable")
+var ErrNotSupported = errors.New("operation is not supported")
+var ErrInvalidToken = errors.New("token is invalid or revoked")
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used with another request")
+var ErrIdempotencyKeyInProgress = errors.New("request with the same idempotency key is processing")
 
 type LimitError struct {
 	RetryAfter time.Duration
@@ -24,3 +34,8 @@ type LimitError struct {
 func (e LimitError) Error() string {
 	return fmt.Sprintf("too many requests, try it again in %d second", e.RetryAfter/time.Second)
 }
+
+// Unwrap allows to check LimitError by errors.Is(err, ErrLimit)
+func (e LimitError) Unwrap() error {
+	return ErrLimit
+}
@@ -2,6 +2,7 @@ package accrual
 
 import (
 	"context"
+	"slices"
 
 	"github.com/vilasle/gophermart/internal/repository/gophermart"
 	"github.com/vilasle/gophermart/internal/service"
@@ -32,3 +33,24 @@ func (s AccrualService) Accruals(ctx context.Context, dto service.AccrualsFilter
 	}, nil
 
 }
+
+func (s AccrualService) BatchAccruals(ctx context.Context, dto service.AccrualsBatchRequest) ([]service.AccrualsInfo, error) {
+	if len(dto.Numbers) == 0 || slices.Contains(dto.Numbers, "") {
+		return nil, service.ErrInvalidFormat
+	}
+
+	result, err := s.rep.AccrualByOrders(ctx, gophermart.AccrualBatchRequest{OrderNumbers: dto.Numbers})
+	if err != nil {
+		return nil, err
+	}
+
+	accruals := make([]service.AccrualsInfo, 0, len(result))
+	for _, r := range result {
+		accruals = append(accruals, service.AccrualsInfo{
+			OrderNumber: r.Number,
+			Status:      r.Status,
+			Accrual:     r.Accrual,
+		})
+	}
+	return accruals, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/vilasle/gophermart/internal/repository/gophermart"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 func TestAccrualServiceHTTP_Accruals(t *testing.T) {
@@ -76,7 +77,7 @@ func TestAccrualServiceHTTP_Accruals(t *testing.T) {
 			want: service.AccrualsInfo{
 				OrderNumber: "1234567890",
 				Status:      "PROCESSED",
-				Accrual:     100,
+				Accrual:     money.FromInt(100),
 			},
 			mockSetting: mockSetting{
 				dtoIn: gophermart.AccrualRequest{
@@ -85,7 +86,7 @@ func TestAccrualServiceHTTP_Accruals(t *testing.T) {
 				dtoOut: gophermart.AccrualInfo{
 					Number:  "1234567890",
 					Status:  "PROCESSED",
-					Accrual: 100,
+					Accrual: money.FromInt(100),
 				},
 				errOut: nil,
 				setup: func(mar *MockAccrualRepository, ctx context.Context, ar gophermart.AccrualRequest, ai gophermart.AccrualInfo, err error) {
@@ -118,3 +119,61 @@ func TestAccrualServiceHTTP_Accruals(t *testing.T) {
 		})
 	}
 }
+
+func TestAccrualServiceHTTP_BatchAccruals(t *testing.T) {
+	tests := []struct {
+		name    string
+		dto     service.AccrualsBatchRequest
+		setup   func(*MockAccrualRepository)
+		want    []service.AccrualsInfo
+		wantErr error
+	}{
+		{
+			name: "known orders",
+			dto:  service.AccrualsBatchRequest{Numbers: []string{"1", "2"}},
+			setup: func(rep *MockAccrualRepository) {
+				rep.EXPECT().AccrualByOrders(gomock.Any(), gophermart.AccrualBatchRequest{OrderNumbers: []string{"1", "2"}}).
+					Return([]gophermart.AccrualInfo{{Number: "1", Status: "PROCESSED", Accrual: money.FromInt(10)}}, nil)
+			},
+			want: []service.AccrualsInfo{{OrderNumber: "1", Status: "PROCESSED", Accrual: money.FromInt(10)}},
+		},
+		{
+			name:    "empty batch",
+			dto:     service.AccrualsBatchRequest{},
+			wantErr: service.ErrInvalidFormat,
+		},
+		{
+			name:    "empty number",
+			dto:     service.AccrualsBatchRequest{Numbers: []string{"1", ""}},
+			wantErr: service.ErrInvalidFormat,
+		},
+		{
+			name: "older accrual service",
+			dto:  service.AccrualsBatchRequest{Numbers: []string{"1"}},
+			setup: func(rep *MockAccrualRepository) {
+				rep.EXPECT().AccrualByOrders(gomock.Any(), gomock.Any()).Return(nil, service.ErrNotSupported)
+			},
+			wantErr: service.ErrNotSupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			rep := NewMockAccrualRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(rep)
+			}
+
+			got, err := NewAccrualService(rep).BatchAccruals(context.Background(), tt.dto)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -2,30 +2,59 @@ package authorization
 
 import (
 	"context"
-	"crypto/hmac"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"sync"
+	"time"
 
 	"github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/logger"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/password"
 )
 
+// refreshTokenExp is lifetime of refresh token, every refreshing issues new token with the same lifetime
+const refreshTokenExp = time.Hour * 24 * 30
+
+// refreshReuseGrace is how long rotated refresh token returns the same successor, so concurrent requests
+// of browser with the same cookie are not treated as theft
+const refreshReuseGrace = time.Second * 30
+
 type AuthorizationService struct {
 	rep gophermart.AuthorizationRepository
+	//params of new password hashes, hashes with other params are upgraded on login
+	params password.Params
+	//backoff of failed logins by login name and by client address
+	loginLockout lockoutPolicy
+	ipLockout    lockoutPolicy
+	dummy        *dummyHash
 }
 
 func NewAuthorizationService(rep gophermart.AuthorizationRepository) AuthorizationService {
-	return AuthorizationService{rep: rep}
+	return AuthorizationService{
+		rep:          rep,
+		params:       password.DefaultParams,
+		loginLockout: loginLockout,
+		ipLockout:    ipLockout,
+		dummy:        &dummyHash{},
+	}
 }
 
 func (svc AuthorizationService) Register(ctx context.Context, dto service.RegisterRequest) (service.UserInfo, error) {
 	if !checkFillingLoginPassword(dto.Login, dto.Password) {
 		return service.UserInfo{}, service.ErrInvalidFormat
 	}
-	hash := svc.createHash(dto.Password)
+	hash, err := password.Hash(dto.Password, svc.params)
+	if err != nil {
+		return service.UserInfo{}, err
+	}
 	user := gophermart.AuthData{
 		Login:        dto.Login,
-		PasswordHash: hash[:],
+		PasswordHash: hash,
 	}
 
 	result, err := svc.rep.AddUser(ctx, user)
@@ -43,8 +72,12 @@ func (svc AuthorizationService) Authorize(ctx context.Context, dto service.Autho
 	if !checkFillingLoginPassword(dto.Login, dto.Password) {
 		return service.UserInfo{}, service.ErrInvalidFormat
 	}
-	
-	hash := svc.createHash(dto.Password)
+
+	keys := svc.lockoutKeys(dto.Login, dto.ClientIP)
+	if err := svc.checkLockout(ctx, keys); err != nil {
+		return service.UserInfo{}, err
+	}
+
 	user := gophermart.AuthData{
 		Login: dto.Login,
 	}
@@ -52,17 +85,30 @@ func (svc AuthorizationService) Authorize(ctx context.Context, dto service.Autho
 	result, err := svc.rep.CheckUser(ctx, user)
 	if err != nil {
 		if errors.Is(err, gophermart.ErrEmptyResult) {
+			//password is checked anyway, so time of response does not reveal which accounts exist
+			svc.dummy.verify(dto.Password, svc.params)
+			//guessing of login names is limited too
+			svc.registerFailure(ctx, keys)
 			return service.UserInfo{}, service.ErrWrongNameOrPassword
 		}
 		return service.UserInfo{}, err
 	}
 
-	passwordHash := []byte(result.PasswordHash)
-
-	if ok := hmac.Equal(passwordHash, hash[:]); !ok {
+	ok, needsRehash, err := password.Verify(dto.Password, result.PasswordHash, svc.params)
+	if err != nil {
+		logger.Warn("password hash can not be verified", "userID", result.ID, "error", err)
+	}
+	if !ok {
+		svc.registerFailure(ctx, keys)
 		return service.UserInfo{}, service.ErrWrongNameOrPassword
 	}
 
+	svc.resetFailures(ctx, keys)
+
+	if needsRehash {
+		svc.rehash(ctx, result, dto.Password)
+	}
+
 	return service.UserInfo{
 		ID: result.ID,
 	}, nil
@@ -90,7 +136,326 @@ func (svc AuthorizationService) CheckByUserID(ctx context.Context, id string) er
 	return nil
 }
 
-func (svc AuthorizationService) createHash(password string) [32]byte {
-	hash := sha256.Sum256([]byte(password))
-	return hash
+func (svc AuthorizationService) CreateSession(ctx context.Context, userID string) (service.SessionInfo, error) {
+	if userID == "" {
+		return service.SessionInfo{}, service.ErrInvalidFormat
+	}
+
+	user, err := svc.rep.CheckUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gophermart.ErrEmptyResult) {
+			return service.SessionInfo{}, service.ErrEntityDoesNotExists
+		}
+		return service.SessionInfo{}, err
+	}
+
+	return svc.newSession(ctx, user.ID, user.TokenVersion)
+}
+
+func (svc AuthorizationService) RefreshSession(ctx context.Context, dto service.RefreshSessionRequest) (service.SessionInfo, error) {
+	if dto.RefreshToken == "" {
+		return service.SessionInfo{}, service.ErrInvalidFormat
+	}
+
+	hash := sha256.Sum256([]byte(dto.RefreshToken))
+
+	next, err := newRefreshToken()
+	if err != nil {
+		return service.SessionInfo{}, err
+	}
+
+	sealed, err := sealSuccessor(dto.RefreshToken, next.refreshToken)
+	if err != nil {
+		return service.SessionInfo{}, err
+	}
+
+	token, err := svc.rep.UseRefreshToken(ctx, gophermart.RefreshTokenUsing{
+		Hash:            hash[:],
+		Successor:       next.request(""),
+		SealedSuccessor: sealed,
+		Grace:           refreshReuseGrace,
+	})
+	if err != nil {
+		if errors.Is(err, gophermart.ErrEmptyResult) {
+			return service.SessionInfo{}, service.ErrInvalidToken
+		}
+		return service.SessionInfo{}, err
+	}
+
+	//token was rotated by concurrent request a moment ago, so the same session is returned
+	if token.Reused {
+		refreshToken, err := openSuccessor(dto.RefreshToken, token.SealedSuccessor)
+		if err != nil {
+			return service.SessionInfo{}, service.ErrInvalidToken
+		}
+		return service.SessionInfo{
+			UserID:           token.UserID,
+			TokenID:          token.SuccessorTokenID,
+			TokenVersion:     token.TokenVersion,
+			RefreshToken:     refreshToken,
+			RefreshExpiresAt: token.SuccessorExpiresAt,
+		}, nil
+	}
+
+	//token was used before grace window, so it was stolen or session was revoked. Anyway all sessions of user must be closed
+	if token.Revoked {
+		if err := svc.rep.RevokeUserTokens(ctx, token.UserID); err != nil {
+			return service.SessionInfo{}, err
+		}
+		return service.SessionInfo{}, service.ErrInvalidToken
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return service.SessionInfo{}, service.ErrInvalidToken
+	}
+
+	return next.session(token.UserID, token.TokenVersion), nil
+}
+
+func (svc AuthorizationService) CheckToken(ctx context.Context, dto service.CheckTokenRequest) error {
+	if dto.UserID == "" || dto.TokenID == "" {
+		return service.ErrInvalidFormat
+	}
+
+	info, err := svc.rep.CheckAccessToken(ctx, gophermart.AccessTokenRequest{
+		UserID:  dto.UserID,
+		TokenID: dto.TokenID,
+	})
+	if err != nil {
+		if errors.Is(err, gophermart.ErrEmptyResult) {
+			return service.ErrInvalidToken
+		}
+		return err
+	}
+
+	if info.Revoked || info.TokenVersion != dto.TokenVersion {
+		return service.ErrInvalidToken
+	}
+	return nil
+}
+
+func (svc AuthorizationService) Logout(ctx context.Context, dto service.LogoutRequest) error {
+	if dto.UserID == "" || dto.TokenID == "" {
+		return service.ErrInvalidFormat
+	}
+
+	return svc.rep.RevokeSession(ctx, gophermart.AccessTokenRequest{
+		UserID:    dto.UserID,
+		TokenID:   dto.TokenID,
+		ExpiresAt: dto.TokenExpiresAt,
+	})
+}
+
+func (svc AuthorizationService) LogoutAll(ctx context.Context, userID string) error {
+	if userID == "" {
+		return service.ErrInvalidFormat
+	}
+	return svc.rep.RevokeUserTokens(ctx, userID)
+}
+
+func (svc AuthorizationService) ChangePassword(ctx context.Context, dto service.ChangePasswordRequest) error {
+	if dto.UserID == "" || dto.OldPassword == "" || dto.NewPassword == "" {
+		return service.ErrInvalidFormat
+	}
+
+	user, err := svc.rep.CheckUserByID(ctx, dto.UserID)
+	if err != nil {
+		if errors.Is(err, gophermart.ErrEmptyResult) {
+			return service.ErrEntityDoesNotExists
+		}
+		return err
+	}
+
+	//stolen session must not allow to guess password bypassing lockout of login
+	keys := svc.lockoutKeys(user.Login, dto.ClientIP)
+	if err := svc.checkLockout(ctx, keys); err != nil {
+		return err
+	}
+
+	ok, _, err := password.Verify(dto.OldPassword, user.PasswordHash, svc.params)
+	if err != nil {
+		logger.Warn("password hash can not be verified", "userID", user.ID, "error", err)
+	}
+	if !ok {
+		svc.registerFailure(ctx, keys)
+		return service.ErrWrongPassword
+	}
+
+	svc.resetFailures(ctx, keys)
+
+	hash, err := password.Hash(dto.NewPassword, svc.params)
+	if err != nil {
+		return err
+	}
+
+	err = svc.rep.UpdatePassword(ctx, gophermart.PasswordUpdateRequest{
+		UserID:          user.ID,
+		PasswordHash:    hash,
+		OldPasswordHash: user.PasswordHash,
+		RevokeTokens:    true,
+	})
+	//password was changed by concurrent request, so old password is not correct anymore
+	if errors.Is(err, gophermart.ErrEmptyResult) {
+		return service.ErrWrongPassword
+	}
+	return err
+}
+
+func (svc AuthorizationService) DeleteAccount(ctx context.Context, userID string) (service.DeletedAccountInfo, error) {
+	if userID == "" {
+		return service.DeletedAccountInfo{}, service.ErrInvalidFormat
+	}
+
+	info, err := svc.rep.DeleteUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, gophermart.ErrEmptyResult) {
+			return service.DeletedAccountInfo{}, service.ErrEntityDoesNotExists
+		}
+		return service.DeletedAccountInfo{}, err
+	}
+
+	return service.DeletedAccountInfo{Forfeited: info.Forfeited}, nil
+}
+
+func (svc AuthorizationService) newSession(ctx context.Context, userID string, version int) (service.SessionInfo, error) {
+	next, err := newRefreshToken()
+	if err != nil {
+		return service.SessionInfo{}, err
+	}
+
+	if err := svc.rep.AddRefreshToken(ctx, next.request(userID)); err != nil {
+		return service.SessionInfo{}, err
+	}
+
+	return next.session(userID, version), nil
+}
+
+// issuedToken is refresh token and id of access token issued together with it
+type issuedToken struct {
+	tokenID      string
+	refreshToken string
+	expiresAt    time.Time
+}
+
+func newRefreshToken() (issuedToken, error) {
+	tokenID, err := randomString(16)
+	if err != nil {
+		return issuedToken{}, err
+	}
+
+	refreshToken, err := randomString(32)
+	if err != nil {
+		return issuedToken{}, err
+	}
+
+	return issuedToken{
+		tokenID:      tokenID,
+		refreshToken: refreshToken,
+		expiresAt:    time.Now().Add(refreshTokenExp),
+	}, nil
+}
+
+func (t issuedToken) request(userID string) gophermart.RefreshTokenRequest {
+	hash := sha256.Sum256([]byte(t.refreshToken))
+	return gophermart.RefreshTokenRequest{
+		Hash:      hash[:],
+		UserID:    userID,
+		TokenID:   t.tokenID,
+		ExpiresAt: t.expiresAt,
+	}
+}
+
+func (t issuedToken) session(userID string, version int) service.SessionInfo {
+	return service.SessionInfo{
+		UserID:           userID,
+		TokenID:          t.tokenID,
+		TokenVersion:     version,
+		RefreshToken:     t.refreshToken,
+		RefreshExpiresAt: t.expiresAt,
+	}
+}
+
+// successorKey is derived from rotated token, only its hash is stored, so successor can be opened
+// only by holder of rotated token
+func successorKey(token string) (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("successor:" + token))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealSuccessor(token, successor string) ([]byte, error) {
+	aead, err := successorKey(token)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, []byte(successor), nil), nil
+}
+
+func openSuccessor(token string, sealed []byte) (string, error) {
+	aead, err := successorKey(token)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("sealed successor is too short")
+	}
+	nonce, data := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	successor, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(successor), nil
+}
+
+// dummyHash is verified for unknown logins instead of hash of user, it is made on the first use
+type dummyHash struct {
+	once sync.Once
+	hash []byte
+}
+
+func (d *dummyHash) verify(pass string, params password.Params) {
+	d.once.Do(func() {
+		hash, err := password.Hash("dummy password", params)
+		if err != nil {
+			logger.Error("making of dummy password hash failed", "error", err)
+			return
+		}
+		d.hash = hash
+	})
+	password.Verify(pass, d.hash, params)
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// rehash upgrades legacy hash of user. User is already authorized, so failure is only logged
+func (svc AuthorizationService) rehash(ctx context.Context, user gophermart.UserInfo, pass string) {
+	hash, err := password.Hash(pass, svc.params)
+	if err == nil {
+		err = svc.rep.UpdatePassword(ctx, gophermart.PasswordUpdateRequest{
+			UserID:          user.ID,
+			PasswordHash:    hash,
+			OldPasswordHash: user.PasswordHash,
+		})
+	}
+
+	//password was changed by another request, nothing to upgrade
+	if err != nil && !errors.Is(err, gophermart.ErrEmptyResult) {
+		logger.Warn("upgrading password hash failed", "userID", user.ID, "error", err)
+	}
 }
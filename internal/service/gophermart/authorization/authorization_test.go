@@ -1,16 +1,81 @@
 package authorization
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/vilasle/gophermart/internal/repository/gophermart"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
+	"github.com/vilasle/gophermart/internal/tool/password"
 )
 
+// testParams makes argon2id cheap for tests
+var testParams = password.Params{Memory: 1024, Time: 2, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+// authData matches AuthData with salted hash of password
+type authData struct {
+	login    string
+	password string
+}
+
+func (m authData) Matches(x any) bool {
+	dto, ok := x.(gophermart.AuthData)
+	if !ok || dto.Login != m.login {
+		return false
+	}
+	valid, _, err := password.Verify(m.password, dto.PasswordHash, testParams)
+	return valid && err == nil
+}
+
+func (m authData) String() string {
+	return fmt.Sprintf("login %s with hash of password %s", m.login, m.password)
+}
+
+// passwordUpdate matches PasswordUpdateRequest with new salted hash of password
+type passwordUpdate struct {
+	userID   string
+	password string
+	old      []byte
+}
+
+func (m passwordUpdate) Matches(x any) bool {
+	dto, ok := x.(gophermart.PasswordUpdateRequest)
+	if !ok || dto.UserID != m.userID || !bytes.Equal(dto.OldPasswordHash, m.old) {
+		return false
+	}
+	valid, needsRehash, err := password.Verify(m.password, dto.PasswordHash, testParams)
+	return valid && !needsRehash && err == nil
+}
+
+func (m passwordUpdate) String() string {
+	return fmt.Sprintf("new hash of password %s for user %s", m.password, m.userID)
+}
+
+// tokenUsing matches RefreshTokenUsing of token with hash which rotates it to new sealed successor
+type tokenUsing struct {
+	hash []byte
+}
+
+func (m tokenUsing) Matches(x any) bool {
+	dto, ok := x.(gophermart.RefreshTokenUsing)
+	return ok && bytes.Equal(dto.Hash, m.hash) && dto.Grace == refreshReuseGrace &&
+		len(dto.Successor.Hash) > 0 && dto.Successor.TokenID != "" && len(dto.SealedSuccessor) > 0
+}
+
+func (m tokenUsing) String() string {
+	return fmt.Sprintf("using of refresh token with hash %x", m.hash)
+}
+
 func TestAuthorizationService_Register(t *testing.T) {
 	type args struct {
 		ctx context.Context
@@ -76,7 +141,7 @@ func TestAuthorizationService_Register(t *testing.T) {
 				dtoOut: gophermart.UserInfo{},
 				errOut: gophermart.ErrDuplicate,
 				setup: func(m *MockAuthorizationRepository, ctx context.Context, dto gophermart.AuthData, result gophermart.UserInfo, err error) {
-					m.EXPECT().AddUser(ctx, dto).Return(result, err)
+					m.EXPECT().AddUser(ctx, authData{login: dto.Login, password: "password"}).Return(result, err)
 				},
 			},
 			want: service.UserInfo{},
@@ -99,7 +164,7 @@ func TestAuthorizationService_Register(t *testing.T) {
 				dtoOut: gophermart.UserInfo{},
 				errOut: repErr,
 				setup: func(m *MockAuthorizationRepository, ctx context.Context, dto gophermart.AuthData, result gophermart.UserInfo, err error) {
-					m.EXPECT().AddUser(ctx, dto).Return(result, err)
+					m.EXPECT().AddUser(ctx, authData{login: dto.Login, password: "password"}).Return(result, err)
 				},
 			},
 			want: service.UserInfo{},
@@ -124,7 +189,7 @@ func TestAuthorizationService_Register(t *testing.T) {
 				},
 				errOut: nil,
 				setup: func(m *MockAuthorizationRepository, ctx context.Context, dto gophermart.AuthData, result gophermart.UserInfo, err error) {
-					m.EXPECT().AddUser(ctx, dto).Return(result, err)
+					m.EXPECT().AddUser(ctx, authData{login: dto.Login, password: "password"}).Return(result, err)
 				},
 			},
 			want: service.UserInfo{
@@ -144,6 +209,7 @@ func TestAuthorizationService_Register(t *testing.T) {
 			tt.mockSetting.setup(mock, tt.args.ctx, tt.mockSetting.dtoIn, tt.mockSetting.dtoOut, tt.mockSetting.errOut)
 
 			svc := NewAuthorizationService(mock)
+			svc.params = testParams
 
 			got, err := svc.Register(tt.args.ctx, tt.args.dto)
 
@@ -178,6 +244,14 @@ func TestAuthorizationService_Authorize(t *testing.T) {
 
 	_, _ = repErr, passwordHash
 
+	argonHash, err := password.Hash("password", testParams)
+	require.NoError(t, err)
+
+	weakParams := testParams
+	weakParams.Time = 1
+	weakHash, err := password.Hash("password", weakParams)
+	require.NoError(t, err)
+
 	tests := []struct {
 		name        string
 		args        args
@@ -295,6 +369,91 @@ func TestAuthorizationService_Authorize(t *testing.T) {
 				errOut: nil,
 				setup: func(m *MockAuthorizationRepository, ctx context.Context, dto gophermart.AuthData, result gophermart.UserInfo, err error) {
 					m.EXPECT().CheckUser(ctx, dto).Return(result, err)
+					//legacy sha256 hash is upgraded
+					m.EXPECT().UpdatePassword(ctx, passwordUpdate{userID: "1234567890", password: "password", old: passwordHash}).Return(nil)
+				},
+			},
+			want: service.UserInfo{
+				ID: "1234567890",
+			},
+			err: nil,
+		},
+		{
+			name: "upgrading of hash failed",
+			args: args{
+				ctx: context.Background(),
+				dto: service.AuthorizeRequest{
+					Login:    "login",
+					Password: "password",
+				},
+			},
+			mockSetting: mockSetting{
+				dtoIn: gophermart.AuthData{
+					Login: "login",
+				},
+				dtoOut: gophermart.UserInfo{
+					ID:           "1234567890",
+					PasswordHash: passwordHash,
+				},
+				errOut: nil,
+				setup: func(m *MockAuthorizationRepository, ctx context.Context, dto gophermart.AuthData, result gophermart.UserInfo, err error) {
+					m.EXPECT().CheckUser(ctx, dto).Return(result, err)
+					m.EXPECT().UpdatePassword(ctx, gomock.Any()).Return(repErr)
+				},
+			},
+			want: service.UserInfo{
+				ID: "1234567890",
+			},
+			err: nil,
+		},
+		{
+			name: "success with argon2id hash",
+			args: args{
+				ctx: context.Background(),
+				dto: service.AuthorizeRequest{
+					Login:    "login",
+					Password: "password",
+				},
+			},
+			mockSetting: mockSetting{
+				dtoIn: gophermart.AuthData{
+					Login: "login",
+				},
+				dtoOut: gophermart.UserInfo{
+					ID:           "1234567890",
+					PasswordHash: argonHash,
+				},
+				errOut: nil,
+				setup: func(m *MockAuthorizationRepository, ctx context.Context, dto gophermart.AuthData, result gophermart.UserInfo, err error) {
+					m.EXPECT().CheckUser(ctx, dto).Return(result, err)
+				},
+			},
+			want: service.UserInfo{
+				ID: "1234567890",
+			},
+			err: nil,
+		},
+		{
+			name: "hash with old params is upgraded",
+			args: args{
+				ctx: context.Background(),
+				dto: service.AuthorizeRequest{
+					Login:    "login",
+					Password: "password",
+				},
+			},
+			mockSetting: mockSetting{
+				dtoIn: gophermart.AuthData{
+					Login: "login",
+				},
+				dtoOut: gophermart.UserInfo{
+					ID:           "1234567890",
+					PasswordHash: weakHash,
+				},
+				errOut: nil,
+				setup: func(m *MockAuthorizationRepository, ctx context.Context, dto gophermart.AuthData, result gophermart.UserInfo, err error) {
+					m.EXPECT().CheckUser(ctx, dto).Return(result, err)
+					m.EXPECT().UpdatePassword(ctx, passwordUpdate{userID: "1234567890", password: "password", old: weakHash}).Return(nil)
 				},
 			},
 			want: service.UserInfo{
@@ -313,7 +472,13 @@ func TestAuthorizationService_Authorize(t *testing.T) {
 
 			tt.mockSetting.setup(mock, tt.args.ctx, tt.mockSetting.dtoIn, tt.mockSetting.dtoOut, tt.mockSetting.errOut)
 
+			//lockout is checked by TestAuthorizationService_AuthorizeLockout
+			mock.EXPECT().LoginAttempts(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+			mock.EXPECT().AddLoginFailure(gomock.Any(), gomock.Any()).Return(gophermart.LoginAttemptInfo{}, nil).AnyTimes()
+			mock.EXPECT().ResetLoginFailures(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
 			svc := NewAuthorizationService(mock)
+			svc.params = testParams
 
 			got, err := svc.Authorize(tt.args.ctx, tt.args.dto)
 
@@ -325,3 +490,571 @@ func TestAuthorizationService_Authorize(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthorizationService_CreateSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mock := NewMockAuthorizationRepository(ctrl)
+
+	var saved gophermart.RefreshTokenRequest
+	mock.EXPECT().CheckUserByID(ctx, "123456").Return(gophermart.UserInfo{ID: "123456", TokenVersion: 3}, nil)
+	mock.EXPECT().AddRefreshToken(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, dto gophermart.RefreshTokenRequest) error {
+			saved = dto
+			return nil
+		})
+
+	svc := NewAuthorizationService(mock)
+
+	session, err := svc.CreateSession(ctx, "123456")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "123456", session.UserID)
+	assert.Equal(t, 3, session.TokenVersion)
+	assert.NotEmpty(t, session.TokenID)
+	assert.NotEmpty(t, session.RefreshToken)
+
+	//only hash of refresh token is stored
+	hash := sha256.Sum256([]byte(session.RefreshToken))
+	assert.Equal(t, hash[:], saved.Hash)
+	assert.Equal(t, session.TokenID, saved.TokenID)
+	assert.Equal(t, session.RefreshExpiresAt, saved.ExpiresAt)
+}
+
+func TestAuthorizationService_RefreshSession(t *testing.T) {
+	refreshToken := "refresh-token"
+	hash := sha256.Sum256([]byte(refreshToken))
+	repErr := errors.New("repository error")
+
+	tests := []struct {
+		name  string
+		dto   service.RefreshSessionRequest
+		setup func(*MockAuthorizationRepository, context.Context)
+		err   error
+	}{
+		{
+			name:  "empty token",
+			dto:   service.RefreshSessionRequest{},
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {},
+			err:   service.ErrInvalidFormat,
+		},
+		{
+			name: "unknown token",
+			dto:  service.RefreshSessionRequest{RefreshToken: refreshToken},
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().UseRefreshToken(ctx, tokenUsing{hash[:]}).Return(gophermart.RefreshTokenInfo{}, gophermart.ErrEmptyResult)
+			},
+			err: service.ErrInvalidToken,
+		},
+		{
+			name: "expired token",
+			dto:  service.RefreshSessionRequest{RefreshToken: refreshToken},
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().UseRefreshToken(ctx, tokenUsing{hash[:]}).Return(gophermart.RefreshTokenInfo{
+					UserID:    "123456",
+					ExpiresAt: time.Now().Add(-time.Minute),
+				}, nil)
+			},
+			err: service.ErrInvalidToken,
+		},
+		{
+			name: "reused token revokes all tokens of user",
+			dto:  service.RefreshSessionRequest{RefreshToken: refreshToken},
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().UseRefreshToken(ctx, tokenUsing{hash[:]}).Return(gophermart.RefreshTokenInfo{
+					UserID:    "123456",
+					ExpiresAt: time.Now().Add(time.Hour),
+					Revoked:   true,
+				}, nil)
+				m.EXPECT().RevokeUserTokens(ctx, "123456").Return(nil)
+			},
+			err: service.ErrInvalidToken,
+		},
+		{
+			name: "repository error",
+			dto:  service.RefreshSessionRequest{RefreshToken: refreshToken},
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().UseRefreshToken(ctx, tokenUsing{hash[:]}).Return(gophermart.RefreshTokenInfo{}, repErr)
+			},
+			err: repErr,
+		},
+		{
+			name: "success",
+			dto:  service.RefreshSessionRequest{RefreshToken: refreshToken},
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().UseRefreshToken(ctx, tokenUsing{hash[:]}).Return(gophermart.RefreshTokenInfo{
+					UserID:       "123456",
+					TokenVersion: 2,
+					ExpiresAt:    time.Now().Add(time.Hour),
+				}, nil)
+			},
+		},
+		{
+			name: "reused token with broken successor",
+			dto:  service.RefreshSessionRequest{RefreshToken: refreshToken},
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().UseRefreshToken(ctx, tokenUsing{hash[:]}).Return(gophermart.RefreshTokenInfo{
+					UserID:          "123456",
+					ExpiresAt:       time.Now().Add(time.Hour),
+					Reused:          true,
+					SealedSuccessor: []byte("sealed by another token"),
+				}, nil)
+			},
+			err: service.ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			mock := NewMockAuthorizationRepository(ctrl)
+			tt.setup(mock, ctx)
+
+			svc := NewAuthorizationService(mock)
+
+			session, err := svc.RefreshSession(ctx, tt.dto)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "123456", session.UserID)
+			assert.Equal(t, 2, session.TokenVersion)
+			assert.NotEqual(t, refreshToken, session.RefreshToken)
+		})
+	}
+}
+
+func TestAuthorizationService_ConcurrentRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mock := NewMockAuthorizationRepository(ctrl)
+
+	refreshToken := "refresh-token"
+	hash := sha256.Sum256([]byte(refreshToken))
+
+	//repository locks row of token, so the second refresh sees token rotated by the first one
+	var (
+		mx      sync.Mutex
+		rotated *gophermart.RefreshTokenUsing
+	)
+	mock.EXPECT().UseRefreshToken(ctx, tokenUsing{hash[:]}).Times(2).DoAndReturn(
+		func(_ context.Context, dto gophermart.RefreshTokenUsing) (gophermart.RefreshTokenInfo, error) {
+			mx.Lock()
+			defer mx.Unlock()
+
+			info := gophermart.RefreshTokenInfo{UserID: "123456", TokenVersion: 2, ExpiresAt: time.Now().Add(time.Hour)}
+			if rotated == nil {
+				rotated = &dto
+				return info, nil
+			}
+			info.Reused = true
+			info.SuccessorTokenID = rotated.Successor.TokenID
+			info.SuccessorExpiresAt = rotated.Successor.ExpiresAt
+			info.SealedSuccessor = rotated.SealedSuccessor
+			return info, nil
+		})
+
+	svc := NewAuthorizationService(mock)
+
+	var wg sync.WaitGroup
+	sessions := make([]service.SessionInfo, 2)
+	errs := make([]error, 2)
+	for i := range sessions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sessions[i], errs[i] = svc.RefreshSession(ctx, service.RefreshSessionRequest{RefreshToken: refreshToken})
+		}(i)
+	}
+	wg.Wait()
+
+	//both requests get the same new session and user is not logged out
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+	assert.Equal(t, sessions[0], sessions[1])
+	assert.NotEqual(t, refreshToken, sessions[0].RefreshToken)
+
+	successor := sha256.Sum256([]byte(sessions[0].RefreshToken))
+	assert.Equal(t, successor[:], rotated.Successor.Hash)
+}
+
+func TestAuthorizationService_CheckToken(t *testing.T) {
+	dto := service.CheckTokenRequest{UserID: "123456", TokenID: "jti", TokenVersion: 1}
+	req := gophermart.AccessTokenRequest{UserID: "123456", TokenID: "jti"}
+
+	tests := []struct {
+		name  string
+		dto   service.CheckTokenRequest
+		setup func(*MockAuthorizationRepository, context.Context)
+		err   error
+	}{
+		{
+			name:  "token without jti",
+			dto:   service.CheckTokenRequest{UserID: "123456"},
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {},
+			err:   service.ErrInvalidFormat,
+		},
+		{
+			name: "user does not exist",
+			dto:  dto,
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().CheckAccessToken(ctx, req).Return(gophermart.AccessTokenInfo{}, gophermart.ErrEmptyResult)
+			},
+			err: service.ErrInvalidToken,
+		},
+		{
+			name: "revoked token",
+			dto:  dto,
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().CheckAccessToken(ctx, req).Return(gophermart.AccessTokenInfo{TokenVersion: 1, Revoked: true}, nil)
+			},
+			err: service.ErrInvalidToken,
+		},
+		{
+			name: "token of previous version",
+			dto:  dto,
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().CheckAccessToken(ctx, req).Return(gophermart.AccessTokenInfo{TokenVersion: 2}, nil)
+			},
+			err: service.ErrInvalidToken,
+		},
+		{
+			name: "valid token",
+			dto:  dto,
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().CheckAccessToken(ctx, req).Return(gophermart.AccessTokenInfo{TokenVersion: 1}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			mock := NewMockAuthorizationRepository(ctrl)
+			tt.setup(mock, ctx)
+
+			svc := NewAuthorizationService(mock)
+
+			err := svc.CheckToken(ctx, tt.dto)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthorizationService_Logout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Minute)
+
+	mock := NewMockAuthorizationRepository(ctrl)
+	mock.EXPECT().RevokeSession(ctx, gophermart.AccessTokenRequest{
+		UserID:    "123456",
+		TokenID:   "jti",
+		ExpiresAt: expiresAt,
+	}).Return(nil)
+	mock.EXPECT().RevokeUserTokens(ctx, "123456").Return(nil)
+
+	svc := NewAuthorizationService(mock)
+
+	assert.NoError(t, svc.Logout(ctx, service.LogoutRequest{UserID: "123456", TokenID: "jti", TokenExpiresAt: expiresAt}))
+	assert.NoError(t, svc.LogoutAll(ctx, "123456"))
+	assert.ErrorIs(t, svc.LogoutAll(ctx, ""), service.ErrInvalidFormat)
+}
+
+func TestAuthorizationService_ChangePassword(t *testing.T) {
+	oldHash, err := password.Hash("old", testParams)
+	require.NoError(t, err)
+
+	user := gophermart.UserInfo{ID: "123456", Login: "login", PasswordHash: oldHash}
+	dto := service.ChangePasswordRequest{UserID: "123456", OldPassword: "old", NewPassword: "new", ClientIP: "10.0.0.1"}
+	keys := []string{"login:login", "ip:10.0.0.1"}
+	update := passwordUpdate{userID: "123456", password: "new", old: oldHash}
+	repErr := errors.New("repository error")
+
+	tests := []struct {
+		name  string
+		dto   service.ChangePasswordRequest
+		setup func(*MockAuthorizationRepository, context.Context)
+		err   error
+	}{
+		{
+			name:  "empty new password",
+			dto:   service.ChangePasswordRequest{UserID: "123456", OldPassword: "old"},
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {},
+			err:   service.ErrInvalidFormat,
+		},
+		{
+			name: "wrong old password is counted by lockout of login",
+			dto:  service.ChangePasswordRequest{UserID: "123456", OldPassword: "another", NewPassword: "new", ClientIP: "10.0.0.1"},
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().CheckUserByID(ctx, "123456").Return(user, nil)
+				m.EXPECT().LoginAttempts(ctx, keys).Return(nil, nil)
+				m.EXPECT().AddLoginFailure(ctx, gophermart.LoginFailureRequest{Key: "login:login", Window: loginLockout.window}).
+					Return(gophermart.LoginAttemptInfo{Key: "login:login", Failures: 1}, nil)
+				m.EXPECT().AddLoginFailure(ctx, gophermart.LoginFailureRequest{Key: "ip:10.0.0.1", Window: ipLockout.window}).
+					Return(gophermart.LoginAttemptInfo{Key: "ip:10.0.0.1", Failures: 1}, nil)
+			},
+			err: service.ErrWrongPassword,
+		},
+		{
+			name: "locked login",
+			dto:  dto,
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().CheckUserByID(ctx, "123456").Return(user, nil)
+				m.EXPECT().LoginAttempts(ctx, keys).Return([]gophermart.LoginAttemptInfo{
+					{Key: "login:login", Failures: 6, LockedUntil: time.Now().Add(time.Minute)},
+				}, nil)
+			},
+			err: service.ErrLimit,
+		},
+		{
+			name: "password was changed concurrently",
+			dto:  dto,
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().CheckUserByID(ctx, "123456").Return(user, nil)
+				m.EXPECT().LoginAttempts(ctx, keys).Return(nil, nil)
+				m.EXPECT().ResetLoginFailures(ctx, []string{"login:login"}).Return(nil)
+				m.EXPECT().UpdatePassword(ctx, update).Return(gophermart.ErrEmptyResult)
+			},
+			err: service.ErrWrongPassword,
+		},
+		{
+			name: "repository error",
+			dto:  dto,
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().CheckUserByID(ctx, "123456").Return(user, nil)
+				m.EXPECT().LoginAttempts(ctx, keys).Return(nil, nil)
+				m.EXPECT().ResetLoginFailures(ctx, []string{"login:login"}).Return(nil)
+				m.EXPECT().UpdatePassword(ctx, update).Return(repErr)
+			},
+			err: repErr,
+		},
+		{
+			name: "success",
+			dto:  dto,
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().CheckUserByID(ctx, "123456").Return(user, nil)
+				m.EXPECT().LoginAttempts(ctx, keys).Return(nil, nil)
+				m.EXPECT().ResetLoginFailures(ctx, []string{"login:login"}).Return(nil)
+				m.EXPECT().UpdatePassword(ctx, update).DoAndReturn(
+					func(_ context.Context, dto gophermart.PasswordUpdateRequest) error {
+						assert.True(t, dto.RevokeTokens, "sessions must be revoked")
+						return nil
+					})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			mock := NewMockAuthorizationRepository(ctrl)
+			tt.setup(mock, ctx)
+
+			svc := NewAuthorizationService(mock)
+			svc.params = testParams
+
+			err := svc.ChangePassword(ctx, tt.dto)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAuthorizationService_DeleteAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mock := NewMockAuthorizationRepository(ctrl)
+	mock.EXPECT().DeleteUser(ctx, "123456").Return(gophermart.DeletedUserInfo{Forfeited: money.FromMinor(1250)}, nil)
+	mock.EXPECT().DeleteUser(ctx, "654321").Return(gophermart.DeletedUserInfo{}, gophermart.ErrEmptyResult)
+
+	svc := NewAuthorizationService(mock)
+
+	info, err := svc.DeleteAccount(ctx, "123456")
+	require.NoError(t, err)
+	assert.Equal(t, money.FromMinor(1250), info.Forfeited)
+
+	_, err = svc.DeleteAccount(ctx, "654321")
+	assert.ErrorIs(t, err, service.ErrEntityDoesNotExists)
+}
+
+func TestAuthorizationService_AuthorizeLockout(t *testing.T) {
+	hash, err := password.Hash("password", testParams)
+	require.NoError(t, err)
+
+	user := gophermart.UserInfo{ID: "123456", Login: "login", PasswordHash: hash}
+	keys := []string{"login:login", "ip:10.0.0.1"}
+
+	tests := []struct {
+		name     string
+		password string
+		setup    func(*MockAuthorizationRepository, context.Context)
+		err      error
+		retry    time.Duration
+	}{
+		{
+			name:     "locked login",
+			password: "password",
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().LoginAttempts(ctx, keys).Return([]gophermart.LoginAttemptInfo{
+					{Key: "login:login", Failures: 6, LockedUntil: time.Now().Add(time.Millisecond * 3500)},
+				}, nil)
+			},
+			err:   service.ErrLimit,
+			retry: time.Second * 4,
+		},
+		{
+			name:     "lock of address is longer",
+			password: "password",
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().LoginAttempts(ctx, keys).Return([]gophermart.LoginAttemptInfo{
+					{Key: "login:login", Failures: 6, LockedUntil: time.Now().Add(time.Second * 3)},
+					{Key: "ip:10.0.0.1", Failures: 30, LockedUntil: time.Now().Add(time.Minute)},
+				}, nil)
+			},
+			err:   service.ErrLimit,
+			retry: time.Minute,
+		},
+		{
+			name:     "expired lock",
+			password: "password",
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().LoginAttempts(ctx, keys).Return([]gophermart.LoginAttemptInfo{
+					{Key: "login:login", Failures: 6, LockedUntil: time.Now().Add(-time.Second)},
+				}, nil)
+				m.EXPECT().CheckUser(ctx, gophermart.AuthData{Login: "login"}).Return(user, nil)
+				m.EXPECT().ResetLoginFailures(ctx, []string{"login:login"}).Return(nil)
+			},
+		},
+		{
+			name:     "failure under free attempts",
+			password: "wrong",
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().LoginAttempts(ctx, keys).Return(nil, nil)
+				m.EXPECT().CheckUser(ctx, gophermart.AuthData{Login: "login"}).Return(user, nil)
+				m.EXPECT().AddLoginFailure(ctx, gophermart.LoginFailureRequest{Key: "login:login", Window: loginLockout.window}).
+					Return(gophermart.LoginAttemptInfo{Key: "login:login", Failures: 1}, nil)
+				m.EXPECT().AddLoginFailure(ctx, gophermart.LoginFailureRequest{Key: "ip:10.0.0.1", Window: ipLockout.window}).
+					Return(gophermart.LoginAttemptInfo{Key: "ip:10.0.0.1", Failures: 1}, nil)
+			},
+			err: service.ErrWrongNameOrPassword,
+		},
+		{
+			name:     "failure locks login",
+			password: "wrong",
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().LoginAttempts(ctx, keys).Return(nil, nil)
+				m.EXPECT().CheckUser(ctx, gophermart.AuthData{Login: "login"}).Return(user, nil)
+				m.EXPECT().AddLoginFailure(ctx, gomock.Any()).Return(gophermart.LoginAttemptInfo{Key: "login:login", Failures: 7}, nil)
+				m.EXPECT().AddLoginFailure(ctx, gomock.Any()).Return(gophermart.LoginAttemptInfo{Key: "ip:10.0.0.1", Failures: 7}, nil)
+				m.EXPECT().LockLogin(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, dto gophermart.LoginLockRequest) error {
+					assert.Equal(t, "login:login", dto.Key)
+					//the third failure after free attempts
+					assert.WithinDuration(t, time.Now().Add(time.Second*8), dto.LockedUntil, time.Second)
+					return nil
+				})
+			},
+			err: service.ErrWrongNameOrPassword,
+		},
+		{
+			name:     "unknown login is counted",
+			password: "password",
+			setup: func(m *MockAuthorizationRepository, ctx context.Context) {
+				m.EXPECT().LoginAttempts(ctx, keys).Return(nil, nil)
+				m.EXPECT().CheckUser(ctx, gophermart.AuthData{Login: "login"}).Return(gophermart.UserInfo{}, gophermart.ErrEmptyResult)
+				m.EXPECT().AddLoginFailure(ctx, gomock.Any()).Times(2).Return(gophermart.LoginAttemptInfo{Failures: 1}, nil)
+			},
+			err: service.ErrWrongNameOrPassword,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			mock := NewMockAuthorizationRepository(ctrl)
+			tt.setup(mock, ctx)
+
+			svc := NewAuthorizationService(mock)
+			svc.params = testParams
+
+			_, err := svc.Authorize(ctx, service.AuthorizeRequest{Login: "login", Password: tt.password, ClientIP: "10.0.0.1"})
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.err)
+
+			var limitErr service.LimitError
+			if tt.retry > 0 {
+				require.ErrorAs(t, err, &limitErr)
+				assert.Equal(t, tt.retry, limitErr.RetryAfter)
+			}
+		})
+	}
+}
+
+// password of unknown login is checked as well, so time of response does not reveal which accounts exist
+func TestAuthorizationService_AuthorizeUnknownLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mock := NewMockAuthorizationRepository(ctrl)
+	mock.EXPECT().LoginAttempts(ctx, gomock.Any()).Return(nil, nil).Times(2)
+	mock.EXPECT().CheckUser(ctx, gophermart.AuthData{Login: "unknown"}).Return(gophermart.UserInfo{}, gophermart.ErrEmptyResult).Times(2)
+	mock.EXPECT().AddLoginFailure(ctx, gomock.Any()).Return(gophermart.LoginAttemptInfo{Failures: 1}, nil).Times(2)
+
+	svc := NewAuthorizationService(mock)
+	svc.params = testParams
+
+	for i := 0; i < 2; i++ {
+		_, err := svc.Authorize(ctx, service.AuthorizeRequest{Login: "unknown", Password: "password"})
+		assert.ErrorIs(t, err, service.ErrWrongNameOrPassword)
+	}
+
+	//dummy hash is made once with params of new hashes
+	valid, needsRehash, err := password.Verify("dummy password", svc.dummy.hash, testParams)
+	require.NoError(t, err)
+	assert.True(t, valid)
+	assert.False(t, needsRehash)
+}
+
+func Test_lockoutPolicy_delay(t *testing.T) {
+	p := lockoutPolicy{freeAttempts: 5, baseDelay: time.Second * 2, maxDelay: time.Minute}
+
+	assert.Equal(t, time.Duration(0), p.delay(4))
+	assert.Equal(t, time.Second*2, p.delay(5))
+	assert.Equal(t, time.Second*4, p.delay(6))
+	assert.Equal(t, time.Second*32, p.delay(9))
+	assert.Equal(t, time.Minute, p.delay(10))
+	assert.Equal(t, time.Minute, p.delay(100))
+}
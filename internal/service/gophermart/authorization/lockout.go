@@ -0,0 +1,135 @@
+package authorization
+
+import (
+	"context"
+	"time"
+
+	"github.com/vilasle/gophermart/internal/logger"
+	"github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/service"
+)
+
+// lockoutPolicy defines backoff of failed logins. After freeAttempts failures login is locked for baseDelay,
+// every next failure doubles the lock up to maxDelay. Failures are forgotten after window without them
+type lockoutPolicy struct {
+	prefix       string
+	freeAttempts int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	window       time.Duration
+}
+
+var (
+	loginLockout = lockoutPolicy{
+		prefix:       "login:",
+		freeAttempts: 5,
+		baseDelay:    time.Second * 2,
+		maxDelay:     time.Minute * 15,
+		window:       time.Hour,
+	}
+	//many users can be behind one address, so it has more attempts
+	ipLockout = lockoutPolicy{
+		prefix:       "ip:",
+		freeAttempts: 20,
+		baseDelay:    time.Second * 2,
+		maxDelay:     time.Hour,
+		window:       time.Hour,
+	}
+)
+
+func (p lockoutPolicy) delay(failures int) time.Duration {
+	if failures < p.freeAttempts {
+		return 0
+	}
+
+	shift := failures - p.freeAttempts
+	if shift > 30 {
+		return p.maxDelay
+	}
+
+	delay := p.baseDelay << shift
+	if delay <= 0 || delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	return delay
+}
+
+type lockoutKey struct {
+	key    string
+	policy lockoutPolicy
+}
+
+// lockoutKeys are shared by login and checking of current password on its change,
+// so password can not be guessed by one of them after lock by another
+func (svc AuthorizationService) lockoutKeys(login, clientIP string) []lockoutKey {
+	keys := []lockoutKey{{key: svc.loginLockout.prefix + login, policy: svc.loginLockout}}
+	if clientIP != "" {
+		keys = append(keys, lockoutKey{key: svc.ipLockout.prefix + clientIP, policy: svc.ipLockout})
+	}
+	return keys
+}
+
+// checkLockout returns LimitError if login or client address is locked
+func (svc AuthorizationService) checkLockout(ctx context.Context, keys []lockoutKey) error {
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.key)
+	}
+
+	attempts, err := svc.rep.LoginAttempts(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	var retry time.Duration
+	now := time.Now()
+	for _, attempt := range attempts {
+		if wait := attempt.LockedUntil.Sub(now); wait > retry {
+			retry = wait
+		}
+	}
+
+	if retry > 0 {
+		//client must not come back before lock is over
+		return service.LimitError{RetryAfter: (retry + time.Second - 1).Truncate(time.Second)}
+	}
+	return nil
+}
+
+// registerFailure counts failed login and locks keys which have exceeded free attempts
+func (svc AuthorizationService) registerFailure(ctx context.Context, keys []lockoutKey) {
+	log := logger.With("component", "authorization", "operation", "registerFailure")
+
+	for _, k := range keys {
+		attempt, err := svc.rep.AddLoginFailure(ctx, gophermart.LoginFailureRequest{
+			Key:    k.key,
+			Window: k.policy.window,
+		})
+		if err != nil {
+			log.Error("counting of failed login failed", "key", k.key, "error", err)
+			continue
+		}
+
+		delay := k.policy.delay(attempt.Failures)
+		if delay == 0 {
+			continue
+		}
+
+		log.Info("login is locked", "key", k.key, "failures", attempt.Failures, "delay", delay)
+
+		err = svc.rep.LockLogin(ctx, gophermart.LoginLockRequest{
+			Key:         k.key,
+			LockedUntil: time.Now().Add(delay),
+		})
+		if err != nil {
+			log.Error("locking of login failed", "key", k.key, "error", err)
+		}
+	}
+}
+
+// resetFailures forgets failures of login after success, failures of address are kept
+func (svc AuthorizationService) resetFailures(ctx context.Context, keys []lockoutKey) {
+	if err := svc.rep.ResetLoginFailures(ctx, []string{keys[0].key}); err != nil {
+		logger.Error("resetting of failed logins failed", "key", keys[0].key, "error", err)
+	}
+}
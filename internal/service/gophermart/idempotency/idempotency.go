@@ -0,0 +1,81 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/service"
+)
+
+const maxKeyLength = 255
+
+// key without response is left by request which crashed or lost database, retry takes it over after processingTimeout.
+// It is much longer than timeouts of server, so request which is still processed is not repeated
+const processingTimeout = time.Minute
+
+type IdempotencyService struct {
+	rep gophermart.IdempotencyRepository
+	ttl time.Duration
+}
+
+func NewIdempotencyService(rep gophermart.IdempotencyRepository, ttl time.Duration) IdempotencyService {
+	return IdempotencyService{rep: rep, ttl: ttl}
+}
+
+func (s IdempotencyService) Start(ctx context.Context, dto service.IdempotencyRequest) (service.IdempotentResponse, bool, error) {
+	if dto.UserID == "" || dto.Key == "" || len(dto.Key) > maxKeyLength {
+		return service.IdempotentResponse{}, false, service.ErrInvalidFormat
+	}
+
+	err := s.rep.ReserveKey(ctx, gophermart.IdempotencyKeyRequest{
+		UserID:            dto.UserID,
+		Key:               dto.Key,
+		Fingerprint:       dto.Fingerprint,
+		TTL:               s.ttl,
+		ProcessingTimeout: processingTimeout,
+	})
+	if err == nil {
+		return service.IdempotentResponse{}, false, nil
+	} else if !errors.Is(err, gophermart.ErrDuplicate) {
+		return service.IdempotentResponse{}, false, err
+	}
+
+	info, err := s.rep.Key(ctx, gophermart.IdempotencyKeyFilter{UserID: dto.UserID, Key: dto.Key})
+	if err != nil {
+		if errors.Is(err, gophermart.ErrEmptyResult) {
+			//key was released between reserving and reading, client can retry
+			return service.IdempotentResponse{}, false, service.ErrIdempotencyKeyInProgress
+		}
+		return service.IdempotentResponse{}, false, err
+	}
+
+	if info.Fingerprint != dto.Fingerprint {
+		return service.IdempotentResponse{}, false, service.ErrIdempotencyKeyReused
+	}
+
+	if !info.Completed {
+		return service.IdempotentResponse{}, false, service.ErrIdempotencyKeyInProgress
+	}
+
+	return service.IdempotentResponse{
+		StatusCode:  info.StatusCode,
+		ContentType: info.ContentType,
+		Body:        info.Body,
+	}, true, nil
+}
+
+func (s IdempotencyService) Complete(ctx context.Context, dto service.IdempotencyRequest, resp service.IdempotentResponse) error {
+	return s.rep.SaveResponse(ctx, gophermart.IdempotencyResponseRequest{
+		UserID:      dto.UserID,
+		Key:         dto.Key,
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.ContentType,
+		Body:        resp.Body,
+	})
+}
+
+func (s IdempotencyService) Cancel(ctx context.Context, dto service.IdempotencyRequest) error {
+	return s.rep.DeleteKey(ctx, gophermart.IdempotencyKeyFilter{UserID: dto.UserID, Key: dto.Key})
+}
@@ -0,0 +1,170 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/service"
+)
+
+func TestIdempotencyService_Start(t *testing.T) {
+	type want struct {
+		resp   service.IdempotentResponse
+		replay bool
+		err    error
+	}
+
+	ttl := time.Hour
+	repErr := errors.New("repository error")
+
+	dto := service.IdempotencyRequest{
+		UserID:      "123456",
+		Key:         "key-1",
+		Fingerprint: "abc",
+	}
+	reserve := gophermart.IdempotencyKeyRequest{
+		UserID:            "123456",
+		Key:               "key-1",
+		Fingerprint:       "abc",
+		TTL:               ttl,
+		ProcessingTimeout: time.Minute,
+	}
+	filter := gophermart.IdempotencyKeyFilter{UserID: "123456", Key: "key-1"}
+
+	tests := []struct {
+		name  string
+		dto   service.IdempotencyRequest
+		setup func(*MockIdempotencyRepository, context.Context)
+		want  want
+	}{
+		{
+			name:  "empty key",
+			dto:   service.IdempotencyRequest{UserID: "123456"},
+			setup: func(m *MockIdempotencyRepository, ctx context.Context) {},
+			want:  want{err: service.ErrInvalidFormat},
+		},
+		{
+			name: "first request",
+			dto:  dto,
+			setup: func(m *MockIdempotencyRepository, ctx context.Context) {
+				m.EXPECT().ReserveKey(ctx, reserve).Return(nil)
+			},
+			want: want{},
+		},
+		{
+			name: "retry of completed request",
+			dto:  dto,
+			setup: func(m *MockIdempotencyRepository, ctx context.Context) {
+				m.EXPECT().ReserveKey(ctx, reserve).Return(gophermart.ErrDuplicate)
+				m.EXPECT().Key(ctx, filter).Return(gophermart.IdempotencyKeyInfo{
+					UserID:      "123456",
+					Key:         "key-1",
+					Fingerprint: "abc",
+					Completed:   true,
+					StatusCode:  202,
+					ContentType: "text/plain",
+				}, nil)
+			},
+			want: want{
+				resp:   service.IdempotentResponse{StatusCode: 202, ContentType: "text/plain"},
+				replay: true,
+			},
+		},
+		{
+			name: "retry of processing request",
+			dto:  dto,
+			setup: func(m *MockIdempotencyRepository, ctx context.Context) {
+				m.EXPECT().ReserveKey(ctx, reserve).Return(gophermart.ErrDuplicate)
+				m.EXPECT().Key(ctx, filter).Return(gophermart.IdempotencyKeyInfo{
+					Fingerprint: "abc",
+					Completed:   false,
+				}, nil)
+			},
+			want: want{err: service.ErrIdempotencyKeyInProgress},
+		},
+		{
+			name: "key with another body",
+			dto:  dto,
+			setup: func(m *MockIdempotencyRepository, ctx context.Context) {
+				m.EXPECT().ReserveKey(ctx, reserve).Return(gophermart.ErrDuplicate)
+				m.EXPECT().Key(ctx, filter).Return(gophermart.IdempotencyKeyInfo{
+					Fingerprint: "another",
+					Completed:   true,
+					StatusCode:  200,
+				}, nil)
+			},
+			want: want{err: service.ErrIdempotencyKeyReused},
+		},
+		{
+			name: "repository error",
+			dto:  dto,
+			setup: func(m *MockIdempotencyRepository, ctx context.Context) {
+				m.EXPECT().ReserveKey(ctx, reserve).Return(repErr)
+			},
+			want: want{err: repErr},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			mock := NewMockIdempotencyRepository(ctrl)
+			tt.setup(mock, ctx)
+
+			s := NewIdempotencyService(mock, ttl)
+
+			resp, replay, err := s.Start(ctx, tt.dto)
+			if tt.want.err != nil {
+				assert.ErrorIs(t, err, tt.want.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want.replay, replay)
+			assert.Equal(t, tt.want.resp, resp)
+		})
+	}
+}
+
+func TestIdempotencyService_Complete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mock := NewMockIdempotencyRepository(ctrl)
+	mock.EXPECT().SaveResponse(ctx, gophermart.IdempotencyResponseRequest{
+		UserID:      "123456",
+		Key:         "key-1",
+		StatusCode:  402,
+		ContentType: "text/plain",
+		Body:        []byte("not have enough points"),
+	}).Return(nil)
+
+	s := NewIdempotencyService(mock, time.Hour)
+
+	err := s.Complete(ctx,
+		service.IdempotencyRequest{UserID: "123456", Key: "key-1", Fingerprint: "abc"},
+		service.IdempotentResponse{StatusCode: 402, ContentType: "text/plain", Body: []byte("not have enough points")},
+	)
+	assert.NoError(t, err)
+}
+
+func TestIdempotencyService_Cancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	mock := NewMockIdempotencyRepository(ctrl)
+	mock.EXPECT().DeleteKey(ctx, gophermart.IdempotencyKeyFilter{UserID: "123456", Key: "key-1"}).Return(nil)
+
+	s := NewIdempotencyService(mock, time.Hour)
+
+	assert.NoError(t, s.Cancel(ctx, service.IdempotencyRequest{UserID: "123456", Key: "key-1"}))
+}
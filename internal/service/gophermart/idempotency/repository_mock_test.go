@@ -0,0 +1,702 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/repository/gophermart/repository.go
+
+// Package idempotency is a generated GoMock package.
+package idempotency
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	gophermart "github.com/vilasle/gophermart/internal/repository/gophermart"
+)
+
+// MockAuthorizationRepository is a mock of AuthorizationRepository interface.
+type MockAuthorizationRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuthorizationRepositoryMockRecorder
+}
+
+// MockAuthorizationRepositoryMockRecorder is the mock recorder for MockAuthorizationRepository.
+type MockAuthorizationRepositoryMockRecorder struct {
+	mock *MockAuthorizationRepository
+}
+
+// NewMockAuthorizationRepository creates a new mock instance.
+func NewMockAuthorizationRepository(ctrl *gomock.Controller) *MockAuthorizationRepository {
+	mock := &MockAuthorizationRepository{ctrl: ctrl}
+	mock.recorder = &MockAuthorizationRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuthorizationRepository) EXPECT() *MockAuthorizationRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AddLoginFailure mocks base method.
+func (m *MockAuthorizationRepository) AddLoginFailure(arg0 context.Context, arg1 gophermart.LoginFailureRequest) (gophermart.LoginAttemptInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddLoginFailure", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.LoginAttemptInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddLoginFailure indicates an expected call of AddLoginFailure.
+func (mr *MockAuthorizationRepositoryMockRecorder) AddLoginFailure(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddLoginFailure", reflect.TypeOf((*MockAuthorizationRepository)(nil).AddLoginFailure), arg0, arg1)
+}
+
+// AddRefreshToken mocks base method.
+func (m *MockAuthorizationRepository) AddRefreshToken(arg0 context.Context, arg1 gophermart.RefreshTokenRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddRefreshToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddRefreshToken indicates an expected call of AddRefreshToken.
+func (mr *MockAuthorizationRepositoryMockRecorder) AddRefreshToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRefreshToken", reflect.TypeOf((*MockAuthorizationRepository)(nil).AddRefreshToken), arg0, arg1)
+}
+
+// AddUser mocks base method.
+func (m *MockAuthorizationRepository) AddUser(arg0 context.Context, arg1 gophermart.AuthData) (gophermart.UserInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddUser", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.UserInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddUser indicates an expected call of AddUser.
+func (mr *MockAuthorizationRepositoryMockRecorder) AddUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockAuthorizationRepository)(nil).AddUser), arg0, arg1)
+}
+
+// CheckAccessToken mocks base method.
+func (m *MockAuthorizationRepository) CheckAccessToken(arg0 context.Context, arg1 gophermart.AccessTokenRequest) (gophermart.AccessTokenInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckAccessToken", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.AccessTokenInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckAccessToken indicates an expected call of CheckAccessToken.
+func (mr *MockAuthorizationRepositoryMockRecorder) CheckAccessToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckAccessToken", reflect.TypeOf((*MockAuthorizationRepository)(nil).CheckAccessToken), arg0, arg1)
+}
+
+// CheckUser mocks base method.
+func (m *MockAuthorizationRepository) CheckUser(arg0 context.Context, arg1 gophermart.AuthData) (gophermart.UserInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckUser", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.UserInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckUser indicates an expected call of CheckUser.
+func (mr *MockAuthorizationRepositoryMockRecorder) CheckUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckUser", reflect.TypeOf((*MockAuthorizationRepository)(nil).CheckUser), arg0, arg1)
+}
+
+// CheckUserByID mocks base method.
+func (m *MockAuthorizationRepository) CheckUserByID(arg0 context.Context, arg1 string) (gophermart.UserInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckUserByID", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.UserInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckUserByID indicates an expected call of CheckUserByID.
+func (mr *MockAuthorizationRepositoryMockRecorder) CheckUserByID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckUserByID", reflect.TypeOf((*MockAuthorizationRepository)(nil).CheckUserByID), arg0, arg1)
+}
+
+// DeleteUser mocks base method.
+func (m *MockAuthorizationRepository) DeleteUser(arg0 context.Context, arg1 string) (gophermart.DeletedUserInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.DeletedUserInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockAuthorizationRepositoryMockRecorder) DeleteUser(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockAuthorizationRepository)(nil).DeleteUser), arg0, arg1)
+}
+
+// LockLogin mocks base method.
+func (m *MockAuthorizationRepository) LockLogin(arg0 context.Context, arg1 gophermart.LoginLockRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LockLogin", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LockLogin indicates an expected call of LockLogin.
+func (mr *MockAuthorizationRepositoryMockRecorder) LockLogin(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LockLogin", reflect.TypeOf((*MockAuthorizationRepository)(nil).LockLogin), arg0, arg1)
+}
+
+// LoginAttempts mocks base method.
+func (m *MockAuthorizationRepository) LoginAttempts(arg0 context.Context, arg1 []string) ([]gophermart.LoginAttemptInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginAttempts", arg0, arg1)
+	ret0, _ := ret[0].([]gophermart.LoginAttemptInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoginAttempts indicates an expected call of LoginAttempts.
+func (mr *MockAuthorizationRepositoryMockRecorder) LoginAttempts(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginAttempts", reflect.TypeOf((*MockAuthorizationRepository)(nil).LoginAttempts), arg0, arg1)
+}
+
+// ResetLoginFailures mocks base method.
+func (m *MockAuthorizationRepository) ResetLoginFailures(arg0 context.Context, arg1 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetLoginFailures", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetLoginFailures indicates an expected call of ResetLoginFailures.
+func (mr *MockAuthorizationRepositoryMockRecorder) ResetLoginFailures(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetLoginFailures", reflect.TypeOf((*MockAuthorizationRepository)(nil).ResetLoginFailures), arg0, arg1)
+}
+
+// RevokeSession mocks base method.
+func (m *MockAuthorizationRepository) RevokeSession(arg0 context.Context, arg1 gophermart.AccessTokenRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockAuthorizationRepositoryMockRecorder) RevokeSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockAuthorizationRepository)(nil).RevokeSession), arg0, arg1)
+}
+
+// RevokeUserTokens mocks base method.
+func (m *MockAuthorizationRepository) RevokeUserTokens(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserTokens", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserTokens indicates an expected call of RevokeUserTokens.
+func (mr *MockAuthorizationRepositoryMockRecorder) RevokeUserTokens(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserTokens", reflect.TypeOf((*MockAuthorizationRepository)(nil).RevokeUserTokens), arg0, arg1)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockAuthorizationRepository) UpdatePassword(arg0 context.Context, arg1 gophermart.PasswordUpdateRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockAuthorizationRepositoryMockRecorder) UpdatePassword(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockAuthorizationRepository)(nil).UpdatePassword), arg0, arg1)
+}
+
+// UseRefreshToken mocks base method.
+func (m *MockAuthorizationRepository) UseRefreshToken(arg0 context.Context, arg1 gophermart.RefreshTokenUsing) (gophermart.RefreshTokenInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRefreshToken", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.RefreshTokenInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRefreshToken indicates an expected call of UseRefreshToken.
+func (mr *MockAuthorizationRepositoryMockRecorder) UseRefreshToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRefreshToken", reflect.TypeOf((*MockAuthorizationRepository)(nil).UseRefreshToken), arg0, arg1)
+}
+
+// MockWithdrawalRepository is a mock of WithdrawalRepository interface.
+type MockWithdrawalRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockWithdrawalRepositoryMockRecorder
+}
+
+// MockWithdrawalRepositoryMockRecorder is the mock recorder for MockWithdrawalRepository.
+type MockWithdrawalRepositoryMockRecorder struct {
+	mock *MockWithdrawalRepository
+}
+
+// NewMockWithdrawalRepository creates a new mock instance.
+func NewMockWithdrawalRepository(ctrl *gomock.Controller) *MockWithdrawalRepository {
+	mock := &MockWithdrawalRepository{ctrl: ctrl}
+	mock.recorder = &MockWithdrawalRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWithdrawalRepository) EXPECT() *MockWithdrawalRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Expense mocks base method.
+func (m *MockWithdrawalRepository) Expense(arg0 context.Context, arg1 gophermart.WithdrawalRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Expense", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Expense indicates an expected call of Expense.
+func (mr *MockWithdrawalRepositoryMockRecorder) Expense(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expense", reflect.TypeOf((*MockWithdrawalRepository)(nil).Expense), arg0, arg1)
+}
+
+// Income mocks base method.
+func (m *MockWithdrawalRepository) Income(arg0 context.Context, arg1 gophermart.WithdrawalRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Income", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Income indicates an expected call of Income.
+func (mr *MockWithdrawalRepositoryMockRecorder) Income(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Income", reflect.TypeOf((*MockWithdrawalRepository)(nil).Income), arg0, arg1)
+}
+
+// Transactions mocks base method.
+func (m *MockWithdrawalRepository) Transactions(arg0 context.Context, arg1 gophermart.TransactionRequest) ([]gophermart.Transaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Transactions", arg0, arg1)
+	ret0, _ := ret[0].([]gophermart.Transaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Transactions indicates an expected call of Transactions.
+func (mr *MockWithdrawalRepositoryMockRecorder) Transactions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Transactions", reflect.TypeOf((*MockWithdrawalRepository)(nil).Transactions), arg0, arg1)
+}
+
+// MockOrderRepository is a mock of OrderRepository interface.
+type MockOrderRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockOrderRepositoryMockRecorder
+}
+
+// MockOrderRepositoryMockRecorder is the mock recorder for MockOrderRepository.
+type MockOrderRepositoryMockRecorder struct {
+	mock *MockOrderRepository
+}
+
+// NewMockOrderRepository creates a new mock instance.
+func NewMockOrderRepository(ctrl *gomock.Controller) *MockOrderRepository {
+	mock := &MockOrderRepository{ctrl: ctrl}
+	mock.recorder = &MockOrderRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOrderRepository) EXPECT() *MockOrderRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AddAttempt mocks base method.
+func (m *MockOrderRepository) AddAttempt(arg0 context.Context, arg1 gophermart.OrderAttemptRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddAttempt", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddAttempt indicates an expected call of AddAttempt.
+func (mr *MockOrderRepositoryMockRecorder) AddAttempt(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAttempt", reflect.TypeOf((*MockOrderRepository)(nil).AddAttempt), arg0, arg1)
+}
+
+// ClaimOrders mocks base method.
+func (m *MockOrderRepository) ClaimOrders(arg0 context.Context, arg1 gophermart.OrderClaimRequest) ([]gophermart.OrderInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimOrders", arg0, arg1)
+	ret0, _ := ret[0].([]gophermart.OrderInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimOrders indicates an expected call of ClaimOrders.
+func (mr *MockOrderRepositoryMockRecorder) ClaimOrders(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimOrders", reflect.TypeOf((*MockOrderRepository)(nil).ClaimOrders), arg0, arg1)
+}
+
+// Create mocks base method.
+func (m *MockOrderRepository) Create(arg0 context.Context, arg1 gophermart.OrderCreateRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockOrderRepositoryMockRecorder) Create(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockOrderRepository)(nil).Create), arg0, arg1)
+}
+
+// ExtendLease mocks base method.
+func (m *MockOrderRepository) ExtendLease(arg0 context.Context, arg1 gophermart.OrderLeaseRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExtendLease", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExtendLease indicates an expected call of ExtendLease.
+func (mr *MockOrderRepositoryMockRecorder) ExtendLease(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExtendLease", reflect.TypeOf((*MockOrderRepository)(nil).ExtendLease), arg0, arg1)
+}
+
+// List mocks base method.
+func (m *MockOrderRepository) List(arg0 context.Context, arg1 gophermart.OrderListRequest) ([]gophermart.OrderInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0, arg1)
+	ret0, _ := ret[0].([]gophermart.OrderInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockOrderRepositoryMockRecorder) List(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockOrderRepository)(nil).List), arg0, arg1)
+}
+
+// OrderEvents mocks base method.
+func (m *MockOrderRepository) OrderEvents(arg0 context.Context, arg1 gophermart.OrderEventRequest) ([]gophermart.OrderEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OrderEvents", arg0, arg1)
+	ret0, _ := ret[0].([]gophermart.OrderEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OrderEvents indicates an expected call of OrderEvents.
+func (mr *MockOrderRepositoryMockRecorder) OrderEvents(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OrderEvents", reflect.TypeOf((*MockOrderRepository)(nil).OrderEvents), arg0, arg1)
+}
+
+// Update mocks base method.
+func (m *MockOrderRepository) Update(arg0 context.Context, arg1 gophermart.OrderUpdateRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockOrderRepositoryMockRecorder) Update(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockOrderRepository)(nil).Update), arg0, arg1)
+}
+
+// UpdateWithIncome mocks base method.
+func (m *MockOrderRepository) UpdateWithIncome(arg0 context.Context, arg1 gophermart.OrderUpdateRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateWithIncome", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateWithIncome indicates an expected call of UpdateWithIncome.
+func (mr *MockOrderRepositoryMockRecorder) UpdateWithIncome(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateWithIncome", reflect.TypeOf((*MockOrderRepository)(nil).UpdateWithIncome), arg0, arg1)
+}
+
+// MockWebhookRepository is a mock of WebhookRepository interface.
+type MockWebhookRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockWebhookRepositoryMockRecorder
+}
+
+// MockWebhookRepositoryMockRecorder is the mock recorder for MockWebhookRepository.
+type MockWebhookRepositoryMockRecorder struct {
+	mock *MockWebhookRepository
+}
+
+// NewMockWebhookRepository creates a new mock instance.
+func NewMockWebhookRepository(ctrl *gomock.Controller) *MockWebhookRepository {
+	mock := &MockWebhookRepository{ctrl: ctrl}
+	mock.recorder = &MockWebhookRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWebhookRepository) EXPECT() *MockWebhookRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AddWebhook mocks base method.
+func (m *MockWebhookRepository) AddWebhook(arg0 context.Context, arg1 gophermart.WebhookRequest) (gophermart.WebhookInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddWebhook", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.WebhookInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddWebhook indicates an expected call of AddWebhook.
+func (mr *MockWebhookRepositoryMockRecorder) AddWebhook(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWebhook", reflect.TypeOf((*MockWebhookRepository)(nil).AddWebhook), arg0, arg1)
+}
+
+// ClaimDeliveries mocks base method.
+func (m *MockWebhookRepository) ClaimDeliveries(arg0 context.Context, arg1 gophermart.DeliveryClaimRequest) ([]gophermart.Delivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimDeliveries", arg0, arg1)
+	ret0, _ := ret[0].([]gophermart.Delivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimDeliveries indicates an expected call of ClaimDeliveries.
+func (mr *MockWebhookRepositoryMockRecorder) ClaimDeliveries(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimDeliveries", reflect.TypeOf((*MockWebhookRepository)(nil).ClaimDeliveries), arg0, arg1)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockWebhookRepository) DeleteWebhook(arg0 context.Context, arg1 gophermart.WebhookFilter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockWebhookRepositoryMockRecorder) DeleteWebhook(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockWebhookRepository)(nil).DeleteWebhook), arg0, arg1)
+}
+
+// Deliveries mocks base method.
+func (m *MockWebhookRepository) Deliveries(arg0 context.Context, arg1 gophermart.DeliveryListRequest) ([]gophermart.Delivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Deliveries", arg0, arg1)
+	ret0, _ := ret[0].([]gophermart.Delivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Deliveries indicates an expected call of Deliveries.
+func (mr *MockWebhookRepositoryMockRecorder) Deliveries(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Deliveries", reflect.TypeOf((*MockWebhookRepository)(nil).Deliveries), arg0, arg1)
+}
+
+// Redeliver mocks base method.
+func (m *MockWebhookRepository) Redeliver(arg0 context.Context, arg1 gophermart.RedeliveryRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Redeliver", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Redeliver indicates an expected call of Redeliver.
+func (mr *MockWebhookRepositoryMockRecorder) Redeliver(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Redeliver", reflect.TypeOf((*MockWebhookRepository)(nil).Redeliver), arg0, arg1)
+}
+
+// SaveDeliveryResult mocks base method.
+func (m *MockWebhookRepository) SaveDeliveryResult(arg0 context.Context, arg1 gophermart.DeliveryResultRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveDeliveryResult", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveDeliveryResult indicates an expected call of SaveDeliveryResult.
+func (mr *MockWebhookRepositoryMockRecorder) SaveDeliveryResult(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveDeliveryResult", reflect.TypeOf((*MockWebhookRepository)(nil).SaveDeliveryResult), arg0, arg1)
+}
+
+// Webhooks mocks base method.
+func (m *MockWebhookRepository) Webhooks(arg0 context.Context, arg1 string) ([]gophermart.WebhookInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Webhooks", arg0, arg1)
+	ret0, _ := ret[0].([]gophermart.WebhookInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Webhooks indicates an expected call of Webhooks.
+func (mr *MockWebhookRepositoryMockRecorder) Webhooks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Webhooks", reflect.TypeOf((*MockWebhookRepository)(nil).Webhooks), arg0, arg1)
+}
+
+// MockIdempotencyRepository is a mock of IdempotencyRepository interface.
+type MockIdempotencyRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdempotencyRepositoryMockRecorder
+}
+
+// MockIdempotencyRepositoryMockRecorder is the mock recorder for MockIdempotencyRepository.
+type MockIdempotencyRepositoryMockRecorder struct {
+	mock *MockIdempotencyRepository
+}
+
+// NewMockIdempotencyRepository creates a new mock instance.
+func NewMockIdempotencyRepository(ctrl *gomock.Controller) *MockIdempotencyRepository {
+	mock := &MockIdempotencyRepository{ctrl: ctrl}
+	mock.recorder = &MockIdempotencyRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdempotencyRepository) EXPECT() *MockIdempotencyRepositoryMockRecorder {
+	return m.recorder
+}
+
+// DeleteKey mocks base method.
+func (m *MockIdempotencyRepository) DeleteKey(arg0 context.Context, arg1 gophermart.IdempotencyKeyFilter) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteKey indicates an expected call of DeleteKey.
+func (mr *MockIdempotencyRepositoryMockRecorder) DeleteKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteKey", reflect.TypeOf((*MockIdempotencyRepository)(nil).DeleteKey), arg0, arg1)
+}
+
+// Key mocks base method.
+func (m *MockIdempotencyRepository) Key(arg0 context.Context, arg1 gophermart.IdempotencyKeyFilter) (gophermart.IdempotencyKeyInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Key", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.IdempotencyKeyInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Key indicates an expected call of Key.
+func (mr *MockIdempotencyRepositoryMockRecorder) Key(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Key", reflect.TypeOf((*MockIdempotencyRepository)(nil).Key), arg0, arg1)
+}
+
+// ReserveKey mocks base method.
+func (m *MockIdempotencyRepository) ReserveKey(arg0 context.Context, arg1 gophermart.IdempotencyKeyRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveKey", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReserveKey indicates an expected call of ReserveKey.
+func (mr *MockIdempotencyRepositoryMockRecorder) ReserveKey(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveKey", reflect.TypeOf((*MockIdempotencyRepository)(nil).ReserveKey), arg0, arg1)
+}
+
+// SaveResponse mocks base method.
+func (m *MockIdempotencyRepository) SaveResponse(arg0 context.Context, arg1 gophermart.IdempotencyResponseRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveResponse", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveResponse indicates an expected call of SaveResponse.
+func (mr *MockIdempotencyRepositoryMockRecorder) SaveResponse(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveResponse", reflect.TypeOf((*MockIdempotencyRepository)(nil).SaveResponse), arg0, arg1)
+}
+
+// MockAccrualRepository is a mock of AccrualRepository interface.
+type MockAccrualRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAccrualRepositoryMockRecorder
+}
+
+// MockAccrualRepositoryMockRecorder is the mock recorder for MockAccrualRepository.
+type MockAccrualRepositoryMockRecorder struct {
+	mock *MockAccrualRepository
+}
+
+// NewMockAccrualRepository creates a new mock instance.
+func NewMockAccrualRepository(ctrl *gomock.Controller) *MockAccrualRepository {
+	mock := &MockAccrualRepository{ctrl: ctrl}
+	mock.recorder = &MockAccrualRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAccrualRepository) EXPECT() *MockAccrualRepositoryMockRecorder {
+	return m.recorder
+}
+
+// AccrualByOrder mocks base method.
+func (m *MockAccrualRepository) AccrualByOrder(arg0 context.Context, arg1 gophermart.AccrualRequest) (gophermart.AccrualInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AccrualByOrder", arg0, arg1)
+	ret0, _ := ret[0].(gophermart.AccrualInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AccrualByOrder indicates an expected call of AccrualByOrder.
+func (mr *MockAccrualRepositoryMockRecorder) AccrualByOrder(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AccrualByOrder", reflect.TypeOf((*MockAccrualRepository)(nil).AccrualByOrder), arg0, arg1)
+}
+
+// AccrualByOrders mocks base method.
+func (m *MockAccrualRepository) AccrualByOrders(arg0 context.Context, arg1 gophermart.AccrualBatchRequest) ([]gophermart.AccrualInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AccrualByOrders", arg0, arg1)
+	ret0, _ := ret[0].([]gophermart.AccrualInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AccrualByOrders indicates an expected call of AccrualByOrders.
+func (mr *MockAccrualRepositoryMockRecorder) AccrualByOrders(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AccrualByOrders", reflect.TypeOf((*MockAccrualRepository)(nil).AccrualByOrders), arg0, arg1)
+}
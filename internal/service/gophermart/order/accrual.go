@@ -3,17 +3,36 @@ package order
 import (
 	"context"
 	"errors"
+	"expvar"
 	"sync"
 	"time"
 
 	"github.com/vilasle/gophermart/internal/logger"
+	"github.com/vilasle/gophermart/internal/repository/gophermart"
 	"github.com/vilasle/gophermart/internal/service"
 )
 
+// metrics of accrual manager are published by expvar: current concurrency limit and its changes
+var metrics = expvar.NewMap("accrual_manager")
+
+// batchProbeTimeout is how long single lookups are used after accrual service answered that it does not have batch lookup
+const batchProbeTimeout = 10 * time.Minute
+
 type checkAccrualJob struct {
-	userID   string
-	number   string
+	userID string
+	number string
+	//quantity of the previous checks of order
 	attempts int
+	//quantity of the previous checks which accrual service answered that order is unknown,
+	//only they lead to invalid order, failures and limits of accrual service are not counted
+	notFound int
+	//result of batch lookup, order is looked up by worker if it is nil
+	lookup *accrualLookup
+}
+
+type accrualLookup struct {
+	result service.AccrualsInfo
+	err    error
 }
 
 type accrualManager struct {
@@ -22,15 +41,15 @@ type accrualManager struct {
 	*/
 	accrualSvc service.AccrualService
 	/*
-		how often need send request and read new jobs
+		how often need read new jobs
 	*/
 	readJobsTimeout time.Duration
 	/*
-		getting unprocessed orders
+		claiming orders which are due to be checked
 	*/
 	ordersSvc OrderService
 	/*
-		updating order state and posting transactions
+		updating order state, posting transactions and scheduling the next check
 	*/
 	updatingOrder updatingOrder
 	/*
@@ -38,23 +57,38 @@ type accrualManager struct {
 	*/
 	jobs chan checkAccrualJob
 	/*
-		sleeping timeout when accrual service does not contain order or return another error, except ErrLimit
+		delay of the next check after the first one, it is doubled after each next check up to maxRetryDelay
 	*/
 	timeoutOnError time.Duration
+	maxRetryDelay  time.Duration
 	/*
-		quantity of attempts to get accrual information before set invalid state
-		if accrual service does not contain order
+		quantity of checks before order is set invalid if accrual service does not contain order
 	*/
 	attemptsOnError int
 	/*
-		if got ErrLimit workers will wait when can continue work
+		claimed orders are not claimed again during lease, also by another instance.
+		owner is id of instance in leases
+	*/
+	lease time.Duration
+	owner string
+	/*
+		if got ErrLimit workers and reader will wait when can continue work
 	*/
 	limit   time.Time
 	limitMx *sync.Mutex
 	wg      *sync.WaitGroup
-	//protection from run the same jobs
-	mxProcessingMx *sync.Mutex
-	orderOnProcess map[string]struct{}
+	/*
+		workers is the largest quantity of simultaneous requests to accrual service,
+		concurrency is adapted to its errors in this bound
+	*/
+	workers     int
+	concurrency *concurrencyLimit
+	/*
+		claimed orders are looked up by one request in batches of this size, zero disables batches.
+		Batches are not used until noBatchUntil if accrual service does not support them
+	*/
+	batchSize    int
+	noBatchUntil time.Time
 }
 
 type accrualManagerConfig struct {
@@ -62,11 +96,22 @@ type accrualManagerConfig struct {
 	ordersSvc       OrderService
 	updatingOrder   updatingOrder
 	timeoutOnError  time.Duration
+	maxRetryDelay   time.Duration
 	attemptsOnError int
 	readJobsTimeout time.Duration
+	lease           time.Duration
+	owner           string
+	workers         int
+	batchSize       int
 }
 
 func newAccrualManager(config accrualManagerConfig) *accrualManager {
+	workers := max(config.workers, 1)
+
+	limit := new(expvar.Int)
+	limit.Set(int64(workers))
+	metrics.Set("concurrency_limit", limit)
+
 	return &accrualManager{
 		jobs:            make(chan checkAccrualJob),
 		limit:           time.Now(),
@@ -75,19 +120,30 @@ func newAccrualManager(config accrualManagerConfig) *accrualManager {
 		ordersSvc:       config.ordersSvc,
 		updatingOrder:   config.updatingOrder,
 		timeoutOnError:  config.timeoutOnError,
+		maxRetryDelay:   config.maxRetryDelay,
 		attemptsOnError: config.attemptsOnError,
 		readJobsTimeout: config.readJobsTimeout,
+		lease:           config.lease,
+		owner:           config.owner,
 		wg:              &sync.WaitGroup{},
-		mxProcessingMx:  &sync.Mutex{},
-		orderOnProcess:  make(map[string]struct{}),
+		workers:         workers,
+		batchSize:       config.batchSize,
+		concurrency: newConcurrencyLimit(1, workers, func(from, to int) {
+			limit.Set(int64(to))
+			if to > from {
+				metrics.Add("concurrency_increases", 1)
+			} else {
+				metrics.Add("concurrency_decreases", 1)
+			}
+		}),
 	}
 }
 
-func (m *accrualManager) start(ctx context.Context, qtyWorkers int) {
-	m.wg.Add(qtyWorkers + 1)
+func (m *accrualManager) start(ctx context.Context) {
+	m.wg.Add(m.workers + 1)
 	go m.runJobReader(ctx)
 
-	for i := 0; i < qtyWorkers; i++ {
+	for i := 0; i < m.workers; i++ {
 		go m.runWorker(ctx)
 	}
 
@@ -110,26 +166,21 @@ func (m *accrualManager) runWorker(ctx context.Context) {
 			if !ok {
 				return
 			}
-			m.mxProcessingMx.Lock()
-			if _, ok := m.orderOnProcess[job.number]; ok {
-				m.mxProcessingMx.Unlock()
-				continue
-			}
-			m.orderOnProcess[job.number] = struct{}{}
-			m.mxProcessingMx.Unlock()
 			m.processJob(ctx, job)
 		}
 	}
 }
 
+/*
+processJob makes one check of order. Order is claimed, so nobody else checks it until its lease expires.
+The next check is scheduled by backoff unless order gets final status
+*/
 func (m *accrualManager) processJob(ctx context.Context, job checkAccrualJob) {
 	log := logger.With("component", "accrual manager", "operation", "processJob", "order", job.number)
 
-	defer func() {
-		m.mxProcessingMx.Lock()
-		delete(m.orderOnProcess, job.number)
-		m.mxProcessingMx.Unlock()
-	}()
+	//processing is canceled if lease is lost, then order is processed by another instance
+	ctx, release := m.keepLease(ctx, job.number)
+	defer release()
 
 	//set state anyway
 	if err := m.updatingOrder.updateOrder(ctx, updateRepositoryJob{
@@ -145,105 +196,185 @@ func (m *accrualManager) processJob(ctx context.Context, job checkAccrualJob) {
 		return
 	}
 
-	for job.attempts > 0 {
+	var (
+		result service.AccrualsInfo
+		err    error
+	)
+	if job.lookup != nil {
+		//order was looked up by reader in batch
+		result, err = job.lookup.result, job.lookup.err
+	} else {
 		//was there limit error and should it wait?
-		now := time.Now()
-		if now.Before(m.limit) {
-			log.Debug("was limit error. need to wait", "start", now.Format(time.RFC3339), "finish", m.limit.Format(time.RFC3339))
-			time.Sleep(m.limit.Sub(now))
+		if !m.waitLimit(ctx) {
+			return
 		}
 
-		result, err := m.accrualSvc.Accruals(ctx, service.AccrualsFilterRequest{
+		if !m.concurrency.acquire(ctx) {
+			return
+		}
+		result, err = m.accrualSvc.Accruals(ctx, service.AccrualsFilterRequest{
 			Number: job.number,
 		})
+		//unknown order is normal answer of working service
+		m.concurrency.release(err == nil || errors.Is(err, service.ErrEntityDoesNotExists))
+	}
+	if ctx.Err() != nil {
+		//order will be claimed again when lease expires
+		return
+	}
 
-		retry, raisePause := handleError(err, &job, m.timeoutOnError)
+	attempt := gophermart.OrderAttemptRequest{
+		Number:     job.number,
+		Owner:      m.owner,
+		RetryAfter: m.backoff(job.attempts + 1),
+	}
 
-		//does it need to set new limit?
-		if raisePause {
-			log.Debug("need to lock limit mutex")
-			if m.limitMx.TryLock() {
-				log.Debug("limit mutex was locked")
-				m.limit = time.Now().Add(retry)
-				m.limitMx.Unlock()
-				log.Debug("new workers limit", "date", m.limit.Format(time.RFC3339))
-			}
-			continue
-		} else if err != nil && retry == 0 {
-			//service is not available, job will  restart when reader get one on next time
+	var limitErr service.LimitError
+	switch {
+	case errors.As(err, &limitErr):
+		log.Error("accrual service is overload", "error", err)
+		m.raiseLimit(limitErr.RetryAfter)
+		attempt.RetryAfter = max(attempt.RetryAfter, limitErr.RetryAfter)
+	case errors.Is(err, service.ErrUnavailable):
+		//orders are not claimed for a while, otherwise they are only postponed
+		log.Error("accrual service is unavailable", "error", err)
+		m.raiseLimit(m.timeoutOnError)
+	case errors.Is(err, service.ErrEntityDoesNotExists):
+		//accrual does not have information about order, may be it will be later
+		//but it can mean that we loaded dummy order
+		attempt.NotFound = true
+		if job.notFound+1 < m.attemptsOnError {
+			log.Error("accrual service does not have information about order, may be it will be later", "error", err)
 			break
-		} else if retry > 0 {
-			now := time.Now()
-			log.Debug("order does not found on accrual service, need to wait",
-				"start", now.Format(time.RFC3339),
-				"finish", now.Add(retry).Format(time.RFC3339),
-			)
-			time.Sleep(retry)
-			continue
 		}
-
+		log.Debug("order does not found on accrual service, all attempts was used, mark order as invalid")
+		m.update(ctx, job, service.AccrualsInfo{
+			OrderNumber: job.number,
+			Status:      StatusInvalid,
+			Accrual:     0,
+		})
+	case err != nil:
+		log.Error("accrual service is not available, order will be checked later", "error", err)
+	case result.Status == StatusProcessing || result.Status == statusRegistered:
+		//order was set processing before request, the same status is not written again
+		log.Debug("order is not calculated yet", "status", result.Status)
+	default:
 		//handler normal situation
-		if err := m.updatingOrder.updateOrder(ctx, updateRepositoryJob{
-			userID:      job.userID,
-			orderNumber: job.number,
-			data:        result,
-		}); err != nil {
-			log.Error("failed to update order", "order", job.number, "error", err)
-		}
-		break
+		m.update(ctx, job, result)
 	}
 
-	if job.attempts == 0 {
-		log.Debug("order does not found on accrual service, all attempts was used, mark order as invalid")
-		err := m.updatingOrder.updateOrder(ctx, updateRepositoryJob{
-			userID:      job.userID,
-			orderNumber: job.number,
-			data: service.AccrualsInfo{
-				OrderNumber: job.number,
-				Status:      StatusInvalid,
-				Accrual:     0,
-			},
-		})
-		if err != nil {
-			log.Error("failed to update order", "order", job.number, "error", err)
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	if err := m.updatingOrder.addAttempt(ctx, attempt); errors.Is(err, gophermart.ErrEmptyResult) {
+		log.Warn("lease of order was lost, attempt is not counted")
+	} else if err != nil {
+		log.Error("failed to count attempt", "error", err)
+	}
+}
+
+/*
+keepLease extends lease of order by heartbeats until returned function is called.
+Returned context is canceled if lease is lost
+*/
+func (m *accrualManager) keepLease(ctx context.Context, number string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	if m.lease <= 0 {
+		return ctx, cancel
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(m.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := m.updatingOrder.extendLease(ctx, gophermart.OrderLeaseRequest{
+				Number: number,
+				Owner:  m.owner,
+				Lease:  m.lease,
+			})
+			if errors.Is(err, gophermart.ErrEmptyResult) {
+				logger.Warn("lease of order was lost, processing is canceled", "order", number)
+				cancel()
+				return
+			} else if err != nil && ctx.Err() == nil {
+				//lease is still valid until it expires, next heartbeat can be successful
+				logger.Error("failed to extend lease of order", "order", number, "error", err)
+			}
 		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		<-done
+	}
+}
+
+func (m *accrualManager) update(ctx context.Context, job checkAccrualJob, data service.AccrualsInfo) {
+	if err := m.updatingOrder.updateOrder(ctx, updateRepositoryJob{
+		userID:      job.userID,
+		orderNumber: job.number,
+		data:        data,
+	}); err != nil {
+		logger.Error("failed to update order", "order", job.number, "error", err)
 	}
+}
 
+// backoff returns delay of the next check after attempts checks of order
+func (m *accrualManager) backoff(attempts int) time.Duration {
+	delay := m.timeoutOnError
+	for i := 1; i < attempts && delay < m.maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, m.maxRetryDelay)
 }
 
-func handleError(err error, job *checkAccrualJob, defaultRetry time.Duration) (retry time.Duration, raisePause bool) {
-	log := logger.With(
-		"component", "accrual manager",
-		"operation", "handleError",
-		"order", job.number,
-		"user", job.userID,
-		"attempts", job.attempts,
-	)
+func (m *accrualManager) raiseLimit(retry time.Duration) {
+	m.limitMx.Lock()
+	defer m.limitMx.Unlock()
 
-	if err == nil {
-		return 0, false
+	if limit := time.Now().Add(retry); limit.After(m.limit) {
+		m.limit = limit
+		logger.Debug("new workers limit", "date", m.limit.Format(time.RFC3339))
 	}
+}
 
-	var limitErr service.LimitError
+func (m *accrualManager) limitedUntil() time.Time {
+	m.limitMx.Lock()
+	defer m.limitMx.Unlock()
+	return m.limit
+}
 
-	if errors.As(err, &limitErr) {
-		log.Error("accrual service is overload", "error", err)
-		retry, raisePause = limitErr.RetryAfter, true
-	} else if errors.Is(err, service.ErrEntityDoesNotExists) {
-		//accrual does not have information about order, may be it will be later
-		//but it can mean that we loaded dummy order
-		log.Error("accrual service does not have information about order, may be it will be later", "error", err)
-		job.attempts--
-		retry = defaultRetry
-	} else {
-		log.Error("accrual service is not available, task will restart later", "error", err)
+// waitLimit sleeps until limit of accrual service is over, returns false if context is done
+func (m *accrualManager) waitLimit(ctx context.Context) bool {
+	wait := time.Until(m.limitedUntil())
+	if wait <= 0 {
+		return true
+	}
+
+	logger.Debug("was limit error. need to wait", "duration", wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
-	return retry, raisePause
 }
 
 /*
-reader by ticker get information from order service about unprocessed orders
-and push they to channel of jobs
+reader by ticker claims orders which are due to be checked and push they to channel of jobs
 */
 func (m *accrualManager) runJobReader(ctx context.Context) {
 	defer m.wg.Done()
@@ -256,31 +387,107 @@ func (m *accrualManager) runJobReader(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			m.readJobs(ctx)
 		}
+
+		//orders are not claimed while accrual service limits requests, otherwise their leases expire in waiting.
+		//Claimed batch is as big as batch lookup or current concurrency, full batch means that there may be more due orders
+		for time.Now().After(m.limitedUntil()) {
+			if limit := m.claimLimit(); m.readJobs(ctx, limit) < limit {
+				break
+			}
+		}
+	}
+}
+
+func (m *accrualManager) claimLimit() int {
+	if m.batchAllowed() {
+		return m.batchSize
 	}
+	return m.concurrency.current()
 }
 
-func (m *accrualManager) readJobs(ctx context.Context) {
-	orders, err := m.ordersSvc.unprocessedOrders(ctx)
+// readJobs claims a batch of orders and returns its size
+func (m *accrualManager) readJobs(ctx context.Context, limit int) int {
+	orders, err := m.ordersSvc.claimOrders(ctx, m.owner, limit, m.lease)
 	if err != nil {
-		logger.Error("reading unprocessed order failed", "error", err)
-		return
+		if ctx.Err() == nil {
+			logger.Error("claiming unprocessed orders failed", "error", err)
+		}
+		return 0
+	}
+
+	//one request instead of request per order, orders are looked up by workers if batch is failed
+	var lookups map[string]*accrualLookup
+	if len(orders) > 1 && m.batchAllowed() {
+		lookups = m.lookupBatch(ctx, orders)
 	}
 
 	for _, order := range orders {
 		select {
 		case <-ctx.Done():
-			return
-		default:
-		}
-
-		m.jobs <- checkAccrualJob{
+			return 0
+		case m.jobs <- checkAccrualJob{
 			userID:   order.UserID,
 			number:   order.Number,
-			attempts: m.attemptsOnError,
+			attempts: order.Attempts,
+			notFound: order.NotFoundAttempts,
+			lookup:   lookups[order.Number],
+		}:
 		}
 	}
+	return len(orders)
+}
+
+/*
+lookupBatch gets information about orders by one request. Orders which are unknown for accrual service get
+ErrEntityDoesNotExists, all orders get error of request. Returns nil if orders must be looked up one by one
+*/
+func (m *accrualManager) lookupBatch(ctx context.Context, orders []gophermart.OrderInfo) map[string]*accrualLookup {
+	numbers := make([]string, 0, len(orders))
+	for _, order := range orders {
+		numbers = append(numbers, order.Number)
+	}
+
+	if !m.waitLimit(ctx) || !m.concurrency.acquire(ctx) {
+		return nil
+	}
+	result, err := m.accrualSvc.BatchAccruals(ctx, service.AccrualsBatchRequest{Numbers: numbers})
+	m.concurrency.release(err == nil || errors.Is(err, service.ErrNotSupported))
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	if errors.Is(err, service.ErrNotSupported) {
+		logger.Info("accrual service does not support batch lookup, orders are looked up one by one", "retry", batchProbeTimeout)
+		m.limitMx.Lock()
+		m.noBatchUntil = time.Now().Add(batchProbeTimeout)
+		m.limitMx.Unlock()
+		return nil
+	}
+
+	lookups := make(map[string]*accrualLookup, len(numbers))
+	for _, number := range numbers {
+		if err != nil {
+			lookups[number] = &accrualLookup{err: err}
+		} else {
+			lookups[number] = &accrualLookup{err: service.ErrEntityDoesNotExists}
+		}
+	}
+	for _, info := range result {
+		if _, ok := lookups[info.OrderNumber]; ok {
+			lookups[info.OrderNumber] = &accrualLookup{result: info}
+		}
+	}
+	return lookups
+}
+
+func (m *accrualManager) batchAllowed() bool {
+	if m.batchSize <= 1 {
+		return false
+	}
+	m.limitMx.Lock()
+	defer m.limitMx.Unlock()
+	return time.Now().After(m.noBatchUntil)
 }
 
 // waiting when all workers finished and close channels
@@ -0,0 +1,406 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
+)
+
+func Test_accrualManager_processJob(t *testing.T) {
+	const number = "31048580869"
+
+	processing := gophermart.OrderUpdateRequest{UserID: "user", Number: number, Status: gophermart.StatusProcessing}
+
+	tests := []struct {
+		name     string
+		attempts int
+		notFound int
+		setup    func(*MockOrderRepository, *MockAccrualService)
+		limit    bool
+		//concurrency is halved by failure of accrual service
+		concurrency int
+	}{
+		{
+			name:     "processed order",
+			attempts: 0,
+			setup: func(rep *MockOrderRepository, acc *MockAccrualService) {
+				acc.EXPECT().Accruals(gomock.Any(), service.AccrualsFilterRequest{Number: number}).
+					Return(service.AccrualsInfo{OrderNumber: number, Status: StatusProcessed, Accrual: money.FromInt(100)}, nil)
+				gomock.InOrder(
+					rep.EXPECT().Update(gomock.Any(), processing).Return(nil),
+					rep.EXPECT().UpdateWithIncome(gomock.Any(), gophermart.OrderUpdateRequest{
+						UserID:  "user",
+						Number:  number,
+						Status:  gophermart.StatusProcessed,
+						Accrual: money.FromInt(100),
+					}).Return(nil),
+					rep.EXPECT().AddAttempt(gomock.Any(), gophermart.OrderAttemptRequest{
+						Number:     number,
+						RetryAfter: 10 * time.Second,
+					}).Return(nil),
+				)
+			},
+		},
+		{
+			//order stays in processing, so status and its events are not changed by every check
+			name:     "registered order",
+			attempts: 0,
+			setup: func(rep *MockOrderRepository, acc *MockAccrualService) {
+				acc.EXPECT().Accruals(gomock.Any(), service.AccrualsFilterRequest{Number: number}).
+					Return(service.AccrualsInfo{OrderNumber: number, Status: statusRegistered}, nil)
+				gomock.InOrder(
+					rep.EXPECT().Update(gomock.Any(), processing).Return(nil),
+					rep.EXPECT().AddAttempt(gomock.Any(), gophermart.OrderAttemptRequest{
+						Number:     number,
+						RetryAfter: 10 * time.Second,
+					}).Return(nil),
+				)
+			},
+		},
+		{
+			name:     "next check is postponed by backoff",
+			attempts: 2,
+			setup: func(rep *MockOrderRepository, acc *MockAccrualService) {
+				acc.EXPECT().Accruals(gomock.Any(), gomock.Any()).Return(service.AccrualsInfo{}, service.ErrUnexpected)
+				rep.EXPECT().Update(gomock.Any(), processing).Return(nil)
+				rep.EXPECT().AddAttempt(gomock.Any(), gophermart.OrderAttemptRequest{
+					Number:     number,
+					Error:      service.ErrUnexpected.Error(),
+					RetryAfter: 40 * time.Second,
+				}).Return(nil)
+			},
+			concurrency: 2,
+		},
+		{
+			name:     "order is not found yet",
+			attempts: 1,
+			notFound: 1,
+			setup: func(rep *MockOrderRepository, acc *MockAccrualService) {
+				acc.EXPECT().Accruals(gomock.Any(), gomock.Any()).Return(service.AccrualsInfo{}, service.ErrEntityDoesNotExists)
+				rep.EXPECT().Update(gomock.Any(), processing).Return(nil)
+				rep.EXPECT().AddAttempt(gomock.Any(), gophermart.OrderAttemptRequest{
+					Number:     number,
+					Error:      service.ErrEntityDoesNotExists.Error(),
+					RetryAfter: 20 * time.Second,
+					NotFound:   true,
+				}).Return(nil)
+			},
+		},
+		{
+			//previous checks failed by accrual service, they are not answers that order is unknown
+			name:     "order is not found after failures of accrual service",
+			attempts: 5,
+			notFound: 0,
+			setup: func(rep *MockOrderRepository, acc *MockAccrualService) {
+				acc.EXPECT().Accruals(gomock.Any(), gomock.Any()).Return(service.AccrualsInfo{}, service.ErrEntityDoesNotExists)
+				rep.EXPECT().Update(gomock.Any(), processing).Return(nil)
+				rep.EXPECT().AddAttempt(gomock.Any(), gophermart.OrderAttemptRequest{
+					Number:     number,
+					Error:      service.ErrEntityDoesNotExists.Error(),
+					RetryAfter: 320 * time.Second,
+					NotFound:   true,
+				}).Return(nil)
+			},
+		},
+		{
+			name:     "order is not found after all attempts",
+			attempts: 2,
+			notFound: 2,
+			setup: func(rep *MockOrderRepository, acc *MockAccrualService) {
+				acc.EXPECT().Accruals(gomock.Any(), gomock.Any()).Return(service.AccrualsInfo{}, service.ErrEntityDoesNotExists)
+				rep.EXPECT().Update(gomock.Any(), processing).Return(nil)
+				rep.EXPECT().Update(gomock.Any(), gophermart.OrderUpdateRequest{
+					UserID: "user",
+					Number: number,
+					Status: gophermart.StatusInvalid,
+				}).Return(nil)
+				rep.EXPECT().AddAttempt(gomock.Any(), gomock.Any()).Return(nil)
+			},
+		},
+		{
+			name:     "limit of accrual service",
+			attempts: 0,
+			setup: func(rep *MockOrderRepository, acc *MockAccrualService) {
+				acc.EXPECT().Accruals(gomock.Any(), gomock.Any()).
+					Return(service.AccrualsInfo{}, service.LimitError{RetryAfter: time.Minute})
+				rep.EXPECT().Update(gomock.Any(), processing).Return(nil)
+				rep.EXPECT().AddAttempt(gomock.Any(), gophermart.OrderAttemptRequest{
+					Number:     number,
+					Error:      service.LimitError{RetryAfter: time.Minute}.Error(),
+					RetryAfter: time.Minute,
+				}).Return(nil)
+			},
+			limit:       true,
+			concurrency: 2,
+		},
+		{
+			name:     "accrual service is unavailable",
+			attempts: 0,
+			setup: func(rep *MockOrderRepository, acc *MockAccrualService) {
+				acc.EXPECT().Accruals(gomock.Any(), gomock.Any()).Return(service.AccrualsInfo{}, service.ErrUnavailable)
+				rep.EXPECT().Update(gomock.Any(), processing).Return(nil)
+				rep.EXPECT().AddAttempt(gomock.Any(), gophermart.OrderAttemptRequest{
+					Number:     number,
+					Error:      service.ErrUnavailable.Error(),
+					RetryAfter: 10 * time.Second,
+				}).Return(nil)
+			},
+			limit:       true,
+			concurrency: 2,
+		},
+		{
+			name:     "order is not checked if it can not be updated",
+			attempts: 0,
+			setup: func(rep *MockOrderRepository, acc *MockAccrualService) {
+				rep.EXPECT().Update(gomock.Any(), processing).Return(errors.New("repository error"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			rep := NewMockOrderRepository(ctrl)
+			acc := NewMockAccrualService(ctrl)
+			tt.setup(rep, acc)
+
+			m := newAccrualManager(accrualManagerConfig{
+				accrualSvc:      acc,
+				updatingOrder:   updatingOrder{orderRepository: rep},
+				timeoutOnError:  10 * time.Second,
+				maxRetryDelay:   time.Hour,
+				attemptsOnError: 3,
+				workers:         4,
+			})
+			m.processJob(context.Background(), checkAccrualJob{userID: "user", number: number, attempts: tt.attempts, notFound: tt.notFound})
+
+			assert.Equal(t, tt.limit, time.Until(m.limitedUntil()) > 0)
+			if tt.concurrency == 0 {
+				tt.concurrency = 4
+			}
+			assert.Equal(t, tt.concurrency, m.concurrency.current())
+		})
+	}
+}
+
+func Test_accrualManager_processJobCanceled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	//attempt is not saved, order is checked again when its lease expires
+	rep := NewMockOrderRepository(ctrl)
+	rep.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+	acc := NewMockAccrualService(ctrl)
+	acc.EXPECT().Accruals(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ service.AccrualsFilterRequest) (service.AccrualsInfo, error) {
+			cancel()
+			return service.AccrualsInfo{}, ctx.Err()
+		})
+
+	m := newAccrualManager(accrualManagerConfig{
+		accrualSvc:    acc,
+		updatingOrder: updatingOrder{orderRepository: rep},
+	})
+	m.processJob(ctx, checkAccrualJob{userID: "user", number: "31048580869"})
+}
+
+func Test_accrualManager_processJobNotFoundAfterFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const number = "31048580869"
+
+	//counters of order are kept by repository as AddAttempt does
+	var attempts, notFound int
+	rep := NewMockOrderRepository(ctrl)
+	rep.EXPECT().Update(gomock.Any(), gophermart.OrderUpdateRequest{UserID: "user", Number: number, Status: gophermart.StatusProcessing}).
+		Return(nil).Times(4)
+	rep.EXPECT().AddAttempt(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, dto gophermart.OrderAttemptRequest) error {
+			attempts++
+			if dto.NotFound {
+				notFound++
+			}
+			return nil
+		}).Times(4)
+
+	m := newAccrualManager(accrualManagerConfig{
+		accrualSvc:      NewMockAccrualService(ctrl),
+		updatingOrder:   updatingOrder{orderRepository: rep},
+		timeoutOnError:  10 * time.Second,
+		maxRetryDelay:   time.Hour,
+		attemptsOnError: 3,
+		workers:         4,
+	})
+
+	//order is not marked as invalid, accrual service answered that it is unknown once
+	for _, err := range []error{
+		service.LimitError{RetryAfter: time.Minute},
+		service.ErrUnavailable,
+		service.ErrUnavailable,
+		service.ErrEntityDoesNotExists,
+	} {
+		m.processJob(context.Background(), checkAccrualJob{
+			userID:   "user",
+			number:   number,
+			attempts: attempts,
+			notFound: notFound,
+			lookup:   &accrualLookup{err: err},
+		})
+	}
+	assert.Equal(t, 4, attempts)
+	assert.Equal(t, 1, notFound)
+}
+
+func Test_accrualManager_backoff(t *testing.T) {
+	m := newAccrualManager(accrualManagerConfig{timeoutOnError: 10 * time.Second, maxRetryDelay: time.Minute})
+
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		assert.Equal(t, w, m.backoff(i+1), "attempts %d", i+1)
+	}
+	assert.Equal(t, time.Minute, m.backoff(1000))
+}
+
+func Test_accrualManager_readJobs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rep := NewMockOrderRepository(ctrl)
+	rep.EXPECT().ClaimOrders(gomock.Any(), gophermart.OrderClaimRequest{Owner: "instance", Limit: 2, Lease: time.Minute}).
+		Return([]gophermart.OrderInfo{{UserID: "user", Number: "31048580869", Attempts: 3, NotFoundAttempts: 1}}, nil)
+
+	m := newAccrualManager(accrualManagerConfig{
+		ordersSvc: OrderService{rep: rep},
+		lease:     time.Minute,
+		owner:     "instance",
+	})
+
+	done := make(chan int)
+	go func() { done <- m.readJobs(context.Background(), 2) }()
+
+	assert.Equal(t, checkAccrualJob{userID: "user", number: "31048580869", attempts: 3, notFound: 1}, <-m.jobs)
+	assert.Equal(t, 1, <-done)
+}
+
+func Test_accrualManager_lostLease(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rep := NewMockOrderRepository(ctrl)
+	rep.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+	rep.EXPECT().ExtendLease(gomock.Any(), gophermart.OrderLeaseRequest{
+		Number: "31048580869",
+		Owner:  "instance",
+		Lease:  30 * time.Millisecond,
+	}).Return(gophermart.ErrEmptyResult)
+
+	//request is canceled when another instance takes order, attempt is not saved
+	acc := NewMockAccrualService(ctrl)
+	acc.EXPECT().Accruals(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ service.AccrualsFilterRequest) (service.AccrualsInfo, error) {
+			<-ctx.Done()
+			return service.AccrualsInfo{}, ctx.Err()
+		})
+
+	m := newAccrualManager(accrualManagerConfig{
+		accrualSvc:    acc,
+		updatingOrder: updatingOrder{orderRepository: rep},
+		lease:         30 * time.Millisecond,
+		owner:         "instance",
+	})
+	m.processJob(context.Background(), checkAccrualJob{userID: "user", number: "31048580869"})
+}
+
+func Test_accrualManager_readJobsBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	orders := []gophermart.OrderInfo{
+		{UserID: "user", Number: "31048580869"},
+		{UserID: "user", Number: "4561261212345467", Attempts: 1},
+	}
+	numbers := []string{"31048580869", "4561261212345467"}
+
+	rep := NewMockOrderRepository(ctrl)
+	rep.EXPECT().ClaimOrders(gomock.Any(), gomock.Any()).Return(orders, nil).Times(2)
+	acc := NewMockAccrualService(ctrl)
+	gomock.InOrder(
+		acc.EXPECT().BatchAccruals(gomock.Any(), service.AccrualsBatchRequest{Numbers: numbers}).
+			Return([]service.AccrualsInfo{{OrderNumber: "31048580869", Status: StatusProcessed, Accrual: money.FromInt(10)}}, nil),
+		acc.EXPECT().BatchAccruals(gomock.Any(), gomock.Any()).Return(nil, service.ErrNotSupported),
+	)
+
+	m := newAccrualManager(accrualManagerConfig{
+		accrualSvc: acc,
+		ordersSvc:  OrderService{rep: rep},
+		workers:    4,
+		batchSize:  10,
+	})
+	assert.Equal(t, 10, m.claimLimit())
+
+	//unknown order is omitted in answer
+	go m.readJobs(context.Background(), m.claimLimit())
+	assert.Equal(t, checkAccrualJob{
+		userID: "user",
+		number: "31048580869",
+		lookup: &accrualLookup{result: service.AccrualsInfo{OrderNumber: "31048580869", Status: StatusProcessed, Accrual: money.FromInt(10)}},
+	}, <-m.jobs)
+	assert.Equal(t, checkAccrualJob{
+		userID:   "user",
+		number:   "4561261212345467",
+		attempts: 1,
+		lookup:   &accrualLookup{err: service.ErrEntityDoesNotExists},
+	}, <-m.jobs)
+
+	//older accrual service, orders are looked up by workers
+	go m.readJobs(context.Background(), m.claimLimit())
+	assert.Nil(t, (<-m.jobs).lookup)
+	assert.Nil(t, (<-m.jobs).lookup)
+	assert.Equal(t, 4, m.claimLimit())
+	assert.Equal(t, 4, m.concurrency.current())
+}
+
+func Test_accrualManager_processJobLookedUp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const number = "31048580869"
+
+	//order is not requested again
+	rep := NewMockOrderRepository(ctrl)
+	gomock.InOrder(
+		rep.EXPECT().Update(gomock.Any(), gophermart.OrderUpdateRequest{UserID: "user", Number: number, Status: gophermart.StatusProcessing}).Return(nil),
+		rep.EXPECT().UpdateWithIncome(gomock.Any(), gophermart.OrderUpdateRequest{
+			UserID:  "user",
+			Number:  number,
+			Status:  gophermart.StatusProcessed,
+			Accrual: money.FromInt(10),
+		}).Return(nil),
+		rep.EXPECT().AddAttempt(gomock.Any(), gomock.Any()).Return(nil),
+	)
+
+	m := newAccrualManager(accrualManagerConfig{
+		accrualSvc:      NewMockAccrualService(ctrl),
+		updatingOrder:   updatingOrder{orderRepository: rep},
+		timeoutOnError:  10 * time.Second,
+		maxRetryDelay:   time.Hour,
+		attemptsOnError: 3,
+	})
+	m.processJob(context.Background(), checkAccrualJob{
+		userID: "user",
+		number: number,
+		lookup: &accrualLookup{result: service.AccrualsInfo{OrderNumber: number, Status: StatusProcessed, Accrual: money.FromInt(10)}},
+	})
+}
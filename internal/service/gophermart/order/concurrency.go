@@ -0,0 +1,93 @@
+package order
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+concurrencyLimit bounds quantity of simultaneous requests to accrual service.
+Limit is halved on failure and grows by one after limit successful requests in a row (AIMD),
+so workers back off when accrual service is overloaded or down and recover when it works again
+*/
+type concurrencyLimit struct {
+	mx        *sync.Mutex
+	limit     int
+	min       int
+	max       int
+	inFlight  int
+	successes int
+	//is closed and replaced when slot can be free
+	changed chan struct{}
+	//is called under lock when limit is changed
+	onChange func(from, to int)
+}
+
+func newConcurrencyLimit(lower, upper int, onChange func(from, to int)) *concurrencyLimit {
+	upper = max(upper, 1)
+	return &concurrencyLimit{
+		mx:       &sync.Mutex{},
+		limit:    upper,
+		min:      max(min(lower, upper), 1),
+		max:      upper,
+		changed:  make(chan struct{}),
+		onChange: onChange,
+	}
+}
+
+// acquire waits for free slot, returns false if context is done
+func (c *concurrencyLimit) acquire(ctx context.Context) bool {
+	for {
+		c.mx.Lock()
+		if c.inFlight < c.limit {
+			c.inFlight++
+			c.mx.Unlock()
+			return true
+		}
+		changed := c.changed
+		c.mx.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// release frees slot and adapts limit by result of request
+func (c *concurrencyLimit) release(success bool) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.inFlight--
+
+	limit := c.limit
+	if success {
+		c.successes++
+		if c.successes >= c.limit && c.limit < c.max {
+			limit++
+		}
+	} else {
+		limit = max(c.limit/2, c.min)
+	}
+
+	if limit != c.limit {
+		if c.onChange != nil {
+			c.onChange(c.limit, limit)
+		}
+		c.limit, c.successes = limit, 0
+	}
+	if !success {
+		c.successes = 0
+	}
+
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *concurrencyLimit) current() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.limit
+}
@@ -0,0 +1,51 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_concurrencyLimit(t *testing.T) {
+	changes := make([][2]int, 0)
+	c := newConcurrencyLimit(1, 4, func(from, to int) {
+		changes = append(changes, [2]int{from, to})
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, c.acquire(ctx))
+	}
+
+	//there is no free slot
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, c.acquire(timeout))
+
+	//failures halve limit down to minimum
+	c.release(false)
+	assert.Equal(t, 2, c.current())
+	c.release(false)
+	c.release(false)
+	assert.Equal(t, 1, c.current())
+
+	//one request is in flight yet, waiting request gets slot when it is released
+	acquired := make(chan bool)
+	go func() { acquired <- c.acquire(ctx) }()
+	c.release(true)
+	assert.True(t, <-acquired)
+
+	//limit grows by one after limit successes in a row
+	c.release(true)
+	assert.Equal(t, 2, c.current())
+	for i := 0; i < 2; i++ {
+		assert.True(t, c.acquire(ctx))
+	}
+	c.release(true)
+	c.release(true)
+	assert.Equal(t, 3, c.current())
+
+	assert.Equal(t, [][2]int{{4, 2}, {2, 1}, {1, 2}, {2, 3}}, changes)
+}
@@ -0,0 +1,49 @@
+package order
+
+import "sync"
+
+// eventBroker wakes up subscribers when orders of their user are changed.
+// Events are read from repository, so signal may be lost or repeated
+type eventBroker struct {
+	mx          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: make(map[string]map[chan struct{}]struct{})}
+}
+
+func (b *eventBroker) subscribe(userID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan struct{}]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+
+	return ch, func() {
+		b.mx.Lock()
+		defer b.mx.Unlock()
+
+		delete(b.subscribers[userID], ch)
+		if len(b.subscribers[userID]) == 0 {
+			delete(b.subscribers, userID)
+		}
+	}
+}
+
+func (b *eventBroker) notify(userID string) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	for ch := range b.subscribers[userID] {
+		//subscriber which did not read previous signal will read all new events anyway
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
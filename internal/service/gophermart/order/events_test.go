@@ -0,0 +1,31 @@
+package order
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_eventBroker(t *testing.T) {
+	b := newEventBroker()
+
+	first, cancelFirst := b.subscribe("user")
+	second, cancelSecond := b.subscribe("user")
+	another, cancelAnother := b.subscribe("another")
+	defer cancelAnother()
+
+	//signals are not accumulated, subscriber reads all new events at once
+	b.notify("user")
+	b.notify("user")
+	assert.Len(t, first, 1)
+	assert.Len(t, second, 1)
+	assert.Empty(t, another)
+
+	<-first
+	cancelFirst()
+	b.notify("user")
+	assert.Empty(t, first)
+
+	cancelSecond()
+	assert.NotContains(t, b.subscribers, "user")
+}
@@ -2,12 +2,15 @@ package order
 
 import (
 	"context"
-	"sort"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
 	"time"
 
 	"github.com/vilasle/gophermart/internal/logger"
 	"github.com/vilasle/gophermart/internal/repository/gophermart"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/cursor"
 	"github.com/vilasle/gophermart/internal/tool/order/validation"
 )
 
@@ -18,29 +21,54 @@ const (
 	StatusProcessed  = "PROCESSED"
 )
 
+// statusRegistered is status of accrual service, order is registered there but is not calculated yet
+const statusRegistered = "REGISTERED"
+
+// eventsLimit is the largest quantity of events which are returned by one call of Events
+const eventsLimit = 100
+
 type OrderService struct {
 	rep                    gophermart.OrderRepository
-	repTx                  gophermart.WithdrawalRepository
+	events                 *eventBroker
 	accrual                service.AccrualService
 	retryOnError           time.Duration
+	maxRetryDelay          time.Duration
 	attemptsGettingAccrual int
+	instanceID             string
+	firstCheckDelay        time.Duration
 }
 
 type OrderServiceConfig struct {
 	gophermart.OrderRepository
 	service.AccrualService
-	gophermart.WithdrawalRepository
-	RetryOnError           time.Duration
+	//delay of the next check of order in accrual service, it is doubled after each check up to MaxRetryDelay
+	RetryOnError  time.Duration
+	MaxRetryDelay time.Duration
+	//order is set invalid if accrual service does not know it after this quantity of checks
 	AttemptsGettingAccrual int
+	//id of replica in leases of orders, it is generated if it is empty
+	InstanceID string
+	//delay of the first check of new order, accrual service pushes results when callbacks are configured
+	//and checks only reconcile missed callbacks
+	FirstCheckDelay time.Duration
 }
 
 func NewOrderService(config OrderServiceConfig) OrderService {
 	s := OrderService{
 		rep:                    config.OrderRepository,
-		repTx:                  config.WithdrawalRepository,
+		events:                 newEventBroker(),
 		accrual:                config.AccrualService,
 		retryOnError:           config.RetryOnError,
+		maxRetryDelay:          config.MaxRetryDelay,
 		attemptsGettingAccrual: config.AttemptsGettingAccrual,
+		instanceID:             config.InstanceID,
+		firstCheckDelay:        config.FirstCheckDelay,
+	}
+	if s.maxRetryDelay < s.retryOnError {
+		s.maxRetryDelay = max(s.retryOnError, time.Hour)
+	}
+	if s.instanceID == "" {
+		s.instanceID = newInstanceID()
 	}
 
 	return s
@@ -55,17 +83,24 @@ func (s OrderService) Start(ctx context.Context) {
 		accrualSvc: s.accrual,
 		ordersSvc:  s,
 		updatingOrder: updatingOrder{
-			orderRepository:       s.rep,
-			transactionRepository: s.repTx,
+			orderRepository: s.rep,
+			events:          s.events,
 		},
 		timeoutOnError:  s.retryOnError,
+		maxRetryDelay:   s.maxRetryDelay,
 		attemptsOnError: s.attemptsGettingAccrual,
-		readJobsTimeout: time.Second * 5,
+		readJobsTimeout: time.Second,
+		//covers waiting of claimed orders for free worker, lease of order in processing is extended by heartbeats
+		lease:   time.Minute,
+		owner:   s.instanceID,
+		workers: 5,
+		//many due orders are looked up by one request, it is important as accrual service limits requests
+		batchSize: service.MaxCalculationsBatch,
 	}
 
 	manager := newAccrualManager(managerConfig)
 
-	go manager.start(ctx, 5)
+	go manager.start(ctx)
 }
 
 func (s OrderService) Register(ctx context.Context, dto service.RegisterOrderRequest) error {
@@ -82,8 +117,9 @@ func (s OrderService) Register(ctx context.Context, dto service.RegisterOrderReq
 	}
 
 	rdt := gophermart.OrderCreateRequest{
-		Number: dto.Number,
-		UserID: dto.UserID,
+		Number:     dto.Number,
+		UserID:     dto.UserID,
+		CheckAfter: s.firstCheckDelay,
 	}
 
 	if err := s.rep.Create(ctx, rdt); err != nil {
@@ -107,22 +143,54 @@ func (s OrderService) checkDuplicate(ctx context.Context, dto service.RegisterOr
 	return nil
 }
 
-func (s OrderService) List(ctx context.Context, dto service.ListOrderRequest) ([]service.OrderInfo, error) {
+func (s OrderService) List(ctx context.Context, dto service.ListOrderRequest) (service.OrderList, error) {
 	if dto.UserID == "" {
-		return nil, service.ErrInvalidFormat
+		return service.OrderList{}, service.ErrInvalidFormat
+	}
+
+	limit, after, err := dto.Page.Bounds()
+	if err != nil {
+		return service.OrderList{}, err
+	}
+
+	if !dto.From.IsZero() && !dto.To.IsZero() && !dto.From.Before(dto.To) {
+		return service.OrderList{}, service.ErrInvalidFormat
 	}
 
+	status := make([]int, 0, len(dto.Status))
+	for _, v := range dto.Status {
+		st, ok := statusOfView(v)
+		if !ok {
+			return service.OrderList{}, service.ErrInvalidFormat
+		}
+		status = append(status, st)
+	}
+
+	//one more order shows that there is next page
 	rld := gophermart.OrderListRequest{
-		UserID: dto.UserID,
+		UserID:     dto.UserID,
+		Status:     status,
+		From:       dto.From,
+		To:         dto.To,
+		Limit:      limit + 1,
+		After:      after,
+		Descending: dto.Page.Descending,
 	}
 	result, err := s.rep.List(ctx, rld)
 	if err != nil {
-		return nil, err
+		return service.OrderList{}, err
 	}
 
-	orders := make([]service.OrderInfo, len(result))
+	list := service.OrderList{}
+	if len(result) > limit {
+		result = result[:limit]
+		last := result[limit-1]
+		list.Next = cursor.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
+	}
+
+	list.Orders = make([]service.OrderInfo, len(result))
 	for i, order := range result {
-		orders[i] = service.OrderInfo{
+		list.Orders[i] = service.OrderInfo{
 			Number:    order.Number,
 			Status:    viewOfStatus(order.Status),
 			Accrual:   order.Accrual,
@@ -130,11 +198,116 @@ func (s OrderService) List(ctx context.Context, dto service.ListOrderRequest) ([
 		}
 	}
 
-	sort.Slice(orders, func(i, j int) bool {
-		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	return list, nil
+}
+
+func (s OrderService) Order(ctx context.Context, dto service.OrderRequest) (service.OrderDetails, error) {
+	if dto.UserID == "" || dto.Number == "" {
+		return service.OrderDetails{}, service.ErrInvalidFormat
+	}
+
+	if !validation.IsValidNumber(dto.Number) {
+		return service.OrderDetails{}, service.ErrWrongNumberOfOrder
+	}
+
+	result, err := s.rep.List(ctx, gophermart.OrderListRequest{OrderNumber: dto.Number})
+	if err != nil {
+		return service.OrderDetails{}, err
+	}
+
+	if len(result) == 0 {
+		return service.OrderDetails{}, service.ErrOrderNotFound
+	}
+
+	order := result[0]
+	if order.UserID != dto.UserID {
+		return service.OrderDetails{}, service.ErrOrderOfAnotherUser
+	}
+
+	return service.OrderDetails{
+		Number:    order.Number,
+		Status:    viewOfStatus(order.Status),
+		Accrual:   order.Accrual,
+		CreatedAt: order.CreatedAt,
+		UpdatedAt: order.UpdatedAt,
+		Attempts:  order.Attempts,
+		CheckedAt: order.CheckedAt,
+	}, nil
+}
+
+func (s OrderService) Events(ctx context.Context, dto service.OrderEventsRequest) ([]service.OrderEvent, error) {
+	if dto.UserID == "" || dto.AfterID < 0 {
+		return nil, service.ErrInvalidFormat
+	}
+
+	result, err := s.rep.OrderEvents(ctx, gophermart.OrderEventRequest{
+		UserID:  dto.UserID,
+		AfterID: dto.AfterID,
+		Limit:   eventsLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]service.OrderEvent, len(result))
+	for i, event := range result {
+		events[i] = service.OrderEvent{
+			ID:        event.ID,
+			Number:    event.Number,
+			Status:    viewOfStatus(event.Status),
+			Accrual:   event.Accrual,
+			CreatedAt: event.CreatedAt,
+		}
+	}
+	return events, nil
+}
+
+func (s OrderService) Subscribe(userID string) (<-chan struct{}, func()) {
+	return s.events.subscribe(userID)
+}
+
+func (s OrderService) ApplyAccrual(ctx context.Context, dto service.AccrualsInfo) error {
+	if dto.OrderNumber == "" || dto.Accrual < 0 {
+		return service.ErrInvalidFormat
+	}
+	switch dto.Status {
+	case StatusProcessing, StatusProcessed, StatusInvalid:
+	case statusRegistered:
+		//order is not calculated yet, there is nothing to change
+		return nil
+	default:
+		return service.ErrInvalidFormat
+	}
+
+	orders, err := s.rep.List(ctx, gophermart.OrderListRequest{OrderNumber: dto.OrderNumber})
+	if err != nil {
+		return err
+	}
+	if len(orders) == 0 {
+		return service.ErrOrderNotFound
+	}
+
+	//order which is checked by accrual manager at the same time is credited at most once
+	return updatingOrder{orderRepository: s.rep, events: s.events}.updateOrder(ctx, updateRepositoryJob{
+		userID:      orders[0].UserID,
+		orderNumber: dto.OrderNumber,
+		data:        dto,
 	})
+}
 
-	return orders, nil
+func statusOfView(status string) (int, bool) {
+	switch status {
+	case StatusNew:
+		return gophermart.StatusNew, true
+	case StatusProcessing:
+		return gophermart.StatusProcessing, true
+	case StatusInvalid:
+		return gophermart.StatusInvalid, true
+	case StatusProcessed:
+		return gophermart.StatusProcessed, true
+	default:
+		return 0, false
+	}
 }
 
 func viewOfStatus(status int) string {
@@ -152,24 +325,16 @@ func viewOfStatus(status int) string {
 	}
 }
 
-func (s OrderService) unprocessedOrders(ctx context.Context) ([]service.OrderInfo, error) {
-	result, err := s.rep.List(ctx, gophermart.OrderListRequest{
-		Status: []int{gophermart.StatusNew, gophermart.StatusProcessing},
-		Limit:  50,
-	})
-	if err != nil {
-		return nil, err
-	}
+// claimOrders returns orders which are due to be checked in accrual service, they are not claimed again during lease
+func (s OrderService) claimOrders(ctx context.Context, owner string, limit int, lease time.Duration) ([]gophermart.OrderInfo, error) {
+	return s.rep.ClaimOrders(ctx, gophermart.OrderClaimRequest{Owner: owner, Limit: limit, Lease: lease})
+}
 
-	orders := make([]service.OrderInfo, len(result))
-	for i, order := range result {
-		orders[i] = service.OrderInfo{
-			UserID:    order.UserID,
-			Number:    order.Number,
-			Status:    viewOfStatus(order.Status),
-			Accrual:   order.Accrual,
-			CreatedAt: order.CreatedAt,
-		}
+// newInstanceID returns random id of replica, hostname is not used because replicas can share it
+func newInstanceID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
 	}
-	return orders, nil
+	return hex.EncodeToString(b)
 }
@@ -10,6 +10,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/vilasle/gophermart/internal/repository/gophermart"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/cursor"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 // TODO change test, and do not test all functions on one test
@@ -41,11 +43,6 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 		dtoAccrualOut service.AccrualsInfo
 		errAccrualOut error
 		setupAccrual  func(m *MockAccrualService, ctx context.Context, dtoIn service.AccrualsFilterRequest, dtoOut service.AccrualsInfo, err error)
-
-		//withdrawal Income()
-		dtoIncomeIn  gophermart.WithdrawalRequest
-		errIncomeOut error
-		setupIncome  func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.WithdrawalRequest, err error)
 	}
 
 	type want struct {
@@ -78,8 +75,6 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 				setupUpdate: func(m *MockOrderRepository, ctx context.Context, dtoIn gophermart.OrderUpdateRequest, err error) {},
 				setupAccrual: func(m *MockAccrualService, ctx context.Context, dtoIn service.AccrualsFilterRequest, dtoOut service.AccrualsInfo, err error) {
 				},
-				setupIncome: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.WithdrawalRequest, err error) {
-				},
 			},
 			want: want{
 				dto: []service.OrderInfo{},
@@ -110,8 +105,6 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 				setupUpdate: func(m *MockOrderRepository, ctx context.Context, dtoIn gophermart.OrderUpdateRequest, err error) {},
 				setupAccrual: func(m *MockAccrualService, ctx context.Context, dtoIn service.AccrualsFilterRequest, dtoOut service.AccrualsInfo, err error) {
 				},
-				setupIncome: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.WithdrawalRequest, err error) {
-				},
 			},
 			want: want{
 				dto: []service.OrderInfo{},
@@ -153,8 +146,6 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 				setupUpdate: func(m *MockOrderRepository, ctx context.Context, dtoIn gophermart.OrderUpdateRequest, err error) {},
 				setupAccrual: func(m *MockAccrualService, ctx context.Context, dtoIn service.AccrualsFilterRequest, dtoOut service.AccrualsInfo, err error) {
 				},
-				setupIncome: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.WithdrawalRequest, err error) {
-				},
 			},
 			want: want{
 				dto: []service.OrderInfo{},
@@ -201,8 +192,6 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 				setupUpdate: func(m *MockOrderRepository, ctx context.Context, dtoIn gophermart.OrderUpdateRequest, err error) {},
 				setupAccrual: func(m *MockAccrualService, ctx context.Context, dtoIn service.AccrualsFilterRequest, dtoOut service.AccrualsInfo, err error) {
 				},
-				setupIncome: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.WithdrawalRequest, err error) {
-				},
 			},
 			want: want{
 				dto: []service.OrderInfo{},
@@ -250,7 +239,7 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 				dtoAccrualOut: service.AccrualsInfo{
 					OrderNumber: "31048580869",
 					Status:      "PROCESSED",
-					Accrual:     100,
+					Accrual:     money.FromInt(100),
 				},
 				errAccrualOut: nil,
 				setupAccrual: func(m *MockAccrualService, ctx context.Context, dtoIn service.AccrualsFilterRequest, dtoOut service.AccrualsInfo, err error) {
@@ -260,19 +249,11 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 					Number:  "31048580869",
 					Status:  gophermart.StatusProcessed,
 					UserID:  "31048580869",
-					Accrual: 100,
+					Accrual: money.FromInt(100),
 				},
 				errUpdateOut: nil,
 				setupUpdate: func(m *MockOrderRepository, ctx context.Context, dtoIn gophermart.OrderUpdateRequest, err error) {
-					m.EXPECT().Update(gomock.Any(), dtoIn).Return(err)
-				},
-				dtoIncomeIn: gophermart.WithdrawalRequest{
-					UserID:      "31048580869",
-					OrderNumber: "31048580869",
-					Sum:         100,
-				},
-				setupIncome: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.WithdrawalRequest, err error) {
-					m.EXPECT().Income(gomock.Any(), dtoIn).Return(err)
+					m.EXPECT().UpdateWithIncome(gomock.Any(), dtoIn).Return(err)
 				},
 			},
 			want: want{
@@ -321,7 +302,7 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 		// 		dtoAccrualOut: service.AccrualsInfo{
 		// 			OrderNumber: "31048580869",
 		// 			Status:      "PROCESSED",
-		// 			Accrual:     100,
+		// 			Accrual:     money.FromInt(100),
 		// 		},
 		// 		errAccrualOut: nil,
 		// 		setupAccrual: func(m *MockAccrualService, ctx context.Context, dtoIn service.AccrualsFilterRequest, dtoOut service.AccrualsInfo, err error) {
@@ -331,7 +312,7 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 		// 			Number:  "31048580869",
 		// 			Status:  gophermart.StatusProcessed,
 		// 			UserID:  "31048580869",
-		// 			Accrual: 100,
+		// 			Accrual: money.FromInt(100),
 		// 		},
 		// 		errUpdateOut: nil,
 		// 		setupUpdate: func(m *MockOrderRepository, ctx context.Context, dtoIn gophermart.OrderUpdateRequest, err error) {
@@ -340,7 +321,7 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 		// 		dtoIncomeIn: gophermart.WithdrawalRequest{
 		// 			UserID:      "31048580869",
 		// 			OrderNumber: "31048580869",
-		// 			Sum:         100,
+		// 			Sum:         money.FromInt(100),
 		// 		},
 		// 		setupIncome: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.WithdrawalRequest, err error) {
 		// 			m.EXPECT().Income(gomock.Any(), dtoIn).Return(err)
@@ -361,18 +342,15 @@ func TODOTestOrderServiceRegister(t *testing.T) {
 
 			repOrder := NewMockOrderRepository(ctrl)
 			accSvc := NewMockAccrualService(ctrl)
-			repTx := NewMockWithdrawalRepository(ctrl)
 
 			tt.mockSetting.setupList(repOrder, tt.args.ctx, tt.mockSetting.dtoListIn, tt.mockSetting.dtoListOut, tt.mockSetting.errListOut)
 			tt.mockSetting.setupCreate(repOrder, tt.args.ctx, tt.mockSetting.dtoCreateIn, tt.mockSetting.errCreateOut)
 			tt.mockSetting.setupUpdate(repOrder, tt.args.ctx, tt.mockSetting.dtoUpdateIn, tt.mockSetting.errUpdateOut)
 			tt.mockSetting.setupAccrual(accSvc, tt.args.ctx, tt.mockSetting.dtoAccrualIn, tt.mockSetting.dtoAccrualOut, tt.mockSetting.errAccrualOut)
-			tt.mockSetting.setupIncome(repTx, tt.args.ctx, tt.mockSetting.dtoIncomeIn, tt.mockSetting.errIncomeOut)
 
 			svc := NewOrderService(OrderServiceConfig{
 				OrderRepository:        repOrder,
 				AccrualService:         accSvc,
-				WithdrawalRepository:   repTx,
 				RetryOnError:           time.Second * 10,
 				AttemptsGettingAccrual: 2,
 			})
@@ -487,7 +465,7 @@ func TODOTestOrderServiceList(t *testing.T) {
 					{
 						Number:  "65432",
 						Status:  gophermart.StatusProcessed,
-						Accrual: 100,
+						Accrual: money.FromInt(100),
 					},
 				},
 				errOut: nil,
@@ -509,7 +487,7 @@ func TODOTestOrderServiceList(t *testing.T) {
 					{
 						Number:  "65432",
 						Status:  "PROCESSED",
-						Accrual: 100,
+						Accrual: money.FromInt(100),
 					},
 				},
 				err: nil,
@@ -524,14 +502,12 @@ func TODOTestOrderServiceList(t *testing.T) {
 
 			repOrder := NewMockOrderRepository(ctrl)
 			accSvc := NewMockAccrualService(ctrl)
-			repTx := NewMockWithdrawalRepository(ctrl)
 
 			tt.mockSetting.setup(repOrder, tt.args.ctx, tt.mockSetting.dtoIn, tt.mockSetting.dtoOut, tt.mockSetting.errOut)
 
 			svc := NewOrderService(OrderServiceConfig{
 				OrderRepository:        repOrder,
 				AccrualService:         accSvc,
-				WithdrawalRepository:   repTx,
 				RetryOnError:           time.Second * 10,
 				AttemptsGettingAccrual: 2,
 			})
@@ -551,3 +527,314 @@ func TODOTestOrderServiceList(t *testing.T) {
 		})
 	}
 }
+
+func TestOrderService_List(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	from := createdAt.Add(-24 * time.Hour)
+	repError := errors.New("repository error")
+
+	tests := []struct {
+		name   string
+		dto    service.ListOrderRequest
+		dtoIn  *gophermart.OrderListRequest
+		dtoOut []gophermart.OrderInfo
+		errOut error
+		want   service.OrderList
+		err    error
+	}{
+		{
+			name: "invalid format",
+			dto:  service.ListOrderRequest{},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "unknown status",
+			dto:  service.ListOrderRequest{UserID: "1234567", Status: []string{"DONE"}},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "empty time range",
+			dto:  service.ListOrderRequest{UserID: "1234567", From: createdAt, To: createdAt},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "limit is too big",
+			dto:  service.ListOrderRequest{UserID: "1234567", Page: service.PageRequest{Limit: service.MaxPageLimit + 1}},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name:   "unknown repository error",
+			dto:    service.ListOrderRequest{UserID: "1234567"},
+			dtoIn:  &gophermart.OrderListRequest{UserID: "1234567", Status: []int{}, Limit: service.MaxPageLimit + 1},
+			errOut: repError,
+			err:    repError,
+		},
+		{
+			name: "last page",
+			dto: service.ListOrderRequest{
+				UserID: "1234567",
+				Status: []string{StatusInvalid, StatusProcessed},
+				From:   from,
+			},
+			dtoIn: &gophermart.OrderListRequest{
+				UserID: "1234567",
+				Status: []int{gophermart.StatusInvalid, gophermart.StatusProcessed},
+				From:   from,
+				Limit:  service.MaxPageLimit + 1,
+			},
+			dtoOut: []gophermart.OrderInfo{
+				{ID: 1, Number: "123456", Status: gophermart.StatusInvalid, CreatedAt: createdAt},
+				{ID: 2, Number: "65432", Status: gophermart.StatusProcessed, Accrual: money.FromInt(100), CreatedAt: createdAt},
+			},
+			want: service.OrderList{Orders: []service.OrderInfo{
+				{Number: "123456", Status: StatusInvalid, CreatedAt: createdAt},
+				{Number: "65432", Status: StatusProcessed, Accrual: money.FromInt(100), CreatedAt: createdAt},
+			}},
+		},
+		{
+			name: "there is next page",
+			dto: service.ListOrderRequest{
+				UserID: "1234567",
+				Page: service.PageRequest{
+					Limit:      1,
+					After:      cursor.Cursor{CreatedAt: createdAt, ID: 5}.String(),
+					Descending: true,
+				},
+			},
+			dtoIn: &gophermart.OrderListRequest{
+				UserID:     "1234567",
+				Status:     []int{},
+				Limit:      2,
+				After:      cursor.Cursor{CreatedAt: createdAt, ID: 5},
+				Descending: true,
+			},
+			dtoOut: []gophermart.OrderInfo{
+				{ID: 4, Number: "123456", Status: gophermart.StatusNew, CreatedAt: createdAt},
+				{ID: 3, Number: "65432", Status: gophermart.StatusNew, CreatedAt: createdAt.Add(-time.Hour)},
+			},
+			want: service.OrderList{
+				Orders: []service.OrderInfo{{Number: "123456", Status: StatusNew, CreatedAt: createdAt}},
+				Next:   cursor.Cursor{CreatedAt: createdAt, ID: 4}.String(),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repOrder := NewMockOrderRepository(ctrl)
+			if tt.dtoIn != nil {
+				repOrder.EXPECT().List(gomock.Any(), *tt.dtoIn).Return(tt.dtoOut, tt.errOut)
+			}
+
+			svc := NewOrderService(OrderServiceConfig{OrderRepository: repOrder})
+
+			got, err := svc.List(context.Background(), tt.dto)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOrderService_Order(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	repError := errors.New("repository error")
+
+	tests := []struct {
+		name   string
+		dto    service.OrderRequest
+		mock   bool
+		dtoOut []gophermart.OrderInfo
+		errOut error
+		want   service.OrderDetails
+		err    error
+	}{
+		{
+			name: "invalid format",
+			dto:  service.OrderRequest{UserID: "1234567"},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "wrong number",
+			dto:  service.OrderRequest{UserID: "1234567", Number: "12345"},
+			err:  service.ErrWrongNumberOfOrder,
+		},
+		{
+			name:   "unknown repository error",
+			dto:    service.OrderRequest{UserID: "1234567", Number: "12345678903"},
+			mock:   true,
+			errOut: repError,
+			err:    repError,
+		},
+		{
+			name:   "order not found",
+			dto:    service.OrderRequest{UserID: "1234567", Number: "12345678903"},
+			mock:   true,
+			dtoOut: []gophermart.OrderInfo{},
+			err:    service.ErrOrderNotFound,
+		},
+		{
+			name:   "order of another user",
+			dto:    service.OrderRequest{UserID: "1234567", Number: "12345678903"},
+			mock:   true,
+			dtoOut: []gophermart.OrderInfo{{UserID: "7654321", Number: "12345678903"}},
+			err:    service.ErrOrderOfAnotherUser,
+		},
+		{
+			name: "success",
+			dto:  service.OrderRequest{UserID: "1234567", Number: "12345678903"},
+			mock: true,
+			dtoOut: []gophermart.OrderInfo{{
+				UserID:    "1234567",
+				Number:    "12345678903",
+				Status:    gophermart.StatusProcessing,
+				CreatedAt: createdAt,
+				UpdatedAt: createdAt.Add(time.Minute),
+				Attempts:  3,
+				CheckedAt: createdAt.Add(2 * time.Minute),
+			}},
+			want: service.OrderDetails{
+				Number:    "12345678903",
+				Status:    StatusProcessing,
+				CreatedAt: createdAt,
+				UpdatedAt: createdAt.Add(time.Minute),
+				Attempts:  3,
+				CheckedAt: createdAt.Add(2 * time.Minute),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repOrder := NewMockOrderRepository(ctrl)
+			if tt.mock {
+				repOrder.EXPECT().
+					List(gomock.Any(), gophermart.OrderListRequest{OrderNumber: tt.dto.Number}).
+					Return(tt.dtoOut, tt.errOut)
+			}
+
+			svc := NewOrderService(OrderServiceConfig{OrderRepository: repOrder})
+
+			got, err := svc.Order(context.Background(), tt.dto)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOrderService_Events(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	repOrder := NewMockOrderRepository(ctrl)
+	repOrder.EXPECT().
+		OrderEvents(gomock.Any(), gophermart.OrderEventRequest{UserID: "1234567", AfterID: 41, Limit: eventsLimit}).
+		Return([]gophermart.OrderEvent{
+			{ID: 42, UserID: "1234567", Number: "12345678903", Status: gophermart.StatusProcessed, Accrual: money.FromInt(100), CreatedAt: createdAt},
+		}, nil)
+
+	svc := NewOrderService(OrderServiceConfig{OrderRepository: repOrder})
+
+	_, err := svc.Events(context.Background(), service.OrderEventsRequest{AfterID: 41})
+	assert.ErrorIs(t, err, service.ErrInvalidFormat)
+
+	events, err := svc.Events(context.Background(), service.OrderEventsRequest{UserID: "1234567", AfterID: 41})
+	assert.NoError(t, err)
+	assert.Equal(t, []service.OrderEvent{
+		{ID: 42, Number: "12345678903", Status: StatusProcessed, Accrual: money.FromInt(100), CreatedAt: createdAt},
+	}, events)
+}
+
+func TestOrderService_ApplyAccrual(t *testing.T) {
+	const number = "12345678903"
+
+	tests := []struct {
+		name    string
+		dto     service.AccrualsInfo
+		setup   func(*MockOrderRepository)
+		wantErr error
+	}{
+		{
+			name: "processed order is credited",
+			dto:  service.AccrualsInfo{OrderNumber: number, Status: StatusProcessed, Accrual: money.FromInt(100)},
+			setup: func(rep *MockOrderRepository) {
+				rep.EXPECT().List(gomock.Any(), gophermart.OrderListRequest{OrderNumber: number}).
+					Return([]gophermart.OrderInfo{{UserID: "1234567", Number: number, Status: gophermart.StatusProcessing}}, nil)
+				rep.EXPECT().UpdateWithIncome(gomock.Any(), gophermart.OrderUpdateRequest{
+					UserID:  "1234567",
+					Number:  number,
+					Status:  gophermart.StatusProcessed,
+					Accrual: money.FromInt(100),
+				}).Return(nil)
+			},
+		},
+		{
+			name: "invalid order",
+			dto:  service.AccrualsInfo{OrderNumber: number, Status: StatusInvalid},
+			setup: func(rep *MockOrderRepository) {
+				rep.EXPECT().List(gomock.Any(), gomock.Any()).Return([]gophermart.OrderInfo{{UserID: "1234567", Number: number}}, nil)
+				rep.EXPECT().Update(gomock.Any(), gophermart.OrderUpdateRequest{
+					UserID: "1234567",
+					Number: number,
+					Status: gophermart.StatusInvalid,
+				}).Return(nil)
+			},
+		},
+		{
+			name: "order is not calculated yet",
+			dto:  service.AccrualsInfo{OrderNumber: number, Status: statusRegistered},
+		},
+		{
+			name: "unknown order",
+			dto:  service.AccrualsInfo{OrderNumber: number, Status: StatusProcessed, Accrual: money.FromInt(100)},
+			setup: func(rep *MockOrderRepository) {
+				rep.EXPECT().List(gomock.Any(), gomock.Any()).Return(nil, nil)
+			},
+			wantErr: service.ErrOrderNotFound,
+		},
+		{
+			name:    "unknown status",
+			dto:     service.AccrualsInfo{OrderNumber: number, Status: "DONE"},
+			wantErr: service.ErrInvalidFormat,
+		},
+		{
+			name:    "negative accrual",
+			dto:     service.AccrualsInfo{OrderNumber: number, Status: StatusProcessed, Accrual: money.FromInt(-1)},
+			wantErr: service.ErrInvalidFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			rep := NewMockOrderRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(rep)
+			}
+
+			svc := NewOrderService(OrderServiceConfig{OrderRepository: rep})
+			err := svc.ApplyAccrual(context.Background(), tt.dto)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -50,6 +50,20 @@ func (mr *MockAuthorizationServiceMockRecorder) Authorize(arg0, arg1 interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authorize", reflect.TypeOf((*MockAuthorizationService)(nil).Authorize), arg0, arg1)
 }
 
+// ChangePassword mocks base method.
+func (m *MockAuthorizationService) ChangePassword(arg0 context.Context, arg1 service.ChangePasswordRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockAuthorizationServiceMockRecorder) ChangePassword(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockAuthorizationService)(nil).ChangePassword), arg0, arg1)
+}
+
 // CheckByUserID mocks base method.
 func (m *MockAuthorizationService) CheckByUserID(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -64,6 +78,93 @@ func (mr *MockAuthorizationServiceMockRecorder) CheckByUserID(arg0, arg1 interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckByUserID", reflect.TypeOf((*MockAuthorizationService)(nil).CheckByUserID), arg0, arg1)
 }
 
+// CheckToken mocks base method.
+func (m *MockAuthorizationService) CheckToken(arg0 context.Context, arg1 service.CheckTokenRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckToken", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckToken indicates an expected call of CheckToken.
+func (mr *MockAuthorizationServiceMockRecorder) CheckToken(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckToken", reflect.TypeOf((*MockAuthorizationService)(nil).CheckToken), arg0, arg1)
+}
+
+// CreateSession mocks base method.
+func (m *MockAuthorizationService) CreateSession(arg0 context.Context, arg1 string) (service.SessionInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", arg0, arg1)
+	ret0, _ := ret[0].(service.SessionInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockAuthorizationServiceMockRecorder) CreateSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockAuthorizationService)(nil).CreateSession), arg0, arg1)
+}
+
+// DeleteAccount mocks base method.
+func (m *MockAuthorizationService) DeleteAccount(arg0 context.Context, arg1 string) (service.DeletedAccountInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAccount", arg0, arg1)
+	ret0, _ := ret[0].(service.DeletedAccountInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteAccount indicates an expected call of DeleteAccount.
+func (mr *MockAuthorizationServiceMockRecorder) DeleteAccount(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAccount", reflect.TypeOf((*MockAuthorizationService)(nil).DeleteAccount), arg0, arg1)
+}
+
+// Logout mocks base method.
+func (m *MockAuthorizationService) Logout(arg0 context.Context, arg1 service.LogoutRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Logout", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Logout indicates an expected call of Logout.
+func (mr *MockAuthorizationServiceMockRecorder) Logout(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockAuthorizationService)(nil).Logout), arg0, arg1)
+}
+
+// LogoutAll mocks base method.
+func (m *MockAuthorizationService) LogoutAll(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LogoutAll", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LogoutAll indicates an expected call of LogoutAll.
+func (mr *MockAuthorizationServiceMockRecorder) LogoutAll(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LogoutAll", reflect.TypeOf((*MockAuthorizationService)(nil).LogoutAll), arg0, arg1)
+}
+
+// RefreshSession mocks base method.
+func (m *MockAuthorizationService) RefreshSession(arg0 context.Context, arg1 service.RefreshSessionRequest) (service.SessionInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshSession", arg0, arg1)
+	ret0, _ := ret[0].(service.SessionInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RefreshSession indicates an expected call of RefreshSession.
+func (mr *MockAuthorizationServiceMockRecorder) RefreshSession(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshSession", reflect.TypeOf((*MockAuthorizationService)(nil).RefreshSession), arg0, arg1)
+}
+
 // Register mocks base method.
 func (m *MockAuthorizationService) Register(arg0 context.Context, arg1 service.RegisterRequest) (service.UserInfo, error) {
 	m.ctrl.T.Helper()
@@ -102,23 +203,40 @@ func (m *MockOrderService) EXPECT() *MockOrderServiceMockRecorder {
 	return m.recorder
 }
 
-// Close mocks base method.
-func (m *MockOrderService) Close() {
+// ApplyAccrual mocks base method.
+func (m *MockOrderService) ApplyAccrual(arg0 context.Context, arg1 service.AccrualsInfo) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Close")
+	ret := m.ctrl.Call(m, "ApplyAccrual", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
-// Close indicates an expected call of Close.
-func (mr *MockOrderServiceMockRecorder) Close() *gomock.Call {
+// ApplyAccrual indicates an expected call of ApplyAccrual.
+func (mr *MockOrderServiceMockRecorder) ApplyAccrual(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockOrderService)(nil).Close))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApplyAccrual", reflect.TypeOf((*MockOrderService)(nil).ApplyAccrual), arg0, arg1)
+}
+
+// Events mocks base method.
+func (m *MockOrderService) Events(arg0 context.Context, arg1 service.OrderEventsRequest) ([]service.OrderEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Events", arg0, arg1)
+	ret0, _ := ret[0].([]service.OrderEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Events indicates an expected call of Events.
+func (mr *MockOrderServiceMockRecorder) Events(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockOrderService)(nil).Events), arg0, arg1)
 }
 
 // List mocks base method.
-func (m *MockOrderService) List(arg0 context.Context, arg1 service.ListOrderRequest) ([]service.OrderInfo, error) {
+func (m *MockOrderService) List(arg0 context.Context, arg1 service.ListOrderRequest) (service.OrderList, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "List", arg0, arg1)
-	ret0, _ := ret[0].([]service.OrderInfo)
+	ret0, _ := ret[0].(service.OrderList)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -129,6 +247,21 @@ func (mr *MockOrderServiceMockRecorder) List(arg0, arg1 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockOrderService)(nil).List), arg0, arg1)
 }
 
+// Order mocks base method.
+func (m *MockOrderService) Order(arg0 context.Context, arg1 service.OrderRequest) (service.OrderDetails, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Order", arg0, arg1)
+	ret0, _ := ret[0].(service.OrderDetails)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Order indicates an expected call of Order.
+func (mr *MockOrderServiceMockRecorder) Order(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Order", reflect.TypeOf((*MockOrderService)(nil).Order), arg0, arg1)
+}
+
 // Register mocks base method.
 func (m *MockOrderService) Register(arg0 context.Context, arg1 service.RegisterOrderRequest) error {
 	m.ctrl.T.Helper()
@@ -143,6 +276,21 @@ func (mr *MockOrderServiceMockRecorder) Register(arg0, arg1 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockOrderService)(nil).Register), arg0, arg1)
 }
 
+// Subscribe mocks base method.
+func (m *MockOrderService) Subscribe(userID string) (<-chan struct{}, func()) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", userID)
+	ret0, _ := ret[0].(<-chan struct{})
+	ret1, _ := ret[1].(func())
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockOrderServiceMockRecorder) Subscribe(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockOrderService)(nil).Subscribe), userID)
+}
+
 // MockWithdrawalService is a mock of WithdrawalService interface.
 type MockWithdrawalService struct {
 	ctrl     *gomock.Controller
@@ -182,10 +330,10 @@ func (mr *MockWithdrawalServiceMockRecorder) Balance(arg0, arg1 interface{}) *go
 }
 
 // List mocks base method.
-func (m *MockWithdrawalService) List(arg0 context.Context, arg1 service.WithdrawalListRequest) ([]service.WithdrawalInfo, error) {
+func (m *MockWithdrawalService) List(arg0 context.Context, arg1 service.WithdrawalListRequest) (service.WithdrawalList, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "List", arg0, arg1)
-	ret0, _ := ret[0].([]service.WithdrawalInfo)
+	ret0, _ := ret[0].(service.WithdrawalList)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -196,6 +344,21 @@ func (mr *MockWithdrawalServiceMockRecorder) List(arg0, arg1 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockWithdrawalService)(nil).List), arg0, arg1)
 }
 
+// Statement mocks base method.
+func (m *MockWithdrawalService) Statement(arg0 context.Context, arg1 service.StatementRequest) ([]service.StatementEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Statement", arg0, arg1)
+	ret0, _ := ret[0].([]service.StatementEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Statement indicates an expected call of Statement.
+func (mr *MockWithdrawalServiceMockRecorder) Statement(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Statement", reflect.TypeOf((*MockWithdrawalService)(nil).Statement), arg0, arg1)
+}
+
 // Withdraw mocks base method.
 func (m *MockWithdrawalService) Withdraw(arg0 context.Context, arg1 service.WithdrawalRequest) error {
 	m.ctrl.T.Helper()
@@ -210,6 +373,169 @@ func (mr *MockWithdrawalServiceMockRecorder) Withdraw(arg0, arg1 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Withdraw", reflect.TypeOf((*MockWithdrawalService)(nil).Withdraw), arg0, arg1)
 }
 
+// MockWebhookService is a mock of WebhookService interface.
+type MockWebhookService struct {
+	ctrl     *gomock.Controller
+	recorder *MockWebhookServiceMockRecorder
+}
+
+// MockWebhookServiceMockRecorder is the mock recorder for MockWebhookService.
+type MockWebhookServiceMockRecorder struct {
+	mock *MockWebhookService
+}
+
+// NewMockWebhookService creates a new mock instance.
+func NewMockWebhookService(ctrl *gomock.Controller) *MockWebhookService {
+	mock := &MockWebhookService{ctrl: ctrl}
+	mock.recorder = &MockWebhookServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWebhookService) EXPECT() *MockWebhookServiceMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockWebhookService) Delete(arg0 context.Context, arg1 service.WebhookRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockWebhookServiceMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockWebhookService)(nil).Delete), arg0, arg1)
+}
+
+// Deliveries mocks base method.
+func (m *MockWebhookService) Deliveries(arg0 context.Context, arg1 service.WebhookRequest) ([]service.DeliveryInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Deliveries", arg0, arg1)
+	ret0, _ := ret[0].([]service.DeliveryInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Deliveries indicates an expected call of Deliveries.
+func (mr *MockWebhookServiceMockRecorder) Deliveries(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Deliveries", reflect.TypeOf((*MockWebhookService)(nil).Deliveries), arg0, arg1)
+}
+
+// List mocks base method.
+func (m *MockWebhookService) List(arg0 context.Context, arg1 string) ([]service.WebhookInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0, arg1)
+	ret0, _ := ret[0].([]service.WebhookInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockWebhookServiceMockRecorder) List(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockWebhookService)(nil).List), arg0, arg1)
+}
+
+// Redeliver mocks base method.
+func (m *MockWebhookService) Redeliver(arg0 context.Context, arg1 service.RedeliveryRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Redeliver", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Redeliver indicates an expected call of Redeliver.
+func (mr *MockWebhookServiceMockRecorder) Redeliver(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Redeliver", reflect.TypeOf((*MockWebhookService)(nil).Redeliver), arg0, arg1)
+}
+
+// Register mocks base method.
+func (m *MockWebhookService) Register(arg0 context.Context, arg1 service.RegisterWebhookRequest) (service.WebhookInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Register", arg0, arg1)
+	ret0, _ := ret[0].(service.WebhookInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Register indicates an expected call of Register.
+func (mr *MockWebhookServiceMockRecorder) Register(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockWebhookService)(nil).Register), arg0, arg1)
+}
+
+// MockIdempotencyService is a mock of IdempotencyService interface.
+type MockIdempotencyService struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdempotencyServiceMockRecorder
+}
+
+// MockIdempotencyServiceMockRecorder is the mock recorder for MockIdempotencyService.
+type MockIdempotencyServiceMockRecorder struct {
+	mock *MockIdempotencyService
+}
+
+// NewMockIdempotencyService creates a new mock instance.
+func NewMockIdempotencyService(ctrl *gomock.Controller) *MockIdempotencyService {
+	mock := &MockIdempotencyService{ctrl: ctrl}
+	mock.recorder = &MockIdempotencyServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdempotencyService) EXPECT() *MockIdempotencyServiceMockRecorder {
+	return m.recorder
+}
+
+// Cancel mocks base method.
+func (m *MockIdempotencyService) Cancel(arg0 context.Context, arg1 service.IdempotencyRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cancel", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Cancel indicates an expected call of Cancel.
+func (mr *MockIdempotencyServiceMockRecorder) Cancel(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cancel", reflect.TypeOf((*MockIdempotencyService)(nil).Cancel), arg0, arg1)
+}
+
+// Complete mocks base method.
+func (m *MockIdempotencyService) Complete(arg0 context.Context, arg1 service.IdempotencyRequest, arg2 service.IdempotentResponse) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Complete", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Complete indicates an expected call of Complete.
+func (mr *MockIdempotencyServiceMockRecorder) Complete(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Complete", reflect.TypeOf((*MockIdempotencyService)(nil).Complete), arg0, arg1, arg2)
+}
+
+// Start mocks base method.
+func (m *MockIdempotencyService) Start(ctx context.Context, dto service.IdempotencyRequest) (service.IdempotentResponse, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Start", ctx, dto)
+	ret0, _ := ret[0].(service.IdempotentResponse)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Start indicates an expected call of Start.
+func (mr *MockIdempotencyServiceMockRecorder) Start(ctx, dto interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Start", reflect.TypeOf((*MockIdempotencyService)(nil).Start), ctx, dto)
+}
+
 // MockAccrualService is a mock of AccrualService interface.
 type MockAccrualService struct {
 	ctrl     *gomock.Controller
@@ -248,6 +574,21 @@ func (mr *MockAccrualServiceMockRecorder) Accruals(arg0, arg1 interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Accruals", reflect.TypeOf((*MockAccrualService)(nil).Accruals), arg0, arg1)
 }
 
+// BatchAccruals mocks base method.
+func (m *MockAccrualService) BatchAccruals(arg0 context.Context, arg1 service.AccrualsBatchRequest) ([]service.AccrualsInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BatchAccruals", arg0, arg1)
+	ret0, _ := ret[0].([]service.AccrualsInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BatchAccruals indicates an expected call of BatchAccruals.
+func (mr *MockAccrualServiceMockRecorder) BatchAccruals(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BatchAccruals", reflect.TypeOf((*MockAccrualService)(nil).BatchAccruals), arg0, arg1)
+}
+
 // MockCalculationService is a mock of CalculationService interface.
 type MockCalculationService struct {
 	ctrl     *gomock.Controller
@@ -271,6 +612,21 @@ func (m *MockCalculationService) EXPECT() *MockCalculationServiceMockRecorder {
 	return m.recorder
 }
 
+// Breakdown mocks base method.
+func (m *MockCalculationService) Breakdown(arg0 context.Context, arg1 service.CalculationFilterRequest) (service.CalculationBreakdown, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Breakdown", arg0, arg1)
+	ret0, _ := ret[0].(service.CalculationBreakdown)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Breakdown indicates an expected call of Breakdown.
+func (mr *MockCalculationServiceMockRecorder) Breakdown(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Breakdown", reflect.TypeOf((*MockCalculationService)(nil).Breakdown), arg0, arg1)
+}
+
 // Calculation mocks base method.
 func (m *MockCalculationService) Calculation(arg0 context.Context, arg1 service.CalculationFilterRequest) (service.CalculationInfo, error) {
 	m.ctrl.T.Helper()
@@ -286,6 +642,21 @@ func (mr *MockCalculationServiceMockRecorder) Calculation(arg0, arg1 interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Calculation", reflect.TypeOf((*MockCalculationService)(nil).Calculation), arg0, arg1)
 }
 
+// Calculations mocks base method.
+func (m *MockCalculationService) Calculations(arg0 context.Context, arg1 service.CalculationsFilterRequest) ([]service.CalculationInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Calculations", arg0, arg1)
+	ret0, _ := ret[0].([]service.CalculationInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Calculations indicates an expected call of Calculations.
+func (mr *MockCalculationServiceMockRecorder) Calculations(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Calculations", reflect.TypeOf((*MockCalculationService)(nil).Calculations), arg0, arg1)
+}
+
 // Register mocks base method.
 func (m *MockCalculationService) Register(arg0 context.Context, arg1 service.RegisterCalculationRequest) error {
 	m.ctrl.T.Helper()
@@ -323,6 +694,20 @@ func (m *MockCalculationRuleService) EXPECT() *MockCalculationRuleServiceMockRec
 	return m.recorder
 }
 
+// Delete mocks base method.
+func (m *MockCalculationRuleService) Delete(arg0 context.Context, arg1 service.DeleteCalculationRuleRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockCalculationRuleServiceMockRecorder) Delete(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockCalculationRuleService)(nil).Delete), arg0, arg1)
+}
+
 // Register mocks base method.
 func (m *MockCalculationRuleService) Register(arg0 context.Context, arg1 service.RegisterCalculationRuleRequest) error {
 	m.ctrl.T.Helper()
@@ -336,3 +721,46 @@ func (mr *MockCalculationRuleServiceMockRecorder) Register(arg0, arg1 interface{
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockCalculationRuleService)(nil).Register), arg0, arg1)
 }
+
+// Rules mocks base method.
+func (m *MockCalculationRuleService) Rules(arg0 context.Context) ([]service.CalculationRuleInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rules", arg0)
+	ret0, _ := ret[0].([]service.CalculationRuleInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Rules indicates an expected call of Rules.
+func (mr *MockCalculationRuleServiceMockRecorder) Rules(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rules", reflect.TypeOf((*MockCalculationRuleService)(nil).Rules), arg0)
+}
+
+// SetDisabled mocks base method.
+func (m *MockCalculationRuleService) SetDisabled(arg0 context.Context, arg1 service.DisableCalculationRuleRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDisabled", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDisabled indicates an expected call of SetDisabled.
+func (mr *MockCalculationRuleServiceMockRecorder) SetDisabled(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDisabled", reflect.TypeOf((*MockCalculationRuleService)(nil).SetDisabled), arg0, arg1)
+}
+
+// Update mocks base method.
+func (m *MockCalculationRuleService) Update(arg0 context.Context, arg1 service.UpdateCalculationRuleRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockCalculationRuleServiceMockRecorder) Update(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockCalculationRuleService)(nil).Update), arg0, arg1)
+}
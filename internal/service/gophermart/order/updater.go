@@ -15,8 +15,9 @@ type updateRepositoryJob struct {
 }
 
 type updatingOrder struct {
-	orderRepository       gophermart.OrderRepository
-	transactionRepository gophermart.WithdrawalRepository
+	orderRepository gophermart.OrderRepository
+	//subscribers of user are notified about change of order, it can be nil
+	events *eventBroker
 }
 
 func (e updatingOrder) updateOrder(ctx context.Context, job updateRepositoryJob) error {
@@ -27,41 +28,22 @@ func (e updatingOrder) updateOrder(ctx context.Context, job updateRepositoryJob)
 
 	data, status := job.data, defineStatus(job.data.Status)
 
-	if err := e.postOrderState(ctx, gophermart.OrderUpdateRequest{
+	return e.postOrderState(ctx, gophermart.OrderUpdateRequest{
 		UserID:  job.userID,
 		Number:  job.orderNumber,
 		Status:  status,
 		Accrual: data.Accrual,
-	}); err != nil {
-		return err
-	}
+	})
+}
 
-	if status == gophermart.StatusProcessed {
-		if err := e.commitTransaction(ctx, gophermart.WithdrawalRequest{
-			UserID:      job.userID,
-			OrderNumber: job.orderNumber,
-			Sum:         data.Accrual,
-		}); err != nil {
-			return err
-		}
-	}
-	return nil
+// addAttempt counts request to accrual service about order and schedules the next one
+func (e updatingOrder) addAttempt(ctx context.Context, dto gophermart.OrderAttemptRequest) error {
+	return e.orderRepository.AddAttempt(ctx, dto)
 }
 
-func (e updatingOrder) commitTransaction(ctx context.Context, dto gophermart.WithdrawalRequest) error{
-	log := logger.With("component", "commitTransaction")
-	select {
-	default:
-	case <-ctx.Done():
-		log.Debug("context was canceled, committing of transaction will stop")
-		return ctx.Err()
-	}
-	if err := e.transactionRepository.Income(ctx, dto); err != nil {
-		log.Error("adding income to user balance was failed", "dto", dto, "error", err)
-		return err
-	}
-	log.Debug("transaction was committed", "dto", dto)
-	return nil
+// extendLease prolongs lease of order which is processed
+func (e updatingOrder) extendLease(ctx context.Context, dto gophermart.OrderLeaseRequest) error {
+	return e.orderRepository.ExtendLease(ctx, dto)
 }
 
 func (e updatingOrder) postOrderState(ctx context.Context, dto gophermart.OrderUpdateRequest) error {
@@ -73,17 +55,28 @@ func (e updatingOrder) postOrderState(ctx context.Context, dto gophermart.OrderU
 		return ctx.Err()
 	}
 
-	if err := e.orderRepository.Update(ctx, dto); err != nil {
+	update := e.orderRepository.Update
+	if dto.Status == gophermart.StatusProcessed {
+		//status and income must be posted together, otherwise crash can leave processed order without credit
+		update = e.orderRepository.UpdateWithIncome
+	}
+
+	if err := update(ctx, dto); err != nil {
 		log.Error("updating order status was failed", "dto", dto, "error", err)
 		return err
 	}
 	log.Debug("order status was updated", "dto", dto)
+
+	if e.events != nil {
+		e.events.notify(dto.UserID)
+	}
 	return nil
 }
 
 func defineStatus(status string) int {
 	switch status {
-	case StatusProcessing:
+	case StatusProcessing, statusRegistered:
+		//registered order is already accepted by accrual service, it is not moved back to new
 		return gophermart.StatusProcessing
 	case StatusInvalid:
 		return gophermart.StatusInvalid
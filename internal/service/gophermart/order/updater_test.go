@@ -0,0 +1,110 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
+)
+
+func Test_updatingOrder_updateOrder(t *testing.T) {
+	repErr := errors.New("repository error")
+
+	tests := []struct {
+		name  string
+		job   updateRepositoryJob
+		setup func(*MockOrderRepository, context.Context)
+		err   error
+	}{
+		{
+			name: "processed order is updated with income",
+			job: updateRepositoryJob{
+				userID:      "user",
+				orderNumber: "31048580869",
+				data:        service.AccrualsInfo{Status: StatusProcessed, Accrual: money.FromInt(100)},
+			},
+			setup: func(m *MockOrderRepository, ctx context.Context) {
+				m.EXPECT().UpdateWithIncome(ctx, gophermart.OrderUpdateRequest{
+					UserID:  "user",
+					Number:  "31048580869",
+					Status:  gophermart.StatusProcessed,
+					Accrual: money.FromInt(100),
+				}).Return(nil)
+			},
+		},
+		{
+			name: "processing order is updated without income",
+			job: updateRepositoryJob{
+				userID:      "user",
+				orderNumber: "31048580869",
+				data:        service.AccrualsInfo{Status: StatusProcessing},
+			},
+			setup: func(m *MockOrderRepository, ctx context.Context) {
+				m.EXPECT().Update(ctx, gophermart.OrderUpdateRequest{
+					UserID: "user",
+					Number: "31048580869",
+					Status: gophermart.StatusProcessing,
+				}).Return(nil)
+			},
+		},
+		{
+			name: "registered order is not moved back to new",
+			job: updateRepositoryJob{
+				userID:      "user",
+				orderNumber: "31048580869",
+				data:        service.AccrualsInfo{Status: statusRegistered},
+			},
+			setup: func(m *MockOrderRepository, ctx context.Context) {
+				m.EXPECT().Update(ctx, gophermart.OrderUpdateRequest{
+					UserID: "user",
+					Number: "31048580869",
+					Status: gophermart.StatusProcessing,
+				}).Return(nil)
+			},
+		},
+		{
+			name: "repository error",
+			job: updateRepositoryJob{
+				userID:      "user",
+				orderNumber: "31048580869",
+				data:        service.AccrualsInfo{Status: StatusProcessed, Accrual: money.FromInt(100)},
+			},
+			setup: func(m *MockOrderRepository, ctx context.Context) {
+				m.EXPECT().UpdateWithIncome(ctx, gomock.Any()).Return(repErr)
+			},
+			err: repErr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			rep := NewMockOrderRepository(ctrl)
+			tt.setup(rep, ctx)
+
+			events := newEventBroker()
+			signal, cancel := events.subscribe(tt.job.userID)
+			defer cancel()
+
+			u := updatingOrder{orderRepository: rep, events: events}
+
+			err := u.updateOrder(ctx, tt.job)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Empty(t, signal)
+			} else {
+				assert.NoError(t, err)
+				//subscribers of user are notified about change
+				assert.Len(t, signal, 1)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vilasle/gophermart/internal/logger"
+	"github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/service/gophermart/order"
+	"github.com/vilasle/gophermart/internal/tool/money"
+	"github.com/vilasle/gophermart/internal/tool/signature"
+)
+
+// headers of request to webhook
+const (
+	HeaderEvent     = "X-Gophermart-Event"
+	HeaderDelivery  = "X-Gophermart-Delivery"
+	HeaderSignature = "X-Gophermart-Signature"
+)
+
+// errForbiddenAddress is returned when webhook host is resolved to address of internal network
+var errForbiddenAddress = errors.New("address of webhook is not public")
+
+type deliveryConfig struct {
+	client       *http.Client
+	allowPrivate bool
+	interval     time.Duration
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	maxFailures  int
+	workers      int
+	//claimed deliveries are not claimed again by another instance until lease expires
+	lease time.Duration
+}
+
+func newDeliveryConfig(config WebhookServiceConfig) deliveryConfig {
+	c := deliveryConfig{
+		client:       newClient(config.Timeout, config.AllowPrivateNetworks),
+		allowPrivate: config.AllowPrivateNetworks,
+		interval:     config.Interval,
+		baseDelay:    config.BaseDelay,
+		maxDelay:     config.MaxDelay,
+		maxFailures:  config.MaxFailures,
+		workers:      config.Workers,
+	}
+
+	if c.client.Timeout <= 0 {
+		c.client.Timeout = 10 * time.Second
+	}
+	if c.interval <= 0 {
+		c.interval = time.Second
+	}
+	if c.baseDelay <= 0 {
+		c.baseDelay = 10 * time.Second
+	}
+	if c.maxDelay <= 0 {
+		c.maxDelay = time.Hour
+	}
+	if c.maxFailures <= 0 {
+		c.maxFailures = 10
+	}
+	if c.workers <= 0 {
+		c.workers = 5
+	}
+	c.lease = 2 * c.client.Timeout
+
+	return c
+}
+
+// newClient checks address on every connection, so host which is resolved to internal network after registration
+// (DNS rebinding) is refused too. Redirects are not followed, they could lead to internal network as well
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(addr.Addr()) {
+				return fmt.Errorf("%w: %s", errForbiddenAddress, address)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	//proxy from environment would connect to webhook instead of checked dialer
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			//response with redirect is failed attempt because of its status
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// isPublicAddr is false for loopback, private, link-local, multicast and unspecified addresses
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && !addr.IsLoopback() && !addr.IsPrivate() && !addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() && !addr.IsInterfaceLocalMulticast() && !addr.IsMulticast() && !addr.IsUnspecified()
+}
+
+// Sign returns value of signature header: t=<unix time>,v1=<hex of HMAC-SHA256 of "<unix time>.<body>">.
+// Receiver computes it by the secret of webhook and rejects old timestamps against replay
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return signature.Sign(secret, timestamp, body)
+}
+
+// Start runs delivery of pending events until context is done
+func (s WebhookService) Start(ctx context.Context) {
+	log := logger.With("component", "WebhookService")
+	log.Info("starting webhook delivery")
+
+	go func() {
+		ticker := time.NewTicker(s.delivery.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			//full batch means that there may be more due deliveries
+			for s.deliverBatch(ctx) == s.delivery.workers && ctx.Err() == nil {
+				log.Debug("reading next batch of webhook deliveries")
+			}
+		}
+	}()
+}
+
+// deliverBatch sends claimed deliveries concurrently and returns their quantity
+func (s WebhookService) deliverBatch(ctx context.Context) int {
+	deliveries, err := s.rep.ClaimDeliveries(ctx, gophermart.DeliveryClaimRequest{
+		Limit: s.delivery.workers,
+		Lease: s.delivery.lease,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("claiming webhook deliveries failed", "error", err)
+		}
+		return 0
+	}
+
+	wg := sync.WaitGroup{}
+	for _, d := range deliveries {
+		wg.Add(1)
+		go func(d gophermart.Delivery) {
+			defer wg.Done()
+			s.deliver(ctx, d)
+		}(d)
+	}
+	wg.Wait()
+
+	return len(deliveries)
+}
+
+func (s WebhookService) deliver(ctx context.Context, d gophermart.Delivery) {
+	log := logger.With("component", "WebhookService", "delivery", d.ID, "webhook", d.WebhookID)
+
+	attempt := s.send(ctx, d)
+	if ctx.Err() != nil {
+		//delivery is claimed again when lease expires
+		return
+	}
+
+	result := gophermart.DeliveryResultRequest{
+		DeliveryID: d.ID,
+		Attempt:    attempt,
+		State:      gophermart.DeliveryDelivered,
+		Failures:   d.Failures,
+	}
+
+	if attempt.Error != "" {
+		result.Failures++
+		result.State = gophermart.DeliveryPending
+		result.NextAttemptAt = attempt.CreatedAt.Add(s.delivery.backoff(result.Failures))
+		if result.Failures >= s.delivery.maxFailures {
+			result.State = gophermart.DeliveryFailed
+		}
+		log.Warn("webhook delivery failed", "failures", result.Failures, "error", attempt.Error)
+	}
+
+	if err := s.rep.SaveDeliveryResult(ctx, result); err != nil {
+		log.Error("saving result of webhook delivery failed", "error", err)
+	}
+}
+
+// send posts signed payload to webhook. Delivery is successful if webhook answers by 2xx
+func (s WebhookService) send(ctx context.Context, d gophermart.Delivery) gophermart.DeliveryAttempt {
+	start := time.Now()
+	attempt := gophermart.DeliveryAttempt{CreatedAt: start}
+
+	body, err := json.Marshal(newPayload(d))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gophermart-webhook")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, start, body))
+
+	resp, err := s.delivery.client.Do(req)
+	attempt.Duration = time.Since(start)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	//connection is reused only if body is read
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return attempt
+}
+
+// backoff returns delay before next attempt after failures
+func (c deliveryConfig) backoff(failures int) time.Duration {
+	delay := c.baseDelay
+	for i := 1; i < failures && delay < c.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, c.maxDelay)
+}
+
+type payload struct {
+	ID         int64       `json:"id"`
+	Event      string      `json:"event"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       payloadData `json:"data"`
+}
+
+type payloadData struct {
+	Order   string       `json:"order"`
+	Status  string       `json:"status,omitempty"`
+	Accrual *money.Money `json:"accrual,omitempty"`
+	Sum     *money.Money `json:"sum,omitempty"`
+}
+
+func newPayload(d gophermart.Delivery) payload {
+	p := payload{
+		ID:         d.ID,
+		Event:      d.Event,
+		OccurredAt: d.OccurredAt,
+		Data:       payloadData{Order: d.OrderNumber},
+	}
+
+	sum := d.Sum
+	if d.Event == gophermart.WebhookEventOrderUpdated {
+		p.Data.Status = viewOfStatus(d.Status)
+		p.Data.Accrual = &sum
+	} else {
+		p.Data.Sum = &sum
+	}
+	return p
+}
+
+func viewOfStatus(status int) string {
+	switch status {
+	case gophermart.StatusNew:
+		return order.StatusNew
+	case gophermart.StatusProcessing:
+		return order.StatusProcessing
+	case gophermart.StatusInvalid:
+		return order.StatusInvalid
+	case gophermart.StatusProcessed:
+		return order.StatusProcessed
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,230 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/service"
+)
+
+// deliveriesLimit is quantity of the last deliveries which are returned by Deliveries
+const deliveriesLimit = 100
+
+type WebhookService struct {
+	rep      gophermart.WebhookRepository
+	delivery deliveryConfig
+}
+
+type WebhookServiceConfig struct {
+	gophermart.WebhookRepository
+	//timeout of request to webhook
+	Timeout time.Duration
+	//how often pending deliveries are read
+	Interval time.Duration
+	//delay after the first failure, it is doubled after each next one up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	//delivery is failed after MaxFailures failed attempts, it can be sent again by Redeliver
+	MaxFailures int
+	Workers     int
+	//webhooks on loopback, private and link-local addresses are refused by default against SSRF,
+	//it is allowed only for local development and tests
+	AllowPrivateNetworks bool
+}
+
+func NewWebhookService(config WebhookServiceConfig) *WebhookService {
+	return &WebhookService{
+		rep:      config.WebhookRepository,
+		delivery: newDeliveryConfig(config),
+	}
+}
+
+func (s WebhookService) Register(ctx context.Context, dto service.RegisterWebhookRequest) (service.WebhookInfo, error) {
+	if dto.UserID == "" || !isValidURL(dto.URL, s.delivery.allowPrivate) {
+		return service.WebhookInfo{}, service.ErrInvalidFormat
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return service.WebhookInfo{}, err
+	}
+
+	webhook, err := s.rep.AddWebhook(ctx, gophermart.WebhookRequest{
+		UserID: dto.UserID,
+		URL:    dto.URL,
+		Secret: secret,
+	})
+	if err != nil {
+		return service.WebhookInfo{}, err
+	}
+
+	return service.WebhookInfo{
+		ID:        webhook.ID,
+		URL:       webhook.URL,
+		Secret:    webhook.Secret,
+		CreatedAt: webhook.CreatedAt,
+	}, nil
+}
+
+func (s WebhookService) List(ctx context.Context, userID string) ([]service.WebhookInfo, error) {
+	if userID == "" {
+		return nil, service.ErrInvalidFormat
+	}
+
+	webhooks, err := s.rep.Webhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]service.WebhookInfo, len(webhooks))
+	for i, webhook := range webhooks {
+		result[i] = service.WebhookInfo{
+			ID:        webhook.ID,
+			URL:       webhook.URL,
+			CreatedAt: webhook.CreatedAt,
+		}
+	}
+	return result, nil
+}
+
+func (s WebhookService) Delete(ctx context.Context, dto service.WebhookRequest) error {
+	if dto.UserID == "" || !isUUID(dto.ID) {
+		return service.ErrInvalidFormat
+	}
+
+	err := s.rep.DeleteWebhook(ctx, gophermart.WebhookFilter{UserID: dto.UserID, ID: dto.ID})
+	if errors.Is(err, gophermart.ErrEmptyResult) {
+		return service.ErrWebhookNotFound
+	}
+	return err
+}
+
+func (s WebhookService) Deliveries(ctx context.Context, dto service.WebhookRequest) ([]service.DeliveryInfo, error) {
+	if dto.UserID == "" || !isUUID(dto.ID) {
+		return nil, service.ErrInvalidFormat
+	}
+
+	deliveries, err := s.rep.Deliveries(ctx, gophermart.DeliveryListRequest{
+		UserID:    dto.UserID,
+		WebhookID: dto.ID,
+		Limit:     deliveriesLimit,
+	})
+	if errors.Is(err, gophermart.ErrEmptyResult) {
+		return nil, service.ErrWebhookNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	result := make([]service.DeliveryInfo, len(deliveries))
+	for i, d := range deliveries {
+		attempts := make([]service.DeliveryAttemptInfo, len(d.Attempts))
+		for j, a := range d.Attempts {
+			attempts[j] = service.DeliveryAttemptInfo{
+				StatusCode: a.StatusCode,
+				Error:      a.Error,
+				Duration:   a.Duration,
+				CreatedAt:  a.CreatedAt,
+			}
+		}
+
+		info := service.DeliveryInfo{
+			ID:          d.ID,
+			Event:       d.Event,
+			OrderNumber: d.OrderNumber,
+			State:       viewOfState(d.State),
+			Failures:    d.Failures,
+			OccurredAt:  d.OccurredAt,
+			DeliveredAt: d.DeliveredAt,
+			Attempts:    attempts,
+		}
+		if d.State == gophermart.DeliveryPending {
+			info.NextAttemptAt = d.NextAttemptAt
+		}
+		result[i] = info
+	}
+	return result, nil
+}
+
+func (s WebhookService) Redeliver(ctx context.Context, dto service.RedeliveryRequest) error {
+	if dto.UserID == "" || dto.DeliveryID <= 0 {
+		return service.ErrInvalidFormat
+	}
+
+	err := s.rep.Redeliver(ctx, gophermart.RedeliveryRequest{UserID: dto.UserID, DeliveryID: dto.DeliveryID})
+	if errors.Is(err, gophermart.ErrEmptyResult) {
+		return service.ErrWebhookNotFound
+	}
+	return err
+}
+
+func viewOfState(state int) string {
+	switch state {
+	case gophermart.DeliveryPending:
+		return "pending"
+	case gophermart.DeliveryDelivered:
+		return "delivered"
+	case gophermart.DeliveryFailed:
+		return "failed"
+	default:
+		return ""
+	}
+}
+
+// isValidURL refuses address literals and localhost of internal networks on registration,
+// other host names are checked on every connection because they can be resolved to another address later
+func isValidURL(v string, allowPrivate bool) bool {
+	u, err := url.Parse(v)
+	if err != nil {
+		return false
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return false
+	}
+	if allowPrivate {
+		return true
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return isPublicAddr(addr)
+	}
+	return true
+}
+
+// isUUID checks format of id before it goes to database
+func isUUID(v string) bool {
+	if len(v) != 36 {
+		return false
+	}
+	for i, c := range v {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
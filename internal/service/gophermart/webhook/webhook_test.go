@@ -0,0 +1,299 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vilasle/gophermart/internal/repository/gophermart"
+	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/money"
+)
+
+const webhookID = "5b7c1c5e-2f4b-4d7e-9a51-0d6b7a3f9e21"
+
+func TestWebhookService_Register(t *testing.T) {
+	tests := []struct {
+		name  string
+		dto   service.RegisterWebhookRequest
+		setup func(*MockWebhookRepository)
+		err   error
+	}{
+		{
+			name: "empty user",
+			dto:  service.RegisterWebhookRequest{URL: "https://example.com/hook"},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "relative url",
+			dto:  service.RegisterWebhookRequest{UserID: "1", URL: "/hook"},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "unsupported scheme",
+			dto:  service.RegisterWebhookRequest{UserID: "1", URL: "ftp://example.com/hook"},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "loopback address",
+			dto:  service.RegisterWebhookRequest{UserID: "1", URL: "http://127.0.0.1:8080/hook"},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "localhost",
+			dto:  service.RegisterWebhookRequest{UserID: "1", URL: "http://localhost/hook"},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "private address",
+			dto:  service.RegisterWebhookRequest{UserID: "1", URL: "http://10.1.2.3/hook"},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "link-local address",
+			dto:  service.RegisterWebhookRequest{UserID: "1", URL: "http://169.254.169.254/latest/meta-data"},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "unspecified ipv6 address",
+			dto:  service.RegisterWebhookRequest{UserID: "1", URL: "http://[::]/hook"},
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name: "success",
+			dto:  service.RegisterWebhookRequest{UserID: "1", URL: "https://example.com/hook"},
+			setup: func(m *MockWebhookRepository) {
+				m.EXPECT().AddWebhook(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, dto gophermart.WebhookRequest) (gophermart.WebhookInfo, error) {
+						assert.Equal(t, "1", dto.UserID)
+						assert.Equal(t, "https://example.com/hook", dto.URL)
+						assert.True(t, strings.HasPrefix(dto.Secret, "whsec_"))
+						return gophermart.WebhookInfo{ID: webhookID, URL: dto.URL, Secret: dto.Secret}, nil
+					})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			rep := NewMockWebhookRepository(ctrl)
+			if tt.setup != nil {
+				tt.setup(rep)
+			}
+
+			svc := NewWebhookService(WebhookServiceConfig{WebhookRepository: rep})
+			webhook, err := svc.Register(context.Background(), tt.dto)
+			assert.ErrorIs(t, err, tt.err)
+			if tt.err == nil {
+				assert.Equal(t, webhookID, webhook.ID)
+				assert.NotEmpty(t, webhook.Secret)
+			}
+		})
+	}
+}
+
+func TestWebhookService_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rep := NewMockWebhookRepository(ctrl)
+	rep.EXPECT().DeleteWebhook(gomock.Any(), gophermart.WebhookFilter{UserID: "1", ID: webhookID}).
+		Return(gophermart.ErrEmptyResult)
+	rep.EXPECT().Deliveries(gomock.Any(), gomock.Any()).Return(nil, gophermart.ErrEmptyResult)
+	rep.EXPECT().Redeliver(gomock.Any(), gophermart.RedeliveryRequest{UserID: "1", DeliveryID: 7}).
+		Return(gophermart.ErrEmptyResult)
+
+	svc := NewWebhookService(WebhookServiceConfig{WebhookRepository: rep})
+	ctx := context.Background()
+
+	assert.ErrorIs(t, svc.Delete(ctx, service.WebhookRequest{UserID: "1", ID: "1"}), service.ErrInvalidFormat)
+	assert.ErrorIs(t, svc.Delete(ctx, service.WebhookRequest{UserID: "1", ID: webhookID}), service.ErrWebhookNotFound)
+
+	_, err := svc.Deliveries(ctx, service.WebhookRequest{UserID: "1", ID: webhookID})
+	assert.ErrorIs(t, err, service.ErrWebhookNotFound)
+
+	assert.ErrorIs(t, svc.Redeliver(ctx, service.RedeliveryRequest{UserID: "1"}), service.ErrInvalidFormat)
+	assert.ErrorIs(t, svc.Redeliver(ctx, service.RedeliveryRequest{UserID: "1", DeliveryID: 7}), service.ErrWebhookNotFound)
+}
+
+func TestWebhookService_deliver(t *testing.T) {
+	const secret = "whsec_test"
+
+	tests := []struct {
+		name     string
+		status   int
+		before   int
+		failures int
+		state    int
+	}{
+		{name: "delivered", status: http.StatusNoContent, before: 1, failures: 1, state: gophermart.DeliveryDelivered},
+		{name: "retry", status: http.StatusInternalServerError, before: 0, failures: 1, state: gophermart.DeliveryPending},
+		{name: "failed after max failures", status: http.StatusBadGateway, before: 2, failures: 3, state: gophermart.DeliveryFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				body    []byte
+				headers http.Header
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = io.ReadAll(r.Body)
+				headers = r.Header.Clone()
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			delivery := gophermart.Delivery{
+				ID:          42,
+				WebhookID:   webhookID,
+				URL:         srv.URL,
+				Secret:      secret,
+				Event:       gophermart.WebhookEventOrderUpdated,
+				OrderNumber: "12345678903",
+				Status:      gophermart.StatusProcessed,
+				Sum:         money.FromInt(500),
+				Failures:    tt.before,
+				OccurredAt:  time.Now().UTC(),
+			}
+
+			var result gophermart.DeliveryResultRequest
+			rep := NewMockWebhookRepository(ctrl)
+			rep.EXPECT().SaveDeliveryResult(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, dto gophermart.DeliveryResultRequest) error {
+					result = dto
+					return nil
+				})
+
+			svc := NewWebhookService(WebhookServiceConfig{
+				WebhookRepository:    rep,
+				BaseDelay:            time.Minute,
+				MaxFailures:          3,
+				AllowPrivateNetworks: true,
+			})
+			svc.deliver(context.Background(), delivery)
+
+			assert.Equal(t, gophermart.WebhookEventOrderUpdated, headers.Get(HeaderEvent))
+			assert.Equal(t, "42", headers.Get(HeaderDelivery))
+
+			sign := headers.Get(HeaderSignature)
+			assert.Equal(t, Sign(secret, result.Attempt.CreatedAt, body), sign)
+
+			var p map[string]any
+			require.NoError(t, json.Unmarshal(body, &p))
+			assert.Equal(t, float64(42), p["id"])
+			assert.Equal(t, map[string]any{"order": "12345678903", "status": "PROCESSED", "accrual": float64(500)}, p["data"])
+
+			assert.Equal(t, int64(42), result.DeliveryID)
+			assert.Equal(t, tt.status, result.Attempt.StatusCode)
+			assert.Equal(t, tt.state, result.State)
+			assert.Equal(t, tt.failures, result.Failures)
+			if tt.state == gophermart.DeliveryDelivered {
+				assert.Empty(t, result.Attempt.Error)
+				assert.True(t, result.NextAttemptAt.IsZero())
+			} else {
+				assert.NotEmpty(t, result.Attempt.Error)
+				assert.Equal(t, result.Attempt.CreatedAt.Add(svc.delivery.backoff(tt.failures)), result.NextAttemptAt)
+			}
+		})
+	}
+}
+
+func TestWebhookService_deliverForbidden(t *testing.T) {
+	var called, redirected atomic.Bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected.Store(true)
+	}))
+	defer target.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		allowPrivate bool
+		status       int
+		err          string
+		called       bool
+	}{
+		//host name of registered webhook can be resolved to internal address later
+		{name: "internal address is refused on connection", err: "address of webhook is not public"},
+		{name: "redirect is not followed", allowPrivate: true, status: http.StatusFound, err: "unexpected status", called: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called.Store(false)
+			redirected.Store(false)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var result gophermart.DeliveryResultRequest
+			rep := NewMockWebhookRepository(ctrl)
+			rep.EXPECT().SaveDeliveryResult(gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, dto gophermart.DeliveryResultRequest) error {
+					result = dto
+					return nil
+				})
+
+			svc := NewWebhookService(WebhookServiceConfig{WebhookRepository: rep, AllowPrivateNetworks: tt.allowPrivate})
+			svc.deliver(context.Background(), gophermart.Delivery{ID: 1, URL: srv.URL, Secret: "whsec_test"})
+
+			assert.Equal(t, tt.called, called.Load())
+			assert.False(t, redirected.Load())
+			assert.Equal(t, tt.status, result.Attempt.StatusCode)
+			assert.Contains(t, result.Attempt.Error, tt.err)
+		})
+	}
+}
+
+func TestWebhookService_deliverCanceled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	//result is not saved, delivery is claimed again after lease
+	rep := NewMockWebhookRepository(ctrl)
+	svc := NewWebhookService(WebhookServiceConfig{WebhookRepository: rep})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	svc.deliver(ctx, gophermart.Delivery{ID: 1, URL: "http://127.0.0.1:1"})
+}
+
+func TestDeliveryConfig_backoff(t *testing.T) {
+	c := deliveryConfig{baseDelay: 10 * time.Second, maxDelay: time.Minute}
+
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, w := range want {
+		assert.Equal(t, w, c.backoff(i+1), "failures %d", i+1)
+	}
+	assert.Equal(t, time.Minute, c.backoff(100))
+}
+
+func TestSign(t *testing.T) {
+	ts := time.Unix(1700000000, 0)
+	sign := Sign("secret", ts, []byte(`{"id":1}`))
+
+	assert.True(t, strings.HasPrefix(sign, "t=1700000000,v1="))
+	assert.NotEqual(t, sign, Sign("another", ts, []byte(`{"id":1}`)))
+	assert.NotEqual(t, sign, Sign("secret", ts.Add(time.Second), []byte(`{"id":1}`)))
+}
@@ -3,11 +3,11 @@ package withdrawal
 import (
 	"context"
 	"errors"
-	"math"
-	"sort"
 
 	"github.com/vilasle/gophermart/internal/repository/gophermart"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/cursor"
+	"github.com/vilasle/gophermart/internal/tool/money"
 	"github.com/vilasle/gophermart/internal/tool/order/validation"
 )
 
@@ -41,17 +41,43 @@ func (s WithdrawalService) Withdraw(ctx context.Context, dto service.WithdrawalR
 	return err
 }
 
-func (s WithdrawalService) List(ctx context.Context, dto service.WithdrawalListRequest) ([]service.WithdrawalInfo, error) {
+func (s WithdrawalService) List(ctx context.Context, dto service.WithdrawalListRequest) (service.WithdrawalList, error) {
 	if dto.UserID == "" {
-		return []service.WithdrawalInfo{}, service.ErrInvalidFormat
+		return service.WithdrawalList{}, service.ErrInvalidFormat
 	}
 
-	r, err := s.rep.Transactions(ctx, gophermart.TransactionRequest{UserID: dto.UserID})
+	limit, after, err := dto.Page.Bounds()
+	if err != nil {
+		return service.WithdrawalList{}, err
+	}
+
+	if !dto.From.IsZero() && !dto.To.IsZero() && !dto.From.Before(dto.To) {
+		return service.WithdrawalList{}, service.ErrInvalidFormat
+	}
+
+	//one more transaction shows that there is next page
+	r, err := s.rep.Transactions(ctx, gophermart.TransactionRequest{
+		UserID:     dto.UserID,
+		Kind:       gophermart.TransactionExpense,
+		From:       dto.From,
+		To:         dto.To,
+		Limit:      limit + 1,
+		After:      after,
+		Descending: dto.Page.Descending,
+	})
 	if err != nil {
-		return []service.WithdrawalInfo{}, err
+		return service.WithdrawalList{}, err
+	}
+
+	list := service.WithdrawalList{}
+	if len(r) > limit {
+		r = r[:limit]
+		last := r[limit-1]
+		list.Next = cursor.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.String()
 	}
+	list.Withdrawals = prepareWithdrawalsInfo(r)
 
-	return prepareWithdrawalsInfo(r), nil
+	return list, nil
 }
 
 func prepareWithdrawalsInfo(transactions []gophermart.Transaction) []service.WithdrawalInfo {
@@ -64,13 +90,10 @@ func prepareWithdrawalsInfo(transactions []gophermart.Transaction) []service.Wit
 
 		result = append(result, service.WithdrawalInfo{
 			OrderNumber: t.OrderNumber,
-			Sum:         math.Round(t.Sum*100) / 100,
+			Sum:         t.Sum,
 			CreatedAt:   t.CreatedAt,
 		})
 	}
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].CreatedAt.Before(result[j].CreatedAt)
-	})
 	return result
 }
 
@@ -86,6 +109,42 @@ func (s WithdrawalService) Balance(ctx context.Context, dto service.UserBalanceR
 	return calculateBalance(r), nil
 }
 
+func (s WithdrawalService) Statement(ctx context.Context, dto service.StatementRequest) ([]service.StatementEntry, error) {
+	if dto.UserID == "" {
+		return nil, service.ErrInvalidFormat
+	}
+
+	//transactions are ordered by time when they were posted
+	r, err := s.rep.Transactions(ctx, gophermart.TransactionRequest{UserID: dto.UserID})
+	if err != nil {
+		return nil, err
+	}
+
+	return prepareStatement(r), nil
+}
+
+func prepareStatement(transactions []gophermart.Transaction) []service.StatementEntry {
+	result := make([]service.StatementEntry, 0, len(transactions))
+
+	var balance money.Money
+	for _, t := range transactions {
+		sum := t.Sum.Abs()
+		if !t.Income {
+			sum = -sum
+		}
+		balance += sum
+
+		result = append(result, service.StatementEntry{
+			OrderNumber: t.OrderNumber,
+			Income:      t.Income,
+			Sum:         sum,
+			Balance:     balance,
+			CreatedAt:   t.CreatedAt,
+		})
+	}
+	return result
+}
+
 func calculateBalance(transactions []gophermart.Transaction) service.UserBalance {
 	balance := service.UserBalance{}
 	for _, h := range transactions {
@@ -96,15 +155,10 @@ func calculateBalance(transactions []gophermart.Transaction) service.UserBalance
 		}
 	}
 
-	if balance.Withdrawn < 0 {
-		balance.Withdrawn = -balance.Withdrawn
-	}
+	balance.Withdrawn = balance.Withdrawn.Abs()
 
 	balance.Current -= balance.Withdrawn
 
-	balance.Current = math.Round(balance.Current*100) / 100
-	balance.Withdrawn = math.Round(balance.Withdrawn*100) / 100
-
 	return balance
 
 }
@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/vilasle/gophermart/internal/repository/gophermart"
 	"github.com/vilasle/gophermart/internal/service"
+	"github.com/vilasle/gophermart/internal/tool/cursor"
+	"github.com/vilasle/gophermart/internal/tool/money"
 )
 
 func TestWithdrawalService_Withdraw(t *testing.T) {
@@ -55,14 +58,14 @@ func TestWithdrawalService_Withdraw(t *testing.T) {
 				dto: service.WithdrawalRequest{
 					UserID:      "123456",
 					OrderNumber: "31048580869",
-					Sum:         100,
+					Sum:         money.FromInt(100),
 				},
 			},
 			mockSetting: mockSetting{
 				dtoIn: gophermart.WithdrawalRequest{
 					UserID:      "123456",
 					OrderNumber: "31048580869",
-					Sum:         100,
+					Sum:         money.FromInt(100),
 				},
 				errOut: gophermart.ErrNotEnoughPoints,
 				setup: func(m *MockWithdrawalRepository, ctx context.Context, dto gophermart.WithdrawalRequest, err error) {
@@ -78,14 +81,14 @@ func TestWithdrawalService_Withdraw(t *testing.T) {
 				dto: service.WithdrawalRequest{
 					UserID:      "123456",
 					OrderNumber: "31048580869",
-					Sum:         100,
+					Sum:         money.FromInt(100),
 				},
 			},
 			mockSetting: mockSetting{
 				dtoIn: gophermart.WithdrawalRequest{
 					UserID:      "123456",
 					OrderNumber: "31048580869",
-					Sum:         100,
+					Sum:         money.FromInt(100),
 				},
 				errOut: repErr,
 				setup: func(m *MockWithdrawalRepository, ctx context.Context, dto gophermart.WithdrawalRequest, err error) {
@@ -101,14 +104,14 @@ func TestWithdrawalService_Withdraw(t *testing.T) {
 				dto: service.WithdrawalRequest{
 					UserID:      "123456",
 					OrderNumber: "31048580869",
-					Sum:         100,
+					Sum:         money.FromInt(100),
 				},
 			},
 			mockSetting: mockSetting{
 				dtoIn: gophermart.WithdrawalRequest{
 					UserID:      "123456",
 					OrderNumber: "31048580869",
-					Sum:         100,
+					Sum:         money.FromInt(100),
 				},
 				errOut: nil,
 				setup: func(m *MockWithdrawalRepository, ctx context.Context, dto gophermart.WithdrawalRequest, err error) {
@@ -153,10 +156,12 @@ func TestWithdrawalService_List(t *testing.T) {
 	}
 
 	type want struct {
-		dto []service.WithdrawalInfo
+		dto service.WithdrawalList
 		err error
 	}
 
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
 	repErr := errors.New("repository error")
 
 	tests := []struct {
@@ -194,6 +199,8 @@ func TestWithdrawalService_List(t *testing.T) {
 			mockSetting: mockSetting{
 				dtoIn: gophermart.TransactionRequest{
 					UserID: "123456",
+					Kind:   gophermart.TransactionExpense,
+					Limit:  service.MaxPageLimit + 1,
 				},
 				errOut: repErr,
 				setup: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.TransactionRequest, dtoOut []gophermart.Transaction, err error) {
@@ -215,25 +222,27 @@ func TestWithdrawalService_List(t *testing.T) {
 			mockSetting: mockSetting{
 				dtoIn: gophermart.TransactionRequest{
 					UserID: "123456",
+					Kind:   gophermart.TransactionExpense,
+					Limit:  service.MaxPageLimit + 1,
 				},
 				dtoOut: []gophermart.Transaction{
 					{
 						Income:      true,
 						UserID:      "123456",
 						OrderNumber: "954323",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 					{
 						Income:      true,
 						UserID:      "123456",
 						OrderNumber: "4323",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 					{
 						Income:      true,
 						UserID:      "123456",
 						OrderNumber: "34534523",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 				},
 				errOut: nil,
@@ -242,7 +251,7 @@ func TestWithdrawalService_List(t *testing.T) {
 				},
 			},
 			want: want{
-				dto: []service.WithdrawalInfo{},
+				dto: service.WithdrawalList{Withdrawals: []service.WithdrawalInfo{}},
 				err: nil,
 			},
 		},
@@ -257,43 +266,45 @@ func TestWithdrawalService_List(t *testing.T) {
 			mockSetting: mockSetting{
 				dtoIn: gophermart.TransactionRequest{
 					UserID: "123456",
+					Kind:   gophermart.TransactionExpense,
+					Limit:  service.MaxPageLimit + 1,
 				},
 				dtoOut: []gophermart.Transaction{
 					{
 						Income:      true,
 						UserID:      "123456",
 						OrderNumber: "954323",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 					{
 						Income:      true,
 						UserID:      "123456",
 						OrderNumber: "4323",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 					{
 						Income:      true,
 						UserID:      "123456",
 						OrderNumber: "34534523",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 					{
 						Income:      false,
 						UserID:      "123456",
 						OrderNumber: "954323",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 					{
 						Income:      false,
 						UserID:      "123456",
 						OrderNumber: "4323",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 					{
 						Income:      false,
 						UserID:      "123456",
 						OrderNumber: "34534523",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 				},
 				errOut: nil,
@@ -302,23 +313,95 @@ func TestWithdrawalService_List(t *testing.T) {
 				},
 			},
 			want: want{
-				dto: []service.WithdrawalInfo{
+				dto: service.WithdrawalList{Withdrawals: []service.WithdrawalInfo{
 					{
 						OrderNumber: "954323",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 					{
 						OrderNumber: "4323",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 					{
 						OrderNumber: "34534523",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
-				},
+				}},
 				err: nil,
 			},
 		},
+		{
+			name: "invalid limit",
+			args: args{
+				ctx: context.Background(),
+				dto: service.WithdrawalListRequest{
+					UserID: "123456",
+					Page:   service.PageRequest{Limit: service.MaxPageLimit + 1},
+				},
+			},
+			mockSetting: mockSetting{
+				setup: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.TransactionRequest, dtoOut []gophermart.Transaction, err error) {
+				},
+			},
+			want: want{
+				err: service.ErrInvalidFormat,
+			},
+		},
+		{
+			name: "invalid cursor",
+			args: args{
+				ctx: context.Background(),
+				dto: service.WithdrawalListRequest{
+					UserID: "123456",
+					Page:   service.PageRequest{After: "not a cursor"},
+				},
+			},
+			mockSetting: mockSetting{
+				setup: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.TransactionRequest, dtoOut []gophermart.Transaction, err error) {
+				},
+			},
+			want: want{
+				err: service.ErrInvalidFormat,
+			},
+		},
+		{
+			name: "there is next page",
+			args: args{
+				ctx: context.Background(),
+				dto: service.WithdrawalListRequest{
+					UserID: "123456",
+					Page: service.PageRequest{
+						Limit:      1,
+						After:      cursor.Cursor{CreatedAt: createdAt, ID: 1}.String(),
+						Descending: true,
+					},
+				},
+			},
+			mockSetting: mockSetting{
+				dtoIn: gophermart.TransactionRequest{
+					UserID:     "123456",
+					Kind:       gophermart.TransactionExpense,
+					Limit:      2,
+					After:      cursor.Cursor{CreatedAt: createdAt, ID: 1},
+					Descending: true,
+				},
+				dtoOut: []gophermart.Transaction{
+					{ID: 7, UserID: "123456", OrderNumber: "4323", Sum: money.FromInt(-100), CreatedAt: createdAt.Add(-time.Hour)},
+					{ID: 5, UserID: "123456", OrderNumber: "954323", Sum: money.FromInt(-100), CreatedAt: createdAt.Add(-2 * time.Hour)},
+				},
+				setup: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.TransactionRequest, dtoOut []gophermart.Transaction, err error) {
+					m.EXPECT().Transactions(ctx, dtoIn).Return(dtoOut, err)
+				},
+			},
+			want: want{
+				dto: service.WithdrawalList{
+					Withdrawals: []service.WithdrawalInfo{
+						{OrderNumber: "4323", Sum: money.FromInt(-100), CreatedAt: createdAt.Add(-time.Hour)},
+					},
+					Next: cursor.Cursor{CreatedAt: createdAt.Add(-time.Hour), ID: 7}.String(),
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -332,7 +415,7 @@ func TestWithdrawalService_List(t *testing.T) {
 			got, err := s.List(tt.args.ctx, tt.args.dto)
 
 			if tt.want.err != nil {
-				assert.Error(t, err, tt.want.err)
+				assert.ErrorIs(t, err, tt.want.err)
 			} else {
 				assert.NoError(t, err)
 				assert.Equal(t, tt.want.dto, got)
@@ -425,25 +508,25 @@ func TestWithdrawalService_Balance(t *testing.T) {
 						Income:      false,
 						UserID:      "12345",
 						OrderNumber: "12345",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 					{
 						Income:      true,
 						UserID:      "12345",
 						OrderNumber: "12345",
-						Sum:         2000,
+						Sum:         money.FromInt(2000),
 					},
 					{
 						Income:      false,
 						UserID:      "12345",
 						OrderNumber: "12345",
-						Sum:         1000,
+						Sum:         money.FromInt(1000),
 					},
 					{
 						Income:      true,
 						UserID:      "12345",
 						OrderNumber: "12345",
-						Sum:         100,
+						Sum:         money.FromInt(100),
 					},
 				},
 				errOut: nil,
@@ -453,12 +536,38 @@ func TestWithdrawalService_Balance(t *testing.T) {
 			},
 			want: want{
 				dto: service.UserBalance{
-					Withdrawn: 1100,
-					Current: 1000,
+					Withdrawn: money.FromInt(1100),
+					Current: money.FromInt(1000),
 				},
 				err:     nil,
 			},
 		},
+		{
+			name: "fractional sums do not drift",
+			args: args{
+				ctx: context.Background(),
+				dto: service.UserBalanceRequest{
+					UserID: "12345",
+				},
+			},
+			mockSetting: mockSetting{
+				dtoIn: gophermart.TransactionRequest{
+					UserID: "12345",
+				},
+				dtoOut: fractionalTransactions("12345", 1000, money.FromMinor(10)),
+				errOut: nil,
+				setup: func(m *MockWithdrawalRepository, ctx context.Context, dtoIn gophermart.TransactionRequest, dtoOut []gophermart.Transaction, err error) {
+					m.EXPECT().Transactions(ctx, dtoIn).Return(dtoOut, err)
+				},
+			},
+			want: want{
+				dto: service.UserBalance{
+					Withdrawn: money.FromMinor(30),
+					Current:   money.FromMinor(9970),
+				},
+				err: nil,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -482,3 +591,87 @@ func TestWithdrawalService_Balance(t *testing.T) {
 		})
 	}
 }
+
+// fractionalTransactions returns qty incomes of sum and 3 expenses of sum
+func fractionalTransactions(userID string, qty int, sum money.Money) []gophermart.Transaction {
+	result := make([]gophermart.Transaction, 0, qty+3)
+	for i := 0; i < qty; i++ {
+		result = append(result, gophermart.Transaction{Income: true, UserID: userID, Sum: sum})
+	}
+	for i := 0; i < 3; i++ {
+		result = append(result, gophermart.Transaction{Income: false, UserID: userID, Sum: -sum})
+	}
+	return result
+}
+
+func TestWithdrawalService_Statement(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	repErr := errors.New("repository error")
+
+	tests := []struct {
+		name   string
+		dto    service.StatementRequest
+		mock   bool
+		dtoOut []gophermart.Transaction
+		errOut error
+		want   []service.StatementEntry
+		err    error
+	}{
+		{
+			name: "invalid format",
+			err:  service.ErrInvalidFormat,
+		},
+		{
+			name:   "unknown repository error",
+			dto:    service.StatementRequest{UserID: "123456"},
+			mock:   true,
+			errOut: repErr,
+			err:    repErr,
+		},
+		{
+			name:   "there are no transactions",
+			dto:    service.StatementRequest{UserID: "123456"},
+			mock:   true,
+			dtoOut: []gophermart.Transaction{},
+			want:   []service.StatementEntry{},
+		},
+		{
+			name: "running balance",
+			dto:  service.StatementRequest{UserID: "123456"},
+			mock: true,
+			dtoOut: []gophermart.Transaction{
+				{Income: true, OrderNumber: "954323", Sum: money.FromInt(100), CreatedAt: createdAt},
+				{Income: false, OrderNumber: "4323", Sum: money.FromInt(-30), CreatedAt: createdAt.Add(time.Hour)},
+				{Income: true, OrderNumber: "34534523", Sum: money.FromMinor(1050), CreatedAt: createdAt.Add(2 * time.Hour)},
+			},
+			want: []service.StatementEntry{
+				{Income: true, OrderNumber: "954323", Sum: money.FromInt(100), Balance: money.FromInt(100), CreatedAt: createdAt},
+				{Income: false, OrderNumber: "4323", Sum: money.FromInt(-30), Balance: money.FromInt(70), CreatedAt: createdAt.Add(time.Hour)},
+				{Income: true, OrderNumber: "34534523", Sum: money.FromMinor(1050), Balance: money.FromMinor(8050), CreatedAt: createdAt.Add(2 * time.Hour)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mock := NewMockWithdrawalRepository(ctrl)
+			if tt.mock {
+				mock.EXPECT().
+					Transactions(gomock.Any(), gophermart.TransactionRequest{UserID: tt.dto.UserID}).
+					Return(tt.dtoOut, tt.errOut)
+			}
+
+			s := NewWithdrawalService(mock)
+
+			got, err := s.Statement(context.Background(), tt.dto)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
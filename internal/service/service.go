@@ -5,10 +5,28 @@ import "context"
 type AuthorizationService interface {
 	//can return defined errors ErrInvalidFormat, ErrDuplicate and undefined error
 	Register(context.Context, RegisterRequest) (UserInfo, error)
-	//can return defined errors ErrInvalidFormat, ErrWrongNameOrPassword and undefined error
+	//can return defined errors ErrInvalidFormat, ErrWrongNameOrPassword, LimitError and undefined error
 	Authorize(context.Context, AuthorizeRequest) (UserInfo, error)
 	//can return defined errors                              and undefined error
 	CheckByUserID(context.Context, string) error
+	//starts new session of user and returns data for access and refresh tokens.
+	//can return defined errors ErrInvalidFormat, ErrEntityDoesNotExists and undefined error
+	CreateSession(context.Context, string) (SessionInfo, error)
+	//rotates refresh token. Reuse of refresh token revokes all tokens of user.
+	//can return defined errors ErrInvalidFormat, ErrInvalidToken and undefined error
+	RefreshSession(context.Context, RefreshSessionRequest) (SessionInfo, error)
+	//can return defined errors ErrInvalidFormat, ErrInvalidToken and undefined error
+	CheckToken(context.Context, CheckTokenRequest) error
+	//revokes access token and refresh token of current session. Can return ErrInvalidFormat and undefined error
+	Logout(context.Context, LogoutRequest) error
+	//revokes all tokens of user. Can return ErrInvalidFormat and undefined error
+	LogoutAll(context.Context, string) error
+	//changes password and revokes all tokens of user.
+	//can return defined errors ErrInvalidFormat, ErrWrongPassword, ErrEntityDoesNotExists and undefined error
+	ChangePassword(context.Context, ChangePasswordRequest) error
+	//anonymizes user and forfeits its balance, history of transactions is kept.
+	//can return defined errors ErrInvalidFormat, ErrEntityDoesNotExists and undefined error
+	DeleteAccount(context.Context, string) (DeletedAccountInfo, error)
 }
 
 type OrderService interface {
@@ -16,21 +34,62 @@ type OrderService interface {
 	//and undefined error
 	Register(context.Context, RegisterOrderRequest) error
 	//can return undefined error
-	List(context.Context, ListOrderRequest) ([]OrderInfo, error)
+	List(context.Context, ListOrderRequest) (OrderList, error)
+	//can return defined errors ErrInvalidFormat, ErrWrongNumberOfOrder, ErrOrderNotFound, ErrOrderOfAnotherUser
+	//and undefined error
+	Order(context.Context, OrderRequest) (OrderDetails, error)
+	//returns changes of user orders after event AfterID in order of id, the quantity of events is limited,
+	//so it should be called until result is empty. Can return defined errors ErrInvalidFormat and undefined error
+	Events(context.Context, OrderEventsRequest) ([]OrderEvent, error)
+	//returns channel which gets signal when orders of user are changed, cancel releases subscription
+	Subscribe(userID string) (<-chan struct{}, func())
+	//applies status of order which is pushed by accrual service, final status of order is not changed.
+	//Can return defined errors ErrInvalidFormat, ErrOrderNotFound and undefined error
+	ApplyAccrual(context.Context, AccrualsInfo) error
 }
 
 type WithdrawalService interface {
 	//can return undefined error  // TODO: mb we should add error  402 — на счету недостаточно средств?
 	Withdraw(context.Context, WithdrawalRequest) error
 	//can return defined errors ErrInvalidFormat, ErrDuplicate and undefined error
-	List(context.Context, WithdrawalListRequest) ([]WithdrawalInfo, error)
+	List(context.Context, WithdrawalListRequest) (WithdrawalList, error)
 	//can return undefined error
 	Balance(context.Context, UserBalanceRequest) (UserBalance, error)
+	//returns all credits and debits of user in chronological order with running balance,
+	//can return defined errors ErrInvalidFormat and undefined error
+	Statement(context.Context, StatementRequest) ([]StatementEntry, error)
+}
+
+type WebhookService interface {
+	//returns webhook with secret which signs payloads, can return defined errors ErrInvalidFormat and undefined error
+	Register(context.Context, RegisterWebhookRequest) (WebhookInfo, error)
+	//can return defined errors ErrInvalidFormat and undefined error
+	List(context.Context, string) ([]WebhookInfo, error)
+	//can return defined errors ErrInvalidFormat, ErrWebhookNotFound and undefined error
+	Delete(context.Context, WebhookRequest) error
+	//returns the last deliveries of webhook with their attempts,
+	//can return defined errors ErrInvalidFormat, ErrWebhookNotFound and undefined error
+	Deliveries(context.Context, WebhookRequest) ([]DeliveryInfo, error)
+	//sends delivery again, can return defined errors ErrInvalidFormat, ErrWebhookNotFound and undefined error
+	Redeliver(context.Context, RedeliveryRequest) error
+}
+
+type IdempotencyService interface {
+	//reserves key for the first request or returns saved response (replay is true) for retries
+	//can return defined errors ErrInvalidFormat, ErrIdempotencyKeyReused, ErrIdempotencyKeyInProgress and undefined error
+	Start(ctx context.Context, dto IdempotencyRequest) (resp IdempotentResponse, replay bool, err error)
+	//saves response of the first request. Can return undefined error
+	Complete(context.Context, IdempotencyRequest, IdempotentResponse) error
+	//releases key when the first request was failed and retry must be processed again. Can return undefined error
+	Cancel(context.Context, IdempotencyRequest) error
 }
 
 type AccrualService interface {
 	//can return defined errors ErrEntityDoesNotExists, ErrLimit, ErrInvalidFormat, ErrUnexpected and undefined error
 	Accruals(context.Context, AccrualsFilterRequest) (AccrualsInfo, error)
+	//returns information about known orders of batch, unknown orders are omitted.
+	//Can return defined errors ErrNotSupported, ErrLimit, ErrInvalidFormat, ErrUnexpected and undefined error
+	BatchAccruals(context.Context, AccrualsBatchRequest) ([]AccrualsInfo, error)
 }
 
 type CalculationService interface {
@@ -38,9 +97,21 @@ type CalculationService interface {
 	Register(context.Context, RegisterCalculationRequest) error
 	//Return information about calculation. Can return defined errors ErrInvalidFormat, ErrDuplicate and undefined error
 	Calculation(context.Context, CalculationFilterRequest) (CalculationInfo, error)
+	//Return information about known orders of batch, unknown orders are omitted. Can return defined error ErrInvalidFormat and undefined error
+	Calculations(context.Context, CalculationsFilterRequest) ([]CalculationInfo, error)
+	//Return calculation with rules which gave reward for order. Can return defined error ErrEntityDoesNotExists and undefined error
+	Breakdown(context.Context, CalculationFilterRequest) (CalculationBreakdown, error)
 }
 
 type CalculationRuleService interface {
 	//can return defined errors ErrInvalidFormat, ErrDuplicate and undefined error
 	Register(context.Context, RegisterCalculationRuleRequest) error
+	//Return all rules including disabled and expired ones
+	Rules(context.Context) ([]CalculationRuleInfo, error)
+	//Replace rule. Can return defined errors ErrInvalidFormat, ErrDuplicate, ErrRuleNotFound and undefined error
+	Update(context.Context, UpdateCalculationRuleRequest) error
+	//Disabled rule is kept but not applied. Can return defined error ErrRuleNotFound and undefined error
+	SetDisabled(context.Context, DisableCalculationRuleRequest) error
+	//can return defined error ErrRuleNotFound and undefined error
+	Delete(context.Context, DeleteCalculationRuleRequest) error
 }
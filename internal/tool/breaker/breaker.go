@@ -0,0 +1,148 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	// Closed passes all requests and counts failures in a row
+	Closed State = iota
+	// Open rejects requests until open timeout expires
+	Open
+	// HalfOpen passes one probe request at a time, success closes breaker and failure opens it again
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type Config struct {
+	//breaker is opened after this quantity of failures in a row
+	Failures int
+	//how long breaker is open before probe request is passed
+	OpenTimeout time.Duration
+	//is called under lock of breaker, so it must not call breaker
+	OnStateChange func(from, to State)
+}
+
+// Breaker is safe for concurrent use. Each allowed request must be reported by Success, Failure or Release
+type Breaker struct {
+	mx       *sync.Mutex
+	config   Config
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+func New(config Config) *Breaker {
+	if config.Failures <= 0 {
+		config.Failures = 5
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	return &Breaker{
+		mx:     &sync.Mutex{},
+		config: config,
+		state:  Closed,
+		now:    time.Now,
+	}
+}
+
+// Allow returns ErrOpen if request must not be sent
+func (b *Breaker) Allow() error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.config.OpenTimeout {
+			return ErrOpen
+		}
+		b.setState(HalfOpen)
+	case HalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+	default:
+		return nil
+	}
+
+	b.probing = true
+	return nil
+}
+
+func (b *Breaker) Success() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.failures = 0
+	if b.state == HalfOpen {
+		b.probing = false
+		b.setState(Closed)
+	}
+}
+
+func (b *Breaker) Failure() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	switch b.state {
+	case HalfOpen:
+		b.probing = false
+		b.open()
+	case Closed:
+		b.failures++
+		if b.failures >= b.config.Failures {
+			b.open()
+		}
+	}
+}
+
+// Release reports request without result, e.g. it was canceled by caller
+func (b *Breaker) Release() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	if b.state == HalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.state
+}
+
+func (b *Breaker) open() {
+	b.failures = 0
+	b.openedAt = b.now()
+	b.setState(Open)
+}
+
+func (b *Breaker) setState(state State) {
+	from := b.state
+	b.state = state
+	if b.config.OnStateChange != nil && from != state {
+		b.config.OnStateChange(from, state)
+	}
+}
@@ -0,0 +1,50 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points to the last row of page. Rows are ordered by creation time and id,
+// so page after cursor is stable when new rows are added
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+func (c Cursor) IsZero() bool {
+	return c.CreatedAt.IsZero() && c.ID == 0
+}
+
+// String returns opaque value of cursor for clients
+func (c Cursor) String() string {
+	if c.IsZero() {
+		return ""
+	}
+	//database keeps microseconds
+	raw := fmt.Sprintf("%d:%d", c.CreatedAt.UnixMicro(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// Parse reads value of String, empty value is zero cursor
+func Parse(s string) (Cursor, error) {
+	if s == "" {
+		return Cursor{}, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var micro, id int64
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &micro, &id); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{CreatedAt: time.UnixMicro(micro).UTC(), ID: id}, nil
+}
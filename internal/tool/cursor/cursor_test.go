@@ -0,0 +1,25 @@
+package cursor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursor(t *testing.T) {
+	c := Cursor{CreatedAt: time.Date(2024, 5, 1, 10, 20, 30, 123456000, time.UTC), ID: 42}
+
+	got, err := Parse(c.String())
+	require.NoError(t, err)
+	assert.Equal(t, c, got)
+
+	empty, err := Parse("")
+	require.NoError(t, err)
+	assert.True(t, empty.IsZero())
+	assert.Equal(t, "", Cursor{}.String())
+
+	_, err = Parse("not a cursor")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
@@ -0,0 +1,216 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is a fixed-point amount of points stored in hundredths (minor units)
+type Money int64
+
+const scale = 100
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// FromInt returns amount of whole points
+func FromInt(v int64) Money {
+	return Money(v * scale)
+}
+
+// FromMinor returns amount from hundredths of point
+func FromMinor(v int64) Money {
+	return Money(v)
+}
+
+// FromFloat rounds value to hundredths, it is only for boundaries with float API
+func FromFloat(v float64) Money {
+	return Money(math.Round(v * scale))
+}
+
+// Parse reads decimal string exactly, digits after second fractional one are rounded half away from zero
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, ErrInvalidAmount
+	}
+	if !onlyDigits(intPart) || !onlyDigits(fracPart) {
+		return 0, ErrInvalidAmount
+	}
+
+	var units int64
+	if intPart != "" {
+		v, err := strconv.ParseInt(intPart, 10, 64)
+		if err != nil || v > math.MaxInt64/scale-1 {
+			return 0, ErrInvalidAmount
+		}
+		units = v
+	}
+
+	var minor int64
+	for i := 0; i < 2; i++ {
+		minor *= 10
+		if i < len(fracPart) {
+			minor += int64(fracPart[i] - '0')
+		}
+	}
+	if len(fracPart) > 2 && fracPart[2] >= '5' {
+		minor++
+	}
+
+	v := Money(units*scale + minor)
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+func onlyDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Minor returns amount in hundredths of point
+func (m Money) Minor() int64 {
+	return int64(m)
+}
+
+// Float64 is only for boundaries with float API, do not use it for arithmetic
+func (m Money) Float64() float64 {
+	return float64(m) / scale
+}
+
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// Percent returns p percent of amount, p is amount too (e.g. 7.5% is 7.50), result is rounded half away from zero
+func (m Money) Percent(p Money) Money {
+	num := int64(m) * int64(p)
+	den := int64(scale * 100)
+
+	q, r := num/den, num%den
+	if r < 0 {
+		r = -r
+	}
+	if r*2 >= den {
+		if num < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Money(q)
+}
+
+// String returns decimal view without trailing zeros, e.g. 100, 12.5, 0.01
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign, v = "-", -v
+	}
+
+	units, minor := v/scale, v%scale
+	switch {
+	case minor == 0:
+		return fmt.Sprintf("%s%d", sign, units)
+	case minor%10 == 0:
+		return fmt.Sprintf("%s%d.%d", sign, units, minor/10)
+	default:
+		return fmt.Sprintf("%s%d.%02d", sign, units, minor)
+	}
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+
+	//json allows exponent form, it is rare for money, but clients can send it
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return ErrInvalidAmount
+		}
+		*m = FromFloat(f)
+		return nil
+	}
+
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Value stores amount as decimal text, it is suitable for NUMERIC columns
+func (m Money) Value() (driver.Value, error) {
+	return fmt.Sprintf("%s%d.%02d", signOf(m), m.Abs()/scale, m.Abs()%scale), nil
+}
+
+func signOf(m Money) string {
+	if m < 0 {
+		return "-"
+	}
+	return ""
+}
+
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = FromInt(v)
+	case float64:
+		*m = FromFloat(v)
+	case float32:
+		*m = FromFloat(float64(v))
+	case string:
+		r, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*m = r
+	case []byte:
+		r, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*m = r
+	default:
+		return fmt.Errorf("can not scan %T to money", src)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{name: "integer", in: "500", want: 50000},
+		{name: "one digit fraction", in: "500.5", want: 50050},
+		{name: "two digits fraction", in: "729.98", want: 72998},
+		{name: "round up", in: "0.005", want: 1},
+		{name: "round down", in: "0.0049", want: 0},
+		{name: "negative", in: "-12.34", want: -1234},
+		{name: "without integer part", in: ".5", want: 50},
+		{name: "empty", in: "", wantErr: true},
+		{name: "letters", in: "12a", wantErr: true},
+		{name: "only dot", in: ".", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{in: 50000, want: "500"},
+		{in: 50050, want: "500.5"},
+		{in: 72998, want: "729.98"},
+		{in: 1, want: "0.01"},
+		{in: -1234, want: "-12.34"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.in.String())
+	}
+}
+
+func TestMoney_Percent(t *testing.T) {
+	assert.Equal(t, FromInt(10), FromInt(100).Percent(FromInt(10)))
+	assert.Equal(t, Money(75), FromInt(10).Percent(Money(750)))
+	//33.33% of 0.10 = 0.03333 -> 0.03
+	assert.Equal(t, Money(3), Money(10).Percent(Money(3333)))
+	//50% of 0.05 = 0.025 -> 0.03
+	assert.Equal(t, Money(3), Money(5).Percent(FromInt(50)))
+}
+
+func TestMoney_JSON(t *testing.T) {
+	v := struct {
+		Sum Money `json:"sum"`
+	}{}
+
+	require.NoError(t, json.Unmarshal([]byte(`{"sum": 751.1}`), &v))
+	assert.Equal(t, Money(75110), v.Sum)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"sum": 1e2}`), &v))
+	assert.Equal(t, FromInt(100), v.Sum)
+
+	data, err := json.Marshal(struct {
+		Sum Money `json:"sum"`
+	}{Sum: 75110})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sum": 751.1}`, string(data))
+}
+
+func TestMoney_Accumulation(t *testing.T) {
+	//the same sum in float64 drifts after many additions
+	var sum Money
+	for i := 0; i < 1000; i++ {
+		sum += FromMinor(10)
+	}
+	assert.Equal(t, FromInt(100), sum)
+}
+
+func TestMoney_Scan(t *testing.T) {
+	var m Money
+	require.NoError(t, m.Scan("123.45"))
+	assert.Equal(t, Money(12345), m)
+
+	require.NoError(t, m.Scan([]byte("-0.10")))
+	assert.Equal(t, Money(-10), m)
+
+	require.NoError(t, m.Scan(int64(7)))
+	assert.Equal(t, FromInt(7), m)
+
+	v, err := Money(-10).Value()
+	require.NoError(t, err)
+	assert.Equal(t, "-0.10", v)
+}
@@ -0,0 +1,99 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+const prefix = "$argon2id$"
+
+// Params of argon2id, they are encoded in hash, so hashes with old params can be verified and upgraded
+type Params struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultParams is the second recommended option of RFC 9106 with lower memory
+var DefaultParams = Params{Memory: 64 * 1024, Time: 3, Threads: 4, SaltLen: 16, KeyLen: 32}
+
+// Hash returns PHC string of argon2id hash with random salt, e.g.
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+func Hash(password string, p Params) ([]byte, error) {
+	salt := make([]byte, p.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+
+	encoded := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", prefix, argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+	return []byte(encoded), nil
+}
+
+// Verify checks password by hash. Unsalted SHA-256 hashes of old accounts are accepted too.
+// needsRehash is true for correct password when hash is legacy or was made with other params
+func Verify(password string, hash []byte, p Params) (ok, needsRehash bool, err error) {
+	if isLegacy(hash) {
+		legacy := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(legacy[:], hash) == 1, true, nil
+	}
+
+	hashParams, salt, key, err := decode(hash)
+	if err != nil {
+		return false, false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, hashParams.Time, hashParams.Memory, hashParams.Threads, hashParams.KeyLen)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+	return true, hashParams != p, nil
+}
+
+// isLegacy reports whether hash is raw sha256 which was stored before argon2id
+func isLegacy(hash []byte) bool {
+	return len(hash) == sha256.Size && !strings.HasPrefix(string(hash), prefix)
+}
+
+func decode(hash []byte) (p Params, salt, key []byte, err error) {
+	parts := strings.Split(string(hash), "$")
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+	return p, salt, key, nil
+}
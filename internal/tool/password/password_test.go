@@ -0,0 +1,66 @@
+package password
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testParams = Params{Memory: 1024, Time: 2, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestHash(t *testing.T) {
+	first, err := Hash("password", testParams)
+	require.NoError(t, err)
+	second, err := Hash("password", testParams)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(string(first), "$argon2id$v=19$m=1024,t=2,p=1$"))
+	//salt is random, so hashes of the same password differ
+	assert.NotEqual(t, first, second)
+}
+
+func TestVerify(t *testing.T) {
+	hash, err := Hash("password", testParams)
+	require.NoError(t, err)
+
+	legacy := sha256.Sum256([]byte("password"))
+
+	weakParams := testParams
+	weakParams.Time = 1
+	weak, err := Hash("password", weakParams)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		password    string
+		hash        []byte
+		ok          bool
+		needsRehash bool
+		wantErr     bool
+	}{
+		{name: "correct password", password: "password", hash: hash, ok: true},
+		{name: "wrong password", password: "another", hash: hash},
+		{name: "legacy hash", password: "password", hash: legacy[:], ok: true, needsRehash: true},
+		{name: "wrong password of legacy hash", password: "another", hash: legacy[:], needsRehash: true},
+		{name: "hash with other params", password: "password", hash: weak, ok: true, needsRehash: true},
+		{name: "broken hash", password: "password", hash: []byte("$argon2id$v=19$m=1024"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := Verify(tt.password, tt.hash, testParams)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidHash)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.needsRehash, needsRehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package signature
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	body := []byte(`{"order":"1"}`)
+	header := Sign("secret", now, body)
+
+	assert.NoError(t, Verify("secret", header, body, now.Add(time.Minute), 5*time.Minute))
+
+	assert.ErrorIs(t, Verify("another", header, body, now, 5*time.Minute), ErrInvalid)
+	assert.ErrorIs(t, Verify("secret", header, []byte(`{"order":"2"}`), now, 5*time.Minute), ErrInvalid)
+	//old signature is replayed
+	assert.ErrorIs(t, Verify("secret", header, body, now.Add(10*time.Minute), 5*time.Minute), ErrInvalid)
+	assert.ErrorIs(t, Verify("secret", "", body, now, 5*time.Minute), ErrInvalid)
+	assert.ErrorIs(t, Verify("secret", "t=1714557600,v1=zz", body, now, 5*time.Minute), ErrInvalid)
+}
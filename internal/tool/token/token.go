@@ -0,0 +1,200 @@
+package token
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+var ErrInvalidToken = errors.New("token is not valid")
+
+// Claims of access token
+type Claims struct {
+	jwt.RegisteredClaims
+	UserID string
+	// version of user tokens, logout from all devices increments it
+	Version int
+}
+
+// Key is used for signing and verifying of tokens. Key without private part is used only for verifying
+type Key struct {
+	ID     string
+	method jwt.SigningMethod
+	sign   any
+	verify any
+}
+
+func (k Key) canSign() bool {
+	return k.sign != nil
+}
+
+// NewHMACKey returns HS256 key. Empty id is replaced by hash of secret, so new secret gets new id
+func NewHMACKey(id string, secret []byte) Key {
+	if id == "" {
+		hash := sha256.Sum256(secret)
+		id = hex.EncodeToString(hash[:4])
+	}
+	return Key{ID: id, method: jwt.SigningMethodHS256, sign: secret, verify: secret}
+}
+
+// LoadKey reads key from file. PEM private key of RSA or Ed25519 is used for RS256 or EdDSA,
+// PEM public key is used only for verifying and any other content is secret of HS256.
+// Trailing line break of secret is dropped, editors and `echo` add it to file
+func LoadKey(id, path string) (Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Key{}, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		secret := bytes.TrimRight(data, "\r\n")
+		if len(secret) == 0 {
+			return Key{}, fmt.Errorf("key %s: secret is empty", path)
+		}
+		return NewHMACKey(id, secret), nil
+	}
+
+	if id == "" {
+		return Key{}, fmt.Errorf("key %s: id is required for asymmetric key", path)
+	}
+
+	key, err := parsePEM(block)
+	if err != nil {
+		return Key{}, fmt.Errorf("key %s: %w", path, err)
+	}
+	key.ID = id
+	return key, nil
+}
+
+func parsePEM(block *pem.Block) (Key, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		return Key{method: jwt.SigningMethodRS256, sign: private, verify: &private.PublicKey}, nil
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		switch v := private.(type) {
+		case *rsa.PrivateKey:
+			return Key{method: jwt.SigningMethodRS256, sign: v, verify: &v.PublicKey}, nil
+		case ed25519.PrivateKey:
+			return Key{method: jwt.SigningMethodEdDSA, sign: v, verify: v.Public()}, nil
+		}
+		return Key{}, fmt.Errorf("unsupported private key %T", private)
+	case "RSA PUBLIC KEY":
+		public, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		return Key{method: jwt.SigningMethodRS256, verify: public}, nil
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		switch v := public.(type) {
+		case *rsa.PublicKey:
+			return Key{method: jwt.SigningMethodRS256, verify: v}, nil
+		case ed25519.PublicKey:
+			return Key{method: jwt.SigningMethodEdDSA, verify: v}, nil
+		}
+		return Key{}, fmt.Errorf("unsupported public key %T", public)
+	}
+	return Key{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// Issuer signs access tokens by one key and verifies them by any of known keys.
+// Key rotation: add new key, switch signing to it, remove old key when its tokens expire
+type Issuer struct {
+	keys    map[string]Key
+	signing Key
+	exp     time.Duration
+}
+
+func NewIssuer(signingKeyID string, exp time.Duration, keys ...Key) (*Issuer, error) {
+	issuer := &Issuer{keys: make(map[string]Key, len(keys)), exp: exp}
+
+	for _, key := range keys {
+		if _, ok := issuer.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		issuer.keys[key.ID] = key
+	}
+
+	signing, ok := issuer.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, signingKeyID)
+	}
+	if !signing.canSign() {
+		return nil, fmt.Errorf("key %q can not be used for signing, it has not private part", signingKeyID)
+	}
+	issuer.signing = signing
+
+	return issuer, nil
+}
+
+// Issue signs new token of user and returns it with its expiration time
+func (i *Issuer) Issue(userID, tokenID string, version int) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(i.exp)
+
+	token := jwt.NewWithClaims(i.signing.method, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		UserID:  userID,
+		Version: version,
+	})
+	token.Header["kid"] = i.signing.ID
+
+	tokenString, err := token.SignedString(i.signing.sign)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expiresAt, nil
+}
+
+// Parse verifies token by key from its kid header and returns its claims
+func (i *Issuer) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := i.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+		}
+		// anti-hacker check, algorithm is defined by key, not by token
+		if t.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		return key.verify, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid || claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
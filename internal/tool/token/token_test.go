@@ -0,0 +1,178 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuer_IssueParse(t *testing.T) {
+	issuer, err := NewIssuer("k1", time.Minute, NewHMACKey("k1", []byte("secret")))
+	require.NoError(t, err)
+
+	tokenString, expiresAt, err := issuer.Issue("user", "jti", 3)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, time.Second)
+
+	claims, err := issuer.Parse(tokenString)
+	require.NoError(t, err)
+	assert.Equal(t, "user", claims.UserID)
+	assert.Equal(t, "jti", claims.ID)
+	assert.Equal(t, 3, claims.Version)
+}
+
+func TestIssuer_Rotation(t *testing.T) {
+	oldKey := NewHMACKey("old", []byte("old secret"))
+	newKey := NewHMACKey("new", []byte("new secret"))
+
+	before, err := NewIssuer("old", time.Minute, oldKey)
+	require.NoError(t, err)
+	oldToken, _, err := before.Issue("user", "jti", 0)
+	require.NoError(t, err)
+
+	//both keys are active, new tokens are signed by new key
+	during, err := NewIssuer("new", time.Minute, oldKey, newKey)
+	require.NoError(t, err)
+	_, err = during.Parse(oldToken)
+	assert.NoError(t, err)
+
+	newToken, _, err := during.Issue("user", "jti", 0)
+	require.NoError(t, err)
+	parsed, _ := jwt.Parse(newToken, nil)
+	assert.Equal(t, "new", parsed.Header["kid"])
+
+	//old key is removed
+	after, err := NewIssuer("new", time.Minute, newKey)
+	require.NoError(t, err)
+	_, err = after.Parse(oldToken)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = after.Parse(newToken)
+	assert.NoError(t, err)
+}
+
+func TestLoadKey_secret(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(path, []byte("secret\n"), 0o600))
+
+	//line break at the end of file is not part of secret
+	fromFile, err := LoadKey("k1", path)
+	require.NoError(t, err)
+	issuer, err := NewIssuer("k1", time.Minute, fromFile)
+	require.NoError(t, err)
+	tokenString, _, err := issuer.Issue("user", "jti", 0)
+	require.NoError(t, err)
+
+	verifier, err := NewIssuer("k1", time.Minute, NewHMACKey("k1", []byte("secret")))
+	require.NoError(t, err)
+	_, err = verifier.Parse(tokenString)
+	assert.NoError(t, err)
+
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(empty, []byte("\n"), 0o600))
+	_, err = LoadKey("k2", empty)
+	assert.Error(t, err)
+}
+
+func TestIssuer_Asymmetric(t *testing.T) {
+	dir := t.TempDir()
+
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edPath := writePEM(t, dir, "ed.pem", "PRIVATE KEY", mustPKCS8(t, edPrivate))
+	edPublicPath := writePEM(t, dir, "ed.pub", "PUBLIC KEY", mustPKIX(t, edPrivate.Public()))
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaPath := writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPrivate))
+
+	edKey, err := LoadKey("ed", edPath)
+	require.NoError(t, err)
+	rsaKey, err := LoadKey("rsa", rsaPath)
+	require.NoError(t, err)
+
+	for _, key := range []Key{edKey, rsaKey} {
+		issuer, err := NewIssuer(key.ID, time.Minute, key)
+		require.NoError(t, err)
+
+		tokenString, _, err := issuer.Issue("user", "jti", 0)
+		require.NoError(t, err)
+
+		_, err = issuer.Parse(tokenString)
+		assert.NoError(t, err, key.ID)
+	}
+
+	//public key is only for verifying, e.g. on replicas which do not issue tokens
+	edPublic, err := LoadKey("ed", edPublicPath)
+	require.NoError(t, err)
+	_, err = NewIssuer("ed", time.Minute, edPublic)
+	assert.Error(t, err)
+}
+
+func TestIssuer_RejectsAnotherAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	public := mustPKIX(t, &rsaPrivate.PublicKey)
+	rsaKey, err := LoadKey("rsa", writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPrivate)))
+	require.NoError(t, err)
+
+	issuer, err := NewIssuer("rsa", time.Minute, rsaKey)
+	require.NoError(t, err)
+
+	//token is signed by HS256 with public key as secret
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ID: "jti", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+		UserID:           "user",
+	})
+	forged.Header["kid"] = "rsa"
+	tokenString, err := forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}))
+	require.NoError(t, err)
+
+	_, err = issuer.Parse(tokenString)
+	assert.Error(t, err)
+}
+
+func TestIssuer_ExpiredToken(t *testing.T) {
+	issuer, err := NewIssuer("k1", -time.Minute, NewHMACKey("k1", []byte("secret")))
+	require.NoError(t, err)
+
+	tokenString, _, err := issuer.Issue("user", "jti", 0)
+	require.NoError(t, err)
+
+	_, err = issuer.Parse(tokenString)
+	assert.ErrorIs(t, err, jwt.ErrTokenExpired)
+}
+
+func writePEM(t *testing.T, dir, name, kind string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: data}), 0o600))
+	return path
+}
+
+func mustPKCS8(t *testing.T, key any) []byte {
+	t.Helper()
+	data, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return data
+}
+
+func mustPKIX(t *testing.T, key any) []byte {
+	t.Helper()
+	data, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return data
+}
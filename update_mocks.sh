@@ -7,7 +7,9 @@ $MOCKBIN -package=calculation -destination=internal/service/calculation/reposito
 # internal/service/gophermart/
 $MOCKBIN -package=accrual -destination=internal/service/gophermart/accrual/repository_mock_test.go -source=internal/repository/gophermart/repository.go
 $MOCKBIN -package=authorization -destination=internal/service/gophermart/authorization/repository_mock_test.go -source=internal/repository/gophermart/repository.go
+$MOCKBIN -package=idempotency -destination=internal/service/gophermart/idempotency/repository_mock_test.go -source=internal/repository/gophermart/repository.go
 $MOCKBIN -package=withdrawal -destination=internal/service/gophermart/withdrawal/repository_mock_test.go -source=internal/repository/gophermart/repository.go
 
 $MOCKBIN -package=order -destination=internal/service/gophermart/order/repository_mock_test.go -source=internal/repository/gophermart/repository.go
 $MOCKBIN -package=order -destination=internal/service/gophermart/order/service_mock_test.go -source=internal/service/service.go
+$MOCKBIN -package=webhook -destination=internal/service/gophermart/webhook/repository_mock_test.go -source=internal/repository/gophermart/repository.go